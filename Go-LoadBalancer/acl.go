@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ACL actions for clients that are not permitted
+const (
+	aclActionDeny       = "deny"
+	aclActionQuarantine = "quarantine"
+)
+
+// AccessList evaluates client IPs against allow and deny CIDR lists
+type AccessList struct {
+	config ACLConfig
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+	mux    sync.RWMutex
+
+	// Metrics
+	allowed     int64
+	denied      int64
+	quarantined int64
+}
+
+// NewAccessList creates an empty access list that permits every client
+func NewAccessList() *AccessList {
+	return &AccessList{config: ACLConfig{Action: aclActionDeny}}
+}
+
+// Update validates and atomically replaces the access list rules
+func (acl *AccessList) Update(config ACLConfig) error {
+	if config.Action == "" {
+		config.Action = aclActionDeny
+	}
+	if config.Action != aclActionDeny && config.Action != aclActionQuarantine {
+		return fmt.Errorf("unknown ACL action %q", config.Action)
+	}
+
+	allow, err := parseCIDRs(config.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseCIDRs(config.Deny)
+	if err != nil {
+		return err
+	}
+
+	acl.mux.Lock()
+	acl.config = config
+	acl.allow = allow
+	acl.deny = deny
+	acl.mux.Unlock()
+
+	log.Printf("🛡️ [ACL] Rules updated: %d allow, %d deny, action=%s", len(allow), len(deny), config.Action)
+	return nil
+}
+
+// Permitted reports whether the client IP passes the deny and allow lists
+func (acl *AccessList) Permitted(clientIP string) bool {
+	acl.mux.RLock()
+	defer acl.mux.RUnlock()
+
+	if len(acl.allow) == 0 && len(acl.deny) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range acl.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(acl.allow) == 0 {
+		return true
+	}
+	for _, network := range acl.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config returns a copy of the current rules
+func (acl *AccessList) Config() ACLConfig {
+	acl.mux.RLock()
+	defer acl.mux.RUnlock()
+	return acl.config
+}
+
+// GetStats returns access control counters
+func (acl *AccessList) GetStats() map[string]interface{} {
+	config := acl.Config()
+	return map[string]interface{}{
+		"allow_rules": len(config.Allow),
+		"deny_rules":  len(config.Deny),
+		"action":      config.Action,
+		"allowed":     atomic.LoadInt64(&acl.allowed),
+		"denied":      atomic.LoadInt64(&acl.denied),
+		"quarantined": atomic.LoadInt64(&acl.quarantined),
+	}
+}
+
+// parseCIDRs parses CIDR strings, treating bare IPs as single-host networks
+func parseCIDRs(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// SetACL replaces the load balancer's access control rules
+func (lb *LoadBalancer) SetACL(config ACLConfig) error {
+	return lb.acl.Update(config)
+}
+
+// aclMiddleware rejects or quarantines clients that are not permitted
+func (lb *LoadBalancer) aclMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := getClientIP(r)
+		if lb.acl.Permitted(clientIP) {
+			atomic.AddInt64(&lb.acl.allowed, 1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if lb.acl.Config().Action == aclActionQuarantine && len(lb.quarantinePool.GetBackends()) > 0 {
+			atomic.AddInt64(&lb.acl.quarantined, 1)
+			log.Printf("☣️ [ACL] %s %s from %s routed to quarantine pool", r.Method, r.URL.Path, clientIP)
+			ctx := context.WithValue(r.Context(), poolKey, lb.quarantinePool)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		atomic.AddInt64(&lb.acl.denied, 1)
+		log.Printf("⛔ [ACL] %s %s from %s denied", r.Method, r.URL.Path, clientIP)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// algorithmNames are the algorithms CreateAlgorithm knows
+var algorithmNames = []string{"round-robin", "weighted", "least-connections", "ewma", "least-latency"}
+
+// registerAdminRoutes adds the runtime administration endpoints to the mux, each behind
+// admin authentication
+func (lb *LoadBalancer) registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/acl", lb.adminAuthMiddleware(lb.adminACL))
+	mux.HandleFunc("/admin/experiment", lb.adminAuthMiddleware(lb.adminExperiment))
+	mux.HandleFunc("/admin/state", lb.adminAuthMiddleware(lb.adminState))
+	mux.HandleFunc("/admin/backends", lb.adminAuthMiddleware(lb.adminBackends))
+	mux.HandleFunc("/admin/algorithm", lb.adminAuthMiddleware(lb.adminAlgorithm))
+	mux.HandleFunc("/admin/algorithm/state", lb.adminAuthMiddleware(lb.adminAlgorithmState))
+	mux.HandleFunc("/admin/events", lb.adminAuthMiddleware(lb.adminEvents))
+	mux.HandleFunc("/admin/drain", lb.adminAuthMiddleware(lb.adminDrain))
+	mux.HandleFunc("/admin/logging", lb.adminAuthMiddleware(lb.adminLogging))
+	mux.HandleFunc("/admin/webhooks", lb.adminAuthMiddleware(lb.adminWebhooks))
+}
+
+// adminACL returns (GET) or replaces (PUT) the access control rules
+func (lb *LoadBalancer) adminACL(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Allow  []string `json:"allow"`
+			Deny   []string `json:"deny"`
+			Action string   `json:"action"` // "deny" or "quarantine"
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		config := lb.acl.Config()
+		config.Allow = req.Allow
+		config.Deny = req.Deny
+		config.Action = req.Action
+		if err := lb.SetACL(config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := lb.acl.Config()
+	writeJSON(w, map[string]interface{}{
+		"allow":  config.Allow,
+		"deny":   config.Deny,
+		"action": config.Action,
+	})
+}
+
+// adminExperiment returns (GET) the experiment state or updates (PUT) the variant splits
+func (lb *LoadBalancer) adminExperiment(w http.ResponseWriter, r *http.Request) {
+	if lb.experiment == nil {
+		http.Error(w, "No experiment configured", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Splits map[string]float64 `json:"splits"` // variant name → percent
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := lb.experiment.SetSplits(req.Splits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, lb.experiment.GetStats())
+}
+
+// backendInfo describes a backend in admin responses
+func backendInfo(backend Backend) map[string]interface{} {
+	return map[string]interface{}{
+		"url":                backend.Address(),
+		"weight":             backend.GetWeight(),
+		"effective_weight":   backend.EffectiveWeight(),
+		"alive":              backend.IsAlive(),
+		"circuit_open":       backend.IsCircuitOpen(),
+		"draining":           backend.IsDraining(),
+		"available":          backend.IsAvailable(),
+		"connections":        backend.GetConnections(),
+		"consecutive_errors": backend.GetConsecutiveErrors(),
+	}
+}
+
+// adminBackends lists (GET), adds (POST), updates (PUT) or removes (DELETE) the backends
+// of one pool, "main" unless the body or ?pool= names another. PUT changes only the
+// fields given: the weight, draining, or the circuit ("open" trips it, "closed" resets it).
+func (lb *LoadBalancer) adminBackends(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pool     string `json:"pool"`
+		URL      string `json:"url"`
+		Weight   *int   `json:"weight"`
+		Draining *bool  `json:"draining"`
+		Circuit  string `json:"circuit"`
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		req.Pool = r.URL.Query().Get("pool")
+		req.URL = r.URL.Query().Get("url")
+	case http.MethodPost, http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Only GET, POST, PUT and DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Pool == "" {
+		req.Pool = "main"
+	}
+	pool, ok := lb.namedPools()[req.Pool]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown pool %q", req.Pool), http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		backends := []map[string]interface{}{}
+		for _, backend := range pool.GetBackends() {
+			backends = append(backends, backendInfo(backend))
+		}
+		writeJSON(w, map[string]interface{}{
+			"pool":      req.Pool,
+			"algorithm": pool.Algorithm().Name(),
+			"backends":  backends,
+		})
+		return
+	}
+
+	// Serialized with desired-state applies, which reconcile the same pools
+	lb.stateMux.Lock()
+	defer lb.stateMux.Unlock()
+	identity := adminIdentity(r)
+	backend := pool.FindBackend(req.URL)
+
+	switch r.Method {
+	case http.MethodPost:
+		if _, err := url.ParseRequestURI(req.URL); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid backend URL %q", req.URL), http.StatusBadRequest)
+			return
+		}
+		if backend != nil {
+			http.Error(w, fmt.Sprintf("Backend %s already in pool %s", req.URL, req.Pool), http.StatusConflict)
+			return
+		}
+		weight := 1
+		if req.Weight != nil {
+			weight = *req.Weight
+		}
+		if weight < 1 {
+			http.Error(w, "Weight must be positive", http.StatusBadRequest)
+			return
+		}
+		created, err := lb.newBackend(req.URL, weight)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pool.AddBackend(created)
+		lb.events.Record(EventAdmin, req.Pool, req.URL, "added with weight %d by %s", weight, identity)
+		lb.persistState()
+		writeJSON(w, backendInfo(created))
+		return
+	case http.MethodDelete:
+		if backend == nil {
+			http.Error(w, fmt.Sprintf("No backend %s in pool %s", req.URL, req.Pool), http.StatusNotFound)
+			return
+		}
+		lb.removeBackend(pool, req.URL)
+		lb.events.Record(EventAdmin, req.Pool, req.URL, "removed by %s", identity)
+		lb.persistState()
+		writeJSON(w, backendInfo(backend))
+		return
+	}
+
+	if backend == nil {
+		http.Error(w, fmt.Sprintf("No backend %s in pool %s", req.URL, req.Pool), http.StatusNotFound)
+		return
+	}
+	if req.Weight != nil && *req.Weight < 1 {
+		http.Error(w, "Weight must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.Circuit != "" && req.Circuit != "open" && req.Circuit != "closed" {
+		http.Error(w, `Circuit must be "open" or "closed"`, http.StatusBadRequest)
+		return
+	}
+	if req.Weight != nil {
+		lb.events.Record(EventAdmin, req.Pool, req.URL, "weight %d -> %d by %s", backend.GetWeight(), *req.Weight, identity)
+		backend.SetWeight(*req.Weight)
+	}
+	if req.Draining != nil {
+		backend.SetDraining(*req.Draining)
+		lb.events.Record(EventAdmin, req.Pool, req.URL, "%s by %s",
+			map[bool]string{true: "drained", false: "undrained"}[*req.Draining], identity)
+	}
+	if req.Circuit != "" {
+		backend.SetCircuitOpen(req.Circuit == "open")
+		lb.events.Record(EventAdmin, req.Pool, req.URL, "circuit %s by %s",
+			map[bool]string{true: "tripped", false: "reset"}[req.Circuit == "open"], identity)
+	}
+	if req.Weight != nil || req.Draining != nil {
+		lb.persistState()
+	}
+	writeJSON(w, backendInfo(backend))
+}
+
+// AlgorithmName returns the name the main pool's algorithm was created from
+func (lb *LoadBalancer) AlgorithmName() string {
+	return *lb.algorithm.Load()
+}
+
+// SetAlgorithm switches the main pool and every experiment variant to another algorithm
+func (lb *LoadBalancer) SetAlgorithm(name string) error {
+	if !slices.Contains(algorithmNames, name) {
+		return fmt.Errorf("unknown algorithm %q", name)
+	}
+	lb.serverPool.SetAlgorithm(CreateAlgorithm(name))
+	if lb.experiment != nil {
+		for _, variant := range lb.experiment.variants {
+			variant.pool.SetAlgorithm(CreateAlgorithm(name))
+		}
+	}
+	lb.algorithm.Store(&name)
+	return nil
+}
+
+// adminAlgorithm returns (GET) or switches (PUT) the load balancing algorithm
+func (lb *LoadBalancer) adminAlgorithm(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Algorithm string `json:"algorithm"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		previous := lb.AlgorithmName()
+		if err := lb.SetAlgorithm(req.Algorithm); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lb.events.Record(EventAdmin, "", "", "algorithm %s -> %s by %s", previous, req.Algorithm, adminIdentity(r))
+	default:
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"algorithm": lb.AlgorithmName(),
+		"name":      lb.serverPool.Algorithm().Name(),
+		"available": algorithmNames,
+	})
+}
+
+// adminAlgorithmState returns (GET) each pool's algorithm's internal state alongside the
+// per backend inputs it selects on, to diagnose unexpected routing distributions. ?pool=
+// limits it to one pool.
+func (lb *LoadBalancer) adminAlgorithmState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pools := lb.namedPools()
+	if name := r.URL.Query().Get("pool"); name != "" {
+		pool, ok := pools[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown pool %q", name), http.StatusNotFound)
+			return
+		}
+		pools = map[string]*ServerPool{name: pool}
+	}
+
+	states := make(map[string]interface{}, len(pools))
+	for name, pool := range pools {
+		backends := []map[string]interface{}{}
+		for _, backend := range pool.GetBackends() {
+			// The load least-connections compares: connections across the cluster per unit of weight
+			connections := backend.GetConnections() + backend.RemoteConnections()
+			backends = append(backends, map[string]interface{}{
+				"url":                backend.Address(),
+				"available":          backend.IsAvailable(),
+				"weight":             backend.GetWeight(),
+				"effective_weight":   backend.EffectiveWeight(),
+				"connections":        backend.GetConnections(),
+				"remote_connections": backend.RemoteConnections(),
+				"load":               float64(connections) / float64(backend.EffectiveWeight()),
+			})
+		}
+		states[name] = map[string]interface{}{
+			"algorithm": pool.Algorithm().Name(),
+			"state":     algorithmState(pool.Algorithm()),
+			"backends":  backends,
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"time":      time.Now().Format(time.RFC3339Nano),
+		"algorithm": lb.AlgorithmName(),
+		"pools":     states,
+	})
+}
+
+// writeJSON encodes a JSON response body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
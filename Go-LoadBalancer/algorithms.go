@@ -1,13 +1,20 @@
 package main
 
 import (
+	"math"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// LoadBalancingAlgorithm defines the interface for load balancing algorithms
+// LoadBalancingAlgorithm defines the interface for load balancing algorithms. The pool
+// only hands NextBackend backends that can take a request (see NextAvailablePeer), so an
+// algorithm needn't check their availability itself. Selection itself only reads the
+// Candidate side of a backend, and is written over any Candidate type so it can be
+// exercised with mocks.
 type LoadBalancingAlgorithm interface {
-	NextBackend(backends []*Backend) *Backend
+	NextBackend(backends []Backend) Backend
 	Name() string
 }
 
@@ -20,25 +27,26 @@ func (rr *RoundRobinAlgorithm) Name() string {
 	return "Round Robin"
 }
 
-func (rr *RoundRobinAlgorithm) NextBackend(backends []*Backend) *Backend {
-	alive := getAliveBackends(backends)
-	if len(alive) == 0 {
+// NextBackend indexes straight into the slice with a single atomic increment. The pool
+// hands it an immutable snapshot of available backends, so no filtering or locking is needed.
+func (rr *RoundRobinAlgorithm) NextBackend(backends []Backend) Backend {
+	if len(backends) == 0 {
 		return nil
 	}
 	
 	next := atomic.AddUint64(&rr.current, 1)
-	return alive[(next-1)%uint64(len(alive))]
+	return backends[(next-1)%uint64(len(backends))]
 }
 
 // WeightedRoundRobinAlgorithm implements weighted round-robin load balancing
 type WeightedRoundRobinAlgorithm struct {
-	currentWeights map[*Backend]int
+	currentWeights map[Candidate]int
 	mux            sync.Mutex
 }
 
 func NewWeightedRoundRobinAlgorithm() *WeightedRoundRobinAlgorithm {
 	return &WeightedRoundRobinAlgorithm{
-		currentWeights: make(map[*Backend]int),
+		currentWeights: make(map[Candidate]int),
 	}
 }
 
@@ -46,83 +54,289 @@ func (wrr *WeightedRoundRobinAlgorithm) Name() string {
 	return "Weighted Round Robin"
 }
 
-func (wrr *WeightedRoundRobinAlgorithm) NextBackend(backends []*Backend) *Backend {
+// Forget drops the current weight kept for a removed backend
+func (wrr *WeightedRoundRobinAlgorithm) Forget(backend Backend) {
 	wrr.mux.Lock()
 	defer wrr.mux.Unlock()
-	
+	delete(wrr.currentWeights, backend)
+}
+
+func (wrr *WeightedRoundRobinAlgorithm) NextBackend(backends []Backend) Backend {
+	wrr.mux.Lock()
+	defer wrr.mux.Unlock()
+	return nextWeighted(wrr.currentWeights, backends)
+}
+
+// nextWeighted picks by smooth weighted round robin, keeping current weights in weights
+func nextWeighted[C Candidate](weights map[Candidate]int, backends []C) C {
+	var selected C
 	alive := getAliveBackends(backends)
 	if len(alive) == 0 {
-		return nil
+		return selected
 	}
 	
-	// Initialize current weights if not exists
+	// Initialize current weights if not exists. Draining backends take no new requests
+	// and get no state, so a backend forgotten after removal is never added back.
 	for _, backend := range alive {
-		if _, exists := wrr.currentWeights[backend]; !exists {
-			wrr.currentWeights[backend] = 0
+		if _, exists := weights[backend]; !exists && !backend.Status().Draining() {
+			weights[backend] = 0
 		}
 	}
 	
 	// Find backend with highest current weight
-	var selected *Backend
-	maxWeight := -1
+	// Current weights can all be negative after a backend leaves the candidates while
+	// ahead, so the first backend seen is always a valid pick
+	found := false
+	maxWeight := 0
 	totalWeight := 0
 	
 	for _, backend := range alive {
-		weight := backend.Weight
-		if weight <= 0 {
-			weight = 1 // Default weight
+		if backend.Status().Draining() {
+			continue
 		}
+		weight := backend.EffectiveWeight() // Defaults to 1, reduced while throttled
 		totalWeight += weight
-		wrr.currentWeights[backend] += weight
+		weights[backend] += weight
 		
-		if wrr.currentWeights[backend] > maxWeight {
-			maxWeight = wrr.currentWeights[backend]
-			selected = backend
+		if !found || weights[backend] > maxWeight {
+			maxWeight = weights[backend]
+			selected, found = backend, true
 		}
 	}
 	
-	if selected != nil {
-		wrr.currentWeights[selected] -= totalWeight
+	if found {
+		weights[selected] -= totalWeight
 	}
 	
 	return selected
 }
 
-// LeastConnectionsAlgorithm implements least connections load balancing
-type LeastConnectionsAlgorithm struct{}
+// LeastConnectionsAlgorithm implements least connections load balancing, weighted: a
+// backend's load is its connections relative to its effective weight, so heavier
+// backends take proportionally more concurrent requests and throttled ones fewer.
+// When load balancers are clustered, the connections other instances have open on a
+// backend count too, so every instance sees the backend's total load. Ties are broken
+// uniformly at random, so they favour no backend whatever order requests arrive in.
+type LeastConnectionsAlgorithm struct {
+	random func(n int) int // rand.IntN unless set by SetRandom
+}
+
+// SetRandom makes ties be broken by random instead of the global source, so seeded
+// simulations replay. It must be called before the algorithm is used.
+func (lc *LeastConnectionsAlgorithm) SetRandom(random func(n int) int) {
+	lc.random = random
+}
 
 func (lc *LeastConnectionsAlgorithm) Name() string {
 	return "Least Connections"
 }
 
-func (lc *LeastConnectionsAlgorithm) NextBackend(backends []*Backend) *Backend {
-	var selected *Backend
-	minConnections := int64(-1)
+func (lc *LeastConnectionsAlgorithm) NextBackend(backends []Backend) Backend {
+	random := lc.random
+	if random == nil {
+		random = rand.IntN
+	}
+	return leastLoaded(backends, random)
+}
+
+// leastLoaded picks the candidate with the fewest connections for its weight, breaking
+// ties with random
+func leastLoaded[C Candidate](backends []C, random func(n int) int) C {
+	var selected C
+	var minConnections, minWeight int64
+	ties := 0 // candidates at the least load so far, 0 until one is selected
 	
 	for _, backend := range backends {
-		if !backend.IsAlive() {
+		if !backend.Status().Available() {
 			continue
 		}
 		
-		connections := backend.GetConnections()
-		if minConnections == -1 || connections < minConnections {
-			minConnections = connections
-			selected = backend
+		// Compare connections/weight with minConnections/minWeight, without dividing
+		connections, weight := backend.GetConnections()+backend.RemoteConnections(), int64(backend.EffectiveWeight())
+		load, least := connections*minWeight, minConnections*weight
+		switch {
+		case ties == 0 || load < least:
+			selected, minConnections, minWeight = backend, connections, weight
+			ties = 1
+		case load == least:
+			// Reservoir sampling: each of the tied backends ends up selected with equal chance
+			ties++
+			if random(ties) == 0 {
+				selected, minConnections, minWeight = backend, connections, weight
+			}
 		}
 	}
 	
 	return selected
 }
 
-// Helper function to get alive backends
-func getAliveBackends(backends []*Backend) []*Backend {
-	alive := make([]*Backend, 0)
+// LatencySource says where a latency observation came from
+type LatencySource int
+
+const (
+	LatencyProbe  LatencySource = iota // a health check
+	LatencyInBand                      // a real proxied request
+)
+
+// LatencyObserver is implemented by algorithms that route on backend latency. The pool
+// reports health check latencies and the load balancer those of proxied requests; each
+// algorithm keeps only the source it estimates from.
+type LatencyObserver interface {
+	ObserveLatency(backend Backend, latency time.Duration, source LatencySource)
+}
+
+const (
+	latencyAlpha        = 0.3              // weight of a new sample in the moving average
+	latencyIdleHalfLife = 10 * time.Second // how fast an idle in-band estimate decays
+)
+
+// latencyEstimate is an exponentially weighted moving average of one backend's latency
+type latencyEstimate struct {
+	ewma    float64 // nanoseconds
+	updated time.Time
+	samples int64
+}
+
+// LatencyAlgorithm sends each request to the backend with the lowest latency estimate,
+// scaled by its in-flight requests and weight so a fast backend isn't piled onto. The
+// estimate comes from one source only, so probe and in-band estimation can be compared
+// on the same traffic. In-band estimates decay while a backend gets no requests, so a
+// backend that was slow is tried again once it has been left alone for a while.
+type LatencyAlgorithm struct {
+	source    LatencySource
+	decay     time.Duration // half-life of idle estimates, 0 for none
+	estimates map[Candidate]*latencyEstimate
+	now       func() time.Time
+	mux       sync.Mutex
+}
+
+// NewEWMAAlgorithm estimates latency from health checks
+func NewEWMAAlgorithm() *LatencyAlgorithm {
+	return &LatencyAlgorithm{source: LatencyProbe, estimates: make(map[Candidate]*latencyEstimate), now: time.Now}
+}
+
+// NewLeastLatencyAlgorithm estimates latency from proxied requests only
+func NewLeastLatencyAlgorithm() *LatencyAlgorithm {
+	return &LatencyAlgorithm{source: LatencyInBand, decay: latencyIdleHalfLife, estimates: make(map[Candidate]*latencyEstimate), now: time.Now}
+}
+
+func (la *LatencyAlgorithm) Name() string {
+	if la.source == LatencyProbe {
+		return "EWMA (health checks)"
+	}
+	return "Least Latency (in-band)"
+}
+
+// ObserveLatency folds a sample from the algorithm's source into the backend's estimate
+func (la *LatencyAlgorithm) ObserveLatency(backend Backend, latency time.Duration, source LatencySource) {
+	if source != la.source {
+		return
+	}
+	la.mux.Lock()
+	defer la.mux.Unlock()
+	
+	now := la.now()
+	estimate, ok := la.estimates[backend]
+	if !ok {
+		if backend.Status().Draining() {
+			return // may already have been forgotten, see BackendForgetter
+		}
+		la.estimates[backend] = &latencyEstimate{ewma: float64(latency), updated: now, samples: 1}
+		return
+	}
+	estimate.ewma = latencyAlpha*float64(latency) + (1-latencyAlpha)*la.current(estimate, now)
+	estimate.updated = now
+	estimate.samples++
+}
+
+// current returns an estimate decayed by how long the backend has gone without samples
+func (la *LatencyAlgorithm) current(estimate *latencyEstimate, now time.Time) float64 {
+	if la.decay <= 0 {
+		return estimate.ewma
+	}
+	idle := now.Sub(estimate.updated)
+	return estimate.ewma * math.Exp2(-idle.Seconds()/la.decay.Seconds())
+}
+
+// SetClock makes estimates age by now instead of the wall clock, for simulations
+func (la *LatencyAlgorithm) SetClock(now func() time.Time) {
+	la.mux.Lock()
+	defer la.mux.Unlock()
+	la.now = now
+}
+
+// Forget drops the estimate kept for a removed backend
+func (la *LatencyAlgorithm) Forget(backend Backend) {
+	la.mux.Lock()
+	defer la.mux.Unlock()
+	delete(la.estimates, backend)
+}
+
+func (la *LatencyAlgorithm) NextBackend(backends []Backend) Backend {
+	la.mux.Lock()
+	defer la.mux.Unlock()
+	return fastest(la, backends)
+}
+
+// fastest picks the candidate with the lowest load-scaled latency estimate. The caller
+// holds la.mux.
+func fastest[C Candidate](la *LatencyAlgorithm, backends []C) C {
+	now := la.now()
+	var selected C
+	minScore := math.Inf(1)
+	
 	for _, backend := range backends {
-		if backend.IsAlive() {
-			alive = append(alive, backend)
+		if !backend.Status().Available() {
+			continue
+		}
+		
+		// Backends without an estimate score 0, so they get tried first
+		score := 0.0
+		if estimate, ok := la.estimates[backend]; ok {
+			score = la.current(estimate, now) * float64(backend.GetConnections()+1) / float64(backend.EffectiveWeight())
+		}
+		if score < minScore {
+			selected, minScore = backend, score
+		}
+	}
+	
+	return selected
+}
+
+// Estimates returns each backend's current latency estimate, for state dumps
+func (la *LatencyAlgorithm) Estimates() map[string]interface{} {
+	la.mux.Lock()
+	defer la.mux.Unlock()
+	
+	now := la.now()
+	estimates := make(map[string]interface{}, len(la.estimates))
+	for backend, estimate := range la.estimates {
+		estimates[backend.Address()] = map[string]interface{}{
+			"latency_ms": la.current(estimate, now) / float64(time.Millisecond),
+			"samples":    estimate.samples,
+			"updated":    estimate.updated.Format(time.RFC3339Nano),
+		}
+	}
+	return estimates
+}
+
+// Helper function to get alive backends. The input slice is returned as is when every
+// backend is alive, so the common case does not allocate.
+func getAliveBackends[C Candidate](backends []C) []C {
+	for i, backend := range backends {
+		if backend.Status().Alive() {
+			continue
+		}
+		alive := make([]C, i, len(backends))
+		copy(alive, backends[:i])
+		for _, b := range backends[i+1:] {
+			if b.Status().Alive() {
+				alive = append(alive, b)
+			}
 		}
+		return alive
 	}
-	return alive
+	return backends
 }
 
 // CreateAlgorithm creates the specified algorithm
@@ -132,6 +346,10 @@ func CreateAlgorithm(algorithmType string) LoadBalancingAlgorithm {
 		return NewWeightedRoundRobinAlgorithm()
 	case "least-connections":
 		return &LeastConnectionsAlgorithm{}
+	case "ewma":
+		return NewEWMAAlgorithm()
+	case "least-latency":
+		return NewLeastLatencyAlgorithm()
 	default:
 		return &RoundRobinAlgorithm{}
 	}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestBackends returns n backends that are never dialed, weighted 1
+func newTestBackends(tb testing.TB, n int) []*HTTPBackend {
+	tb.Helper()
+	backends := make([]*HTTPBackend, n)
+	for i := range backends {
+		backend, err := NewHTTPBackend(fmt.Sprintf("http://backend-%d.invalid", i+1), 1)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		backends[i] = backend
+	}
+	return backends
+}
+
+// newTestPool returns a pool over backends using algorithm
+func newTestPool(algorithm string, backends []*HTTPBackend) *ServerPool {
+	pool := NewServerPool(CreateAlgorithm(algorithm))
+	for _, backend := range backends {
+		pool.AddBackend(backend)
+	}
+	return pool
+}
+
+// mockCandidate is a Candidate with fixed state, for testing selection without backends
+type mockCandidate struct {
+	address     string
+	status      BackendStatus
+	weight      int
+	connections int64
+	remote      int64
+}
+
+func (m *mockCandidate) Address() string          { return m.address }
+func (m *mockCandidate) Status() BackendStatus    { return m.status }
+func (m *mockCandidate) EffectiveWeight() int     { return m.weight }
+func (m *mockCandidate) GetConnections() int64    { return m.connections }
+func (m *mockCandidate) RemoteConnections() int64 { return m.remote }
+
+func TestSelectionOverMockCandidates(t *testing.T) {
+	noTies := func(n int) int {
+		t.Fatalf("random(%d) called without a tie", n)
+		return 0
+	}
+
+	t.Run("weighted", func(t *testing.T) {
+		candidates := []*mockCandidate{
+			{address: "a", status: statusAlive, weight: 1},
+			{address: "b", status: statusAlive, weight: 2},
+			{address: "c", status: statusAlive | statusDraining, weight: 5},
+			{address: "d", status: statusAlive, weight: 3},
+		}
+		weights := make(map[Candidate]int)
+		served := make(map[string]int)
+		for i := 0; i < 60; i++ {
+			served[nextWeighted(weights, candidates).address]++
+		}
+		if served["a"] != 10 || served["b"] != 20 || served["c"] != 0 || served["d"] != 30 {
+			t.Errorf("served %v, want a:10 b:20 d:30", served)
+		}
+		if _, ok := weights[candidates[2]]; ok {
+			t.Error("draining candidate was given a current weight")
+		}
+	})
+
+	t.Run("least connections", func(t *testing.T) {
+		candidates := []*mockCandidate{
+			{address: "a", status: statusAlive, weight: 1, connections: 2},
+			{address: "b", status: statusAlive, weight: 4, connections: 3, remote: 3}, // 6/4
+			{address: "c", status: statusAlive | statusCircuitOpen, weight: 1},
+			{address: "d", status: statusAlive, weight: 2, connections: 2}, // 2/2, the least
+		}
+		if got := leastLoaded(candidates, noTies); got.address != "d" {
+			t.Errorf("picked %s, want d", got.address)
+		}
+		if got := leastLoaded([]*mockCandidate{}, noTies); got != nil {
+			t.Errorf("picked %s from no candidates", got.address)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		candidates := []*mockCandidate{
+			{address: "a", status: statusAlive, weight: 1},
+			{address: "b", status: statusAlive, weight: 1, connections: 3}, // 10ms * 4
+			{address: "c", status: statusAlive, weight: 2, connections: 1}, // 30ms * 2 / 2
+		}
+		la := NewEWMAAlgorithm()
+		la.estimates[candidates[0]] = &latencyEstimate{ewma: float64(50 * time.Millisecond)}
+		la.estimates[candidates[1]] = &latencyEstimate{ewma: float64(10 * time.Millisecond)}
+		la.estimates[candidates[2]] = &latencyEstimate{ewma: float64(30 * time.Millisecond)}
+		if got := fastest(la, candidates); got.address != "c" {
+			t.Errorf("picked %s, want c", got.address)
+		}
+	})
+}
+
+func TestNextAvailablePeerSkipsUnavailable(t *testing.T) {
+	for _, algorithm := range algorithmNames {
+		t.Run(algorithm, func(t *testing.T) {
+			backends := newTestBackends(t, 4)
+			backends[1].SetAlive(false)
+			backends[2].SetCircuitOpen(true)
+			pool := newTestPool(algorithm, backends)
+
+			for i := 0; i < 100; i++ {
+				peer := pool.NextAvailablePeer(nil)
+				if peer != backends[0] && peer != backends[3] {
+					t.Fatalf("selection %d picked %v, want one of the available backends", i, peer)
+				}
+			}
+		})
+	}
+}
+
+func TestLeastConnectionsBreaksTiesUniformly(t *testing.T) {
+	const selections = 100000
+	tests := []struct {
+		name        string
+		connections []int64
+		weights     []int
+		tied        []int // indexes of the backends with the least load
+	}{
+		{name: "all idle", connections: []int64{0, 0, 0, 0}, weights: []int{1, 1, 1, 1}, tied: []int{0, 1, 2, 3}},
+		{name: "some busy", connections: []int64{2, 0, 1, 0, 0}, weights: []int{1, 1, 1, 1, 1}, tied: []int{1, 3, 4}},
+		{name: "tied by weight", connections: []int64{1, 2, 3, 3}, weights: []int{1, 2, 3, 2}, tied: []int{0, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := make([]Backend, len(tt.connections))
+			for i, backend := range newTestBackends(t, len(tt.connections)) {
+				backend.SetWeight(tt.weights[i])
+				for c := int64(0); c < tt.connections[i]; c++ {
+					backend.AddConnection()
+				}
+				backends[i] = backend
+			}
+			lc := &LeastConnectionsAlgorithm{}
+			lc.SetRandom(rand.New(rand.NewPCG(1, 2)).IntN)
+
+			counts := make(map[Backend]int)
+			for i := 0; i < selections; i++ {
+				counts[lc.NextBackend(backends)]++
+			}
+
+			// Pearson's chi-squared statistic against an even split between the tied
+			// backends; 20 is beyond the 0.1% critical value for up to 4 degrees of freedom
+			expected := float64(selections) / float64(len(tt.tied))
+			chiSquared := 0.0
+			for _, i := range tt.tied {
+				diff := float64(counts[backends[i]]) - expected
+				chiSquared += diff * diff / expected
+				delete(counts, backends[i])
+			}
+			if len(counts) > 0 {
+				t.Fatalf("selected backends without the least load: %v", counts)
+			}
+			if chiSquared > 20 {
+				t.Errorf("ties not broken uniformly: chi-squared %.1f over %d backends", chiSquared, len(tt.tied))
+			}
+		})
+	}
+}
+
+// TestLeastConnectionsTiesIgnoreRequestOrder sends requests in pairs, the first held
+// while the second is routed. A tie break that follows the sequence of selections (such
+// as a scan start rotated per selection) gives the first of every pair the same backend.
+func TestLeastConnectionsTiesIgnoreRequestOrder(t *testing.T) {
+	const pairs = 20000
+	backends := newTestBackends(t, 2)
+	candidates := []Backend{backends[0], backends[1]}
+	lc := &LeastConnectionsAlgorithm{}
+	lc.SetRandom(rand.New(rand.NewPCG(3, 4)).IntN)
+
+	firsts := make(map[Backend]int)
+	for i := 0; i < pairs; i++ {
+		first := lc.NextBackend(candidates).(*HTTPBackend)
+		firsts[first]++
+		first.AddConnection()
+		if second := lc.NextBackend(candidates); second == first {
+			t.Fatalf("pair %d: both requests went to the same backend while the other was idle", i)
+		}
+		first.RemoveConnection()
+	}
+	for i, backend := range candidates {
+		if got := firsts[backend]; got < pairs*45/100 || got > pairs*55/100 {
+			t.Errorf("backend %d took the first request of %d pairs out of %d, want about half", i, got, pairs)
+		}
+	}
+}
+
+// BenchmarkNextBackendContention selects from 64 goroutines at once, as many concurrent
+// requests would, to show how each algorithm scales under contention
+func BenchmarkNextBackendContention(b *testing.B) {
+	const goroutines = 64
+	for _, algorithm := range algorithmNames {
+		b.Run(algorithm, func(b *testing.B) {
+			pool := newTestPool(algorithm, newTestBackends(b, 8))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				// Split b.N selections between the goroutines
+				n := b.N / goroutines
+				if g < b.N%goroutines {
+					n++
+				}
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					for i := 0; i < n; i++ {
+						if pool.NextAvailablePeer(nil) == nil {
+							b.Error("no backend selected")
+							return
+						}
+					}
+				}(n)
+			}
+			wg.Wait()
+		})
+	}
+}
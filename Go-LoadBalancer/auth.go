@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// AdminAuth authenticates admin API callers and checks their roles against the
+// per-endpoint restrictions
+type AdminAuth struct {
+	credentials []AdminCredential
+	roles       map[string][]string // "METHOD /path" or "/path" → roles allowed
+
+	// Metrics
+	authenticated int64
+	unauthorized  int64
+	forbidden     int64
+}
+
+// adminIdentityKey is the context key of the authenticated admin identity
+type adminIdentityKey struct{}
+
+// NewAdminAuth validates the admin authentication config
+func NewAdminAuth(config AdminAuthConfig) (*AdminAuth, error) {
+	names := make(map[string]bool)
+	for i, cred := range config.Credentials {
+		if cred.Name == "" {
+			return nil, fmt.Errorf("admin credential %d has no name", i+1)
+		}
+		if names[cred.Name] {
+			return nil, fmt.Errorf("duplicate admin credential %q", cred.Name)
+		}
+		names[cred.Name] = true
+		if (cred.Token == "") == (cred.Username == "") {
+			return nil, fmt.Errorf("admin credential %q needs either a token or a username", cred.Name)
+		}
+		if cred.Username != "" && cred.Password == "" {
+			return nil, fmt.Errorf("admin credential %q has no password", cred.Name)
+		}
+	}
+	for endpoint := range config.Roles {
+		path := endpoint
+		if method, rest, ok := strings.Cut(endpoint, " "); ok {
+			if method != strings.ToUpper(method) {
+				return nil, fmt.Errorf("admin role restriction %q: method must be upper case", endpoint)
+			}
+			path = rest
+		}
+		if !strings.HasPrefix(path, "/admin/") {
+			return nil, fmt.Errorf("admin role restriction %q: path must start with /admin/", endpoint)
+		}
+	}
+	if len(config.Credentials) == 0 && len(config.Roles) > 0 {
+		return nil, fmt.Errorf("admin role restrictions given without any credentials")
+	}
+	return &AdminAuth{credentials: config.Credentials, roles: config.Roles}, nil
+}
+
+// LoadAdminAuthConfig reads an AdminAuthConfig from a JSON file
+func LoadAdminAuthConfig(path string) (AdminAuthConfig, error) {
+	var config AdminAuthConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return config, nil
+}
+
+// Enabled reports whether the admin API requires authentication
+func (a *AdminAuth) Enabled() bool {
+	return a != nil && len(a.credentials) > 0
+}
+
+// authenticate returns the credential matching the request's Authorization header
+func (a *AdminAuth) authenticate(r *http.Request) (AdminCredential, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, value, _ := strings.Cut(header, " ")
+	username, password, basic := r.BasicAuth()
+	for _, cred := range a.credentials {
+		switch {
+		case cred.Token != "" && strings.EqualFold(scheme, "Bearer"):
+			if subtle.ConstantTimeCompare([]byte(value), []byte(cred.Token)) == 1 {
+				return cred, true
+			}
+		case cred.Username != "" && basic:
+			userOK := subtle.ConstantTimeCompare([]byte(username), []byte(cred.Username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(password), []byte(cred.Password)) == 1
+			if userOK && passOK {
+				return cred, true
+			}
+		}
+	}
+	return AdminCredential{}, false
+}
+
+// allowedRoles returns the roles permitted to call method on path; a method-specific
+// restriction takes precedence over one for the whole endpoint. No restriction means
+// any authenticated identity may call it.
+func (a *AdminAuth) allowedRoles(method, path string) ([]string, bool) {
+	if roles, ok := a.roles[method+" "+path]; ok {
+		return roles, true
+	}
+	roles, ok := a.roles[path]
+	return roles, ok
+}
+
+// authorized reports whether the credential holds one of the roles method on path requires
+func (a *AdminAuth) authorized(cred AdminCredential, method, path string) bool {
+	allowed, restricted := a.allowedRoles(method, path)
+	if !restricted {
+		return true
+	}
+	for _, role := range cred.Roles {
+		for _, want := range allowed {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetStats returns the admin authentication statistics
+func (a *AdminAuth) GetStats() map[string]interface{} {
+	if a == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":       a.Enabled(),
+		"credentials":   len(a.credentials),
+		"authenticated": atomic.LoadInt64(&a.authenticated),
+		"unauthorized":  atomic.LoadInt64(&a.unauthorized),
+		"forbidden":     atomic.LoadInt64(&a.forbidden),
+	}
+}
+
+// SetAdminAuth validates and installs the admin API authentication config
+func (lb *LoadBalancer) SetAdminAuth(config AdminAuthConfig) error {
+	auth, err := NewAdminAuth(config)
+	if err != nil {
+		return err
+	}
+	lb.adminAuth = auth
+	if auth.Enabled() {
+		log.Printf("🔐 [CONFIG] Admin API requires authentication (%d credentials, %d role restrictions)",
+			len(config.Credentials), len(config.Roles))
+	} else {
+		log.Printf("⚠️ [CONFIG] Admin API is unauthenticated")
+	}
+	return nil
+}
+
+// adminAuthMiddleware authenticates and authorizes admin requests and writes an audit log
+// line for each one with the caller's identity. Without credentials configured every
+// request is let through, audited as anonymous.
+func (lb *LoadBalancer) adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := lb.adminAuth
+		identity := "anonymous"
+		if auth.Enabled() {
+			cred, ok := auth.authenticate(r)
+			if !ok {
+				atomic.AddInt64(&auth.unauthorized, 1)
+				log.Printf("🔐 [ADMIN] Rejected unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin", Basic realm="admin"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			identity = cred.Name
+			if !auth.authorized(cred, r.Method, r.URL.Path) {
+				atomic.AddInt64(&auth.forbidden, 1)
+				log.Printf("🔐 [ADMIN] Forbidden %s %s for %s (roles %v)", r.Method, r.URL.Path, identity, cred.Roles)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			atomic.AddInt64(&auth.authenticated, 1)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), adminIdentityKey{}, identity)))
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+		log.Printf("🔐 [ADMIN] %s %s by %s from %s → %d", r.Method, r.URL.Path, identity, r.RemoteAddr, recorder.statusCode)
+	}
+}
+
+// adminIdentity returns the identity an admin request was authenticated as
+func adminIdentity(r *http.Request) string {
+	if identity, ok := r.Context().Value(adminIdentityKey{}).(string); ok {
+		return identity
+	}
+	return "anonymous"
+}
@@ -1,113 +1,369 @@
 package main
 
 import (
+	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"MPBunce/Go-LoadBalancer/pkg/circuit"
 )
 
-// Backend represents a backend server with circuit breaker functionality
-type Backend struct {
+// Backend is a load balancing target. ServerPool only uses this interface, so mock
+// backends or other transports can stand in for HTTPBackend. The algorithms see less
+// of it still: they choose between Candidates.
+type Backend interface {
+	Candidate
+	GetWeight() int
+	SetWeight(weight int)
+	BackendHealth
+	BackendAccounting
+
+	// Serve proxies the request to the backend
+	Serve(w http.ResponseWriter, r *http.Request)
+}
+
+// Candidate is the part of a backend that selection reads: who it is, whether it can
+// take a request, and how loaded it is for its weight
+type Candidate interface {
+	// Address identifies the backend in logs and stats (the URL for HTTP backends)
+	Address() string
+	Status() BackendStatus
+	EffectiveWeight() int
+	GetConnections() int64
+	RemoteConnections() int64 // in flight on the backend through other clustered load balancers
+}
+
+// BackendHealth is a backend's health and circuit breaker state
+type BackendHealth interface {
+	IsAlive() bool
+	SetAlive(alive bool)
+	IsAvailable() bool
+	IsCircuitOpen() bool
+	SetCircuitOpen(open bool)
+	IsDraining() bool
+	SetDraining(draining bool)
+	IsThrottled() bool
+	RecordSuccess()
+	RecordError()
+	GetConsecutiveErrors() int64
+}
+
+// BackendAccounting counts the connections and traffic of requests sent to a backend
+type BackendAccounting interface {
+	AddConnection()
+	TryAddConnection() bool // AddConnection unless the backend is at its connection limit
+	RemoveConnection()
+	SetRemoteConnections(connections int64)
+	IsSaturated() bool
+	RecordClientCancellation()
+	GetClientCancellations() int64
+	GetSaturationReroutes() int64
+	Traffic() *Traffic       // body bytes proxied to and from the backend
+	Timing() *ResponseTiming // time to first byte and full response of proxied requests
+}
+
+var _ Backend = (*HTTPBackend)(nil)
+
+// BackendStatus packs a backend's health, circuit and connection state into one word,
+// so selection reads it with a single atomic load
+type BackendStatus uint32
+
+const (
+	statusAlive BackendStatus = 1 << iota
+	statusCircuitOpen
+	statusSaturated
+	statusDraining
+)
+
+// Alive reports whether the last health check passed
+func (s BackendStatus) Alive() bool { return s&statusAlive != 0 }
+
+// CircuitOpen reports whether the circuit breaker is open
+func (s BackendStatus) CircuitOpen() bool { return s&statusCircuitOpen != 0 }
+
+// Saturated reports whether the backend is at its connection limit
+func (s BackendStatus) Saturated() bool { return s&statusSaturated != 0 }
+
+// Draining reports whether the backend was taken out of rotation by an operator
+func (s BackendStatus) Draining() bool { return s&statusDraining != 0 }
+
+// Available reports whether the backend is alive with its circuit closed and not draining
+func (s BackendStatus) Available() bool { return s.Alive() && !s.CircuitOpen() && !s.Draining() }
+
+// HTTPBackend is a Backend served through a reverse proxy, with circuit breaker functionality
+type HTTPBackend struct {
 	URL          *url.URL
-	alive        bool
-	mux          sync.RWMutex
+	status       uint32 // BackendStatus, refreshed whenever its inputs change
 	ReverseProxy *httputil.ReverseProxy
-	Weight       int
+	weight       int64
 	connections  int64
 
-	// Circuit breaker fields
-	consecutiveErrors int64
-	lastErrorTime     time.Time
-	circuitOpen       bool
-	circuitMux        sync.RWMutex
+	clientCancellations int64
+
+	// The breaker's state is mirrored in status, which is what availability checks read
+	breaker *circuit.Breaker
+
+	// Throttling (backend returned 429)
+	throttledUntil time.Time
+	throttleFactor float64
+	throttleMux    sync.RWMutex
 
 	// Configuration
-	maxConsecutiveErrors int
-	circuitTimeout       time.Duration
+	maxConnections int64 // 0 means unlimited
+
+	saturationReroutes int64 // requests turned away by TryAddConnection at the limit
+	traffic            Traffic
+	timing             *ResponseTiming
+	remoteConnections  int64 // set by the cluster
+
+	onCircuitChange func(open bool) // called when the circuit opens or closes
+}
+
+// Address returns the backend URL
+func (b *HTTPBackend) Address() string {
+	return b.URL.String()
+}
+
+// GetWeight returns the configured weight
+func (b *HTTPBackend) GetWeight() int {
+	return int(atomic.LoadInt64(&b.weight))
+}
+
+// SetWeight changes the configured weight at runtime
+func (b *HTTPBackend) SetWeight(weight int) {
+	atomic.StoreInt64(&b.weight, int64(weight))
+}
+
+// Serve proxies the request to the backend
+func (b *HTTPBackend) Serve(w http.ResponseWriter, r *http.Request) {
+	b.ReverseProxy.ServeHTTP(w, r)
+}
+
+// Status returns the backend's state word, closing the circuit first if its timeout has passed
+func (b *HTTPBackend) Status() BackendStatus {
+	status := BackendStatus(atomic.LoadUint32(&b.status))
+	if status.CircuitOpen() && b.breaker.Allow() {
+		status = b.updateStatus(statusCircuitOpen, false)
+	}
+	return status
+}
+
+// updateStatus sets or clears flag in the state word and returns the new word
+func (b *HTTPBackend) updateStatus(flag BackendStatus, set bool) BackendStatus {
+	for {
+		old := atomic.LoadUint32(&b.status)
+		status := BackendStatus(old) &^ flag
+		if set {
+			status |= flag
+		}
+		if atomic.CompareAndSwapUint32(&b.status, old, uint32(status)) {
+			if flag&statusCircuitOpen != 0 && BackendStatus(old).CircuitOpen() != status.CircuitOpen() && b.onCircuitChange != nil {
+				b.onCircuitChange(status.CircuitOpen())
+			}
+			return status
+		}
+	}
 }
 
 // SetAlive updates the alive status of the backend
-func (b *Backend) SetAlive(alive bool) {
-	b.mux.Lock()
-	b.alive = alive
-	b.mux.Unlock()
+func (b *HTTPBackend) SetAlive(alive bool) {
+	b.updateStatus(statusAlive, alive)
 }
 
 // IsAlive returns the alive status of the backend
-func (b *Backend) IsAlive() bool {
-	b.mux.RLock()
-	alive := b.alive
-	b.mux.RUnlock()
-	return alive
+func (b *HTTPBackend) IsAlive() bool {
+	return b.Status().Alive()
 }
 
 // IsCircuitOpen checks if the circuit breaker is open
-func (b *Backend) IsCircuitOpen() bool {
-	b.circuitMux.RLock()
-	defer b.circuitMux.RUnlock()
-
-	// If circuit is open, check if timeout has passed
-	if b.circuitOpen {
-		if time.Since(b.lastErrorTime) > b.circuitTimeout {
-			b.circuitOpen = false // Reset circuit breaker
-			atomic.StoreInt64(&b.consecutiveErrors, 0)
-			return false
-		}
-		return true
+func (b *HTTPBackend) IsCircuitOpen() bool {
+	return b.Status().CircuitOpen()
+}
+
+// SetCircuitOpen trips the circuit breaker for the circuit timeout, or closes it
+func (b *HTTPBackend) SetCircuitOpen(open bool) {
+	if open {
+		b.breaker.Trip()
+	} else {
+		b.breaker.Reset()
 	}
-	return false
+	b.updateStatus(statusCircuitOpen, open)
 }
 
-// IsAvailable returns true if backend is alive and circuit is not open
-func (b *Backend) IsAvailable() bool {
-	return b.IsAlive() && !b.IsCircuitOpen()
+// IsDraining returns true while the backend is drained: it gets no new requests, but
+// requests already in flight complete
+func (b *HTTPBackend) IsDraining() bool {
+	return b.Status().Draining()
 }
 
-// RecordSuccess resets the consecutive error count
-func (b *Backend) RecordSuccess() {
-	atomic.StoreInt64(&b.consecutiveErrors, 0)
-	b.circuitMux.Lock()
-	b.circuitOpen = false
-	b.circuitMux.Unlock()
+// SetDraining takes the backend out of rotation or puts it back
+func (b *HTTPBackend) SetDraining(draining bool) {
+	b.updateStatus(statusDraining, draining)
 }
 
-// RecordError increments consecutive errors and opens circuit if threshold is reached
-func (b *Backend) RecordError() {
-	errors := atomic.AddInt64(&b.consecutiveErrors, 1)
+// IsAvailable returns true if backend is alive, its circuit is not open and it is not draining
+func (b *HTTPBackend) IsAvailable() bool {
+	return b.Status().Available()
+}
 
-	b.circuitMux.Lock()
-	b.lastErrorTime = time.Now()
+// RecordSuccess resets the consecutive error count
+func (b *HTTPBackend) RecordSuccess() {
+	b.breaker.RecordSuccess()
+	if BackendStatus(atomic.LoadUint32(&b.status)).CircuitOpen() {
+		b.updateStatus(statusCircuitOpen, false)
+	}
+}
 
-	if errors >= int64(b.maxConsecutiveErrors) {
-		b.circuitOpen = true
+// RecordError increments consecutive errors and opens circuit if threshold is reached
+func (b *HTTPBackend) RecordError() {
+	if b.breaker.RecordFailure() == circuit.Open {
+		b.updateStatus(statusCircuitOpen, true)
 	}
-	b.circuitMux.Unlock()
 }
 
 // GetConsecutiveErrors returns the current consecutive error count
-func (b *Backend) GetConsecutiveErrors() int64 {
-	return atomic.LoadInt64(&b.consecutiveErrors)
+func (b *HTTPBackend) GetConsecutiveErrors() int64 {
+	return b.breaker.Failures()
+}
+
+// Throttle reduces the backend's effective weight by factor until the given duration passes
+func (b *HTTPBackend) Throttle(duration time.Duration, factor float64) {
+	b.throttleMux.Lock()
+	b.throttledUntil = time.Now().Add(duration)
+	b.throttleFactor = factor
+	b.throttleMux.Unlock()
+}
+
+// IsThrottled returns true while a throttle penalty is in effect
+func (b *HTTPBackend) IsThrottled() bool {
+	b.throttleMux.RLock()
+	defer b.throttleMux.RUnlock()
+	return time.Now().Before(b.throttledUntil)
+}
+
+// EffectiveWeight returns the configured weight, reduced while the backend is throttled
+func (b *HTTPBackend) EffectiveWeight() int {
+	weight := b.GetWeight()
+	if weight <= 0 {
+		weight = 1
+	}
+
+	b.throttleMux.RLock()
+	defer b.throttleMux.RUnlock()
+	if time.Now().Before(b.throttledUntil) {
+		weight = int(float64(weight) * b.throttleFactor)
+		if weight < 1 {
+			weight = 1
+		}
+	}
+	return weight
 }
 
 // AddConnection increments the connection count
-func (b *Backend) AddConnection() {
-	atomic.AddInt64(&b.connections, 1)
+func (b *HTTPBackend) AddConnection() {
+	connections := atomic.AddInt64(&b.connections, 1)
+	if b.maxConnections > 0 && connections >= b.maxConnections {
+		b.refreshSaturation()
+	}
+}
+
+// TryAddConnection admits a request unless the backend already has maxConnections, so
+// concurrent requests that all picked it can't push it past the limit
+func (b *HTTPBackend) TryAddConnection() bool {
+	if b.maxConnections <= 0 {
+		b.AddConnection()
+		return true
+	}
+	for {
+		connections := atomic.LoadInt64(&b.connections)
+		if connections >= b.maxConnections {
+			atomic.AddInt64(&b.saturationReroutes, 1)
+			b.refreshSaturation()
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.connections, connections, connections+1) {
+			if connections+1 >= b.maxConnections {
+				b.refreshSaturation()
+			}
+			return true
+		}
+	}
+}
+
+// GetSaturationReroutes returns how many requests TryAddConnection turned away
+func (b *HTTPBackend) GetSaturationReroutes() int64 {
+	return atomic.LoadInt64(&b.saturationReroutes)
+}
+
+// RemoteConnections returns the requests other clustered load balancers have in flight
+// on the backend, as last gossiped
+func (b *HTTPBackend) RemoteConnections() int64 {
+	return atomic.LoadInt64(&b.remoteConnections)
+}
+
+// SetRemoteConnections updates the requests other load balancers have in flight
+func (b *HTTPBackend) SetRemoteConnections(connections int64) {
+	atomic.StoreInt64(&b.remoteConnections, connections)
+}
+
+// Traffic returns the backend's request and response byte counters
+func (b *HTTPBackend) Traffic() *Traffic {
+	return &b.traffic
+}
+
+// Timing returns the backend's response latencies
+func (b *HTTPBackend) Timing() *ResponseTiming {
+	return b.timing
 }
 
 // RemoveConnection decrements the connection count
-func (b *Backend) RemoveConnection() {
-	atomic.AddInt64(&b.connections, -1)
+func (b *HTTPBackend) RemoveConnection() {
+	connections := atomic.AddInt64(&b.connections, -1)
+	if b.maxConnections > 0 && connections < b.maxConnections {
+		b.refreshSaturation()
+	}
+}
+
+// refreshSaturation recomputes the saturated flag from the live connection count,
+// retrying if the word changed underneath it
+func (b *HTTPBackend) refreshSaturation() {
+	for {
+		old := atomic.LoadUint32(&b.status)
+		status := BackendStatus(old) &^ statusSaturated
+		if b.GetConnections() >= b.maxConnections {
+			status |= statusSaturated
+		}
+		if uint32(status) == old || atomic.CompareAndSwapUint32(&b.status, old, uint32(status)) {
+			return
+		}
+	}
 }
 
 // GetConnections returns the current connection count
-func (b *Backend) GetConnections() int64 {
+func (b *HTTPBackend) GetConnections() int64 {
 	return atomic.LoadInt64(&b.connections)
 }
 
-// NewBackend creates a new backend instance with circuit breaker
-func NewBackend(serverURL string, weight int) (*Backend, error) {
+// RecordClientCancellation counts a request aborted because its client disconnected
+func (b *HTTPBackend) RecordClientCancellation() {
+	atomic.AddInt64(&b.clientCancellations, 1)
+}
+
+// GetClientCancellations returns the number of requests aborted by client disconnects
+func (b *HTTPBackend) GetClientCancellations() int64 {
+	return atomic.LoadInt64(&b.clientCancellations)
+}
+
+// IsSaturated returns true if the backend has reached its connection limit
+func (b *HTTPBackend) IsSaturated() bool {
+	return b.Status().Saturated()
+}
+
+// NewHTTPBackend creates a new backend instance with circuit breaker
+func NewHTTPBackend(serverURL string, weight int) (*HTTPBackend, error) {
 	u, err := url.Parse(serverURL)
 	if err != nil {
 		return nil, err
@@ -115,27 +371,26 @@ func NewBackend(serverURL string, weight int) (*Backend, error) {
 
 	proxy := httputil.NewSingleHostReverseProxy(u)
 
-	return &Backend{
+	return &HTTPBackend{
 		URL:          u,
-		alive:        true,
+		status:       uint32(statusAlive),
 		ReverseProxy: proxy,
-		Weight:       weight,
+		weight:       int64(weight),
+		timing:       NewResponseTiming(backendTimingSamples),
 
-		// Circuit breaker defaults
-		maxConsecutiveErrors: 10,               // Circuit opens after 10 consecutive 500 errors
-		circuitTimeout:       30 * time.Second, // Circuit stays open for 30 seconds
+		// Circuit opens after 10 consecutive errors and stays open for 30 seconds
+		breaker: circuit.New(10, 30*time.Second),
 	}, nil
 }
 
-// NewBackendWithCircuitConfig creates a backend with custom circuit breaker settings
-func NewBackendWithCircuitConfig(serverURL string, weight int, maxErrors int, timeout time.Duration) (*Backend, error) {
-	backend, err := NewBackend(serverURL, weight)
+// NewHTTPBackendWithCircuitConfig creates a backend with custom circuit breaker settings
+func NewHTTPBackendWithCircuitConfig(serverURL string, weight int, maxErrors int, timeout time.Duration) (*HTTPBackend, error) {
+	backend, err := NewHTTPBackend(serverURL, weight)
 	if err != nil {
 		return nil, err
 	}
 
-	backend.maxConsecutiveErrors = maxErrors
-	backend.circuitTimeout = timeout
+	backend.breaker = circuit.New(maxErrors, timeout)
 
 	return backend, nil
 }
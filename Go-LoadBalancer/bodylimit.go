@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// bodyLimitFor returns the body size limit for a request's route, or the global limit
+func (lb *LoadBalancer) bodyLimitFor(r *http.Request) int64 {
+	if route := lb.matchRoute(r.URL.Path); route != nil && route.MaxRequestBodyBytes > 0 {
+		return route.MaxRequestBodyBytes
+	}
+	return lb.config.MaxRequestBodyBytes
+}
+
+// bodyLimitMiddleware rejects oversized bodies with 413 before a backend is selected, and
+// caps bodies of unknown length while they are read
+func (lb *LoadBalancer) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := lb.bodyLimitFor(r)
+		if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			log.Printf("📦 [BODY_LIMIT] %s %s from %s rejected: %d bytes exceeds %d byte limit",
+				r.Method, r.URL.Path, r.RemoteAddr, r.ContentLength, limit)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errConnBudgetExhausted is returned by the upstream dialer once MaxUpstreamConns are open
+var errConnBudgetExhausted = errors.New("upstream connection budget exhausted")
+
+// ResourceBudget guards goroutine and upstream file descriptor usage so overload surfaces as
+// clean 503s instead of EMFILE errors
+type ResourceBudget struct {
+	config        BudgetConfig
+	upstreamConns int64
+
+	// Metrics
+	dials             int64
+	refusedDials      int64
+	shedForGoroutines int64
+}
+
+// NewResourceBudget creates a resource budget from the given configuration
+func NewResourceBudget(config BudgetConfig) *ResourceBudget {
+	return &ResourceBudget{config: config}
+}
+
+// Transport returns a transport whose dialer enforces the upstream connection budget,
+// or nil to keep the default transport when no budget is set
+func (rb *ResourceBudget) Transport() *http.Transport {
+	if rb.config.MaxUpstreamConns <= 0 {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if atomic.AddInt64(&rb.upstreamConns, 1) > int64(rb.config.MaxUpstreamConns) {
+			atomic.AddInt64(&rb.upstreamConns, -1)
+			atomic.AddInt64(&rb.refusedDials, 1)
+			return nil, errConnBudgetExhausted
+		}
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			atomic.AddInt64(&rb.upstreamConns, -1)
+			return nil, err
+		}
+		atomic.AddInt64(&rb.dials, 1)
+		return &budgetConn{Conn: conn, budget: rb}, nil
+	}
+	return transport
+}
+
+// overGoroutineBudget reports whether the process has reached MaxGoroutines
+func (rb *ResourceBudget) overGoroutineBudget() bool {
+	return rb.config.MaxGoroutines > 0 && runtime.NumGoroutine() >= rb.config.MaxGoroutines
+}
+
+// GetStats returns resource budget usage
+func (rb *ResourceBudget) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"max_goroutines":      rb.config.MaxGoroutines,
+		"goroutines":          runtime.NumGoroutine(),
+		"shed_for_goroutines": atomic.LoadInt64(&rb.shedForGoroutines),
+		"max_upstream_conns":  rb.config.MaxUpstreamConns,
+		"upstream_conns":      atomic.LoadInt64(&rb.upstreamConns),
+		"dials":               atomic.LoadInt64(&rb.dials),
+		"refused_dials":       atomic.LoadInt64(&rb.refusedDials),
+	}
+}
+
+// budgetConn returns its slot in the connection budget when closed
+type budgetConn struct {
+	net.Conn
+	budget    *ResourceBudget
+	closeOnce sync.Once
+}
+
+// Close closes the connection and releases its budget slot
+func (c *budgetConn) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&c.budget.upstreamConns, -1)
+	})
+	return c.Conn.Close()
+}
+
+// budgetMiddleware sheds requests with 503 once the goroutine budget is used up
+func (lb *LoadBalancer) budgetMiddleware(next http.Handler) http.Handler {
+	if lb.budget.config.MaxGoroutines <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lb.budget.overGoroutineBudget() {
+			atomic.AddInt64(&lb.budget.shedForGoroutines, 1)
+			log.Printf("🧯 [BUDGET] %s %s from %s shed, goroutine budget of %d reached",
+				r.Method, r.URL.Path, r.RemoteAddr, lb.budget.config.MaxGoroutines)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
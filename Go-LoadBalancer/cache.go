@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheEntry is a stored response
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// size approximates the memory held by the entry
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.key) + len(e.body))
+	for name, values := range e.header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// ResponseCache is a size-bounded LRU cache of GET responses
+type ResponseCache struct {
+	config  CacheConfig
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+	size    int64
+	mux     sync.Mutex
+
+	// Metrics
+	hits      int64
+	misses    int64
+	stores    int64
+	evictions int64
+	bypassed  int64
+}
+
+// NewResponseCache creates a response cache from the given configuration
+func NewResponseCache(config CacheConfig) *ResponseCache {
+	if config.MaxEntryBytes <= 0 || config.MaxEntryBytes > config.MaxBytes {
+		config.MaxEntryBytes = config.MaxBytes
+	}
+	return &ResponseCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Enabled reports whether a cache size is configured
+func (c *ResponseCache) Enabled() bool {
+	return c.config.MaxBytes > 0
+}
+
+// Get returns a fresh entry for key, dropping it if expired
+func (c *ResponseCache) Get(key string) *cacheEntry {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry
+}
+
+// Set stores an entry, evicting least recently used entries to make room
+func (c *ResponseCache) Set(entry *cacheEntry) {
+	size := entry.size()
+	if size > c.config.MaxEntryBytes {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+
+	for c.size+size > c.config.MaxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += size
+	atomic.AddInt64(&c.stores, 1)
+}
+
+// remove deletes an element; the caller must hold the lock
+func (c *ResponseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size()
+}
+
+// GetStats returns cache counters
+func (c *ResponseCache) GetStats() map[string]interface{} {
+	c.mux.Lock()
+	entries, size := c.lru.Len(), c.size
+	c.mux.Unlock()
+
+	hits, misses := atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = float64(hits) / float64(hits+misses)
+	}
+
+	return map[string]interface{}{
+		"enabled":   c.Enabled(),
+		"max_bytes": c.config.MaxBytes,
+		"size":      size,
+		"entries":   entries,
+		"hits":      hits,
+		"misses":    misses,
+		"hit_ratio": hitRatio,
+		"stores":    atomic.LoadInt64(&c.stores),
+		"evictions": atomic.LoadInt64(&c.evictions),
+		"bypassed":  atomic.LoadInt64(&c.bypassed),
+	}
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, keyed by lower-case name
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// responseTTL returns how long a response may be cached, or 0 if it must not be.
+// Entries are keyed by host and URI alone, so a response that varies with any request
+// header is never cached: another client would get the variant chosen for this one.
+func (c *ResponseCache) responseTTL(header http.Header) time.Duration {
+	if header.Get("Set-Cookie") != "" || len(header.Values("Vary")) > 0 {
+		return 0
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return 0
+		}
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return c.config.DefaultTTL
+}
+
+// cacheMiddleware serves GET requests on caching routes from the cache and stores misses
+func (lb *LoadBalancer) cacheMiddleware(next http.Handler) http.Handler {
+	if !lb.cache.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := lb.matchRoute(r.URL.Path)
+		if r.Method != http.MethodGet || route == nil || !route.Cache {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+		_, noStore := requestDirectives["no-store"]
+		_, noCache := requestDirectives["no-cache"]
+		if noStore || r.Header.Get("Authorization") != "" {
+			atomic.AddInt64(&lb.cache.bypassed, 1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Host + r.URL.RequestURI()
+		if !noCache {
+			if entry := lb.cache.Get(key); entry != nil {
+				atomic.AddInt64(&lb.cache.hits, 1)
+				// Copied, so nothing downstream can change the entry other hits share
+				for name, values := range entry.header {
+					w.Header()[name] = slices.Clone(values)
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+				w.WriteHeader(entry.status)
+				w.Write(entry.body)
+				return
+			}
+		}
+
+		atomic.AddInt64(&lb.cache.misses, 1)
+		w.Header().Set("X-Cache", "MISS")
+		cw := &cachingWriter{ResponseWriter: w, limit: lb.cache.config.MaxEntryBytes}
+		next.ServeHTTP(cw, r)
+
+		if cw.status != http.StatusOK || cw.overflow {
+			return
+		}
+		ttl := lb.cache.responseTTL(cw.header)
+		if ttl <= 0 {
+			return
+		}
+
+		cw.header.Del("X-Cache")
+		now := time.Now()
+		lb.cache.Set(&cacheEntry{
+			key:     key,
+			status:  cw.status,
+			header:  cw.header,
+			body:    cw.body.Bytes(),
+			stored:  now,
+			expires: now.Add(ttl),
+		})
+	})
+}
+
+// cachingWriter copies the response into a buffer while writing it to the client
+type cachingWriter struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+// WriteHeader snapshots the status and headers
+func (cw *cachingWriter) WriteHeader(statusCode int) {
+	if cw.status == 0 {
+		cw.status = statusCode
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write buffers the body until it exceeds the entry size limit
+func (cw *cachingWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.overflow {
+		if int64(cw.body.Len()+len(b)) > cw.limit {
+			cw.overflow = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, so flushes and hijacks reach the connection; a
+// hijacked response never gets a status and so is never cached
+func (cw *cachingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCachingLoadBalancer returns a load balancer caching every route
+func newCachingLoadBalancer(t *testing.T, backends ...*httptest.Server) (*LoadBalancer, *httptest.Server) {
+	t.Helper()
+	return newTestLoadBalancer(t, &Config{
+		Cache:  CacheConfig{MaxBytes: 1 << 20, DefaultTTL: time.Minute},
+		Routes: []RouteConfig{{PathPrefix: "/", Cache: true}},
+	}, backends...)
+}
+
+func TestCacheSkipsVaryingResponses(t *testing.T) {
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "greeting in "+r.Header.Get("Accept-Language"))
+	}))
+	t.Cleanup(backend.Close)
+	_, proxy := newCachingLoadBalancer(t, backend)
+
+	for _, language := range []string{"en", "fr", "en"} {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/greeting", nil)
+		req.Header.Set("Accept-Language", language)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := "greeting in " + language; string(body) != want {
+			t.Errorf("Accept-Language %s: got %q, want %q", language, body, want)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("backend served %d of 3 requests, want all of them", requests)
+	}
+}
+
+func TestCacheHitsDontShareEntryHeaders(t *testing.T) {
+	lb, _ := newCachingLoadBalancer(t)
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Tag", "original")
+		io.WriteString(w, "cached")
+	})
+	cached := lb.cacheMiddleware(origin)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tagged", nil))
+		if i > 0 && w.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("request %d: X-Cache = %q, want HIT", i, w.Header().Get("X-Cache"))
+		}
+		// As a handler after the cache might, edit the header value in place
+		w.Header()["X-Tag"][0] = "edited"
+	}
+	entry := lb.cache.Get("example.com/tagged")
+	if entry == nil || entry.header.Get("X-Tag") != "original" {
+		t.Fatalf("cached X-Tag was changed through a hit: %+v", entry)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientLimiter caps concurrent connections per client IP and paces response bandwidth
+type ClientLimiter struct {
+	config  ClientLimitConfig
+	clients map[string]int
+	mux     sync.Mutex
+
+	// Metrics
+	accepted        int64
+	rejected        int64
+	throttledWrites int64
+}
+
+// NewClientLimiter creates a client limiter from the given configuration
+func NewClientLimiter(config ClientLimitConfig) *ClientLimiter {
+	return &ClientLimiter{
+		config:  config,
+		clients: make(map[string]int),
+	}
+}
+
+// Wrap returns a listener enforcing the limits, or l itself when none are configured
+func (cl *ClientLimiter) Wrap(l net.Listener) net.Listener {
+	if cl.config.MaxConnectionsPerIP <= 0 && cl.config.BandwidthBytesPerSec <= 0 {
+		return l
+	}
+	return &limitedListener{Listener: l, limiter: cl}
+}
+
+// acquire reserves a connection slot for the client IP
+func (cl *ClientLimiter) acquire(ip string) bool {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	if cl.config.MaxConnectionsPerIP > 0 && cl.clients[ip] >= cl.config.MaxConnectionsPerIP {
+		return false
+	}
+	cl.clients[ip]++
+	return true
+}
+
+// release frees a connection slot for the client IP
+func (cl *ClientLimiter) release(ip string) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	cl.clients[ip]--
+	if cl.clients[ip] <= 0 {
+		delete(cl.clients, ip)
+	}
+}
+
+// GetStats returns client limit counters
+func (cl *ClientLimiter) GetStats() map[string]interface{} {
+	cl.mux.Lock()
+	activeClients := len(cl.clients)
+	cl.mux.Unlock()
+
+	return map[string]interface{}{
+		"max_connections_per_ip":  cl.config.MaxConnectionsPerIP,
+		"bandwidth_bytes_per_sec": cl.config.BandwidthBytesPerSec,
+		"active_clients":          activeClients,
+		"accepted":                atomic.LoadInt64(&cl.accepted),
+		"rejected":                atomic.LoadInt64(&cl.rejected),
+		"throttled_writes":        atomic.LoadInt64(&cl.throttledWrites),
+	}
+}
+
+// limitedListener rejects connections from clients over their limit
+type limitedListener struct {
+	net.Listener
+	limiter *ClientLimiter
+}
+
+// Accept returns the next connection within its client's limit
+func (ll *limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ll.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			ip = conn.RemoteAddr().String()
+		}
+
+		if !ll.limiter.acquire(ip) {
+			atomic.AddInt64(&ll.limiter.rejected, 1)
+			log.Printf("🚷 [CLIENT_LIMIT] Rejecting connection from %s (limit %d connections)",
+				ip, ll.limiter.config.MaxConnectionsPerIP)
+			conn.Close()
+			continue
+		}
+
+		atomic.AddInt64(&ll.limiter.accepted, 1)
+		return &limitedConn{
+			Conn:    conn,
+			limiter: ll.limiter,
+			ip:      ip,
+			rate:    ll.limiter.config.BandwidthBytesPerSec,
+		}, nil
+	}
+}
+
+// limitedConn releases its slot on close and paces writes to the configured rate
+type limitedConn struct {
+	net.Conn
+	limiter *ClientLimiter
+	ip      string
+	once    sync.Once
+
+	rate      int64
+	sent      int64
+	paceStart time.Time
+}
+
+// Write sends b in chunks, sleeping as needed to stay under the bandwidth limit
+func (lc *limitedConn) Write(b []byte) (int, error) {
+	if lc.rate <= 0 {
+		return lc.Conn.Write(b)
+	}
+
+	// Restart pacing after idle periods so keep-alive gaps don't build up credit
+	if lc.paceStart.IsZero() || time.Since(lc.paceStart) > time.Duration(lc.sent)*time.Second/time.Duration(lc.rate)+time.Second {
+		lc.paceStart = time.Now()
+		lc.sent = 0
+	}
+
+	chunk := int(lc.rate / 10) // roughly ten writes per second
+	if chunk < 512 {
+		chunk = 512
+	}
+
+	written := 0
+	for written < len(b) {
+		end := written + chunk
+		if end > len(b) {
+			end = len(b)
+		}
+		n, err := lc.Conn.Write(b[written:end])
+		written += n
+		lc.sent += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+		expected := time.Duration(lc.sent) * time.Second / time.Duration(lc.rate)
+		if wait := expected - time.Since(lc.paceStart); wait > 0 {
+			atomic.AddInt64(&lc.limiter.throttledWrites, 1)
+			time.Sleep(wait)
+		}
+	}
+	return written, nil
+}
+
+// Close closes the connection and releases the client's slot once
+func (lc *limitedConn) Close() error {
+	lc.once.Do(func() {
+		lc.limiter.release(lc.ip)
+	})
+	return lc.Conn.Close()
+}
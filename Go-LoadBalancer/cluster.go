@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clusterKeyHeader carries the shared cluster key on gossip requests
+const clusterKeyHeader = "X-Cluster-Key"
+
+// ClusterBackendState is one node's latest observation of a backend's health and circuit
+type ClusterBackendState struct {
+	Pool        string `json:"pool"`
+	URL         string `json:"url"`
+	Alive       bool   `json:"alive"`
+	CircuitOpen bool   `json:"circuit_open"`
+	ObservedAt  int64  `json:"observed_at"` // unix nanoseconds
+	ObservedBy  string `json:"observed_by"` // node ID
+}
+
+// ClusterBackendLoad is the requests one node has in flight on a backend
+type ClusterBackendLoad struct {
+	Pool        string `json:"pool"`
+	URL         string `json:"url"`
+	Connections int64  `json:"connections"`
+}
+
+// ClusterMessage is what a node gossips to its peers: every observation it knows of,
+// its own and those it heard from others, and its own connection counts
+type ClusterMessage struct {
+	Node     string                `json:"node"`
+	Backends []ClusterBackendState `json:"backends"`
+	Load     []ClusterBackendLoad  `json:"load,omitempty"`
+}
+
+// nodeLoad is a peer's latest connection counts, by pool and backend URL
+type nodeLoad struct {
+	received    time.Time // by this node's clock, so staleness doesn't depend on clock skew
+	connections map[string]int64
+}
+
+// clusterPeer is another load balancer instance gossiped to
+type clusterPeer struct {
+	URL         string `json:"url"`
+	Sent        int64  `json:"sent"`
+	Failures    int64  `json:"failures"`
+	LastSuccess string `json:"last_success,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// Cluster shares backend health and circuit breaker state between load balancer
+// instances. Each backend transition one instance sees is gossiped to its peers, which
+// apply it at once instead of waiting for their own health checks or errors to notice.
+// The newest observation of a backend wins, so node clocks should be roughly in sync.
+type Cluster struct {
+	lb      *LoadBalancer
+	config  ClusterConfig
+	client  *http.Client
+	changed chan struct{} // wakes the gossip loop after a local transition
+
+	mux   sync.Mutex
+	known map[string]ClusterBackendState // by pool and backend URL
+	load  map[string]nodeLoad            // by node ID
+	peers []*clusterPeer
+
+	received int64
+	applied  int64 // remote observations applied to a backend
+	rejected int64 // gossip requests with a wrong key or invalid body
+}
+
+// clusterKey identifies a backend across nodes
+func clusterKey(pool, url string) string {
+	return pool + " " + url
+}
+
+// SetupCluster starts gossiping backend state with the configured peers
+func (lb *LoadBalancer) SetupCluster(config ClusterConfig) error {
+	if len(config.Peers) == 0 {
+		return nil
+	}
+	if config.NodeID == "" {
+		return fmt.Errorf("cluster node ID is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.MaxStaleness <= 0 {
+		config.MaxStaleness = 3 * config.Interval
+	}
+
+	cluster := &Cluster{
+		lb:      lb,
+		config:  config,
+		client:  &http.Client{Timeout: 2 * time.Second},
+		changed: make(chan struct{}, 1),
+		known:   make(map[string]ClusterBackendState),
+		load:    make(map[string]nodeLoad),
+	}
+	for _, u := range config.Peers {
+		if err := validateWebhookURL(u); err != nil {
+			return fmt.Errorf("invalid cluster peer %q: %v", u, err)
+		}
+		cluster.peers = append(cluster.peers, &clusterPeer{URL: strings.TrimSuffix(u, "/")})
+	}
+	lb.cluster = cluster
+	lb.events.Subscribe(cluster.handle)
+	go cluster.run()
+	go cluster.expireLoad()
+
+	log.Printf("🌐 [CONFIG] Cluster node %s gossiping backend state with %d peers every %v",
+		config.NodeID, len(config.Peers), config.Interval)
+	return nil
+}
+
+// pool returns the pool with the given event name, or nil
+func (c *Cluster) pool(name string) *ServerPool {
+	switch name {
+	case c.lb.serverPool.name:
+		return c.lb.serverPool
+	case c.lb.quarantinePool.name:
+		return c.lb.quarantinePool
+	}
+	return nil
+}
+
+// handle records a local backend transition as this node's observation
+func (c *Cluster) handle(event Event) {
+	switch event.Type {
+	case EventBackendUp, EventBackendDown, EventCircuitOpen, EventCircuitClosed:
+	default:
+		return
+	}
+	pool := c.pool(event.Pool)
+	if pool == nil {
+		return
+	}
+	backend := pool.FindBackend(event.Backend)
+	if backend == nil {
+		return
+	}
+
+	key := clusterKey(event.Pool, event.Backend)
+	alive, circuitOpen := backend.IsAlive(), backend.IsCircuitOpen()
+	c.mux.Lock()
+	if state, ok := c.known[key]; ok && state.Alive == alive && state.CircuitOpen == circuitOpen {
+		// Already known, most likely because it was just applied from a peer
+		c.mux.Unlock()
+		return
+	}
+	c.known[key] = ClusterBackendState{
+		Pool:        event.Pool,
+		URL:         event.Backend,
+		Alive:       alive,
+		CircuitOpen: circuitOpen,
+		ObservedAt:  event.Time.UnixNano(),
+		ObservedBy:  c.config.NodeID,
+	}
+	c.mux.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run gossips every interval, and right after a local transition
+func (c *Cluster) run() {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.changed:
+		}
+		c.gossip()
+	}
+}
+
+// expireLoad drops peers' connection counts once they go stale, on its own ticker so a
+// gossip round waiting on an unreachable peer doesn't hold it up
+func (c *Cluster) expireLoad() {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.updateRemoteConnections()
+	}
+}
+
+// message returns everything this node knows, and its connection counts
+func (c *Cluster) message() ClusterMessage {
+	message := ClusterMessage{Node: c.config.NodeID}
+	for _, pool := range []*ServerPool{c.lb.serverPool, c.lb.quarantinePool} {
+		for _, backend := range pool.GetBackends() {
+			message.Load = append(message.Load, ClusterBackendLoad{Pool: pool.name, URL: backend.Address(), Connections: backend.GetConnections()})
+		}
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	message.Backends = make([]ClusterBackendState, 0, len(c.known))
+	for _, state := range c.known {
+		message.Backends = append(message.Backends, state)
+	}
+	return message
+}
+
+// updateRemoteConnections gives every backend the requests the other nodes have in
+// flight on it, leaving out nodes not heard from within MaxStaleness
+func (c *Cluster) updateRemoteConnections() {
+	totals := make(map[string]int64)
+	c.mux.Lock()
+	for _, load := range c.load {
+		if time.Since(load.received) > c.config.MaxStaleness {
+			continue
+		}
+		for key, connections := range load.connections {
+			totals[key] += connections
+		}
+	}
+	c.mux.Unlock()
+
+	for _, pool := range []*ServerPool{c.lb.serverPool, c.lb.quarantinePool} {
+		for _, backend := range pool.GetBackends() {
+			backend.SetRemoteConnections(totals[clusterKey(pool.name, backend.Address())])
+		}
+	}
+}
+
+// freshNodes counts the peers whose connection counts are within MaxStaleness
+func (c *Cluster) freshNodes() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	fresh := 0
+	for _, load := range c.load {
+		if time.Since(load.received) <= c.config.MaxStaleness {
+			fresh++
+		}
+	}
+	return fresh
+}
+
+// gossip sends this node's view to every peer
+func (c *Cluster) gossip() {
+	body, err := json.Marshal(c.message())
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		wg.Add(1)
+		go func(peer *clusterPeer) {
+			defer wg.Done()
+			err := c.send(peer.URL+"/cluster/state", body)
+			c.mux.Lock()
+			defer c.mux.Unlock()
+			if err != nil {
+				peer.Failures++
+				if peer.LastError != err.Error() {
+					log.Printf("🌐 [CLUSTER] Failed to gossip to %s: %v", peer.URL, err)
+				}
+				peer.LastError = err.Error()
+				return
+			}
+			if peer.LastError != "" {
+				log.Printf("🌐 [CLUSTER] Gossiping to %s again", peer.URL)
+			}
+			peer.Sent++
+			peer.LastSuccess, peer.LastError = time.Now().Format(time.RFC3339), ""
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// send posts a gossip message to a peer
+func (c *Cluster) send(u string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.Key != "" {
+		req.Header.Set(clusterKeyHeader, c.config.Key)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// merge applies the observations in a peer's message that are newer than ours
+func (c *Cluster) merge(message ClusterMessage) {
+	type change struct {
+		backend Backend
+		state   ClusterBackendState
+	}
+	var changes []change
+
+	c.mux.Lock()
+	if message.Node != "" && message.Node != c.config.NodeID {
+		load := nodeLoad{received: time.Now(), connections: make(map[string]int64, len(message.Load))}
+		for _, backend := range message.Load {
+			load.connections[clusterKey(backend.Pool, backend.URL)] = backend.Connections
+		}
+		c.load[message.Node] = load
+	}
+	for _, state := range message.Backends {
+		key := clusterKey(state.Pool, state.URL)
+		if known, ok := c.known[key]; ok && known.ObservedAt >= state.ObservedAt {
+			continue
+		}
+		pool := c.pool(state.Pool)
+		if pool == nil {
+			continue
+		}
+		backend := pool.FindBackend(state.URL)
+		if backend == nil {
+			continue
+		}
+		// Known before it is applied, so the transitions applying it causes aren't
+		// mistaken for new local observations
+		c.known[key] = state
+		changes = append(changes, change{backend, state})
+	}
+	c.mux.Unlock()
+	c.updateRemoteConnections()
+
+	// Applied outside the lock: opening or closing a circuit records an event, which
+	// comes back to handle
+	for _, ch := range changes {
+		backend, state := ch.backend, ch.state
+		if backend.IsAlive() != state.Alive {
+			backend.SetAlive(state.Alive)
+			atomic.AddInt64(&c.applied, 1)
+			log.Printf("🌐 [CLUSTER] Backend %s marked %s, as seen by node %s",
+				state.URL, map[bool]string{true: "✅UP", false: "🔴DOWN"}[state.Alive], state.ObservedBy)
+		}
+		if backend.IsCircuitOpen() != state.CircuitOpen {
+			backend.SetCircuitOpen(state.CircuitOpen)
+			atomic.AddInt64(&c.applied, 1)
+			log.Printf("🌐 [CLUSTER] Backend %s circuit %s, as seen by node %s",
+				state.URL, map[bool]string{true: "🔒OPEN", false: "🔓CLOSED"}[state.CircuitOpen], state.ObservedBy)
+		}
+	}
+}
+
+// clusterState receives gossip from peers (POST) or shows this node's view (GET)
+func (lb *LoadBalancer) clusterState(w http.ResponseWriter, r *http.Request) {
+	c := lb.cluster
+	if c.config.Key != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(clusterKeyHeader)), []byte(c.config.Key)) != 1 {
+		atomic.AddInt64(&c.rejected, 1)
+		http.Error(w, "Invalid cluster key", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, c.message())
+	case http.MethodPost:
+		var message ClusterMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&message); err != nil {
+			atomic.AddInt64(&c.rejected, 1)
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&c.received, 1)
+		c.merge(message)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetStats returns the cluster membership and gossip counters
+func (c *Cluster) GetStats() map[string]interface{} {
+	if c == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	c.mux.Lock()
+	peers := make([]clusterPeer, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, *peer)
+	}
+	known := len(c.known)
+	c.mux.Unlock()
+	fresh := c.freshNodes()
+
+	return map[string]interface{}{
+		"enabled":               true,
+		"node":                  c.config.NodeID,
+		"interval_seconds":      c.config.Interval.Seconds(),
+		"peers":                 peers,
+		"observations":          known,
+		"fresh_nodes":           fresh, // peers whose connection counts are used
+		"max_staleness_seconds": c.config.MaxStaleness.Seconds(),
+		"received":              atomic.LoadInt64(&c.received),
+		"applied":               atomic.LoadInt64(&c.applied),
+		"rejected":              atomic.LoadInt64(&c.rejected),
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// LBAdapter starts one load balancer under test, so the orchestrator can compare the
+// Go load balancer's algorithms with other load balancers on the same backends
+type LBAdapter interface {
+	// Name labels the results
+	Name() string
+	// WeightAware reports whether the load balancer should split requests by weight
+	WeightAware() bool
+	// Start launches the load balancer on target.Port in front of target.Backends
+	Start(procs *processes, target LBTarget) error
+	// Stats returns the load balancer's own statistics after a run, if it keeps any
+	Stats(lbURL string) (map[string]interface{}, error)
+}
+
+// LBTarget is what a load balancer is started with
+type LBTarget struct {
+	Port           int
+	Backends       []TargetBackend
+	HealthInterval int    // seconds
+	Dir            string // working directory for rendered configs and pid files
+	LogPath        string
+}
+
+// TargetBackend is one backend as seen by a load balancer config template
+type TargetBackend struct {
+	URL      string // http://localhost:3001
+	Host     string // localhost:3001
+	Hostname string // localhost
+	Port     int
+	Weight   int
+}
+
+// newTargetBackend splits a backend URL into the forms config templates need
+func newTargetBackend(rawURL string, weight int) (TargetBackend, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return TargetBackend{}, err
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return TargetBackend{}, fmt.Errorf("backend %s has no port", rawURL)
+	}
+	return TargetBackend{URL: rawURL, Host: u.Host, Hostname: u.Hostname(), Port: port, Weight: weight}, nil
+}
+
+// goLB runs this repository's load balancer with one algorithm
+type goLB struct {
+	binary    string
+	algorithm string
+}
+
+func (g goLB) Name() string      { return g.algorithm }
+func (g goLB) WeightAware() bool { return weightAwareAlgorithms[g.algorithm] }
+
+func (g goLB) Start(procs *processes, target LBTarget) error {
+	backends := make([]string, len(target.Backends))
+	for i, backend := range target.Backends {
+		backends[i] = fmt.Sprintf("%s=%d", backend.URL, backend.Weight)
+	}
+	_, err := procs.start(target.LogPath, g.binary,
+		"-port", strconv.Itoa(target.Port),
+		"-algorithm", g.algorithm,
+		"-backends", strings.Join(backends, ","),
+		"-health-interval", strconv.Itoa(max(1, target.HealthInterval)),
+		"-identity-headers",
+	)
+	return err
+}
+
+// statsSchemaVersion is the /stats schema_version the report is written against; the
+// load balancer publishes the schema itself at /schema
+const statsSchemaVersion = 1
+
+func (g goLB) Stats(lbURL string) (map[string]interface{}, error) {
+	stats, err := fetchJSON(lbURL + "/stats")
+	if err != nil {
+		return nil, err
+	}
+	if version, _ := stats["schema_version"].(float64); int(version) != statsSchemaVersion {
+		log.Printf("⚠️ [BENCH] %s reports stats schema v%d, expected v%d; some report columns may be empty",
+			lbURL, int(version), statsSchemaVersion)
+	}
+	return stats, nil
+}
+
+// ExternalLB describes a third-party load balancer (nginx, HAProxy, Caddy, Envoy, ...)
+// run from a binary or container in place of the Go load balancer. Its config is rendered
+// from a text/template over LBTarget, and Command may refer to {{.Config}} (the rendered
+// file), {{.Port}} and {{.Dir}}. A container runs the same way, for example
+//
+//	{"name": "nginx", "command": ["docker", "run", "--rm", "--network", "host",
+//	  "-v", "{{.Dir}}:{{.Dir}}", "nginx:stable", "nginx", "-c", "{{.Config}}"]}
+//
+// Name, Command and Template all default from the built-in definition of the same name.
+type ExternalLB struct {
+	Name     string   `json:"name"`
+	Command  []string `json:"command"`
+	Template string   `json:"template"` // config template file
+	Weighted *bool    `json:"weighted"` // whether the config balances by weight; defaults to true
+}
+
+//go:embed lbtemplates
+var builtinTemplates embed.FS
+
+// builtinExternal are the load balancers known without any configuration. Their
+// templates balance round-robin by weight, health check /health and retry failed
+// connections, like the Go load balancer.
+var builtinExternal = map[string]struct {
+	command  []string
+	template string
+}{
+	"nginx":   {[]string{"nginx", "-c", "{{.Config}}"}, "nginx.conf.tmpl"},
+	"haproxy": {[]string{"haproxy", "-db", "-f", "{{.Config}}"}, "haproxy.cfg.tmpl"},
+	"caddy":   {[]string{"caddy", "run", "--adapter", "caddyfile", "--config", "{{.Config}}"}, "Caddyfile.tmpl"},
+	"envoy":   {[]string{"envoy", "-c", "{{.Config}}", "--log-level", "warn"}, "envoy.yaml.tmpl"},
+}
+
+// externalLB is an ExternalLB with its defaults filled in and template parsed
+type externalLB struct {
+	name     string
+	command  []string
+	config   *template.Template
+	filename string
+	weighted bool
+}
+
+// NewExternalLB resolves an ExternalLB definition against the built-in ones
+func NewExternalLB(def ExternalLB) (LBAdapter, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("external load balancer has no name")
+	}
+	builtin, known := builtinExternal[def.Name]
+	if len(def.Command) == 0 {
+		if !known {
+			return nil, fmt.Errorf("%s: no command given and no built-in definition", def.Name)
+		}
+		def.Command = builtin.command
+	}
+
+	lb := &externalLB{name: def.Name, command: def.Command, weighted: def.Weighted == nil || *def.Weighted}
+	var text []byte
+	var err error
+	switch {
+	case def.Template != "":
+		text, err = os.ReadFile(def.Template)
+		lb.filename = strings.TrimSuffix(filepath.Base(def.Template), ".tmpl")
+	case known:
+		text, err = builtinTemplates.ReadFile("lbtemplates/" + builtin.template)
+		lb.filename = strings.TrimSuffix(builtin.template, ".tmpl")
+	default:
+		return nil, fmt.Errorf("%s: no config template given and no built-in definition", def.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", def.Name, err)
+	}
+	if lb.config, err = template.New(lb.filename).Parse(string(text)); err != nil {
+		return nil, fmt.Errorf("%s: %w", def.Name, err)
+	}
+	for _, arg := range lb.command {
+		if _, err := template.New("command").Parse(arg); err != nil {
+			return nil, fmt.Errorf("%s: command argument %q: %w", def.Name, arg, err)
+		}
+	}
+	return lb, nil
+}
+
+func (e *externalLB) Name() string      { return e.name }
+func (e *externalLB) WeightAware() bool { return e.weighted }
+
+// Start renders the config into target.Dir and launches the command
+func (e *externalLB) Start(procs *processes, target LBTarget) error {
+	dir, err := filepath.Abs(target.Dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	target.Dir = dir
+
+	var config bytes.Buffer
+	if err := e.config.Execute(&config, target); err != nil {
+		return fmt.Errorf("rendering %s config: %w", e.name, err)
+	}
+	configPath := filepath.Join(dir, e.filename)
+	if err := os.WriteFile(configPath, config.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	vars := map[string]interface{}{"Config": configPath, "Port": target.Port, "Dir": dir}
+	args := make([]string, len(e.command))
+	for i, arg := range e.command {
+		var expanded strings.Builder
+		if err := template.Must(template.New("command").Parse(arg)).Execute(&expanded, vars); err != nil {
+			return fmt.Errorf("expanding %s command: %w", e.name, err)
+		}
+		args[i] = expanded.String()
+	}
+	_, err = procs.start(target.LogPath, args[0], args[1:]...)
+	return err
+}
+
+// Stats returns nothing: external load balancers don't serve the Go load balancer's /stats
+func (e *externalLB) Stats(string) (map[string]interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Thresholds are the regressions tolerated against a baseline, in percent
+type Thresholds struct {
+	ThroughputDrop float64 // fail if req/s falls by more than this
+	P99Rise        float64 // fail if p99 latency rises by more than this
+}
+
+// Comparison is one algorithm's result measured against its baseline
+type Comparison struct {
+	Algorithm          string   `json:"algorithm"`
+	BaselineThroughput float64  `json:"baseline_requests_per_second"`
+	Throughput         float64  `json:"requests_per_second"`
+	ThroughputChange   float64  `json:"throughput_change"` // percent
+	BaselineP99        float64  `json:"baseline_p99_ms"`
+	P99                float64  `json:"p99_ms"`
+	P99Change          float64  `json:"p99_change"` // percent
+	Regressions        []string `json:"regressions"`
+}
+
+// baselinePath resolves a baseline name to a file in dir; anything that looks like a
+// path is used as it is
+func baselinePath(dir, name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.HasSuffix(name, ".json") {
+		return name
+	}
+	return filepath.Join(dir, name+".json")
+}
+
+// SaveBaseline stores results as the named baseline and returns where it was written
+func SaveBaseline(dir, name string, results []AlgorithmResult) (string, error) {
+	path := baselinePath(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return path, writeResults(path, results)
+}
+
+// LoadBaseline reads a baseline saved by SaveBaseline
+func LoadBaseline(dir, name string) ([]AlgorithmResult, error) {
+	return readResults(baselinePath(dir, name))
+}
+
+// CompareBaseline compares every algorithm present in both runs. Algorithms missing
+// from the baseline are skipped, as there is nothing to regress from.
+func CompareBaseline(baseline, results []AlgorithmResult, thresholds Thresholds) []Comparison {
+	previous := make(map[string]AlgorithmResult, len(baseline))
+	for _, result := range baseline {
+		previous[result.Algorithm] = result
+	}
+
+	var comparisons []Comparison
+	for _, result := range results {
+		base, ok := previous[result.Algorithm]
+		if !ok {
+			continue
+		}
+		c := Comparison{
+			Algorithm:          result.Algorithm,
+			BaselineThroughput: base.Load.Throughput,
+			Throughput:         result.Load.Throughput,
+			ThroughputChange:   percentChange(base.Load.Throughput, result.Load.Throughput),
+			BaselineP99:        base.Load.Latency.P99,
+			P99:                result.Load.Latency.P99,
+			P99Change:          percentChange(base.Load.Latency.P99, result.Load.Latency.P99),
+			Regressions:        []string{},
+		}
+		if -c.ThroughputChange > thresholds.ThroughputDrop {
+			c.Regressions = append(c.Regressions,
+				fmt.Sprintf("throughput dropped %.1f%% (limit %.1f%%)", -c.ThroughputChange, thresholds.ThroughputDrop))
+		}
+		if c.P99Change > thresholds.P99Rise {
+			c.Regressions = append(c.Regressions,
+				fmt.Sprintf("p99 rose %.1f%% (limit %.1f%%)", c.P99Change, thresholds.P99Rise))
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// percentChange returns the change from before to after in percent, 0 without a baseline value
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return 100 * (after - before) / before
+}
+
+// PrintComparison writes one row per algorithm and returns the number of regressions
+func PrintComparison(w io.Writer, name string, comparisons []Comparison) int {
+	fmt.Fprintf(w, "\nAgainst baseline %s:\n", name)
+	fmt.Fprintf(w, "%-20s %10s %10s %8s %9s %9s %8s  %s\n",
+		"ALGORITHM", "BASE REQ/S", "REQ/S", "CHANGE", "BASE P99", "P99", "CHANGE", "RESULT")
+	regressions := 0
+	for _, c := range comparisons {
+		verdict := "ok"
+		if len(c.Regressions) > 0 {
+			verdict = "REGRESSED: " + strings.Join(c.Regressions, ", ")
+			regressions += len(c.Regressions)
+		}
+		fmt.Fprintf(w, "%-20s %10.0f %10.0f %+7.1f%% %9.2f %9.2f %+7.1f%%  %s\n",
+			c.Algorithm, c.BaselineThroughput, c.Throughput, c.ThroughputChange,
+			c.BaselineP99, c.P99, c.P99Change, verdict)
+	}
+	return regressions
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ChaosEvent is a scheduled disruption of one backend while load is running, as written
+// in a scenario file:
+//
+//	{"at": "30s", "backend": 2, "action": "pause", "for": "10s"}
+//	{"at": "60s", "backend": 1, "action": "degrade", "delay": "300ms", "error_rate": 0.2, "for": "20s"}
+//
+// Actions are kill (SIGKILL), restart, pause (SIGSTOP), resume (SIGCONT), degrade (slower
+// and/or failing through /control) and recover. With "for", kill is followed by restart,
+// pause by resume and degrade by recover.
+type ChaosEvent struct {
+	At        string   `json:"at"`      // offset from the start of load
+	Backend   int      `json:"backend"` // 1-based position in the backend list
+	Action    string   `json:"action"`
+	For       string   `json:"for"`
+	Delay     string   `json:"delay"`      // degrade: response delay
+	ErrorRate *float64 `json:"error_rate"` // degrade: error rate
+}
+
+// ChaosStep is a validated ChaosEvent
+type ChaosStep struct {
+	At        time.Duration
+	Backend   int // index into the backend list
+	Action    string
+	For       time.Duration
+	Delay     time.Duration
+	ErrorRate *float64
+}
+
+// ChaosRecord annotates the results with a chaos action that was carried out
+type ChaosRecord struct {
+	Seconds float64 `json:"seconds"` // since the start of load
+	Backend string  `json:"backend"`
+	Action  string  `json:"action"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// chaosReverts maps actions to the action that undoes them after "for"
+var chaosReverts = map[string]string{"kill": "restart", "pause": "resume", "degrade": "recover"}
+
+// ParseChaos validates chaos events against the number of backends
+func ParseChaos(events []ChaosEvent, backends int) ([]ChaosStep, error) {
+	var steps []ChaosStep
+	for i, event := range events {
+		at, err := time.ParseDuration(event.At)
+		if err != nil || at < 0 {
+			return nil, fmt.Errorf("chaos event %d: invalid at %q", i+1, event.At)
+		}
+		if event.Backend < 1 || event.Backend > backends {
+			return nil, fmt.Errorf("chaos event %d: backend must be between 1 and %d", i+1, backends)
+		}
+		step := ChaosStep{At: at, Backend: event.Backend - 1, Action: event.Action, ErrorRate: event.ErrorRate}
+		switch event.Action {
+		case "kill", "restart", "pause", "resume", "recover":
+		case "degrade":
+			if event.Delay == "" && event.ErrorRate == nil {
+				return nil, fmt.Errorf("chaos event %d: degrade needs a delay and/or error_rate", i+1)
+			}
+			if event.Delay != "" {
+				if step.Delay, err = time.ParseDuration(event.Delay); err != nil || step.Delay < 0 {
+					return nil, fmt.Errorf("chaos event %d: invalid delay %q", i+1, event.Delay)
+				}
+			}
+			if event.ErrorRate != nil && (*event.ErrorRate < 0 || *event.ErrorRate > 1) {
+				return nil, fmt.Errorf("chaos event %d: error_rate must be between 0.0 and 1.0", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("chaos event %d: unknown action %q", i+1, event.Action)
+		}
+		if event.For != "" {
+			if _, ok := chaosReverts[event.Action]; !ok {
+				return nil, fmt.Errorf("chaos event %d: %s can't take a duration", i+1, event.Action)
+			}
+			if step.For, err = time.ParseDuration(event.For); err != nil || step.For <= 0 {
+				return nil, fmt.Errorf("chaos event %d: invalid for %q", i+1, event.For)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// backendProcess is a running TestBackend that chaos actions can act on
+type backendProcess struct {
+	url     string
+	logPath string
+	binary  string
+	args    []string
+	child   *child
+	saved   map[string]interface{} // settings replaced by degrade, restored by recover
+}
+
+// runChaos carries out the steps, timed from start, until they are done or stop is closed
+func runChaos(backends []*backendProcess, steps []ChaosStep, procs *processes, start time.Time, stop <-chan struct{}) []ChaosRecord {
+	// Expand timed actions into the action and its revert
+	var schedule []ChaosStep
+	for _, step := range steps {
+		schedule = append(schedule, step)
+		if step.For > 0 {
+			schedule = append(schedule, ChaosStep{At: step.At + step.For, Backend: step.Backend, Action: chaosReverts[step.Action]})
+		}
+	}
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].At < schedule[j].At })
+
+	var records []ChaosRecord
+	for _, step := range schedule {
+		select {
+		case <-time.After(time.Until(start.Add(step.At))):
+		case <-stop:
+			return records
+		}
+
+		backend := backends[step.Backend]
+		record := ChaosRecord{Seconds: time.Since(start).Seconds(), Backend: backend.url, Action: step.Action}
+		if err := backend.apply(step, procs); err != nil {
+			record.Error = err.Error()
+			log.Printf("💥 [CHAOS] %s %s failed: %v", step.Action, backend.url, err)
+		} else {
+			log.Printf("💥 [CHAOS] %s %s at %.1fs", step.Action, backend.url, record.Seconds)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// apply carries out one chaos action on the backend
+func (b *backendProcess) apply(step ChaosStep, procs *processes) error {
+	switch step.Action {
+	case "kill":
+		if err := b.child.cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-b.child.done
+		return nil
+	case "restart":
+		if !b.child.exited() {
+			b.child.cmd.Process.Kill()
+			<-b.child.done
+		}
+		child, err := procs.start(b.logPath, b.binary, b.args...)
+		if err != nil {
+			return err
+		}
+		b.child = child
+		return nil
+	case "pause":
+		return pauseProcess(b.child.cmd.Process)
+	case "resume":
+		return resumeProcess(b.child.cmd.Process)
+	case "degrade":
+		current, err := fetchJSON(b.url + "/control")
+		if err != nil {
+			return err
+		}
+		if config, ok := current["config"].(map[string]interface{}); ok && b.saved == nil {
+			b.saved = map[string]interface{}{
+				"base_delay_ms": config["base_delay_ms"],
+				"max_delay_ms":  config["max_delay_ms"],
+				"error_rate":    config["error_rate"],
+			}
+		}
+		settings := map[string]interface{}{"action": "set"}
+		if step.Delay > 0 {
+			settings["base_delay_ms"] = step.Delay.Milliseconds()
+			settings["max_delay_ms"] = step.Delay.Milliseconds()
+		}
+		if step.ErrorRate != nil {
+			settings["error_rate"] = *step.ErrorRate
+		}
+		return b.control(settings)
+	case "recover":
+		if b.saved == nil {
+			return b.control(map[string]interface{}{"action": "recover"})
+		}
+		settings := map[string]interface{}{"action": "set"}
+		for key, value := range b.saved {
+			settings[key] = value
+		}
+		b.saved = nil
+		return b.control(settings)
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
+
+// control posts an action to the backend's /control endpoint
+func (b *backendProcess) control(body map[string]interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(b.url+"/control", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/control returned %s", resp.Status)
+	}
+	return nil
+}
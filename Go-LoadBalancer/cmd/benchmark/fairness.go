@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// FairnessStats measures how closely a request distribution matched the expected one
+type FairnessStats struct {
+	Requests     int64   `json:"requests"`
+	ChiSquare    float64 `json:"chi_square"`
+	PValue       float64 `json:"p_value"`       // chance of a deviation this large if the algorithm were exact
+	MaxDeviation float64 `json:"max_deviation"` // largest |actual - expected| share, in percentage points
+	WorstBackend string  `json:"worst_backend"` // backend with the largest deviation
+}
+
+// WindowFairness is the fairness of one time window of a run
+type WindowFairness struct {
+	StartSeconds float64  `json:"start_seconds"`
+	EndSeconds   float64  `json:"end_seconds"`
+	Events       []string `json:"events,omitempty"` // chaos actions carried out during the window
+	FairnessStats
+}
+
+// weightAwareAlgorithms are expected to split requests by configured weight; every other
+// algorithm is expected to split them evenly
+var weightAwareAlgorithms = map[string]bool{"weighted": true, "least-connections": true}
+
+// ExpectedShares returns the fraction of requests each backend should receive, by
+// weight when weightAware and evenly otherwise
+func ExpectedShares(weightAware bool, weights map[string]int) map[string]float64 {
+	shares := make(map[string]float64, len(weights))
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	for url, weight := range weights {
+		if weightAware && total > 0 {
+			shares[url] = float64(weight) / float64(total)
+		} else {
+			shares[url] = 1 / float64(len(weights))
+		}
+	}
+	return shares
+}
+
+// ComputeFairness compares observed request counts with the expected shares using
+// Pearson's chi-square test and the largest per-backend deviation
+func ComputeFairness(counts map[string]int64, expected map[string]float64) FairnessStats {
+	var stats FairnessStats
+	for _, n := range counts {
+		stats.Requests += n
+	}
+	if stats.Requests == 0 || len(expected) < 2 {
+		stats.PValue = 1
+		return stats
+	}
+
+	urls := make([]string, 0, len(expected))
+	for url := range expected {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	for _, url := range urls {
+		share := expected[url]
+		observed := float64(counts[url])
+		if want := share * float64(stats.Requests); want > 0 {
+			stats.ChiSquare += (observed - want) * (observed - want) / want
+		}
+		deviation := math.Abs(100*observed/float64(stats.Requests) - 100*share)
+		if deviation > stats.MaxDeviation {
+			stats.MaxDeviation, stats.WorstBackend = deviation, url
+		}
+	}
+	stats.PValue = chiSquareSurvival(stats.ChiSquare, float64(len(expected)-1))
+	return stats
+}
+
+// chiSquareSurvival returns P(X >= x) for a chi-square distribution with k degrees of freedom
+func chiSquareSurvival(x, k float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return upperIncompleteGamma(k/2, x/2)
+}
+
+// upperIncompleteGamma returns the regularized upper incomplete gamma function Q(a, x),
+// by series expansion below a+1 and by continued fraction above (Numerical Recipes 6.2)
+func upperIncompleteGamma(a, x float64) float64 {
+	const epsilon, iterations = 1e-12, 500
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < iterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// Lentz's method for the continued fraction
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < iterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return math.Min(1, prefix*h)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LatencySummary holds latency percentiles in milliseconds
+type LatencySummary struct {
+	P50  float64 `json:"p50_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	P999 float64 `json:"p999_ms"`
+	Max  float64 `json:"max_ms"`
+	Mean float64 `json:"mean_ms"`
+}
+
+// LoadResult holds what the load generator measured against the load balancer
+type LoadResult struct {
+	Mode        string           `json:"mode"`                  // "closed" or "open"
+	Rate        float64          `json:"target_rate,omitempty"` // open loop arrival rate, requests per second
+	Concurrency int              `json:"concurrency"`
+	Requests    int64            `json:"requests"`
+	Errors      int64            `json:"errors"`  // transport errors plus 5xx responses
+	Seconds     float64          `json:"seconds"` // measured after the warm-up
+	Throughput  float64          `json:"requests_per_second"`
+	Latency     LatencySummary   `json:"latency"`                       // corrected for coordinated omission in open loop
+	Uncorrected *LatencySummary  `json:"uncorrected_latency,omitempty"` // open loop: timed from when each request was actually sent
+	StatusCodes map[string]int64 `json:"status_codes"`
+	ServedBy    map[string]int64 `json:"served_by,omitempty"` // responses per X-Served-By header, when the load balancer sends one
+
+	WarmupSeconds  float64      `json:"warmup_seconds,omitempty"`
+	WarmupRequests int64        `json:"warmup_requests,omitempty"` // discarded from the summary
+	Windows        []LoadWindow `json:"windows,omitempty"`         // the whole run, warm-up included
+
+	// ByTemplate breaks the results down by request template when there is a traffic mix
+	ByTemplate map[string]TemplateResult `json:"by_template,omitempty"`
+}
+
+// TemplateResult holds what was measured for one request template of a mix
+type TemplateResult struct {
+	Requests int64          `json:"requests"`
+	Errors   int64          `json:"errors"`
+	Latency  LatencySummary `json:"latency"`
+}
+
+// LoadSpec describes the load to generate. In a closed loop Concurrency workers each
+// send their next request as soon as the last one completes, so a slow load balancer
+// is offered less load. In an open loop requests arrive at Rate per second whatever
+// happens to earlier ones, queueing without bound while Concurrency are in flight
+// (0 for no limit), and latency counts from when each request should have been sent.
+type LoadSpec struct {
+	Mode        string // "closed" (the default) or "open"
+	Concurrency int
+	Rate        float64
+	Duration    time.Duration
+	Mix         []RequestTemplate // the requests sent, see RequestTemplate
+	Warmup      time.Duration     // requests completing before this are left out of the summary
+	Window      time.Duration     // length of the LoadResult.Windows time series
+}
+
+// outcome is what happened to one request
+type outcome struct {
+	template    int
+	done        time.Duration // since load started
+	latency     time.Duration // from when the request was due
+	uncorrected time.Duration // from when it was actually sent
+	status      int           // 0 for a transport error
+	servedBy    string        // the X-Served-By response header
+}
+
+// loadRecorder collects the outcome of requests from many goroutines
+type loadRecorder struct {
+	mux      sync.Mutex
+	start    time.Time
+	outcomes []outcome
+}
+
+// send issues a request for the i-th template of mix and records its outcome
+func (r *loadRecorder) send(client *http.Client, base string, mix *requestMix, i int, intended time.Time) {
+	sent := time.Now()
+	req, err := mix.request(base, i)
+	var resp *http.Response
+	if err == nil {
+		resp, err = client.Do(req)
+	}
+	result := outcome{template: i}
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		result.status = resp.StatusCode
+		result.servedBy = resp.Header.Get("X-Served-By")
+	}
+	done := time.Now()
+	result.done = done.Sub(r.start)
+	result.latency = done.Sub(intended)
+	result.uncorrected = done.Sub(sent)
+
+	r.mux.Lock()
+	r.outcomes = append(r.outcomes, result)
+	r.mux.Unlock()
+}
+
+// GenerateLoad sends spec.Mix requests to the base URL as spec describes until
+// spec.Duration has passed. Every latency is kept so the tail percentiles are exact.
+// The summary covers what completed after spec.Warmup; Windows cover the whole run.
+func GenerateLoad(base string, spec LoadSpec) LoadResult {
+	openLoop := spec.Mode == "open"
+	conns := spec.Concurrency
+	if conns <= 0 {
+		conns = 1000
+	}
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: conns},
+		Timeout:   30 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+
+	mix := newRequestMix(spec.Mix)
+	start := time.Now()
+	recorder := &loadRecorder{start: start}
+	deadline := start.Add(spec.Duration)
+	var wg sync.WaitGroup
+	if openLoop {
+		// Each arrival gets its own goroutine, which waits for a slot if Concurrency are
+		// already in flight; waiting counts towards its latency
+		var slots chan struct{}
+		if spec.Concurrency > 0 {
+			slots = make(chan struct{}, spec.Concurrency)
+		}
+		interval := time.Duration(float64(time.Second) / spec.Rate)
+		for i := 0; ; i++ {
+			intended := start.Add(time.Duration(i) * interval)
+			if !intended.Before(deadline) {
+				break
+			}
+			time.Sleep(time.Until(intended))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if slots != nil {
+					slots <- struct{}{}
+					defer func() { <-slots }()
+				}
+				recorder.send(client, base, mix, mix.pick(), intended)
+			}()
+		}
+	} else {
+		for i := 0; i < spec.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for time.Now().Before(deadline) {
+					recorder.send(client, base, mix, mix.pick(), time.Now())
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := LoadResult{
+		Mode:          "closed",
+		Concurrency:   spec.Concurrency,
+		WarmupSeconds: spec.Warmup.Seconds(),
+		Seconds:       (elapsed - spec.Warmup).Seconds(),
+		StatusCodes:   make(map[string]int64),
+	}
+	if openLoop {
+		result.Mode, result.Rate = "open", spec.Rate
+	}
+
+	// Requests completing during the warm-up only appear in the time series
+	latencies := make([][]time.Duration, len(spec.Mix))
+	errors := make([]int64, len(spec.Mix))
+	var all, uncorrected []time.Duration
+	for _, o := range recorder.outcomes {
+		if o.done < spec.Warmup {
+			result.WarmupRequests++
+			continue
+		}
+		if o.status == 0 {
+			errors[o.template]++
+			result.StatusCodes["error"]++
+			continue
+		}
+		latencies[o.template] = append(latencies[o.template], o.latency)
+		all = append(all, o.latency)
+		uncorrected = append(uncorrected, o.uncorrected)
+		result.StatusCodes[strconv.Itoa(o.status)]++
+		if o.servedBy != "" {
+			if result.ServedBy == nil {
+				result.ServedBy = make(map[string]int64)
+			}
+			result.ServedBy[o.servedBy]++
+		}
+		if o.status >= 500 {
+			errors[o.template]++
+		}
+	}
+	for i, t := range spec.Mix {
+		result.Errors += errors[i]
+		if len(spec.Mix) > 1 {
+			if result.ByTemplate == nil {
+				result.ByTemplate = make(map[string]TemplateResult)
+			}
+			result.ByTemplate[t.label()] = TemplateResult{
+				Requests: int64(len(latencies[i])),
+				Errors:   errors[i],
+				Latency:  summarize(latencies[i]),
+			}
+		}
+	}
+	result.Requests = int64(len(all))
+	result.Latency = summarize(all)
+	if openLoop {
+		summary := summarize(uncorrected)
+		result.Uncorrected = &summary
+	}
+	result.Throughput = float64(result.Requests) / result.Seconds
+	result.Windows = loadWindows(recorder.outcomes, spec.Window, spec.Warmup, elapsed)
+	return result
+}
+
+// LoadWindow is one interval of the load time series
+type LoadWindow struct {
+	StartSeconds float64        `json:"start_seconds"`
+	EndSeconds   float64        `json:"end_seconds"`
+	Warmup       bool           `json:"warmup,omitempty"` // left out of the run's summary
+	Requests     int64          `json:"requests"`
+	Errors       int64          `json:"errors"`
+	Throughput   float64        `json:"requests_per_second"`
+	Latency      LatencySummary `json:"latency"`
+}
+
+// loadWindows buckets outcomes by completion time into windows of the given length,
+// with a boundary at the end of the warm-up
+func loadWindows(outcomes []outcome, window, warmup, elapsed time.Duration) []LoadWindow {
+	if window <= 0 {
+		return nil
+	}
+	var bounds []time.Duration
+	for at := time.Duration(0); at < elapsed; {
+		next := at + window
+		if at < warmup && next > warmup {
+			next = warmup
+		}
+		bounds = append(bounds, at)
+		at = next
+	}
+	bounds = append(bounds, elapsed)
+
+	windows := make([]LoadWindow, len(bounds)-1)
+	latencies := make([][]time.Duration, len(windows))
+	for _, o := range outcomes {
+		i := sort.Search(len(windows), func(i int) bool { return bounds[i+1] > o.done })
+		if i == len(windows) {
+			i--
+		}
+		if o.status == 0 || o.status >= 500 {
+			windows[i].Errors++
+		}
+		if o.status != 0 {
+			latencies[i] = append(latencies[i], o.latency)
+		}
+	}
+	for i := range windows {
+		w := &windows[i]
+		w.StartSeconds, w.EndSeconds = bounds[i].Seconds(), bounds[i+1].Seconds()
+		w.Warmup = bounds[i+1] <= warmup
+		w.Requests = int64(len(latencies[i]))
+		if seconds := w.EndSeconds - w.StartSeconds; seconds > 0 {
+			w.Throughput = float64(w.Requests) / seconds
+		}
+		w.Latency = summarize(latencies[i])
+	}
+	return windows
+}
+
+// Describe summarizes how the load was generated
+func (r LoadResult) Describe() string {
+	if r.Mode == "open" {
+		if r.Concurrency > 0 {
+			return fmt.Sprintf("open loop, %.0f req/s, at most %d in flight", r.Rate, r.Concurrency)
+		}
+		return fmt.Sprintf("open loop, %.0f req/s", r.Rate)
+	}
+	return fmt.Sprintf("closed loop, %d clients", r.Concurrency)
+}
+
+// summarize computes latency percentiles
+func summarize(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	percentile := func(p float64) float64 {
+		return ms(latencies[int(float64(len(latencies)-1)*p)])
+	}
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	return LatencySummary{
+		P50:  percentile(0.50),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		P999: percentile(0.999),
+		Max:  ms(latencies[len(latencies)-1]),
+		Mean: ms(total / time.Duration(len(latencies))),
+	}
+}
+
+// ms converts a duration to fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,340 @@
+// Command benchmark runs a full load balancer comparison: for each algorithm it starts
+// the TestBackends and the load balancer, drives load through it, collects load balancer
+// and backend metrics and tears everything down. External load balancers (see ExternalLB)
+// can be run on the same backends for comparison.
+//
+//	go build -o bin/benchmark ./Go-LoadBalancer/cmd/benchmark
+//	bin/benchmark -backends fast,fast:2,slow:3,failing -algorithms round-robin,weighted -duration 30s
+//	bin/benchmark -scenario Go-LoadBalancer/cmd/benchmark/scenarios/one-degrades.yaml
+//	bin/benchmark -algorithms weighted -external nginx,haproxy
+//	bin/benchmark -save-baseline main              # then, after a change:
+//	bin/benchmark -baseline main -max-p99-rise 15  # exits 1 on a regression
+//	bin/benchmark -scenario one-degrades.yaml -generate compose -out env && docker compose -f env/docker-compose.yml up
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+	lbBinary := flag.String("lb", "./bin/Go-LoadBalancer", "load balancer binary")
+	backendBinary := flag.String("backend", "./bin/TestBackend", "TestBackend binary")
+	algorithms := flag.String("algorithms", "round-robin,weighted,least-connections", "comma separated algorithms to compare")
+	backends := flag.String("backends", "fast,fast,fast:2,slow,failing", "comma separated backend profiles as type or type:weight")
+	basePort := flag.Int("base-port", 3001, "port of the first backend; the others follow")
+	lbPort := flag.Int("lb-port", 3030, "load balancer port")
+	duration := flag.Duration("duration", 30*time.Second, "load duration per algorithm")
+	concurrency := flag.Int("concurrency", 50, "concurrent clients (closed loop), or the cap on requests in flight (open loop, 0 = none)")
+	loadMode := flag.String("mode", "closed", "load mode: closed (fixed concurrency) or open (fixed -rate, latency corrected for coordinated omission)")
+	rate := flag.Float64("rate", 0, "open loop arrival rate in requests per second")
+	path := flag.String("path", "/", "request path")
+	mixFile := flag.String("mix", "", "JSON file with a weighted mix of request templates to send instead of GET -path")
+	healthCheck := flag.Int("health-interval", 2, "load balancer health check interval in seconds")
+	warmup := flag.Duration("warmup", 0, "warm-up left out of the summaries and fairness (still in the time series)")
+	window := flag.Duration("window", 5*time.Second, "interval for sampling the request distribution")
+	outDir := flag.String("out", "benchmark-results", "directory for results and process logs")
+	reportOnly := flag.String("report", "", "regenerate the report from a saved results.json into -out and exit")
+	external := flag.String("external", "", "comma separated external load balancers to compare too (nginx, haproxy, caddy, envoy)")
+	externalConfig := flag.String("external-config", "", "JSON file with an array of external load balancer definitions (name, command, template)")
+	baselineDir := flag.String("baseline-dir", "benchmark-baselines", "directory holding named baselines")
+	saveBaseline := flag.String("save-baseline", "", "save this run's results as the named baseline")
+	baseline := flag.String("baseline", "", "compare against the named baseline (or a results JSON file) and exit non-zero on regressions")
+	maxThroughputDrop := flag.Float64("max-throughput-drop", 10, "percent drop in req/s tolerated against -baseline")
+	maxP99Rise := flag.Float64("max-p99-rise", 20, "percent rise in p99 latency tolerated against -baseline")
+	pushURL := flag.String("push-url", "", "push results to this Prometheus remote-write endpoint or Pushgateway")
+	pushFormat := flag.String("push-format", "remote-write", "how -push-url receives results: remote-write or pushgateway")
+	target := flag.String("target", "", "only drive load at this already running load balancer URL, labelled with the first of -algorithms")
+	generate := flag.String("generate", "", "write the environment as \"compose\" (docker-compose.yml) or \"procfile\" into -out instead of running it")
+	sourceDir := flag.String("source", ".", "repository root, for -generate compose image builds")
+	scenarioFile := flag.String("scenario", "", "YAML (or .json) scenario file; overrides -algorithms, -backends, -duration, -concurrency, -mode, -rate, -mix, -warmup and -path")
+	flag.Parse()
+
+	thresholds := Thresholds{ThroughputDrop: *maxThroughputDrop, P99Rise: *maxP99Rise}
+	if *reportOnly != "" {
+		results, err := readResults(*reportOnly)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *reportOnly, err)
+		}
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := WriteReport(*outDir, BuildReport(results)); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		log.Printf("🏁 [BENCH] Report written to %s", *outDir)
+		push(*pushFormat, *pushURL, results)
+		if *baseline != "" && !checkBaseline(*outDir, *baselineDir, *baseline, results, thresholds) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	profiles, err := parseProfiles(*backends)
+	if err != nil {
+		log.Fatalf("Invalid -backends: %v", err)
+	}
+
+	if err := validateLoadMode(*loadMode, *rate); err != nil {
+		log.Fatalf("Invalid -mode: %v", err)
+	}
+	var mix []RequestTemplate
+	if *mixFile != "" {
+		if mix, err = LoadMix(*mixFile); err != nil {
+			log.Fatalf("Invalid mix %s: %v", *mixFile, err)
+		}
+	}
+	adapters, err := externalAdapters(*external, *externalConfig)
+	if err != nil {
+		log.Fatalf("Invalid external load balancers: %v", err)
+	}
+
+	config := BenchmarkConfig{
+		LBBinary:      *lbBinary,
+		BackendBinary: *backendBinary,
+		Algorithms:    splitList(*algorithms),
+		External:      adapters,
+		Backends:      profiles,
+		BasePort:      *basePort,
+		LBPort:        *lbPort,
+		Duration:      *duration,
+		Concurrency:   *concurrency,
+		LoadMode:      *loadMode,
+		Rate:          *rate,
+		Path:          *path,
+		Mix:           mix,
+		Window:        *window,
+		Warmup:        *warmup,
+		HealthCheck:   *healthCheck,
+		OutDir:        *outDir,
+	}
+
+	if *scenarioFile != "" {
+		scenario, err := LoadScenario(*scenarioFile)
+		if err != nil {
+			log.Fatalf("Invalid scenario %s: %v", *scenarioFile, err)
+		}
+		scenario.Apply(&config)
+		config.Scenario = scenario.Name
+		log.Printf("🏁 [BENCH] Scenario %q: %d backends, %v per algorithm", scenario.Name, len(config.Backends), config.Duration)
+	}
+
+	if *generate != "" {
+		if len(config.Algorithms) == 0 {
+			log.Fatalf("-generate needs at least one algorithm")
+		}
+		path, err := GenerateTopology(config, *generate, *sourceDir, config.OutDir)
+		if err != nil {
+			log.Fatalf("Failed to generate topology: %v", err)
+		}
+		log.Printf("🏁 [BENCH] Wrote %s", path)
+		return
+	}
+	if *target != "" {
+		results, err := RunTarget(config, *target)
+		if err != nil {
+			log.Fatalf("❌ [BENCH] %v", err)
+		}
+		PrintResults(os.Stdout, results)
+		if err := writeResults(filepath.Join(config.OutDir, "results.json"), results); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+		push(*pushFormat, *pushURL, results)
+		return
+	}
+
+	if config.Warmup >= config.Duration {
+		log.Fatalf("The warm-up (%v) must be shorter than the duration (%v)", config.Warmup, config.Duration)
+	}
+
+	// Never leave backends or load balancers behind when interrupted
+	procs := &processes{}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		log.Printf("🏁 [BENCH] Interrupted, stopping child processes")
+		procs.stopAll()
+		os.Exit(1)
+	}()
+
+	results, err := RunBenchmark(config, procs)
+	if err != nil {
+		log.Printf("❌ [BENCH] %v", err)
+	}
+	if len(results) == 0 {
+		os.Exit(1)
+	}
+
+	PrintResults(os.Stdout, results)
+	resultsPath := filepath.Join(config.OutDir, "results.json")
+	if err := writeResults(resultsPath, results); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+	if err := WriteReport(config.OutDir, BuildReport(results)); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	log.Printf("🏁 [BENCH] Results and report (json, csv, html) written to %s", config.OutDir)
+	push(*pushFormat, *pushURL, results)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if *saveBaseline != "" {
+		path, err := SaveBaseline(*baselineDir, *saveBaseline, results)
+		if err != nil {
+			log.Fatalf("Failed to save baseline: %v", err)
+		}
+		log.Printf("🏁 [BENCH] Saved baseline %q to %s", *saveBaseline, path)
+	}
+	if *baseline != "" && !checkBaseline(config.OutDir, *baselineDir, *baseline, results, thresholds) {
+		os.Exit(1)
+	}
+}
+
+// push sends results to url if one is set; a failed push is logged but doesn't fail the run
+func push(format, url string, results []AlgorithmResult) {
+	if url == "" {
+		return
+	}
+	if err := PushResults(format, url, results); err != nil {
+		log.Printf("❌ [BENCH] Push to %s failed: %v", url, err)
+		return
+	}
+	log.Printf("🏁 [BENCH] Pushed %d runs to %s (%s)", len(results), url, format)
+}
+
+// checkBaseline compares results with the named baseline, prints and saves the comparison
+// and reports whether the run is free of regressions
+func checkBaseline(outDir, baselineDir, name string, results []AlgorithmResult, thresholds Thresholds) bool {
+	baseline, err := LoadBaseline(baselineDir, name)
+	if err != nil {
+		log.Fatalf("Failed to read baseline %q: %v", name, err)
+	}
+	comparisons := CompareBaseline(baseline, results, thresholds)
+	if len(comparisons) == 0 {
+		log.Fatalf("Baseline %q has none of the algorithms that were run", name)
+	}
+	regressions := PrintComparison(os.Stdout, name, comparisons)
+
+	data, err := json.MarshalIndent(comparisons, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(outDir, "baseline-comparison.json"), data, 0o644)
+	}
+	if err != nil {
+		log.Printf("❌ [BENCH] Failed to write baseline comparison: %v", err)
+	}
+
+	if regressions > 0 {
+		log.Printf("❌ [BENCH] %d regressions against baseline %q", regressions, name)
+		return false
+	}
+	log.Printf("🏁 [BENCH] No regressions against baseline %q", name)
+	return true
+}
+
+// parseProfiles parses "type" or "type:weight" entries
+func parseProfiles(list string) ([]BackendProfile, error) {
+	var profiles []BackendProfile
+	for _, entry := range strings.Split(list, ",") {
+		profile := BackendProfile{Type: strings.TrimSpace(entry), Weight: 1}
+		if name, weight, ok := strings.Cut(profile.Type, ":"); ok {
+			w, err := strconv.Atoi(weight)
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight in %q", entry)
+			}
+			profile.Type, profile.Weight = name, w
+		}
+		if profile.Type == "" {
+			return nil, fmt.Errorf("empty backend profile")
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// externalAdapters resolves the -external names against the definitions in the
+// -external-config file, falling back to the built-in ones
+func externalAdapters(names, configPath string) ([]LBAdapter, error) {
+	defs := make(map[string]ExternalLB)
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		var list []ExternalLB
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		for _, def := range list {
+			defs[def.Name] = def
+		}
+	}
+
+	var adapters []LBAdapter
+	for _, name := range splitList(names) {
+		def, ok := defs[name]
+		if !ok {
+			def = ExternalLB{Name: name}
+		}
+		adapter, err := NewExternalLB(def)
+		if err != nil {
+			return nil, err
+		}
+		adapters = append(adapters, adapter)
+	}
+	return adapters, nil
+}
+
+// PrintResults writes one row per algorithm
+func PrintResults(w io.Writer, results []AlgorithmResult) {
+	fmt.Fprintf(w, "%-20s %10s %8s %10s %9s %9s %9s %9s\n",
+		"ALGORITHM", "REQUESTS", "ERRORS", "REQ/S", "P50 MS", "P95 MS", "P99 MS", "P999 MS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%-20s %10d %8d %10.0f %9.2f %9.2f %9.2f %9.2f\n",
+			r.Algorithm, r.Load.Requests, r.Load.Errors, r.Load.Throughput,
+			r.Load.Latency.P50, r.Load.Latency.P95, r.Load.Latency.P99, r.Load.Latency.P999)
+	}
+}
+
+// writeResults saves the full results, including distributions and load balancer stats
+func writeResults(path string, results []AlgorithmResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// readResults loads results saved by a previous run
+func readResults(path string) ([]AlgorithmResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []AlgorithmResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// RequestTemplate is one kind of request in a traffic mix, e.g.
+//
+//	[{"path": "/", "weight": 70},
+//	 {"path": "/slow", "weight": 20},
+//	 {"method": "POST", "path": "/upload", "body_bytes": 65536, "weight": 10,
+//	  "headers": {"Content-Type": "application/octet-stream"}}]
+type RequestTemplate struct {
+	Name      string            `json:"name"`   // labels the template's results; defaults to "METHOD path"
+	Method    string            `json:"method"` // defaults to GET
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers"`
+	BodyBytes int               `json:"body_bytes"`
+	Weight    int               `json:"weight"` // share of requests relative to the others; defaults to 1
+}
+
+// LoadMix reads a JSON array of request templates
+func LoadMix(path string) ([]RequestTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mix []RequestTemplate
+	if err := json.Unmarshal(data, &mix); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return mix, ValidateMix(mix)
+}
+
+// ValidateMix checks every template of a mix
+func ValidateMix(mix []RequestTemplate) error {
+	names := make(map[string]bool)
+	for i, t := range mix {
+		if !strings.HasPrefix(t.Path, "/") {
+			return fmt.Errorf("request template %d: path %q must start with /", i+1, t.Path)
+		}
+		if t.Weight < 0 || t.BodyBytes < 0 {
+			return fmt.Errorf("request template %d: weight and body_bytes must not be negative", i+1)
+		}
+		name := t.label()
+		if names[name] {
+			return fmt.Errorf("request template %d: duplicate name %q", i+1, name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// label returns the template's name, or "METHOD path" without one
+func (t RequestTemplate) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.method() + " " + t.Path
+}
+
+// method returns the HTTP method, GET by default
+func (t RequestTemplate) method() string {
+	if t.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(t.Method)
+}
+
+// metricPath returns the path TestBackend counts the template's requests under
+func (t RequestTemplate) metricPath() string {
+	path, _, _ := strings.Cut(t.Path, "?")
+	return path
+}
+
+// requestMix picks request templates at random in proportion to their weights
+type requestMix struct {
+	templates  []RequestTemplate
+	bodies     [][]byte
+	cumulative []int
+	total      int
+}
+
+// newRequestMix prepares a mix; bodies are built once and shared by every request
+func newRequestMix(templates []RequestTemplate) *requestMix {
+	m := &requestMix{templates: templates}
+	for _, t := range templates {
+		m.total += max(1, t.Weight)
+		m.cumulative = append(m.cumulative, m.total)
+		m.bodies = append(m.bodies, bytes.Repeat([]byte("x"), t.BodyBytes))
+	}
+	return m
+}
+
+// pick returns the index of a random template
+func (m *requestMix) pick() int {
+	n := rand.IntN(m.total)
+	for i, limit := range m.cumulative {
+		if n < limit {
+			return i
+		}
+	}
+	return len(m.cumulative) - 1
+}
+
+// request builds a request for the i-th template against base
+func (m *requestMix) request(base string, i int) (*http.Request, error) {
+	t := m.templates[i]
+	var body io.Reader
+	if t.BodyBytes > 0 {
+		body = bytes.NewReader(m.bodies[i])
+	}
+	req, err := http.NewRequest(t.method(), base+t.Path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range t.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value // the client ignores a Host header
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+	return req, nil
+}
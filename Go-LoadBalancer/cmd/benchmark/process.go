@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// child is a running process started by the orchestrator
+type child struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+}
+
+// exited reports whether the process has exited
+func (c *child) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// processes tracks every child process so they can all be stopped on interrupt
+type processes struct {
+	mux      sync.Mutex
+	children []*child
+}
+
+// start launches a child process, appending its output to logPath
+func (p *processes) start(logPath, binary string, args ...string) (*child, error) {
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("starting %s: %w", binary, err)
+	}
+
+	c := &child{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+		close(c.done)
+	}()
+
+	p.mux.Lock()
+	p.children = append(p.children, c)
+	p.mux.Unlock()
+	return c, nil
+}
+
+// stopAll interrupts every running child and kills those still running after a grace period
+func (p *processes) stopAll() {
+	p.mux.Lock()
+	children := p.children
+	p.children = nil
+	p.mux.Unlock()
+
+	for _, c := range children {
+		if c.exited() {
+			continue
+		}
+		// A paused process can't handle the interrupt until it is resumed
+		resumeProcess(c.cmd.Process)
+		if err := c.cmd.Process.Signal(os.Interrupt); err != nil {
+			c.cmd.Process.Kill()
+		}
+	}
+	timeout := time.After(10 * time.Second)
+	for _, c := range children {
+		select {
+		case <-c.done:
+		case <-timeout:
+			c.cmd.Process.Kill()
+			<-c.done
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pushJob is the Pushgateway job and the job label of remote-written series
+const pushJob = "lb_benchmark"
+
+// sample is one metric value at a point in time
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+	at     time.Time
+}
+
+// sampleLabels returns a result's scenario and algorithm labels plus extra name, value pairs
+func sampleLabels(result AlgorithmResult, extra ...string) map[string]string {
+	labels := map[string]string{"job": pushJob, "scenario": result.Scenario, "algorithm": result.Algorithm}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	return labels
+}
+
+// seriesSamples returns the time series of a run: backend requests and throughput per
+// distribution window, timed at the window's end, and the chaos events
+func seriesSamples(result AlgorithmResult) []sample {
+	var samples []sample
+	for _, window := range result.Windows {
+		at := result.Started.Add(time.Duration(window.EndSeconds * float64(time.Second)))
+		var total int64
+		for url, n := range window.Requests {
+			total += n
+			samples = append(samples, sample{"lbbench_backend_requests", sampleLabels(result, "backend", url), float64(n), at})
+		}
+		if seconds := window.EndSeconds - window.StartSeconds; seconds > 0 {
+			samples = append(samples, sample{"lbbench_requests_per_second", sampleLabels(result), float64(total) / seconds, at})
+		}
+	}
+	for _, event := range result.Events {
+		at := result.Started.Add(time.Duration(event.Seconds * float64(time.Second)))
+		samples = append(samples, sample{"lbbench_chaos_event", sampleLabels(result, "action", event.Action, "backend", event.Backend), 1, at})
+	}
+	return samples
+}
+
+// summarySamples returns a run's totals and latency percentiles, timed at its end
+func summarySamples(result AlgorithmResult) []sample {
+	end := result.Started.Add(time.Duration(result.Load.Seconds * float64(time.Second)))
+	latency := result.Load.Latency
+	var samples []sample
+	for _, q := range []struct {
+		quantile string
+		value    float64
+	}{{"0.5", latency.P50}, {"0.95", latency.P95}, {"0.99", latency.P99}, {"0.999", latency.P999}, {"1", latency.Max}} {
+		samples = append(samples, sample{"lbbench_latency_ms", sampleLabels(result, "quantile", q.quantile), q.value, end})
+	}
+	return append(samples,
+		sample{"lbbench_throughput", sampleLabels(result), result.Load.Throughput, end},
+		sample{"lbbench_requests_total", sampleLabels(result), float64(result.Load.Requests), end},
+		sample{"lbbench_errors_total", sampleLabels(result), float64(result.Load.Errors), end},
+	)
+}
+
+// PushResults sends every result to a Prometheus remote-write endpoint ("remote-write")
+// or a Pushgateway ("pushgateway"). Remote write gets the time series and summaries; the
+// Pushgateway only holds one value per series, so it gets the summaries.
+func PushResults(format, url string, results []AlgorithmResult) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, result := range results {
+		var req *http.Request
+		var err error
+		switch format {
+		case "remote-write":
+			req, err = http.NewRequest(http.MethodPost, url, bytes.NewReader(remoteWriteBody(append(seriesSamples(result), summarySamples(result)...))))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/x-protobuf")
+				req.Header.Set("Content-Encoding", "snappy")
+				req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+			}
+		case "pushgateway":
+			// PUT replaces the whole group, so series from an earlier run don't linger
+			req, err = http.NewRequest(http.MethodPut, pushgatewayURL(url, result), strings.NewReader(exposition(summarySamples(result))))
+			if err == nil {
+				req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+			}
+		default:
+			return fmt.Errorf("unknown push format %q (use remote-write or pushgateway)", format)
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("pushing %s: %w", result.Algorithm, err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("pushing %s: %s: %s", result.Algorithm, resp.Status, strings.TrimSpace(string(body)))
+		}
+	}
+	return nil
+}
+
+// pushgatewayURL returns the group URL for a result, with the scenario and algorithm as
+// grouping labels. Values are base64 encoded as they may contain slashes or be empty.
+func pushgatewayURL(base string, result AlgorithmResult) string {
+	encode := func(value string) string {
+		if value == "" {
+			return "="
+		}
+		return base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return fmt.Sprintf("%s/metrics/job/%s/scenario@base64/%s/algorithm@base64/%s",
+		strings.TrimSuffix(base, "/"), pushJob, encode(result.Scenario), encode(result.Algorithm))
+}
+
+// exposition renders samples in the Prometheus text format, leaving out the labels the
+// Pushgateway adds from the group URL
+func exposition(samples []sample) string {
+	var b strings.Builder
+	for _, s := range samples {
+		var labels []string
+		for name, value := range s.labels {
+			if name != "job" && name != "scenario" && name != "algorithm" {
+				labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+			}
+		}
+		sort.Strings(labels)
+		if len(labels) > 0 {
+			fmt.Fprintf(&b, "%s{%s} %g\n", s.name, strings.Join(labels, ","), s.value)
+		} else {
+			fmt.Fprintf(&b, "%s %g\n", s.name, s.value)
+		}
+	}
+	return b.String()
+}
+
+// remoteWriteBody encodes samples as a snappy-compressed prometheus.WriteRequest with one
+// time series per label set, its samples in the order given
+func remoteWriteBody(samples []sample) []byte {
+	type series struct {
+		labels []byte // encoded, sorted as remote write requires (__name__ sorts first)
+		points []byte
+	}
+	bySeries := make(map[string]*series)
+	var order []*series
+	for _, s := range samples {
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		labels := protoBytes(nil, 1, protoLabel("__name__", s.name))
+		for _, name := range names {
+			labels = protoBytes(labels, 1, protoLabel(name, s.labels[name]))
+		}
+
+		ts, ok := bySeries[string(labels)]
+		if !ok {
+			ts = &series{labels: labels}
+			bySeries[string(labels)] = ts
+			order = append(order, ts)
+		}
+		var point []byte
+		point = protoKey(point, 1, 1)
+		point = binary.LittleEndian.AppendUint64(point, math.Float64bits(s.value))
+		point = protoKey(point, 2, 0)
+		point = binary.AppendUvarint(point, uint64(s.at.UnixMilli()))
+		ts.points = protoBytes(ts.points, 2, point)
+	}
+
+	var request []byte
+	for _, ts := range order {
+		request = protoBytes(request, 1, append(ts.labels, ts.points...))
+	}
+	return snappyEncode(request)
+}
+
+// protoLabel encodes a prometheus.Label
+func protoLabel(name, value string) []byte {
+	var label []byte
+	label = protoBytes(label, 1, []byte(name))
+	return protoBytes(label, 2, []byte(value))
+}
+
+// protoKey appends a protobuf field key
+func protoKey(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+// protoBytes appends a length-delimited protobuf field
+func protoBytes(b []byte, field int, data []byte) []byte {
+	b = protoKey(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// snappyEncode frames data as a snappy block made only of literals. That is valid snappy
+// without compressing anything, which is fine for the few kilobytes a run produces.
+func snappyEncode(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		chunk := data[:min(len(data), 65536)]
+		data = data[len(chunk):]
+		n := len(chunk) - 1
+		if n < 60 {
+			out = append(out, byte(n<<2))
+		} else if n < 256 {
+			out = append(out, 60<<2, byte(n))
+		} else {
+			out = append(out, 61<<2, byte(n), byte(n>>8))
+		}
+		out = append(out, chunk...)
+	}
+	return out
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Report compares the algorithms of one benchmark run side by side
+type Report struct {
+	Generated  string            `json:"generated"`
+	Scenario   string            `json:"scenario,omitempty"`
+	Warmup     float64           `json:"warmup_seconds,omitempty"` // discarded from every summary
+	Algorithms []AlgorithmReport `json:"algorithms"`
+}
+
+// AlgorithmReport is one algorithm's row of the report
+type AlgorithmReport struct {
+	Algorithm  string         `json:"algorithm"`
+	Build      string         `json:"build,omitempty"` // load balancer version and commit
+	Requests   int64          `json:"requests"`
+	Throughput float64        `json:"requests_per_second"`
+	Load       string         `json:"load"` // see LoadResult.Describe
+	Latency    LatencySummary `json:"latency"`
+	ErrorRate  float64        `json:"error_rate"` // fraction of requests
+	Retries    int64          `json:"retries"`
+	Backends   []BackendShare `json:"backends"`
+
+	// Fairness compares the whole run's distribution with the expected one, and
+	// WindowFairness each sampling window's, so transient imbalance (after a failure,
+	// say) isn't averaged away
+	Fairness       FairnessStats    `json:"fairness"`
+	WindowFairness []WindowFairness `json:"window_fairness"`
+	Events         []ChaosRecord    `json:"events"`
+
+	// UncorrectedLatency is the open loop latency timed from when requests were actually
+	// sent; Latency counts from when they were due, correcting for coordinated omission
+	UncorrectedLatency *LatencySummary `json:"uncorrected_latency,omitempty"`
+
+	ByTemplate map[string]TemplateResult `json:"by_template,omitempty"` // with a traffic mix
+
+	// LoadWindows is the steady-state load time series
+	LoadWindows []LoadWindow `json:"load_windows"`
+}
+
+// BackendShare compares the requests a backend served with its configured weight
+type BackendShare struct {
+	URL           string  `json:"url"`
+	Weight        int     `json:"weight"`
+	Requests      int64   `json:"requests"`
+	Share         float64 `json:"share"`          // percent of all backend requests
+	ExpectedShare float64 `json:"expected_share"` // percent, see ExpectedShares
+}
+
+// BuildReport derives the comparison from raw results
+func BuildReport(results []AlgorithmResult) Report {
+	report := Report{Generated: time.Now().Format(time.RFC3339)}
+	for _, result := range results {
+		report.Scenario = result.Scenario
+		report.Warmup = result.Load.WarmupSeconds
+		row := AlgorithmReport{
+			Algorithm:  result.Algorithm,
+			Build:      describeBuild(result.Build),
+			Requests:   result.Load.Requests,
+			Throughput: result.Load.Throughput,
+			Load:       result.Load.Describe(),
+			Latency:    result.Load.Latency,
+
+			UncorrectedLatency: result.Load.Uncorrected,
+			ByTemplate:         result.Load.ByTemplate,
+		}
+		if result.Load.Requests > 0 {
+			row.ErrorRate = float64(result.Load.Errors) / float64(result.Load.Requests)
+		}
+		if retries, ok := result.LBStats["retries"].(float64); ok {
+			row.Retries = int64(retries)
+		}
+
+		// Results saved before weight_aware was recorded fall back to the algorithm name
+		weightAware := result.WeightAware || weightAwareAlgorithms[result.Algorithm]
+		expected := ExpectedShares(weightAware, result.Weights)
+		row.Fairness = ComputeFairness(result.Distribution, expected)
+		for _, window := range result.Load.Windows {
+			if !window.Warmup {
+				row.LoadWindows = append(row.LoadWindows, window)
+			}
+		}
+		for _, window := range result.Windows {
+			if window.Warmup {
+				continue
+			}
+			row.WindowFairness = append(row.WindowFairness, WindowFairness{
+				StartSeconds:  window.StartSeconds,
+				EndSeconds:    window.EndSeconds,
+				FairnessStats: ComputeFairness(window.Requests, expected),
+				Events:        eventsBetween(result.Events, window.StartSeconds, window.EndSeconds),
+			})
+		}
+		row.Events = result.Events
+
+		for url, requests := range result.Distribution {
+			share := BackendShare{
+				URL:           url,
+				Weight:        result.Weights[url],
+				Requests:      requests,
+				ExpectedShare: 100 * expected[url],
+			}
+			if row.Fairness.Requests > 0 {
+				share.Share = 100 * float64(requests) / float64(row.Fairness.Requests)
+			}
+			row.Backends = append(row.Backends, share)
+		}
+		sort.Slice(row.Backends, func(i, j int) bool { return row.Backends[i].URL < row.Backends[j].URL })
+		report.Algorithms = append(report.Algorithms, row)
+	}
+	return report
+}
+
+// describeBuild summarizes a load balancer's build information as "version (commit)"
+func describeBuild(build map[string]interface{}) string {
+	version, _ := build["version"].(string)
+	commit, _ := build["commit"].(string)
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if dirty, _ := build["dirty"].(bool); dirty && commit != "" {
+		commit += "-dirty"
+	}
+	switch {
+	case commit == "":
+		return version
+	case version == "":
+		return commit
+	}
+	return version + " (" + commit + ")"
+}
+
+// eventsBetween describes the chaos events in [start, end) seconds
+func eventsBetween(events []ChaosRecord, start, end float64) []string {
+	var described []string
+	for _, event := range events {
+		if event.Seconds >= start && event.Seconds < end {
+			described = append(described, event.Action+" "+event.Backend)
+		}
+	}
+	return described
+}
+
+// WriteReport writes report.json, report.csv and report.html to dir
+func WriteReport(dir string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), data, 0o644); err != nil {
+		return err
+	}
+	if err := writeReportCSV(filepath.Join(dir, "report.csv"), report); err != nil {
+		return err
+	}
+	return writeReportHTML(filepath.Join(dir, "report.html"), report)
+}
+
+// writeReportCSV writes one row per algorithm
+func writeReportCSV(path string, report Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"algorithm", "requests", "requests_per_second", "p50_ms", "p95_ms", "p99_ms", "p999_ms",
+		"max_ms", "mean_ms", "error_rate", "retries", "max_deviation", "chi_square", "p_value", "build"})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, r := range report.Algorithms {
+		w.Write([]string{r.Algorithm, strconv.FormatInt(r.Requests, 10), f(r.Throughput),
+			f(r.Latency.P50), f(r.Latency.P95), f(r.Latency.P99), f(r.Latency.P999), f(r.Latency.Max), f(r.Latency.Mean),
+			strconv.FormatFloat(r.ErrorRate, 'f', 5, 64), strconv.FormatInt(r.Retries, 10),
+			f(r.Fairness.MaxDeviation), f(r.Fairness.ChiSquare), strconv.FormatFloat(r.Fairness.PValue, 'g', 4, 64), r.Build})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// chartBar is one bar of an inline SVG bar chart
+type chartBar struct {
+	Label string
+	Value float64
+	X, Y  float64
+	W, H  float64
+	Color string
+}
+
+// chart is an inline SVG bar chart, laid out in Go so the page needs no scripts
+type chart struct {
+	Title  string
+	Unit   string
+	Width  float64
+	Height float64
+	Bars   []chartBar
+}
+
+// chartColors are cycled through for series within a group
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948"}
+
+// barChart lays out groups of bars, one group per label and one bar per series
+func barChart(title, unit string, groups []string, series []string, values func(group, series int) float64) chart {
+	const barWidth, gap, plotHeight = 28.0, 24.0, 200.0
+	c := chart{Title: title, Unit: unit, Height: plotHeight + 120} // room for rotated labels
+
+	maxValue := 0.0
+	for g := range groups {
+		for s := range series {
+			maxValue = math.Max(maxValue, values(g, s))
+		}
+	}
+	if maxValue == 0 {
+		maxValue = 1
+	}
+
+	x := gap
+	for g, group := range groups {
+		for s, name := range series {
+			v := values(g, s)
+			h := v / maxValue * plotHeight
+			label := group
+			if len(series) > 1 {
+				label = group + " " + name
+			}
+			c.Bars = append(c.Bars, chartBar{
+				Label: label, Value: v,
+				X: x, Y: 20 + plotHeight - h, W: barWidth, H: h,
+				Color: chartColors[s%len(chartColors)],
+			})
+			x += barWidth + 2
+		}
+		x += gap
+	}
+	c.Width = math.Max(x, 300)
+	return c
+}
+
+// reportTemplate renders a self-contained HTML page
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"f1":  func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) },
+	"f2":  func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+	"pct": func(v float64) string { return strconv.FormatFloat(v*100, 'f', 2, 64) + "%" },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Load balancer comparison</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+svg { display: block; margin-bottom: 2em; }
+svg text { font-size: 10px; }
+</style></head><body>
+<h1>Load balancer comparison</h1>
+<p>{{if .Report.Scenario}}Scenario: {{.Report.Scenario}} &middot; {{end}}{{if .Report.Warmup}}First {{f1 .Report.Warmup}}s discarded as warm-up &middot; {{end}}Generated {{.Report.Generated}}</p>
+<table>
+<tr><th>Algorithm</th><th>Load</th><th>Requests</th><th>Req/s</th><th>p50 ms</th><th>p95 ms</th><th>p99 ms</th><th>p99.9 ms</th><th>Errors</th><th>Retries</th><th>Max deviation</th><th>&chi;&sup2;</th><th>p</th><th>Build</th></tr>
+{{range .Report.Algorithms}}<tr><td>{{.Algorithm}}</td><td>{{.Load}}</td><td>{{.Requests}}</td><td>{{f1 .Throughput}}</td><td>{{f2 .Latency.P50}}</td><td>{{f2 .Latency.P95}}</td><td>{{f2 .Latency.P99}}</td><td>{{f2 .Latency.P999}}</td><td>{{pct .ErrorRate}}</td><td>{{.Retries}}</td><td>{{f1 .Fairness.MaxDeviation}} pts</td><td>{{f1 .Fairness.ChiSquare}}</td><td>{{printf "%.3g" .Fairness.PValue}}</td><td>{{.Build}}</td></tr>
+{{end}}</table>
+{{range .Report.Algorithms}}{{if .UncorrectedLatency}}<p>{{.Algorithm}}: latencies are corrected for coordinated omission. Timed from when requests were actually sent, p99 is {{f2 .UncorrectedLatency.P99}} ms and p99.9 is {{f2 .UncorrectedLatency.P999}} ms.</p>
+{{end}}{{end}}{{range .Charts}}<h2>{{.Title}}</h2>
+<svg width="{{.Width}}" height="{{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{$unit := .Unit}}{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="{{.H}}" fill="{{.Color}}"><title>{{.Label}}: {{f2 .Value}} {{$unit}}</title></rect>
+<text x="{{.X}}" y="{{.Y}}" dy="-3">{{f1 .Value}}</text>
+<text x="{{.X}}" y="235" transform="rotate(30 {{.X}} 235)">{{.Label}}</text>
+{{end}}</svg>
+{{end}}
+<h2>Request distribution</h2>
+{{range .Report.Algorithms}}<h3>{{.Algorithm}}</h3>
+<table><tr><th>Backend</th><th>Weight</th><th>Requests</th><th>Share</th><th>Expected share</th></tr>
+{{range .Backends}}<tr><td>{{.URL}}</td><td>{{.Weight}}</td><td>{{.Requests}}</td><td>{{f1 .Share}}%</td><td>{{f1 .ExpectedShare}}%</td></tr>
+{{end}}</table>
+{{if .ByTemplate}}<table><tr><th>Request</th><th>Requests</th><th>Errors</th><th>p50 ms</th><th>p99 ms</th><th>p99.9 ms</th></tr>
+{{range $name, $t := .ByTemplate}}<tr><td>{{$name}}</td><td>{{$t.Requests}}</td><td>{{$t.Errors}}</td><td>{{f2 $t.Latency.P50}}</td><td>{{f2 $t.Latency.P99}}</td><td>{{f2 $t.Latency.P999}}</td></tr>
+{{end}}</table>
+{{end}}{{if .LoadWindows}}<table><tr><th>Window</th><th>Req/s</th><th>Errors</th><th>p50 ms</th><th>p99 ms</th></tr>
+{{range .LoadWindows}}<tr><td>{{f1 .StartSeconds}}&ndash;{{f1 .EndSeconds}}s</td><td>{{f1 .Throughput}}</td><td>{{.Errors}}</td><td>{{f2 .Latency.P50}}</td><td>{{f2 .Latency.P99}}</td></tr>
+{{end}}</table>
+{{end}}<table><tr><th>Window</th><th>Requests</th><th>Max deviation</th><th>Worst backend</th><th>&chi;&sup2;</th><th>p</th><th>Chaos</th></tr>
+{{range .WindowFairness}}<tr><td>{{f1 .StartSeconds}}&ndash;{{f1 .EndSeconds}}s</td><td>{{.Requests}}</td><td>{{f1 .MaxDeviation}} pts</td><td>{{.WorstBackend}}</td><td>{{f1 .ChiSquare}}</td><td>{{printf "%.3g" .PValue}}</td><td>{{range .Events}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{end}}</body></html>
+`))
+
+// writeReportHTML renders the report with inline SVG charts
+func writeReportHTML(path string, report Report) error {
+	var names []string
+	for _, r := range report.Algorithms {
+		names = append(names, r.Algorithm)
+	}
+	percentiles := []string{"p50", "p95", "p99", "p99.9"}
+
+	charts := []chart{
+		barChart("Throughput", "req/s", names, []string{""}, func(g, _ int) float64 {
+			return report.Algorithms[g].Throughput
+		}),
+		barChart("Latency percentiles", "ms", names, percentiles, func(g, s int) float64 {
+			l := report.Algorithms[g].Latency
+			return []float64{l.P50, l.P95, l.P99, l.P999}[s]
+		}),
+		barChart("Error rate", "%", names, []string{""}, func(g, _ int) float64 {
+			return report.Algorithms[g].ErrorRate * 100
+		}),
+		barChart("Max deviation from expected distribution", "pts", names, []string{""}, func(g, _ int) float64 {
+			return report.Algorithms[g].Fairness.MaxDeviation
+		}),
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := reportTemplate.Execute(file, map[string]interface{}{"Report": report, "Charts": charts}); err != nil {
+		return fmt.Errorf("rendering report: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackendProfile describes one TestBackend instance to start
+type BackendProfile struct {
+	Type     string   // TestBackend -type: fast, slow, heavy, failing, balanced, controllable
+	Weight   int      // weight given to the load balancer
+	Args     []string // extra TestBackend flags
+	Timeline []string // failure timeline entries passed to TestBackend -scenario
+}
+
+// BenchmarkConfig describes a full comparison run
+type BenchmarkConfig struct {
+	LBBinary      string
+	BackendBinary string
+	Algorithms    []string    // Go load balancer algorithms
+	External      []LBAdapter // other load balancers, run after the algorithms
+	Backends      []BackendProfile
+	BasePort      int // backends listen on BasePort, BasePort+1, ...
+	LBPort        int
+	Duration      time.Duration
+	Concurrency   int
+	LoadMode      string  // "closed" or "open", see LoadSpec
+	Rate          float64 // open loop arrival rate, requests per second
+	Path          string  // request path sent through the load balancer, without a Mix
+	Mix           []RequestTemplate
+	Window        time.Duration // distribution sampling interval for fairness over time
+	Warmup        time.Duration // left out of the summaries, see LoadSpec
+	HealthCheck   int           // load balancer health check interval in seconds
+	Chaos         []ChaosStep   // disruptions carried out while load runs
+	OutDir        string        // process logs and results are written here
+	Scenario      string        // scenario name, if the run came from a scenario file
+}
+
+// AlgorithmResult holds what one algorithm's run measured
+type AlgorithmResult struct {
+	Algorithm    string                 `json:"algorithm"` // or the external load balancer's name
+	WeightAware  bool                   `json:"weight_aware"`
+	Scenario     string                 `json:"scenario,omitempty"`
+	Started      time.Time              `json:"started"` // when load began; window and event times count from here
+	Load         LoadResult             `json:"load"`
+	Distribution map[string]int64       `json:"distribution"` // requests served per backend URL, from backend metrics
+	Windows      []DistributionWindow   `json:"windows"`
+	Events       []ChaosRecord          `json:"events"`
+	Weights      map[string]int         `json:"weights"`
+	LBStats      map[string]interface{} `json:"lb_stats"`
+	Build        map[string]interface{} `json:"build,omitempty"` // the load balancer's /version, when it has one
+}
+
+// loadSpec returns the load each run generates
+func (config BenchmarkConfig) loadSpec() LoadSpec {
+	return LoadSpec{
+		Mode:        config.LoadMode,
+		Concurrency: config.Concurrency,
+		Rate:        config.Rate,
+		Duration:    config.Duration,
+		Mix:         config.requests(),
+		Warmup:      config.Warmup,
+		Window:      config.Window,
+	}
+}
+
+// requests returns the traffic mix, or a single GET of Path without one
+func (config BenchmarkConfig) requests() []RequestTemplate {
+	if len(config.Mix) > 0 {
+		return config.Mix
+	}
+	return []RequestTemplate{{Path: config.Path}}
+}
+
+// metricPaths returns the distinct paths backends count the load's requests under
+func (config BenchmarkConfig) metricPaths() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, t := range config.requests() {
+		if path := t.metricPath(); !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// RunBenchmark runs every algorithm, then every external load balancer, in turn against a
+// fresh set of backends, so state left by one run (circuits, warm connections, backend
+// counters) can't skew the next
+func RunBenchmark(config BenchmarkConfig, procs *processes) ([]AlgorithmResult, error) {
+	// Process logs are appended to (restarted backends keep theirs), so start afresh
+	logDir := filepath.Join(config.OutDir, "logs")
+	if err := os.RemoveAll(logDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var adapters []LBAdapter
+	for _, algorithm := range config.Algorithms {
+		adapters = append(adapters, goLB{binary: config.LBBinary, algorithm: algorithm})
+	}
+	adapters = append(adapters, config.External...)
+
+	results := make([]AlgorithmResult, 0, len(adapters))
+	for _, adapter := range adapters {
+		log.Printf("🏁 [BENCH] %s: starting %d backends", adapter.Name(), len(config.Backends))
+		result, err := runAlgorithm(config, adapter, procs)
+		procs.stopAll()
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", adapter.Name(), err)
+		}
+		log.Printf("🏁 [BENCH] %s: %d requests, %.0f req/s, p99 %.2fms, %d errors",
+			adapter.Name(), result.Load.Requests, result.Load.Throughput, result.Load.Latency.P99, result.Load.Errors)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// RunTarget only drives load at a load balancer started elsewhere, such as one from a
+// generated topology. The distribution can't be measured without the backends' metrics.
+func RunTarget(config BenchmarkConfig, target string) ([]AlgorithmResult, error) {
+	if err := os.MkdirAll(config.OutDir, 0o755); err != nil {
+		return nil, err
+	}
+	target = strings.TrimSuffix(target, "/")
+	if err := waitReady(target + "/health"); err != nil {
+		return nil, err
+	}
+	result := AlgorithmResult{Algorithm: target, Scenario: config.Scenario}
+	if len(config.Algorithms) > 0 {
+		result.Algorithm = config.Algorithms[0]
+	}
+	log.Printf("🏁 [BENCH] %s: driving load at %s for %v", result.Algorithm, target, config.Duration)
+	result.Started = time.Now()
+	if build, err := fetchJSON(target + "/version"); err == nil {
+		result.Build = build
+	}
+	result.Load = GenerateLoad(target, config.loadSpec())
+	return []AlgorithmResult{result}, nil
+}
+
+// runAlgorithm starts the backends and load balancer, drives load and collects metrics
+func runAlgorithm(config BenchmarkConfig, adapter LBAdapter, procs *processes) (AlgorithmResult, error) {
+	algorithm := adapter.Name()
+	result := AlgorithmResult{
+		Algorithm:    algorithm,
+		WeightAware:  adapter.WeightAware(),
+		Scenario:     config.Scenario,
+		Distribution: make(map[string]int64),
+		Weights:      make(map[string]int),
+	}
+
+	var targets []TargetBackend
+	var backends []*backendProcess
+	for i, profile := range config.Backends {
+		port := config.BasePort + i
+		url := fmt.Sprintf("http://localhost:%d", port)
+		args := append([]string{"-port", strconv.Itoa(port), "-type", profile.Type}, profile.Args...)
+		if len(profile.Timeline) > 0 {
+			timelinePath := filepath.Join(config.OutDir, "logs", fmt.Sprintf("%s-backend-%d.timeline", algorithm, port))
+			if err := os.WriteFile(timelinePath, []byte(strings.Join(profile.Timeline, "\n")+"\n"), 0o644); err != nil {
+				return result, err
+			}
+			args = append(args, "-scenario", timelinePath)
+		}
+		logPath := filepath.Join(config.OutDir, "logs", fmt.Sprintf("%s-backend-%d.log", algorithm, port))
+		child, err := procs.start(logPath, config.BackendBinary, args...)
+		if err != nil {
+			return result, err
+		}
+		backends = append(backends, &backendProcess{
+			url: url, logPath: logPath, binary: config.BackendBinary, args: args, child: child,
+		})
+		target, err := newTargetBackend(url, profile.Weight)
+		if err != nil {
+			return result, err
+		}
+		targets = append(targets, target)
+		result.Weights[url] = profile.Weight
+	}
+	for url := range result.Weights {
+		if err := waitReady(url + "/health"); err != nil {
+			return result, err
+		}
+	}
+
+	lbURL := fmt.Sprintf("http://localhost:%d", config.LBPort)
+	if err := adapter.Start(procs, LBTarget{
+		Port:           config.LBPort,
+		Backends:       targets,
+		HealthInterval: max(1, config.HealthCheck),
+		Dir:            filepath.Join(config.OutDir, "logs", algorithm),
+		LogPath:        filepath.Join(config.OutDir, "logs", algorithm+"-lb.log"),
+	}); err != nil {
+		return result, err
+	}
+	if err := waitReady(lbURL + "/health"); err != nil {
+		return result, err
+	}
+
+	urls := make([]string, 0, len(result.Weights))
+	for url := range result.Weights {
+		urls = append(urls, url)
+	}
+	loadDone := make(chan struct{})
+	windows := make(chan []DistributionWindow)
+	events := make(chan []ChaosRecord)
+	go func() {
+		windows <- sampleDistribution(urls, config.metricPaths(), config.Window, config.Warmup, loadDone)
+	}()
+	result.Started = time.Now()
+	go func() {
+		events <- runChaos(backends, config.Chaos, procs, result.Started, loadDone)
+	}()
+	result.Load = GenerateLoad(lbURL, config.loadSpec())
+	close(loadDone)
+	result.Windows = <-windows
+	result.Events = <-events
+
+	stats, err := adapter.Stats(lbURL)
+	if err != nil {
+		return result, fmt.Errorf("collecting load balancer stats: %w", err)
+	}
+	result.LBStats = stats
+	if build, ok := stats["build"].(map[string]interface{}); ok {
+		result.Build = build
+	}
+
+	if config.Warmup > 0 {
+		// The backends' totals include the warm-up, so add up the steady-state windows
+		for url := range result.Weights {
+			result.Distribution[url] = 0
+		}
+		for _, window := range result.Windows {
+			if !window.Warmup {
+				for url, n := range window.Requests {
+					result.Distribution[url] += n
+				}
+			}
+		}
+		return result, nil
+	}
+	for url := range result.Weights {
+		served, err := backendRequests(url, config.metricPaths())
+		if err != nil {
+			return result, fmt.Errorf("collecting metrics from %s: %w", url, err)
+		}
+		result.Distribution[url] = served
+	}
+	return result, nil
+}
+
+// DistributionWindow holds the requests each backend served during one sampling window
+type DistributionWindow struct {
+	StartSeconds float64          `json:"start_seconds"`
+	EndSeconds   float64          `json:"end_seconds"`
+	Warmup       bool             `json:"warmup,omitempty"` // left out of Distribution
+	Requests     map[string]int64 `json:"requests"`
+}
+
+// sampleDistribution reads every backend's request count each window until stop is
+// closed, then takes a final sample, and returns the per-window deltas. The end of the
+// warm-up is always a window boundary.
+func sampleDistribution(urls, paths []string, window, warmup time.Duration, stop <-chan struct{}) []DistributionWindow {
+	if window <= 0 {
+		window = 5 * time.Second
+	}
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	var warmupDone <-chan time.Time
+	if warmup > 0 {
+		warmupDone = time.After(warmup)
+	}
+
+	start := time.Now()
+	last := start
+	previous := snapshotRequests(urls, paths, map[string]int64{})
+
+	var windows []DistributionWindow
+	for {
+		done, warming := false, false
+		select {
+		case <-ticker.C:
+			warming = warmupDone != nil
+		case <-warmupDone:
+			warming, warmupDone = true, nil
+			ticker.Reset(window)
+		case <-stop:
+			done = true
+		}
+
+		now := time.Now()
+		current := snapshotRequests(urls, paths, previous)
+		sample := DistributionWindow{
+			StartSeconds: last.Sub(start).Seconds(),
+			EndSeconds:   now.Sub(start).Seconds(),
+			Warmup:       warming,
+			Requests:     make(map[string]int64, len(urls)),
+		}
+		for _, url := range urls {
+			delta := current[url] - previous[url]
+			if delta < 0 {
+				delta = current[url] // the backend restarted and its counter began again
+			}
+			sample.Requests[url] = delta
+		}
+		windows = append(windows, sample)
+		previous, last = current, now
+		if done {
+			return windows
+		}
+	}
+}
+
+// snapshotRequests reads the request count of every backend, keeping the previous
+// count for backends that can't be reached
+func snapshotRequests(urls, paths []string, previous map[string]int64) map[string]int64 {
+	counts := make(map[string]int64, len(urls))
+	for _, url := range urls {
+		if n, err := backendRequests(url, paths); err == nil {
+			counts[url] = n
+		} else {
+			counts[url] = previous[url]
+		}
+	}
+	return counts
+}
+
+// waitReady polls url until it answers or 10 seconds pass
+func waitReady(url string) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("%s not ready after 10s", url)
+}
+
+// fetchJSON gets url and decodes a JSON object
+func fetchJSON(url string) (map[string]interface{}, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// backendRequests sums a backend's testbackend_requests_total samples for paths, all codes
+func backendRequests(url string, paths []string) (int64, error) {
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	prefixes := make([]string, len(paths))
+	for i, path := range paths {
+		prefixes[i] = fmt.Sprintf("testbackend_requests_total{path=%q,", path)
+	}
+	var total int64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(line, prefix) }) {
+			continue
+		}
+		fields := strings.Fields(line)
+		n, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad metrics line %q", line)
+		}
+		total += n
+	}
+	return total, scanner.Err()
+}
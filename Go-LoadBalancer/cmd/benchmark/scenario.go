@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scenario is a declarative experiment read from a YAML file (see parseYAML for the
+// subset understood), or from the equivalent JSON:
+//
+//	name: one backend degrades
+//	duration: 120s
+//	warmup: 10s
+//	algorithms: [weighted, least-connections]
+//	backends:
+//	  - type: fast
+//	    count: 4
+//	  - type: fast
+//	    timeline: ["at 60s: delay 500ms for 30s"]
+//	traffic:
+//	  concurrency: 50
+//	  path: /
+//	chaos:
+//	  - {at: 90s, backend: 2, action: kill, for: 15s}
+//	external:
+//	  - name: nginx
+//	  - name: haproxy
+//
+// Timelines use the TestBackend scenario syntax and are timed from backend startup,
+// which happens just before load starts; chaos events (see ChaosEvent) are timed from the
+// start of load.
+type Scenario struct {
+	Name       string            `json:"name"`
+	Duration   string            `json:"duration"`
+	Warmup     string            `json:"warmup"` // left out of the summaries
+	Algorithms []string          `json:"algorithms"`
+	Backends   []ScenarioBackend `json:"backends"`
+	Traffic    ScenarioTraffic   `json:"traffic"`
+	Chaos      []ChaosEvent      `json:"chaos"`
+	External   []ExternalLB      `json:"external"` // other load balancers to compare, see ExternalLB
+}
+
+// ScenarioBackend describes Count identical backends
+type ScenarioBackend struct {
+	Type     string   `json:"type"`
+	Weight   int      `json:"weight"`   // defaults to 1
+	Count    int      `json:"count"`    // defaults to 1
+	Args     []string `json:"args"`     // extra TestBackend flags
+	Timeline []string `json:"timeline"` // failure timeline entries
+}
+
+// ScenarioTraffic describes the load sent through the load balancer
+type ScenarioTraffic struct {
+	Concurrency int               `json:"concurrency"`
+	Path        string            `json:"path"`
+	Mode        string            `json:"mode"` // "closed" or "open", see LoadSpec
+	Rate        float64           `json:"rate"` // open loop requests per second
+	Mix         []RequestTemplate `json:"mix"`  // replaces path, see RequestTemplate
+}
+
+// LoadScenario reads and validates a scenario file, which is JSON if its name ends in
+// .json and YAML otherwise
+func LoadScenario(path string) (Scenario, error) {
+	var scenario Scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario, err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		// The YAML is decoded through JSON, so both formats share the json tags
+		document, err := parseYAML(data)
+		if err != nil {
+			return scenario, fmt.Errorf("invalid YAML: %w", err)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return scenario, err
+		}
+	}
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return scenario, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if len(scenario.Backends) == 0 {
+		return scenario, fmt.Errorf("scenario has no backends")
+	}
+	for i, backend := range scenario.Backends {
+		if backend.Type == "" {
+			return scenario, fmt.Errorf("backend %d has no type", i+1)
+		}
+		if backend.Weight < 0 || backend.Count < 0 {
+			return scenario, fmt.Errorf("backend %d: weight and count must not be negative", i+1)
+		}
+	}
+	if scenario.Traffic.Concurrency < 0 {
+		return scenario, fmt.Errorf("traffic concurrency must not be negative")
+	}
+	if err := ValidateMix(scenario.Traffic.Mix); err != nil {
+		return scenario, err
+	}
+	if scenario.Traffic.Mode != "" {
+		if err := validateLoadMode(scenario.Traffic.Mode, scenario.Traffic.Rate); err != nil {
+			return scenario, err
+		}
+	}
+	if scenario.Duration != "" {
+		if d, err := time.ParseDuration(scenario.Duration); err != nil || d <= 0 {
+			return scenario, fmt.Errorf("invalid duration %q", scenario.Duration)
+		}
+	}
+	if scenario.Warmup != "" {
+		if d, err := time.ParseDuration(scenario.Warmup); err != nil || d < 0 {
+			return scenario, fmt.Errorf("invalid warmup %q", scenario.Warmup)
+		}
+	}
+	backends := 0
+	for _, backend := range scenario.Backends {
+		backends += max(1, backend.Count)
+	}
+	if _, err := ParseChaos(scenario.Chaos, backends); err != nil {
+		return scenario, err
+	}
+	for _, external := range scenario.External {
+		if _, err := NewExternalLB(external); err != nil {
+			return scenario, err
+		}
+	}
+	return scenario, nil
+}
+
+// validateLoadMode checks a load mode and its arrival rate
+func validateLoadMode(mode string, rate float64) error {
+	switch mode {
+	case "closed":
+		return nil
+	case "open":
+		if rate <= 0 {
+			return fmt.Errorf("open loop load needs a positive rate")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown load mode %q (use closed or open)", mode)
+}
+
+// Apply overrides config with everything the scenario specifies (LoadScenario has validated it)
+func (s Scenario) Apply(config *BenchmarkConfig) {
+	if s.Duration != "" {
+		config.Duration, _ = time.ParseDuration(s.Duration)
+	}
+	if s.Warmup != "" {
+		config.Warmup, _ = time.ParseDuration(s.Warmup)
+	}
+	if len(s.Algorithms) > 0 {
+		config.Algorithms = s.Algorithms
+	}
+	if len(s.External) > 0 {
+		config.External = nil
+		for _, external := range s.External {
+			adapter, _ := NewExternalLB(external)
+			config.External = append(config.External, adapter)
+		}
+	}
+	if s.Traffic.Concurrency > 0 {
+		config.Concurrency = s.Traffic.Concurrency
+	}
+	if s.Traffic.Path != "" {
+		config.Path = s.Traffic.Path
+	}
+	if len(s.Traffic.Mix) > 0 {
+		config.Mix = s.Traffic.Mix
+	}
+	if s.Traffic.Mode != "" {
+		config.LoadMode, config.Rate = s.Traffic.Mode, s.Traffic.Rate
+	}
+
+	config.Backends = nil
+	for _, backend := range s.Backends {
+		profile := BackendProfile{
+			Type:     backend.Type,
+			Weight:   max(1, backend.Weight),
+			Args:     backend.Args,
+			Timeline: backend.Timeline,
+		}
+		for i := 0; i < max(1, backend.Count); i++ {
+			config.Backends = append(config.Backends, profile)
+		}
+	}
+	config.Chaos, _ = ParseChaos(s.Chaos, len(config.Backends))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLMatchesJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		json string
+	}{
+		{"scalars", `
+string: plain text
+quoted: "at 60s: down # not a comment"
+single: 'it''s'
+number: 262144
+fraction: -0.25
+bool: true
+null: ~
+empty:
+version: 1.2.3 # a comment
+`, `{"string": "plain text", "quoted": "at 60s: down # not a comment", "single": "it's",
+			"number": 262144, "fraction": -0.25, "bool": true, "null": null, "empty": null,
+			"version": "1.2.3"}`},
+		{"nesting", `
+---
+backends:
+- type: fast
+  count: 2
+- type: slow
+  timeline:
+    - "at 1s: down"
+    -
+      nested: true
+- - a
+  - b
+traffic: {concurrency: 5, path: /, mix: [{path: /a, weight: 2}, "/b"]}
+empty: []
+`, `{"backends": [{"type": "fast", "count": 2}, {"type": "slow", "timeline": ["at 1s: down", {"nested": true}]}, ["a", "b"]],
+			"traffic": {"concurrency": 5, "path": "/", "mix": [{"path": "/a", "weight": 2}, "/b"]}, "empty": []}`},
+		{"json", `{"at": "30s", "backend": 2, "action": "pause", "for": "10s"}`,
+			`{"at": "30s", "backend": 2, "action": "pause", "for": "10s"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.json), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %#v\nwant %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want string
+	}{
+		{"a: 1\n  b: 2", "line 2: unexpected indentation"},
+		{"a: 1\na: 2", "line 2: duplicate key"},
+		{"a: 1\n- b", "line 2: sequence item"},
+		{"a:\n\tb: 1", "line 2: indent with spaces"},
+		{"just text", "line 1: expected \"key: value\""},
+		{"a: [1, 2", "line 1: missing ']'"},
+		{"a: \"open", "line 1: unterminated string"},
+		{"a: |\n  text", "line 1: unsupported YAML"},
+		{"a: &anchor 1", "line 1: unsupported YAML"},
+	}
+	for _, tt := range tests {
+		if _, err := parseYAML([]byte(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseYAML(%q) error %v, want %q", tt.yaml, err, tt.want)
+		}
+	}
+}
+
+func TestExampleScenariosLoad(t *testing.T) {
+	paths, err := filepath.Glob("scenarios/*.yaml")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no example scenarios: %v", err)
+	}
+	for _, path := range paths {
+		if _, err := LoadScenario(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+
+	// The same scenario in JSON
+	jsonPath := filepath.Join(t.TempDir(), "mixed-workload.json")
+	if err := os.WriteFile(jsonPath, []byte(mixedWorkloadJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := LoadScenario(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := LoadScenario("scenarios/mixed-workload.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("YAML scenario %+v\ndiffers from JSON %+v", fromYAML, fromJSON)
+	}
+}
+
+const mixedWorkloadJSON = `
+{
+  "name": "mixed workload: root, slow reads, uploads and downloads",
+  "duration": "60s",
+  "algorithms": ["round-robin", "least-connections"],
+  "backends": [
+    {"type": "fast", "count": 3},
+    {"type": "balanced", "count": 2}
+  ],
+  "traffic": {
+    "concurrency": 40,
+    "mix": [
+      {"path": "/", "weight": 70},
+      {"name": "slow read", "path": "/slow?size=512&write_bps=2048", "weight": 15},
+      {"name": "upload", "method": "POST", "path": "/upload", "body_bytes": 262144, "weight": 10,
+       "headers": {"Content-Type": "application/octet-stream"}},
+      {"name": "download", "path": "/download?size=1MB", "weight": 5}
+    ]
+  }
+}
+`
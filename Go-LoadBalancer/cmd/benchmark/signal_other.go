@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// pauseProcess is unsupported on this platform
+func pauseProcess(p *os.Process) error {
+	return errors.New("pausing processes is not supported on this platform")
+}
+
+// resumeProcess is unsupported on this platform
+func resumeProcess(p *os.Process) error {
+	return errors.New("resuming processes is not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseProcess freezes a process with SIGSTOP; it keeps its sockets but stops responding
+func pauseProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// resumeProcess continues a process paused with pauseProcess
+func resumeProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// topology is the comparison environment a BenchmarkConfig describes: every backend,
+// one load balancer per algorithm, and a load generator run per load balancer
+type topology struct {
+	config   BenchmarkConfig
+	backends []topologyBackend
+}
+
+// topologyBackend is one backend process or container
+type topologyBackend struct {
+	name     string
+	port     int
+	weight   int
+	args     []string
+	timeline string // timeline file name, if the profile has a timeline
+}
+
+// lbPort returns the port of the i-th algorithm's load balancer
+func (t topology) lbPort(i int) int {
+	return t.config.LBPort + i
+}
+
+// GenerateTopology writes the environment described by config into dir, as a
+// docker-compose.yml ("compose") or a Procfile for foreman, honcho or overmind
+// ("procfile"). Backend timelines and the traffic mix are written next to it. The load balancers share one
+// set of backends, so unlike a benchmark run, state carries over between algorithms.
+// Chaos events and external load balancers are left to the orchestrator.
+func GenerateTopology(config BenchmarkConfig, format, sourceDir, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	t := topology{config: config}
+	for i, profile := range config.Backends {
+		backend := topologyBackend{
+			name:   fmt.Sprintf("backend-%d", i+1),
+			port:   config.BasePort + i,
+			weight: profile.Weight,
+			args:   append([]string{"-type", profile.Type}, profile.Args...),
+		}
+		if len(profile.Timeline) > 0 {
+			backend.timeline = backend.name + ".timeline"
+			timeline := strings.Join(profile.Timeline, "\n") + "\n"
+			if err := os.WriteFile(filepath.Join(dir, backend.timeline), []byte(timeline), 0o644); err != nil {
+				return "", err
+			}
+		}
+		t.backends = append(t.backends, backend)
+	}
+
+	if len(config.Mix) > 0 {
+		data, err := json.MarshalIndent(config.Mix, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "mix.json"), data, 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	var path, content string
+	var err error
+	switch format {
+	case "compose":
+		path = filepath.Join(dir, "docker-compose.yml")
+		content, err = t.compose(sourceDir)
+	case "procfile":
+		path = filepath.Join(dir, "Procfile")
+		content, err = t.procfile(dir)
+	default:
+		return "", fmt.Errorf("unknown topology format %q (use compose or procfile)", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte(content), 0o644)
+}
+
+// backendList returns the -backends value for a load balancer, with host(i) naming backend i
+func (t topology) backendList(host func(i int) string) string {
+	list := make([]string, len(t.backends))
+	for i, backend := range t.backends {
+		list[i] = fmt.Sprintf("http://%s:%d=%d", host(i), backend.port, backend.weight)
+	}
+	return strings.Join(list, ",")
+}
+
+// loadArgs returns the benchmark flags that drive load at the i-th load balancer, with
+// the traffic mix read from mixPath when there is one
+func (t topology) loadArgs(i int, host, resultsDir, mixPath string) []string {
+	args := []string{
+		"-target", fmt.Sprintf("http://%s:%d", host, t.lbPort(i)),
+		"-algorithms", t.config.Algorithms[i],
+		"-duration", t.config.Duration.String(),
+		"-warmup", t.config.Warmup.String(),
+		"-window", t.config.Window.String(),
+		"-concurrency", strconv.Itoa(t.config.Concurrency),
+		"-mode", t.config.LoadMode,
+		"-rate", strconv.FormatFloat(t.config.Rate, 'g', -1, 64),
+		"-path", t.config.Path,
+		"-out", filepath.Join(resultsDir, t.config.Algorithms[i]),
+	}
+	if len(t.config.Mix) > 0 {
+		args = append(args, "-mix", mixPath)
+	}
+	return args
+}
+
+// composeDockerfile builds a module's binaries into a small image
+const composeDockerfile = `FROM golang:1.24 AS build
+WORKDIR /src
+COPY . .
+RUN CGO_ENABLED=0 go build -o /out/ %s
+FROM gcr.io/distroless/static
+COPY --from=build /out/ /bin/
+`
+
+// compose renders a docker-compose.yml building images from the repository at sourceDir
+func (t topology) compose(sourceDir string) (string, error) {
+	root, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return "", err
+	}
+	for _, module := range []string{"TestBackend", "Go-LoadBalancer"} {
+		if _, err := os.Stat(filepath.Join(root, module, "go.mod")); err != nil {
+			return "", fmt.Errorf("%s is not the repository root (no %s module)", root, module)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by benchmark -generate compose; load generator results go to ./results\n")
+	fmt.Fprintf(&b, "name: %s\n\n", composeName(t.config.Scenario))
+	// Every service of a module shares one build definition through a YAML anchor
+	for _, image := range []struct{ anchor, module, packages string }{
+		{"testbackend", "TestBackend", "."},
+		{"go-loadbalancer", "Go-LoadBalancer", ". ./cmd/benchmark"},
+	} {
+		fmt.Fprintf(&b, "x-%s: &%s\n  context: %q\n  dockerfile_inline: |\n", image.anchor, image.anchor, filepath.Join(root, image.module))
+		for _, line := range strings.Split(strings.TrimSpace(fmt.Sprintf(composeDockerfile, image.packages)), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("services:\n")
+	build := func(anchor string) {
+		fmt.Fprintf(&b, "    image: lbcompare/%s\n    build: *%s\n", anchor, anchor)
+	}
+	command := func(args ...string) {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = strconv.Quote(arg)
+		}
+		fmt.Fprintf(&b, "    command: [%s]\n", strings.Join(quoted, ", "))
+	}
+
+	for _, backend := range t.backends {
+		fmt.Fprintf(&b, "  %s:\n", backend.name)
+		build("testbackend")
+		args := append([]string{"/bin/TestBackend", "-port", strconv.Itoa(backend.port)}, backend.args...)
+		if backend.timeline != "" {
+			args = append(args, "-scenario", "/etc/testbackend/timeline")
+			fmt.Fprintf(&b, "    volumes:\n      - ./%s:/etc/testbackend/timeline:ro\n", backend.timeline)
+		}
+		command(args...)
+		fmt.Fprintf(&b, "    ports:\n      - \"%d:%d\"\n\n", backend.port, backend.port)
+	}
+
+	for i, algorithm := range t.config.Algorithms {
+		fmt.Fprintf(&b, "  lb-%s:\n", algorithm)
+		build("go-loadbalancer")
+		command("/bin/Go-LoadBalancer",
+			"-port", strconv.Itoa(t.lbPort(i)),
+			"-algorithm", algorithm,
+			"-backends", t.backendList(func(i int) string { return t.backends[i].name }),
+			"-health-interval", strconv.Itoa(max(1, t.config.HealthCheck)))
+		fmt.Fprintf(&b, "    depends_on: [%s]\n", strings.Join(t.backendNames(), ", "))
+		fmt.Fprintf(&b, "    ports:\n      - \"%d:%d\"\n\n", t.lbPort(i), t.lbPort(i))
+	}
+
+	// One load generator per load balancer, each waiting for the previous to finish so
+	// the algorithms are measured one at a time
+	for i, algorithm := range t.config.Algorithms {
+		fmt.Fprintf(&b, "  load-%s:\n", algorithm)
+		build("go-loadbalancer")
+		command(append([]string{"/bin/benchmark"}, t.loadArgs(i, "lb-"+algorithm, "/results", "/etc/benchmark/mix.json")...)...)
+		fmt.Fprintf(&b, "    depends_on:\n      lb-%s:\n        condition: service_started\n", algorithm)
+		if i > 0 {
+			fmt.Fprintf(&b, "      load-%s:\n        condition: service_completed_successfully\n", t.config.Algorithms[i-1])
+		}
+		fmt.Fprintf(&b, "    volumes:\n      - ./results:/results\n")
+		if len(t.config.Mix) > 0 {
+			fmt.Fprintf(&b, "      - ./mix.json:/etc/benchmark/mix.json:ro\n")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// backendNames lists the backend service names
+func (t topology) backendNames() []string {
+	names := make([]string, len(t.backends))
+	for i, backend := range t.backends {
+		names[i] = backend.name
+	}
+	return names
+}
+
+// composeName turns a scenario name into a compose project name
+func composeName(scenario string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, scenario)
+	if name = strings.Trim(name, "-"); name == "" {
+		return "lb-comparison"
+	}
+	return name
+}
+
+// procfile renders a Procfile running the built binaries on localhost. The load
+// generators run one after another in a single process entry.
+func (t topology) procfile(dir string) (string, error) {
+	backendBinary, err := filepath.Abs(t.config.BackendBinary)
+	if err != nil {
+		return "", err
+	}
+	lbBinary, err := filepath.Abs(t.config.LBBinary)
+	if err != nil {
+		return "", err
+	}
+	benchmarkBinary, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	outDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by benchmark -generate procfile\n")
+	line := func(name string, args ...string) {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, strings.Join(quoted, " "))
+	}
+	for _, backend := range t.backends {
+		args := append([]string{backendBinary, "-port", strconv.Itoa(backend.port)}, backend.args...)
+		if backend.timeline != "" {
+			args = append(args, "-scenario", filepath.Join(outDir, backend.timeline))
+		}
+		line(backend.name, args...)
+	}
+	localhost := func(int) string { return "localhost" }
+	for i, algorithm := range t.config.Algorithms {
+		line("lb-"+algorithm, lbBinary,
+			"-port", strconv.Itoa(t.lbPort(i)),
+			"-algorithm", algorithm,
+			"-backends", t.backendList(localhost),
+			"-health-interval", strconv.Itoa(max(1, t.config.HealthCheck)))
+	}
+
+	var runs []string
+	for i := range t.config.Algorithms {
+		args := append([]string{benchmarkBinary}, t.loadArgs(i, "localhost", filepath.Join(outDir, "results"), filepath.Join(outDir, "mix.json"))...)
+		quoted := make([]string, len(args))
+		for j, arg := range args {
+			quoted[j] = shellQuote(arg)
+		}
+		runs = append(runs, strings.Join(quoted, " "))
+	}
+	fmt.Fprintf(&b, "load: sh -c %s\n", shellQuote(strings.Join(runs, " && ")))
+	return b.String(), nil
+}
+
+// shellQuote quotes s for sh when it contains anything but safe characters
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
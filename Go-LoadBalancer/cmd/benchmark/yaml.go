@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML scenarios are written in into the values
+// encoding/json decodes the equivalent JSON to, so one set of json tags describes both
+// formats. Supported are block mappings and sequences indented with spaces, flow
+// sequences and mappings on a single line, plain, single- and double-quoted scalars, and
+// comments. Anchors, tags, multi-line scalars and multiple documents are not.
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripYAMLComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (trimmed == "---" && len(p.lines) == 0) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+
+	value, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return value, nil
+}
+
+// yamlLine is a non-blank line with its comment and indentation removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses a block at a time, consuming lines from pos
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	line := p.lines[len(p.lines)-1].number
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].number
+	}
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// isSequenceItem reports whether a line starts an item of a block sequence
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock parses the mapping or sequence whose lines are indented by indent, or a
+// flow collection on a line of its own
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	text := p.lines[p.pos].text
+	switch {
+	case isSequenceItem(text):
+		return p.parseSequence(indent)
+	case text[0] == '[' || text[0] == '{':
+		value, err := parseYAMLInline(text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos++
+		return value, nil
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+
+		var item interface{}
+		var err error
+		switch _, _, isKey := splitYAMLKey(rest); {
+		case rest == "":
+			p.pos++
+			item, err = p.parseNested(indent)
+		case isKey || isSequenceItem(rest):
+			// "- key: value" starts a mapping indented to where its first key is, and
+			// "- - item" a sequence
+			p.lines[p.pos] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.parseBlock(p.lines[p.pos].indent)
+		default:
+			item, err = parseYAMLInline(rest)
+			if err != nil {
+				err = p.errorf("%v", err)
+			}
+			p.pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if isSequenceItem(line.text) {
+			return nil, p.errorf("sequence item where a key was expected")
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\"")
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		var value interface{}
+		var err error
+		if rest == "" {
+			// A sequence may sit at its key's indentation
+			if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+				value, err = p.parseSequence(indent)
+			} else {
+				value, err = p.parseNested(indent)
+			}
+		} else if value, err = parseYAMLInline(rest); err != nil {
+			p.pos--
+			err = p.errorf("%v", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+	return mapping, nil
+}
+
+// parseNested parses the block indented further than parent, or returns null if the
+// next line isn't
+func (p *yamlParser) parseNested(parent int) (interface{}, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= parent {
+		return nil, nil
+	}
+	return p.parseBlock(p.lines[p.pos].indent)
+}
+
+// splitYAMLKey splits "key: value" (or "key:") into its key and value text
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		s := &flowScanner{text: text}
+		quoted, err := s.quoted()
+		if err != nil {
+			return "", "", false
+		}
+		after := text[s.pos:]
+		if after == ":" || strings.HasPrefix(after, ": ") {
+			return quoted, strings.TrimSpace(after[1:]), true
+		}
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return text[:len(text)-1], "", true
+	}
+	key, rest, ok = strings.Cut(text, ": ")
+	return key, strings.TrimSpace(rest), ok
+}
+
+// stripYAMLComment drops a comment: a # at the start of a line or after whitespace,
+// outside quotes
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// parseYAMLInline parses the value after "key: " or "- ": a scalar or a flow collection
+func parseYAMLInline(text string) (interface{}, error) {
+	if strings.ContainsRune("|>&*!%@`", rune(text[0])) {
+		return nil, fmt.Errorf("unsupported YAML %q", text)
+	}
+	if text[0] != '[' && text[0] != '{' && text[0] != '"' && text[0] != '\'' {
+		return yamlScalar(text), nil
+	}
+	s := &flowScanner{text: text}
+	value, err := s.value()
+	if err != nil {
+		return nil, err
+	}
+	if s.skipSpaces(); s.pos < len(s.text) {
+		return nil, fmt.Errorf("unexpected %q after value", s.text[s.pos:])
+	}
+	return value, nil
+}
+
+// flowScanner parses flow collections and quoted scalars
+type flowScanner struct {
+	text string
+	pos  int
+}
+
+func (s *flowScanner) skipSpaces() {
+	for s.pos < len(s.text) && s.text[s.pos] == ' ' {
+		s.pos++
+	}
+}
+
+func (s *flowScanner) value() (interface{}, error) {
+	s.skipSpaces()
+	if s.pos >= len(s.text) {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch s.text[s.pos] {
+	case '[':
+		return s.sequence()
+	case '{':
+		return s.mapping()
+	case '"', '\'':
+		return s.quoted()
+	}
+	return yamlScalar(s.plain()), nil
+}
+
+func (s *flowScanner) sequence() (interface{}, error) {
+	items := []interface{}{}
+	s.pos++ // [
+	for {
+		s.skipSpaces()
+		if s.pos < len(s.text) && s.text[s.pos] == ']' {
+			s.pos++
+			return items, nil
+		}
+		item, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if err := s.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *flowScanner) mapping() (interface{}, error) {
+	mapping := map[string]interface{}{}
+	s.pos++ // {
+	for {
+		s.skipSpaces()
+		if s.pos < len(s.text) && s.text[s.pos] == '}' {
+			s.pos++
+			return mapping, nil
+		}
+		var key string
+		if s.pos < len(s.text) && (s.text[s.pos] == '"' || s.text[s.pos] == '\'') {
+			quoted, err := s.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = quoted
+		} else {
+			key = s.plain()
+		}
+		if s.skipSpaces(); s.pos >= len(s.text) || s.text[s.pos] != ':' {
+			return nil, fmt.Errorf("expected \":\" after key %q", key)
+		}
+		s.pos++
+		value, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		mapping[key] = value
+		if err := s.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the "," between flow items, leaving the closing bracket
+func (s *flowScanner) separator(closing byte) error {
+	s.skipSpaces()
+	switch {
+	case s.pos >= len(s.text):
+		return fmt.Errorf("missing %q", closing)
+	case s.text[s.pos] == ',':
+		s.pos++
+	case s.text[s.pos] != closing:
+		return fmt.Errorf("expected \",\" or %q, found %q", closing, s.text[s.pos])
+	}
+	return nil
+}
+
+// plain reads an unquoted scalar up to the next flow indicator or ": "
+func (s *flowScanner) plain() string {
+	start := s.pos
+	for s.pos < len(s.text) {
+		c := s.text[s.pos]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if c == ':' && (s.pos+1 == len(s.text) || strings.ContainsRune(" ,]}", rune(s.text[s.pos+1]))) {
+			break
+		}
+		s.pos++
+	}
+	return strings.TrimSpace(s.text[start:s.pos])
+}
+
+// quoted reads a double-quoted scalar, with Go-style escapes, or a single-quoted one, in
+// which ” is a quote
+func (s *flowScanner) quoted() (string, error) {
+	quote := s.text[s.pos]
+	for end := s.pos + 1; end < len(s.text); end++ {
+		switch c := s.text[end]; {
+		case c == '\\' && quote == '"':
+			end++
+		case c == quote && quote == '\'' && end+1 < len(s.text) && s.text[end+1] == '\'':
+			end++
+		case c == quote:
+			raw := s.text[s.pos : end+1]
+			s.pos = end + 1
+			if quote == '\'' {
+				return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'"), nil
+			}
+			unquoted, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", fmt.Errorf("invalid string %s", raw)
+			}
+			return unquoted, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string %s", s.text[s.pos:])
+}
+
+// yamlNumber matches the plain scalars that are numbers, in the form JSON writes them
+var yamlNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// yamlScalar resolves a plain scalar to null, a boolean, a number or a string
+func yamlScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if yamlNumber.MatchString(text) {
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	}
+	return text
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client calls the load balancer's admin API
+type client struct {
+	base     string
+	token    string
+	username string
+	password string
+	http     *http.Client
+}
+
+// newClient creates a client for the load balancer at base; credentials are a bearer
+// token or "user:password" for basic auth, either may be empty
+func newClient(base, token, userPassword string) *client {
+	c := &client{
+		base:  strings.TrimSuffix(base, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+	if userPassword != "" {
+		c.username, c.password, _ = strings.Cut(userPassword, ":")
+	}
+	return c
+}
+
+// do sends a request with body encoded as JSON (when not nil) and decodes the JSON
+// response into out (when not nil)
+func (c *client) do(method, path string, query url.Values, body, out interface{}) error {
+	target := c.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// backend is a backend as reported by /admin/backends
+type backend struct {
+	URL               string `json:"url"`
+	Weight            int    `json:"weight"`
+	EffectiveWeight   int    `json:"effective_weight"`
+	Alive             bool   `json:"alive"`
+	CircuitOpen       bool   `json:"circuit_open"`
+	Draining          bool   `json:"draining"`
+	Available         bool   `json:"available"`
+	Connections       int64  `json:"connections"`
+	ConsecutiveErrors int64  `json:"consecutive_errors"`
+}
+
+// poolBackends is the /admin/backends listing of one pool
+type poolBackends struct {
+	Pool      string    `json:"pool"`
+	Algorithm string    `json:"algorithm"`
+	Backends  []backend `json:"backends"`
+}
+
+// event is one entry of /admin/events
+type event struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Pool    string    `json:"pool"`
+	Backend string    `json:"backend"`
+	Message string    `json:"message"`
+}
+
+// eventPage is an /admin/events response
+type eventPage struct {
+	Events []event `json:"events"`
+	Last   int64   `json:"last"`
+}
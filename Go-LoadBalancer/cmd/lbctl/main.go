@@ -0,0 +1,334 @@
+// Command lbctl drives a running load balancer through its admin API.
+//
+//	go build -o bin/lbctl ./Go-LoadBalancer/cmd/lbctl
+//	bin/lbctl backends
+//	bin/lbctl add http://localhost:3007 3
+//	bin/lbctl weight http://localhost:3002 5
+//	bin/lbctl drain http://localhost:3003
+//	bin/lbctl trip http://localhost:3004
+//	bin/lbctl algorithm least-connections
+//	bin/lbctl events -f
+//	bin/lbctl lb-drain && bin/lbctl lb-drain status
+//
+// The load balancer URL and credentials default from LBCTL_URL, LBCTL_TOKEN and LBCTL_USER.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// command is one lbctl subcommand
+type command struct {
+	usage string
+	help  string
+	run   func(c *client, args []string) error
+}
+
+// options are the global flags the subcommands share
+var options struct {
+	pool string
+	json bool
+}
+
+var commands = map[string]command{
+	"backends":  {"backends", "list the pool's backends", listBackends},
+	"add":       {"add URL [WEIGHT]", "add a backend (weight 1 by default)", addBackend},
+	"remove":    {"remove URL", "remove a backend", removeBackend},
+	"weight":    {"weight URL WEIGHT", "change a backend's weight", setWeight},
+	"drain":     {"drain URL", "stop sending new requests to a backend", updateFlag("drain", map[string]interface{}{"draining": true})},
+	"undrain":   {"undrain URL", "put a drained backend back into rotation", updateFlag("undrain", map[string]interface{}{"draining": false})},
+	"trip":      {"trip URL", "open a backend's circuit breaker", updateFlag("trip", map[string]interface{}{"circuit": "open"})},
+	"reset":     {"reset URL", "close a backend's circuit breaker", updateFlag("reset", map[string]interface{}{"circuit": "closed"})},
+	"algorithm": {"algorithm [NAME]", "show or switch the load balancing algorithm", algorithm},
+	"events":    {"events [-f]", "print recent events; -f follows new ones", events},
+	"lb-drain":  {"lb-drain [status|cancel]", "drain the whole load balancer, show progress or cancel", lbDrain},
+}
+
+var commandOrder = []string{"backends", "add", "remove", "weight", "drain", "undrain", "trip", "reset", "algorithm", "events", "lb-drain"}
+
+func main() {
+	lbURL := flag.String("lb", envOr("LBCTL_URL", "http://localhost:3030"), "load balancer URL")
+	token := flag.String("token", os.Getenv("LBCTL_TOKEN"), "admin API bearer token")
+	user := flag.String("user", os.Getenv("LBCTL_USER"), "admin API basic auth as user:password")
+	flag.StringVar(&options.pool, "pool", "main", "backend pool: main, quarantine or variant:<name>")
+	flag.BoolVar(&options.json, "json", false, "print raw JSON responses")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "lbctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(newClient(*lbURL, *token, *user), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "lbctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the flags and subcommands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: lbctl [flags] COMMAND [ARGS]\n\nCommands:\n")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range commandOrder {
+		fmt.Fprintf(w, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// envOr returns the environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// wantArgs checks a subcommand got between min and max arguments
+func wantArgs(args []string, min, max int, usage string) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("usage: lbctl %s", usage)
+	}
+	return nil
+}
+
+// printJSON pretty prints a response
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printBackend prints a backend after a change
+func printBackend(b backend) error {
+	if options.json {
+		return printJSON(b)
+	}
+	fmt.Printf("%s weight=%d state=%s connections=%d\n", b.URL, b.Weight, state(b), b.Connections)
+	return nil
+}
+
+// state summarizes why a backend does or doesn't get requests
+func state(b backend) string {
+	switch {
+	case b.Draining:
+		return "draining"
+	case !b.Alive:
+		return "down"
+	case b.CircuitOpen:
+		return "circuit-open"
+	}
+	return "up"
+}
+
+func listBackends(c *client, args []string) error {
+	if err := wantArgs(args, 0, 0, "backends"); err != nil {
+		return err
+	}
+	var pool poolBackends
+	if err := c.do(http.MethodGet, "/admin/backends", url.Values{"pool": {options.pool}}, nil, &pool); err != nil {
+		return err
+	}
+	if options.json {
+		return printJSON(pool)
+	}
+	fmt.Printf("Pool %s (%s)\n", pool.Pool, pool.Algorithm)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tWEIGHT\tEFFECTIVE\tSTATE\tCONNECTIONS\tERRORS")
+	for _, b := range pool.Backends {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%d\n", b.URL, b.Weight, b.EffectiveWeight, state(b), b.Connections, b.ConsecutiveErrors)
+	}
+	return w.Flush()
+}
+
+func addBackend(c *client, args []string) error {
+	if err := wantArgs(args, 1, 2, "add URL [WEIGHT]"); err != nil {
+		return err
+	}
+	weight := 1
+	if len(args) == 2 {
+		var err error
+		if weight, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid weight %q", args[1])
+		}
+	}
+	var b backend
+	body := map[string]interface{}{"pool": options.pool, "url": args[0], "weight": weight}
+	if err := c.do(http.MethodPost, "/admin/backends", nil, body, &b); err != nil {
+		return err
+	}
+	return printBackend(b)
+}
+
+func removeBackend(c *client, args []string) error {
+	if err := wantArgs(args, 1, 1, "remove URL"); err != nil {
+		return err
+	}
+	var b backend
+	if err := c.do(http.MethodDelete, "/admin/backends", url.Values{"pool": {options.pool}, "url": {args[0]}}, nil, &b); err != nil {
+		return err
+	}
+	fmt.Printf("removed %s\n", b.URL)
+	return nil
+}
+
+func setWeight(c *client, args []string) error {
+	if err := wantArgs(args, 2, 2, "weight URL WEIGHT"); err != nil {
+		return err
+	}
+	weight, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", args[1])
+	}
+	var b backend
+	body := map[string]interface{}{"pool": options.pool, "url": args[0], "weight": weight}
+	if err := c.do(http.MethodPut, "/admin/backends", nil, body, &b); err != nil {
+		return err
+	}
+	return printBackend(b)
+}
+
+// updateFlag returns a subcommand that applies a fixed change to the backend named by its argument
+func updateFlag(name string, change map[string]interface{}) func(c *client, args []string) error {
+	return func(c *client, args []string) error {
+		if err := wantArgs(args, 1, 1, name+" URL"); err != nil {
+			return err
+		}
+		body := map[string]interface{}{"pool": options.pool, "url": args[0]}
+		for key, value := range change {
+			body[key] = value
+		}
+		var b backend
+		if err := c.do(http.MethodPut, "/admin/backends", nil, body, &b); err != nil {
+			return err
+		}
+		return printBackend(b)
+	}
+}
+
+func algorithm(c *client, args []string) error {
+	if err := wantArgs(args, 0, 1, "algorithm [NAME]"); err != nil {
+		return err
+	}
+	var resp struct {
+		Algorithm string   `json:"algorithm"`
+		Name      string   `json:"name"`
+		Available []string `json:"available"`
+	}
+	var err error
+	if len(args) == 1 {
+		err = c.do(http.MethodPut, "/admin/algorithm", nil, map[string]string{"algorithm": args[0]}, &resp)
+	} else {
+		err = c.do(http.MethodGet, "/admin/algorithm", nil, nil, &resp)
+	}
+	if err != nil {
+		return err
+	}
+	if options.json {
+		return printJSON(resp)
+	}
+	fmt.Printf("%s (%s)\n", resp.Algorithm, resp.Name)
+	return nil
+}
+
+func lbDrain(c *client, args []string) error {
+	if err := wantArgs(args, 0, 1, "lb-drain [status|cancel]"); err != nil {
+		return err
+	}
+	method := http.MethodPost
+	if len(args) == 1 {
+		switch args[0] {
+		case "status":
+			method = http.MethodGet
+		case "cancel":
+			method = http.MethodDelete
+		default:
+			return fmt.Errorf("usage: lbctl lb-drain [status|cancel]")
+		}
+	}
+	var progress struct {
+		Draining     bool    `json:"draining"`
+		Drained      bool    `json:"drained"`
+		InFlight     int64   `json:"in_flight"`
+		Rejected     int64   `json:"rejected"`
+		Elapsed      float64 `json:"elapsed_seconds"`
+		DrainSeconds float64 `json:"drain_seconds"`
+	}
+	if err := c.do(method, "/admin/drain", nil, nil, &progress); err != nil {
+		return err
+	}
+	if options.json {
+		return printJSON(progress)
+	}
+	switch {
+	case !progress.Draining:
+		fmt.Println("serving")
+	case progress.Drained:
+		fmt.Printf("drained in %.1fs (%d requests rejected)\n", progress.DrainSeconds, progress.Rejected)
+	default:
+		fmt.Printf("draining for %.1fs: %d in flight, %d rejected\n", progress.Elapsed, progress.InFlight, progress.Rejected)
+	}
+	return nil
+}
+
+func events(c *client, args []string) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	follow := flags.Bool("f", false, "keep printing new events")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := wantArgs(flags.Args(), 0, 0, "events [-f]"); err != nil {
+		return err
+	}
+
+	var since int64
+	for first := true; ; first = false {
+		query := url.Values{"since": {strconv.FormatInt(since, 10)}}
+		if !first {
+			query.Set("wait", "10s")
+		}
+		var page eventPage
+		if err := c.do(http.MethodGet, "/admin/events", query, nil, &page); err != nil {
+			return err
+		}
+		for _, e := range page.Events {
+			if options.json {
+				data, _ := json.Marshal(e)
+				fmt.Println(string(data))
+				continue
+			}
+			subject := e.Pool
+			if e.Backend != "" {
+				subject += " " + e.Backend
+			}
+			fmt.Printf("%s  %-14s %-40s %s\n", e.Time.Format(time.RFC3339), e.Type, subject, e.Message)
+		}
+		if !*follow {
+			return nil
+		}
+		// A restarted load balancer numbers its events from 1 again
+		if page.Last < since {
+			since = 0
+			continue
+		}
+		since = page.Last
+	}
+}
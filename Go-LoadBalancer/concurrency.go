@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Adaptive limit tuning, modelled on the Netflix concurrency-limits gradient algorithm
+	adaptiveWindow     = 100 * time.Millisecond // latency sampling window
+	adaptiveTolerance  = 2.0                    // tolerated latency growth over the minimum
+	adaptiveSmoothing  = 0.2                    // weight of each new limit estimate
+	adaptiveMinRTTTTL  = 30 * time.Second       // how long a minimum latency observation is trusted
+	defaultMinInFlight = 10
+)
+
+// ConcurrencyLimiter caps in-flight requests, optionally adapting the cap to latency
+type ConcurrencyLimiter struct {
+	config   ConcurrencyLimitConfig
+	inFlight int64
+	limit    int64
+
+	// Adaptive state
+	minRTT      time.Duration
+	minRTTSet   time.Time
+	windowStart time.Time
+	windowSum   time.Duration
+	windowCount int
+	smoothLimit float64
+	adaptiveMux sync.Mutex
+
+	// Metrics
+	admitted int64
+	shed     int64
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter from the given configuration
+func NewConcurrencyLimiter(config ConcurrencyLimitConfig) *ConcurrencyLimiter {
+	if config.ShedStatus == 0 {
+		config.ShedStatus = http.StatusServiceUnavailable
+	}
+	if config.MinLimit <= 0 {
+		config.MinLimit = defaultMinInFlight
+	}
+	if config.MinLimit > config.MaxInFlight {
+		config.MinLimit = config.MaxInFlight
+	}
+
+	return &ConcurrencyLimiter{
+		config:      config,
+		limit:       int64(config.MaxInFlight),
+		smoothLimit: float64(config.MaxInFlight),
+		windowStart: time.Now(),
+	}
+}
+
+// Enabled reports whether a limit is configured
+func (cl *ConcurrencyLimiter) Enabled() bool {
+	return cl.config.MaxInFlight > 0
+}
+
+// Acquire reserves an in-flight slot, returning false when the limit is reached
+func (cl *ConcurrencyLimiter) Acquire() bool {
+	if atomic.AddInt64(&cl.inFlight, 1) > atomic.LoadInt64(&cl.limit) {
+		atomic.AddInt64(&cl.inFlight, -1)
+		atomic.AddInt64(&cl.shed, 1)
+		return false
+	}
+	atomic.AddInt64(&cl.admitted, 1)
+	return true
+}
+
+// Release frees an in-flight slot and feeds the request latency to the adaptive limit
+func (cl *ConcurrencyLimiter) Release(latency time.Duration) {
+	atomic.AddInt64(&cl.inFlight, -1)
+	if cl.config.Adaptive {
+		cl.observe(latency)
+	}
+}
+
+// observe records a latency sample and recomputes the limit once per window
+func (cl *ConcurrencyLimiter) observe(latency time.Duration) {
+	cl.adaptiveMux.Lock()
+	defer cl.adaptiveMux.Unlock()
+
+	now := time.Now()
+	if cl.minRTT == 0 || latency < cl.minRTT || now.Sub(cl.minRTTSet) > adaptiveMinRTTTTL {
+		cl.minRTT = latency
+		cl.minRTTSet = now
+	}
+
+	cl.windowSum += latency
+	cl.windowCount++
+	if now.Sub(cl.windowStart) < adaptiveWindow {
+		return
+	}
+
+	avg := cl.windowSum / time.Duration(cl.windowCount)
+	cl.windowStart = now
+	cl.windowSum = 0
+	cl.windowCount = 0
+	if avg <= 0 {
+		return
+	}
+
+	// Shrink the limit as latency grows beyond the tolerated multiple of the minimum,
+	// and probe upwards by sqrt(limit) when latency is healthy
+	gradient := math.Max(0.5, math.Min(1.0, adaptiveTolerance*float64(cl.minRTT)/float64(avg)))
+	estimate := cl.smoothLimit*gradient + math.Sqrt(cl.smoothLimit)
+	cl.smoothLimit = cl.smoothLimit*(1-adaptiveSmoothing) + estimate*adaptiveSmoothing
+	cl.smoothLimit = math.Max(float64(cl.config.MinLimit), math.Min(float64(cl.config.MaxInFlight), cl.smoothLimit))
+
+	newLimit := int64(cl.smoothLimit)
+	if oldLimit := atomic.SwapInt64(&cl.limit, newLimit); oldLimit != newLimit {
+		log.Printf("📉 [CONCURRENCY] Adaptive limit %d → %d (avg latency %v, min latency %v)",
+			oldLimit, newLimit, avg, cl.minRTT)
+	}
+}
+
+// GetStats returns concurrency limiting counters
+func (cl *ConcurrencyLimiter) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":       cl.Enabled(),
+		"adaptive":      cl.config.Adaptive,
+		"max_in_flight": cl.config.MaxInFlight,
+		"current_limit": atomic.LoadInt64(&cl.limit),
+		"in_flight":     atomic.LoadInt64(&cl.inFlight),
+		"admitted":      atomic.LoadInt64(&cl.admitted),
+		"shed":          atomic.LoadInt64(&cl.shed),
+	}
+}
+
+// concurrencyMiddleware sheds requests early once the in-flight limit is reached
+func (lb *LoadBalancer) concurrencyMiddleware(next http.Handler) http.Handler {
+	if !lb.concurrencyLimiter.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !lb.concurrencyLimiter.Acquire() {
+			log.Printf("🛑 [SHED] %s %s from %s shed, %d requests in flight",
+				r.Method, r.URL.Path, r.RemoteAddr, atomic.LoadInt64(&lb.concurrencyLimiter.inFlight))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server overloaded", lb.concurrencyLimiter.config.ShedStatus)
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			lb.concurrencyLimiter.Release(time.Since(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,13 +1,364 @@
 package main
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Config struct {
 	Port                string
-	HealthCheckInterval int    // seconds
+	HealthCheckInterval int // seconds
+	HealthCheck         HealthCheckConfig
 	MaxRetries          int
-	Algorithm           string // "round-robin", "weighted", "least-connections"
+	Algorithm           string // "round-robin", "weighted", "least-connections", "ewma", "least-latency"
+	LogRouting          bool   // log every backend selection (costly at high request rates)
+	Logging             LoggingConfig
+	DumpDir             string // where SIGUSR1 state dumps are written, the working directory if empty
+	IdentityHeaders     bool   // add X-Served-By and X-LB-Algorithm to proxied responses
+	TraceHeaders        bool   // propagate traceparent/B3 headers, starting a trace when a request has none
+	Acceptors           int    // >1 opens that many SO_REUSEPORT listeners with independent accept loops
+
+	MaxConnectionsPerBackend int           // 0 means unlimited
+	RemovalDrainTimeout      time.Duration // how long a removed backend may finish in-flight requests; 0 releases it at once
+	ProxyBufferSize          int           // bytes per pooled proxy copy buffer, 0 for 32KB
+	RouteMetricsCap          int           // distinct routes broken down in /stats and /metrics, 0 disables them
+
+	Retry             RetryPolicy
+	MaxRetryBodyBytes int64 // request bodies up to this size are buffered so they can be replayed
+	Throttle          ThrottleConfig
+
+	MaxRequestBodyBytes int64         // 0 means unlimited
+	MaxRequestTimeout   time.Duration // cap on X-Request-Timeout/grpc-timeout deadlines; 0 ignores those headers
+	RequestTimeout      time.Duration // end-to-end limit on proxied requests, answered with 504; 0 for none
+	Fallback            FallbackConfig
+
+	RateLimit        RateLimitConfig
+	ConcurrencyLimit ConcurrencyLimitConfig
+	Overload         OverloadConfig
+	Budget           BudgetConfig
+	WarmPool         WarmPoolConfig
+	UpstreamTLS      UpstreamTLSConfig
+	Cluster          ClusterConfig
+	Queue            QueueConfig
+	ACL              ACLConfig
+	AdminAuth        AdminAuthConfig
+	Webhooks         WebhookConfig
+	StatsExport      StatsExportConfig
+	Weights          WeightPersistenceConfig
+	StateStore       StateStoreConfig
+	Experiment       ExperimentConfig
+	ClientLimits     ClientLimitConfig
+	Cache            CacheConfig
+	Routes           []RouteConfig
 }
 
 type BackendConfig struct {
 	URL    string
 	Weight int
-}
\ No newline at end of file
+}
+
+// ParseBackendList parses a comma separated list of backends, each "URL" or "URL=weight"
+func ParseBackendList(list string) ([]BackendConfig, error) {
+	var backends []BackendConfig
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		backend := BackendConfig{URL: entry, Weight: 1}
+		if i := strings.LastIndex(entry, "="); i > 0 {
+			weight, err := strconv.Atoi(entry[i+1:])
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("invalid weight in %q", entry)
+			}
+			backend = BackendConfig{URL: entry[:i], Weight: weight}
+		}
+		backends = append(backends, backend)
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no backends given")
+	}
+	return backends, nil
+}
+
+// TokenBucketConfig describes a token bucket; a zero Rate disables it
+type TokenBucketConfig struct {
+	Rate  float64 // tokens (requests) per second
+	Burst int     // bucket capacity
+}
+
+// RateLimitConfig configures the global and per client IP rate limits
+type RateLimitConfig struct {
+	Global TokenBucketConfig
+	PerIP  TokenBucketConfig
+}
+
+// ConcurrencyLimitConfig caps the number of in-flight proxied requests
+type ConcurrencyLimitConfig struct {
+	MaxInFlight int  // 0 disables the limit
+	ShedStatus  int  // status returned when shedding (503 or 429)
+	Adaptive    bool // adjust the limit from observed latency, never above MaxInFlight
+	MinLimit    int  // lower bound for the adaptive limit
+}
+
+// OverloadConfig sheds load while recent p99 latency exceeds a target
+type OverloadConfig struct {
+	TargetP99  time.Duration // 0 disables overload protection
+	RetryAfter int           // seconds sent with shed responses, defaults to 1
+}
+
+// BudgetConfig caps process resources so a runaway load test cannot exhaust them
+type BudgetConfig struct {
+	MaxGoroutines    int // requests are shed with 503 at this many goroutines, 0 means unlimited
+	MaxUpstreamConns int // open connections to all backends, 0 means unlimited
+}
+
+// UpstreamTLSConfig controls TLS to https backends
+type UpstreamTLSConfig struct {
+	RootCAs            *x509.CertPool // backend certificates are verified against these, nil for the system roots
+	InsecureSkipVerify bool           // accept any backend certificate, e.g. a self-signed test backend's
+	SessionCacheSize   int            // TLS sessions kept for resumption, 0 makes every handshake a full one
+}
+
+// ClusterConfig lets load balancer instances share backend health and circuit breaker
+// state by gossiping it to each other
+type ClusterConfig struct {
+	NodeID   string        // this instance's name in gossip, unique within the cluster
+	Peers    []string      // base URLs of the other instances, none disables clustering
+	Interval time.Duration // how often the full state is gossiped, defaults to 1s
+	Key      string        // shared secret peers must send, empty accepts any gossip
+
+	// Connection counts from a peer not heard from for this long are ignored by
+	// least-connections (checked every interval), defaults to three intervals
+	MaxStaleness time.Duration
+}
+
+// WarmPoolConfig keeps idle keep-alive connections open to every backend, so requests
+// after startup or a quiet period don't wait for a connection to be established
+type WarmPoolConfig struct {
+	Connections int           // idle connections kept per backend, 0 disables the warm pool
+	Interval    time.Duration // how often they are topped up, defaults to 30s
+	Path        string        // requested to open and refresh connections, defaults to /health
+}
+
+// QueueConfig lets requests wait for a backend instead of failing immediately
+type QueueConfig struct {
+	MaxSize int           // 0 disables queueing
+	Timeout time.Duration // maximum time a request waits for a backend
+}
+
+// ACLConfig controls which client IPs are proxied; entries are CIDRs or single IPs
+type ACLConfig struct {
+	Allow              []string // when non-empty, only these clients are allowed
+	Deny               []string // always rejected, evaluated before Allow
+	Action             string   // "deny" (403) or "quarantine" (route to QuarantineBackends)
+	QuarantineBackends []BackendConfig
+}
+
+// AdminAuthConfig protects the admin API, e.g.
+//
+//	{"credentials": [{"name": "ci", "token": "s3cret", "roles": ["operator"]},
+//	                 {"name": "alice", "username": "alice", "password": "pw", "roles": ["viewer"]}],
+//	 "roles": {"PUT /admin/state": ["operator"], "/admin/acl": ["operator", "security"]}}
+//
+// No credentials leaves the admin API open
+type AdminAuthConfig struct {
+	Credentials []AdminCredential   `json:"credentials"`
+	Roles       map[string][]string `json:"roles"` // "METHOD /path" or "/path" → roles allowed; unlisted endpoints accept any credential
+}
+
+// AdminCredential is one admin API identity, authenticated by a bearer token or basic auth
+type AdminCredential struct {
+	Name     string   `json:"name"` // identity recorded in the audit log
+	Token    string   `json:"token"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// HealthCheckConfig selects how backends are health checked
+type HealthCheckConfig struct {
+	Type    string        // "http" (default), "tcp" or "script"
+	Path    string        // http: path expected to answer 2xx; empty tries /health, then /
+	Command string        // script: command line run per backend, healthy if it exits 0
+	Timeout time.Duration // per check, 0 for 2s
+	TLS     *tls.Config   // http: for https backends, nil for the defaults
+
+	UserAgent string        // http: User-Agent sent with probes, empty for Go's default
+	Headers   HealthHeaders // http: extra request headers, e.g. auth tokens or a Host override
+}
+
+// HealthHeaders are request headers added to http health checks, for backends behind
+// virtual host routing or with an authenticated health endpoint. A "Host" entry sets
+// the request's host rather than a header.
+type HealthHeaders struct {
+	All      map[string]string            `json:"headers"`  // sent to every backend
+	Backends map[string]map[string]string `json:"backends"` // by backend URL, overriding All
+}
+
+// LoadHealthHeaders reads HealthHeaders from a JSON file
+func LoadHealthHeaders(path string) (HealthHeaders, error) {
+	var headers HealthHeaders
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return headers, err
+	}
+	if err := json.Unmarshal(data, &headers); err != nil {
+		return headers, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := validateHeaders(headers.All); err != nil {
+		return headers, err
+	}
+	backends := make(map[string]map[string]string, len(headers.Backends))
+	for backend, values := range headers.Backends {
+		if err := validateHeaders(values); err != nil {
+			return headers, fmt.Errorf("backend %s: %w", backend, err)
+		}
+		backends[strings.TrimSuffix(backend, "/")] = values
+	}
+	headers.Backends = backends
+	return headers, nil
+}
+
+// validateHeaders rejects header names and values that can't be sent as they are
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+	}
+	return nil
+}
+
+// WebhookConfig lists the URLs notified of backend up/down and circuit open/close
+// transitions; more can be registered through /admin/webhooks
+type WebhookConfig struct {
+	URLs     []string
+	Debounce time.Duration // how long a new state must hold before it is sent
+}
+
+// StatsExportConfig writes /stats snapshots to disk; an empty Path disables it
+type StatsExportConfig struct {
+	Path     string        // NDJSON file to append to, or directory for "files"
+	Format   string        // "ndjson" (one line per snapshot) or "files" (one file per snapshot)
+	Interval time.Duration // time between snapshots
+}
+
+// WeightPersistenceConfig keeps runtime weight changes across restarts; an empty Path
+// disables it
+type WeightPersistenceConfig struct {
+	Path     string        // JSON file the weights are saved to
+	Interval time.Duration // how often changed weights are saved, 0 for 30s
+	Restore  bool          // apply the saved weights at startup
+}
+
+// StateStoreConfig persists the admin state (backends, weights, drain flags and routes)
+// to a file after every change; an empty path disables it
+type StateStoreConfig struct {
+	Path    string
+	Restore bool // apply the saved state at startup
+}
+
+// LoggingConfig sets the startup logging; it can be changed later through /admin/logging
+type LoggingConfig struct {
+	Level            string  // "debug", "info" (default), "warn" or "error"
+	DisableAccessLog bool    // skip the per-request route and response lines
+	AccessSampleRate float64 // fraction of requests with access log lines, 0 for all
+}
+
+// ThrottleConfig controls how 429 responses from backends are handled
+type ThrottleConfig struct {
+	Failover        bool          // retry throttled requests on a different backend
+	PenaltyDuration time.Duration // minimum time a throttled backend's weight stays reduced
+	PenaltyFactor   float64       // multiplier applied to the weight while throttled (0-1)
+	RetryAfter      string        // "propagate" (default), "rewrite" or "strip"
+	RetryAfterValue string        // Retry-After sent to clients when rewriting
+}
+
+// ClientLimitConfig enforces per-client fairness at the connection level
+type ClientLimitConfig struct {
+	MaxConnectionsPerIP  int   // 0 means unlimited
+	BandwidthBytesPerSec int64 // per-connection response bandwidth, 0 means unlimited
+}
+
+// CacheConfig configures the in-memory LRU cache for GET responses
+type CacheConfig struct {
+	MaxBytes      int64         // total cache size, 0 disables caching
+	MaxEntryBytes int64         // larger responses are never cached
+	DefaultTTL    time.Duration // used when the response sets no max-age
+}
+
+// ExperimentConfig splits traffic between variants, each served by its own backends
+type ExperimentConfig struct {
+	Name       string
+	CookieName string // cookie persisting the assignment, defaults to "lb_variant"
+	Variants   []VariantConfig
+}
+
+// VariantConfig is one arm of an experiment
+type VariantConfig struct {
+	Name     string
+	Percent  float64 // share of newly assigned clients
+	Backends []BackendConfig
+}
+
+// RouteConfig holds settings for requests whose path starts with PathPrefix
+type RouteConfig struct {
+	PathPrefix      string
+	RateLimit       TokenBucketConfig
+	RequestHeaders  HeaderRules  // applied before proxying
+	ResponseHeaders HeaderRules  // applied before returning to the client
+	Retry           *RetryPolicy // overrides the global retry policy
+
+	// A backend that hasn't started responding within this long is abandoned and the
+	// request rerouted, while retries remain; 0 waits as long as the backend takes
+	FirstByteTimeout time.Duration
+
+	MaxRequestBodyBytes int64           // overrides the global body limit when non-zero
+	Fallback            *FallbackConfig // overrides the global fallback response
+	Fault               FaultConfig
+	Cache               bool // cache GET responses on this route
+
+	StripPrefix bool   // remove PathPrefix from the path sent upstream
+	HostHeader  string // Host sent upstream, may use the HeaderRules placeholders; empty keeps the client's
+}
+
+// FaultConfig injects failures at the load balancer; percentages are 0-100
+type FaultConfig struct {
+	AbortPercent float64 // share of requests answered with AbortStatus without proxying
+	AbortStatus  int     // defaults to 503
+	DelayPercent float64 // share of requests delayed before proxying
+	Delay        time.Duration
+}
+
+// FallbackConfig describes the response sent when no backend can serve a request
+type FallbackConfig struct {
+	Status      int    // defaults to 503
+	ContentType string // defaults to text/plain
+	Body        string // defaults to "Service not available"
+	RetryAfter  int    // seconds, 0 omits the Retry-After header
+	RedirectURL string // when set, clients are redirected (302) to this status page instead
+}
+
+// RetryPolicy controls which requests may be retried on another backend
+type RetryPolicy struct {
+	Methods     []string // retryable methods, defaults to the idempotent methods
+	StatusCodes []int    // upstream statuses that trigger a retry, defaults to 502, 503, 504
+}
+
+// HeaderRules transforms headers; values may use the {backend}, {backend_host} and
+// {client_ip} placeholders
+type HeaderRules struct {
+	Add    map[string]string
+	Set    map[string]string
+	Remove []string
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+const firstByteKey contextKey = "first_byte"
+
+// States of a firstByteCutoff
+const (
+	cutoffPending int32 = iota
+	cutoffStarted       // the backend started responding in time
+	cutoffFired         // the attempt was canceled
+)
+
+// firstByteCutoff cancels an attempt whose backend hasn't started responding within
+// its route's FirstByteTimeout, so the request can be rerouted to another backend
+type firstByteCutoff struct {
+	parent  context.Context // the request's context, without the attempt's cancel
+	timeout time.Duration
+	state   int32
+}
+
+// armFirstByteCutoff returns r with a context canceled when the backend's response
+// hasn't started within the route's FirstByteTimeout, and a func to call once the
+// attempt is over. The cutoff only applies while the request has a retry left.
+func (lb *LoadBalancer) armFirstByteCutoff(r *http.Request, route *RouteConfig) (*http.Request, func()) {
+	if route == nil || route.FirstByteTimeout <= 0 ||
+		getRetryFromContext(r) >= lb.config.MaxRetries || !lb.canRetry(r) {
+		return r, func() {}
+	}
+
+	cutoff := &firstByteCutoff{parent: r.Context(), timeout: route.FirstByteTimeout}
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), firstByteKey, cutoff))
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			atomic.CompareAndSwapInt32(&cutoff.state, cutoffPending, cutoffStarted)
+		},
+	})
+	timer := time.AfterFunc(route.FirstByteTimeout, func() {
+		if atomic.CompareAndSwapInt32(&cutoff.state, cutoffPending, cutoffFired) {
+			cancel()
+		}
+	})
+	return r.WithContext(ctx), func() {
+		timer.Stop()
+		cancel()
+	}
+}
+
+// firstByteCutoffFired returns the cutoff that canceled r's attempt, or nil if it
+// wasn't canceled by one (or the client went away as well)
+func firstByteCutoffFired(r *http.Request) *firstByteCutoff {
+	cutoff, ok := r.Context().Value(firstByteKey).(*firstByteCutoff)
+	if !ok || atomic.LoadInt32(&cutoff.state) != cutoffFired || cutoff.parent.Err() != nil {
+		return nil
+	}
+	return cutoff
+}
+
+// rerouteSlow retries a request whose backend didn't start responding in time. The
+// backend is slow rather than failed, so this counts toward neither its circuit breaker
+// nor the proxy errors.
+func (lb *LoadBalancer) rerouteSlow(w http.ResponseWriter, r *http.Request, backend Backend, cutoff *firstByteCutoff) {
+	retries := getRetryFromContext(r)
+	atomic.AddInt64(&lb.firstByteReroutes, 1)
+	log.Printf("⏱️ [CUTOFF] %s %s: backend %s didn't start responding within %v, rerouting (attempt %d/%d)%s",
+		r.Method, r.URL.Path, backend.Address(), cutoff.timeout, retries+1, lb.config.MaxRetries, traceSuffix(r))
+	lb.retryElsewhere(w, r.WithContext(cutoff.parent), backend)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// grpcTimeoutUnits maps the unit suffix of a grpc-timeout header to its duration
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// requestTimeout returns the deadline a client asked for with X-Request-Timeout (a Go
+// duration such as "250ms", or seconds) or grpc-timeout ("100m"), and whether it asked
+func requestTimeout(r *http.Request) (time.Duration, bool, error) {
+	if value := r.Header.Get("X-Request-Timeout"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d, true, nil
+		}
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second)), true, nil
+		}
+		return 0, true, fmt.Errorf("invalid X-Request-Timeout %q", value)
+	}
+
+	if value := r.Header.Get("Grpc-Timeout"); value != "" {
+		// At most 8 digits followed by a unit
+		unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+		amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if !ok || err != nil || amount <= 0 || len(value) > 9 {
+			return 0, true, fmt.Errorf("invalid grpc-timeout %q", value)
+		}
+		return time.Duration(amount) * unit, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// requestDeadline records which limit a request's context deadline came from
+const (
+	defaultWriteTimeout = 15 * time.Second // the server's write timeout unless a configured timeout needs longer
+	writeTimeoutMargin  = 5 * time.Second  // left after the longest deadline to write its 504
+)
+
+// writeTimeout returns the server's WriteTimeout: long enough for the longest request
+// the configured timeouts let through, plus time to answer one that runs out, so the
+// connection isn't cut before the deadline middleware writes its 504. Routes loaded
+// later don't change it.
+func (lb *LoadBalancer) writeTimeout() time.Duration {
+	longest := max(lb.config.RequestTimeout, lb.config.MaxRequestTimeout)
+	for _, route := range *lb.routes.Load() {
+		// Every attempt may wait out the first-byte timeout before being rerouted
+		longest = max(longest, route.FirstByteTimeout*time.Duration(lb.config.MaxRetries+1))
+	}
+	return max(defaultWriteTimeout, longest+writeTimeoutMargin)
+}
+
+type requestDeadline struct {
+	timeout time.Duration
+	client  bool // the client asked for it, rather than RequestTimeout
+}
+
+// deadlineKey holds the *requestDeadline of requests with a deadline
+type deadlineKey struct{}
+
+// deadlineMiddleware limits the rest of the request (queueing, retries and the upstream
+// call) to RequestTimeout, or to the client's requested timeout capped at
+// MaxRequestTimeout if that is shorter
+func (lb *LoadBalancer) deadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := requestDeadline{timeout: lb.config.RequestTimeout}
+
+		if lb.config.MaxRequestTimeout > 0 {
+			timeout, requested, err := requestTimeout(r)
+			if err != nil {
+				atomic.AddInt64(&lb.deadlinesInvalid, 1)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if requested {
+				atomic.AddInt64(&lb.deadlinesApplied, 1)
+				if timeout > lb.config.MaxRequestTimeout {
+					atomic.AddInt64(&lb.deadlinesCapped, 1)
+					timeout = lb.config.MaxRequestTimeout
+				}
+				if deadline.timeout <= 0 || timeout < deadline.timeout {
+					deadline = requestDeadline{timeout: timeout, client: true}
+				}
+
+				// Pass the deadline on so backends can give up in time too
+				r.Header.Del("Grpc-Timeout")
+				r.Header.Set("X-Request-Timeout", deadline.timeout.String())
+			}
+		}
+
+		if deadline.timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), deadline.timeout)
+		defer cancel()
+		ctx = context.WithValue(ctx, deadlineKey{}, &deadline)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientDeadline reports whether the deadline a request ran out of was the client's
+func clientDeadline(r *http.Request) bool {
+	deadline, ok := r.Context().Value(deadlineKey{}).(*requestDeadline)
+	return ok && deadline.client
+}
+
+// writeDeadlineExceeded answers a request that ran out of time with 504; where says
+// what it was waiting on
+func (lb *LoadBalancer) writeDeadlineExceeded(w http.ResponseWriter, r *http.Request, where string) {
+	w = lbResponse(w, http.StatusGatewayTimeout)
+	deadline, _ := r.Context().Value(deadlineKey{}).(*requestDeadline)
+	if deadline != nil && deadline.client {
+		atomic.AddInt64(&lb.deadlinesExceeded, 1)
+		log.Printf("⏰ [DEADLINE] %s %s from %s ran out of its %v deadline waiting on %s",
+			r.Method, r.URL.Path, r.RemoteAddr, deadline.timeout, where)
+		http.Error(w, "Request deadline exceeded", http.StatusGatewayTimeout)
+		return
+	}
+
+	atomic.AddInt64(&lb.requestTimeouts, 1)
+	log.Printf("⏰ [TIMEOUT] %s %s from %s exceeded the %v request timeout waiting on %s",
+		r.Method, r.URL.Path, r.RemoteAddr, lb.config.RequestTimeout, where)
+	http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+}
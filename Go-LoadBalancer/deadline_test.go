@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteTimeoutOutlastsDeadlines(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   time.Duration
+	}{
+		{"no timeouts", Config{}, defaultWriteTimeout},
+		{"short request timeout", Config{RequestTimeout: 5 * time.Second}, defaultWriteTimeout},
+		{"request timeout", Config{RequestTimeout: 30 * time.Second}, 30*time.Second + writeTimeoutMargin},
+		{"client timeouts", Config{RequestTimeout: 30 * time.Second, MaxRequestTimeout: time.Minute}, time.Minute + writeTimeoutMargin},
+		{"route first byte", Config{MaxRetries: 2, Routes: []RouteConfig{
+			{PathPrefix: "/fast", FirstByteTimeout: time.Second},
+			{PathPrefix: "/slow", FirstByteTimeout: 10 * time.Second},
+		}}, 30*time.Second + writeTimeoutMargin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Algorithm = "round-robin"
+			if got := NewLoadBalancer(&tt.config).writeTimeout(); got != tt.want {
+				t.Errorf("writeTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DirectorFunc customizes the request sent to backend, after the default director has
+// pointed it there and the route's upstream rewrites are applied
+type DirectorFunc func(req *http.Request, backend Backend)
+
+// SetDirector installs fn on every backend's reverse proxy, e.g. to add upstream
+// credentials per backend; nil removes it
+func (lb *LoadBalancer) SetDirector(fn DirectorFunc) {
+	if fn == nil {
+		lb.director.Store(nil)
+		return
+	}
+	lb.director.Store(&fn)
+}
+
+// wrapDirector extends a backend's director with the route's prefix stripping and Host
+// rewrite, then the custom director. It runs on the outgoing copy of each attempt.
+func (lb *LoadBalancer) wrapDirector(backend *HTTPBackend) {
+	base := backend.ReverseProxy.Director
+	backend.ReverseProxy.Director = func(req *http.Request) {
+		route := lb.matchRoute(req.URL.Path)
+		if route != nil && route.StripPrefix {
+			stripPathPrefix(req, route.PathPrefix)
+		}
+
+		base(req)
+
+		if route != nil && route.HostHeader != "" {
+			req.Host = placeholderReplacer(backend, req).Replace(route.HostHeader)
+		}
+		if fn := lb.director.Load(); fn != nil {
+			(*fn)(req, backend)
+		}
+	}
+}
+
+// stripPathPrefix removes prefix from the request path, leaving at least "/"
+func stripPathPrefix(req *http.Request, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	trim := func(path string) string {
+		path = strings.TrimPrefix(path, prefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return path
+	}
+	req.URL.Path = trim(req.URL.Path)
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = trim(req.URL.RawPath)
+	}
+}
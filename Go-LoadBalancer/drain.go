@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Drainer takes the whole load balancer out of service: once draining, new requests get
+// a 503 with Connection: close while requests already in flight run to completion
+type Drainer struct {
+	draining atomic.Bool
+	inFlight int64
+	rejected int64
+
+	mux       sync.Mutex
+	started   time.Time
+	completed time.Time // when the last in-flight request finished, zero until then
+}
+
+// Draining reports whether a drain is in progress
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Start begins draining; it returns false if a drain was already in progress
+func (d *Drainer) Start() bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if !d.draining.CompareAndSwap(false, true) {
+		return false
+	}
+	d.started = time.Now()
+	d.completed = time.Time{}
+	if atomic.LoadInt64(&d.inFlight) == 0 {
+		d.completed = d.started
+	}
+	return true
+}
+
+// Stop ends a drain, so new requests are served again
+func (d *Drainer) Stop() bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.draining.CompareAndSwap(true, false)
+}
+
+// enter counts a request in flight, or returns false when it must be turned away
+func (d *Drainer) enter() bool {
+	atomic.AddInt64(&d.inFlight, 1)
+	if d.draining.Load() {
+		d.leave()
+		atomic.AddInt64(&d.rejected, 1)
+		return false
+	}
+	return true
+}
+
+// leave ends a request, noting when the last one of a drain finishes
+func (d *Drainer) leave() {
+	if atomic.AddInt64(&d.inFlight, -1) == 0 && d.draining.Load() {
+		d.mux.Lock()
+		if d.completed.IsZero() && d.draining.Load() {
+			d.completed = time.Now()
+			log.Printf("🚰 [DRAIN] Drained: last in-flight request finished after %v",
+				d.completed.Sub(d.started).Round(time.Millisecond))
+		}
+		d.mux.Unlock()
+	}
+}
+
+// GetStats returns the drain progress
+func (d *Drainer) GetStats() map[string]interface{} {
+	d.mux.Lock()
+	started, completed := d.started, d.completed
+	d.mux.Unlock()
+
+	draining := d.draining.Load()
+	inFlight := atomic.LoadInt64(&d.inFlight)
+	stats := map[string]interface{}{
+		"draining":  draining,
+		"in_flight": inFlight,
+		"rejected":  atomic.LoadInt64(&d.rejected),
+		"drained":   draining && inFlight == 0,
+	}
+	if draining {
+		stats["started"] = started.Unix()
+		stats["elapsed_seconds"] = time.Since(started).Seconds()
+		if !completed.IsZero() {
+			stats["drain_seconds"] = completed.Sub(started).Seconds()
+		}
+	}
+	return stats
+}
+
+// drainMiddleware turns new requests away while draining and tracks the ones in flight
+func (lb *LoadBalancer) drainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !lb.drainer.enter() {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Load balancer draining", http.StatusServiceUnavailable)
+			return
+		}
+		defer lb.drainer.leave()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminDrain reports (GET), starts (POST) or cancels (DELETE) a drain of the whole load
+// balancer. Keep-alives are turned off for the drain, so idle client connections close
+// and clients reconnect to whatever replaces this load balancer.
+func (lb *LoadBalancer) adminDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if lb.drainer.Start() {
+			lb.setKeepAlives(false)
+			log.Printf("🚰 [DRAIN] Draining by %s: rejecting new requests, %d in flight",
+				adminIdentity(r), atomic.LoadInt64(&lb.drainer.inFlight))
+			lb.events.Record(EventAdmin, "", "", "drain started by %s", adminIdentity(r))
+		}
+	case http.MethodDelete:
+		if lb.drainer.Stop() {
+			lb.setKeepAlives(true)
+			log.Printf("🚰 [DRAIN] Drain cancelled by %s, serving requests again", adminIdentity(r))
+			lb.events.Record(EventAdmin, "", "", "drain cancelled by %s", adminIdentity(r))
+		}
+	default:
+		http.Error(w, "Only GET, POST and DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, lb.drainer.GetStats())
+}
+
+// setKeepAlives enables or disables keep-alives on the running server
+func (lb *LoadBalancer) setKeepAlives(enabled bool) {
+	if server := lb.server.Load(); server != nil {
+		server.SetKeepAlivesEnabled(enabled)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// StateDump returns a snapshot of the load balancer's internals for post-mortem analysis:
+// every pool's membership, backend counters and breaker state, the algorithms' internal
+// state, the /stats payload, recent events and every goroutine's stack
+func (lb *LoadBalancer) StateDump() map[string]interface{} {
+	pools := make(map[string]interface{})
+	for name, pool := range lb.namedPools() {
+		backends := []map[string]interface{}{}
+		for _, backend := range pool.GetBackends() {
+			info := backendInfo(backend)
+			info["throttled"] = backend.IsThrottled()
+			info["saturated"] = backend.IsSaturated()
+			info["client_cancellations"] = backend.GetClientCancellations()
+			if b, ok := backend.(*HTTPBackend); ok {
+				circuit := map[string]interface{}{
+					"open":                   b.IsCircuitOpen(),
+					"max_consecutive_errors": b.breaker.Threshold(),
+					"timeout_seconds":        b.breaker.Timeout().Seconds(),
+				}
+				if until := b.breaker.OpenUntil(); !until.IsZero() {
+					circuit["open_until"] = until.Format(time.RFC3339Nano)
+				}
+				info["circuit"] = circuit
+			}
+			backends = append(backends, info)
+		}
+		pools[name] = map[string]interface{}{
+			"algorithm":       pool.Algorithm().Name(),
+			"algorithm_state": algorithmState(pool.Algorithm()),
+			"backends":        backends,
+		}
+	}
+
+	var stacks bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&stacks, 1)
+	events, _, _ := lb.events.Since(0)
+
+	return map[string]interface{}{
+		"time":             time.Now().Format(time.RFC3339Nano),
+		"build":            BuildInfo(),
+		"algorithm":        lb.AlgorithmName(),
+		"goroutines":       runtime.NumGoroutine(),
+		"pools":            pools,
+		"stats":            lb.Stats(),
+		"events":           events,
+		"goroutine_stacks": stacks.String(),
+	}
+}
+
+// algorithmState returns what an algorithm remembers between selections
+func algorithmState(algorithm LoadBalancingAlgorithm) map[string]interface{} {
+	switch a := algorithm.(type) {
+	case *RoundRobinAlgorithm:
+		return map[string]interface{}{"counter": atomic.LoadUint64(&a.current)}
+	case *WeightedRoundRobinAlgorithm:
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		weights := make(map[string]int, len(a.currentWeights))
+		for backend, weight := range a.currentWeights {
+			weights[backend.Address()] = weight
+		}
+		return map[string]interface{}{"current_weights": weights}
+	case *LatencyAlgorithm:
+		return map[string]interface{}{"estimates": a.Estimates()}
+	}
+	return map[string]interface{}{}
+}
+
+// WriteStateDump writes StateDump to a timestamped JSON file in dir (the working
+// directory if empty) and returns its path
+func (lb *LoadBalancer) WriteStateDump(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	data, err := json.MarshalIndent(lb.StateDump(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("lb-state-%s-%s.json", lb.config.Port, time.Now().UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, data, 0o644)
+}
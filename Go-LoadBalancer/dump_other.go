@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// watchDumpSignal does nothing: there is no SIGUSR1 on this platform
+func (lb *LoadBalancer) watchDumpSignal(dir string) {}
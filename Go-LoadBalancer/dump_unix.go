@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchDumpSignal writes a state dump into dir on every SIGUSR1
+func (lb *LoadBalancer) watchDumpSignal(dir string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			path, err := lb.WriteStateDump(dir)
+			if err != nil {
+				log.Printf("❌ [DUMP] Failed to write state dump: %v", err)
+				continue
+			}
+			log.Printf("💾 [DUMP] State written to %s", path)
+		}
+	}()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// ProxyErrorKind classifies why proxying to a backend failed
+type ProxyErrorKind int
+
+const (
+	ErrKindConnection       ProxyErrorKind = iota // any other transport failure
+	ErrKindConnRefused                            // nothing listening on the backend port
+	ErrKindConnReset                              // the backend dropped the connection mid-exchange
+	ErrKindTimeout                                // dial, TLS handshake or response header timeout
+	ErrKindDNS                                    // the backend's host name didn't resolve
+	ErrKindTLS                                    // handshake or certificate failure
+	ErrKindClientCanceled                         // the client went away
+	ErrKindDeadlineExceeded                       // the client's requested deadline ran out
+	ErrKindRequestTimeout                         // the backend took longer than RequestTimeout
+	ErrKindBodyTooLarge                           // the request body went over the size limit while streaming
+	ErrKindBudgetExhausted                        // the shared upstream connection budget is used up
+	ErrKindRetryableStatus                        // the backend answered with a retryable status
+	ErrKindThrottled                              // the backend answered 429 and the request fails over
+
+	numProxyErrorKinds
+)
+
+var proxyErrorKindNames = [numProxyErrorKinds]string{
+	ErrKindConnection:       "connection_error",
+	ErrKindConnRefused:      "connection_refused",
+	ErrKindConnReset:        "connection_reset",
+	ErrKindTimeout:          "timeout",
+	ErrKindDNS:              "dns",
+	ErrKindTLS:              "tls",
+	ErrKindClientCanceled:   "client_canceled",
+	ErrKindDeadlineExceeded: "deadline_exceeded",
+	ErrKindRequestTimeout:   "request_timeout",
+	ErrKindBodyTooLarge:     "body_too_large",
+	ErrKindBudgetExhausted:  "budget_exhausted",
+	ErrKindRetryableStatus:  "retryable_status",
+	ErrKindThrottled:        "throttled",
+}
+
+// String names the kind in logs and /stats
+func (k ProxyErrorKind) String() string {
+	if k < 0 || k >= numProxyErrorKinds {
+		return "unknown"
+	}
+	return proxyErrorKindNames[k]
+}
+
+// BackendFault reports whether the error counts against the backend's circuit breaker
+func (k ProxyErrorKind) BackendFault() bool {
+	switch k {
+	case ErrKindClientCanceled, ErrKindDeadlineExceeded, ErrKindBodyTooLarge, ErrKindBudgetExhausted, ErrKindThrottled:
+		return false
+	}
+	return true
+}
+
+// Retryable reports whether another backend might succeed where this one failed
+func (k ProxyErrorKind) Retryable() bool {
+	switch k {
+	case ErrKindClientCanceled, ErrKindDeadlineExceeded, ErrKindRequestTimeout, ErrKindBodyTooLarge, ErrKindBudgetExhausted:
+		return false
+	}
+	return true
+}
+
+// classifyProxyError works out why a proxied request failed from the error the
+// reverse proxy reported and the state of the request's context
+func classifyProxyError(r *http.Request, e error) ProxyErrorKind {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		return ErrKindClientCanceled
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded) && clientDeadline(r):
+		return ErrKindDeadlineExceeded
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		return ErrKindRequestTimeout
+	case errors.Is(e, errRetryableStatus):
+		return ErrKindRetryableStatus
+	case errors.Is(e, errBackendThrottled):
+		return ErrKindThrottled
+	case errors.Is(e, errConnBudgetExhausted):
+		return ErrKindBudgetExhausted
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var netErr net.Error
+
+	switch {
+	case errors.As(e, &maxBytesErr):
+		return ErrKindBodyTooLarge
+	case errors.As(e, &dnsErr):
+		return ErrKindDNS
+	case errors.As(e, &recordErr), errors.As(e, &alertErr), errors.As(e, &certErr),
+		errors.As(e, &authorityErr), errors.As(e, &hostnameErr):
+		return ErrKindTLS
+	case errors.Is(e, syscall.ECONNREFUSED):
+		return ErrKindConnRefused
+	case errors.Is(e, syscall.ECONNRESET), errors.Is(e, syscall.EPIPE), errors.Is(e, io.ErrUnexpectedEOF), errors.Is(e, io.EOF):
+		return ErrKindConnReset
+	case errors.Is(e, os.ErrDeadlineExceeded), errors.As(e, &netErr) && netErr.Timeout():
+		return ErrKindTimeout
+	}
+	return ErrKindConnection
+}
+
+// recordProxyError counts a proxy error by kind
+func (lb *LoadBalancer) recordProxyError(kind ProxyErrorKind) {
+	if kind >= 0 && kind < numProxyErrorKinds {
+		atomic.AddInt64(&lb.proxyErrors[kind], 1)
+	}
+}
+
+// proxyErrorStats returns the proxy error counts by kind
+func (lb *LoadBalancer) proxyErrorStats() map[string]int64 {
+	stats := make(map[string]int64, numProxyErrorKinds)
+	for kind := ProxyErrorKind(0); kind < numProxyErrorKinds; kind++ {
+		stats[kind.String()] = atomic.LoadInt64(&lb.proxyErrors[kind])
+	}
+	return stats
+}
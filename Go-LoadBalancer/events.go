@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventBackendUp     = "backend_up"
+	EventBackendDown   = "backend_down"
+	EventCircuitOpen   = "circuit_open"
+	EventCircuitClosed = "circuit_closed"
+	EventAdmin         = "admin"
+)
+
+// maxEventWait caps how long an event request may wait for new events, well inside the
+// server's write timeout
+const maxEventWait = 10 * time.Second
+
+// Event is one notable change: a backend going up or down, a circuit opening or
+// closing, or a change made through the admin API
+type Event struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Pool    string    `json:"pool,omitempty"`
+	Backend string    `json:"backend,omitempty"`
+	Message string    `json:"message"`
+}
+
+// EventLog keeps the most recent events in a ring, numbered so readers can poll for
+// whatever happened after the last event they saw
+type EventLog struct {
+	mux     sync.Mutex
+	events  []Event
+	size    int
+	seq     int64
+	changed chan struct{} // closed and replaced whenever an event is recorded
+
+	subscribers []func(Event)
+}
+
+// NewEventLog creates an event log retaining the last size events
+func NewEventLog(size int) *EventLog {
+	return &EventLog{size: size, changed: make(chan struct{})}
+}
+
+// Record appends an event; recording to a nil log does nothing
+func (l *EventLog) Record(eventType, pool, backend, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	l.seq++
+	event := Event{
+		Seq:     l.seq,
+		Time:    time.Now(),
+		Type:    eventType,
+		Pool:    pool,
+		Backend: backend,
+		Message: fmt.Sprintf(format, args...),
+	}
+	l.events = append(l.events, event)
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+	subscribers := l.subscribers
+	l.mux.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+}
+
+// Subscribe calls fn with every event recorded from now on. It runs on the recording
+// goroutine, so it must not block.
+func (l *EventLog) Subscribe(fn func(Event)) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.subscribers = append(l.subscribers, fn)
+}
+
+// Since returns the retained events after seq, the sequence number of the last event,
+// and a channel closed when the next event is recorded
+func (l *EventLog) Since(seq int64) ([]Event, int64, <-chan struct{}) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	events := []Event{}
+	for _, event := range l.events {
+		if event.Seq > seq {
+			events = append(events, event)
+		}
+	}
+	return events, l.seq, l.changed
+}
+
+// adminEvents returns the events after ?since=N (every retained event by default). With
+// ?wait=DURATION the request blocks until an event arrives or the wait is over, so
+// clients can follow the log by long polling with the returned "last" sequence number.
+func (lb *LoadBalancer) adminEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseInt(value, 10, 64); err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		var err error
+		if wait, err = time.ParseDuration(value); err != nil || wait < 0 {
+			http.Error(w, "Invalid wait", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxEventWait)
+	}
+
+	events, last, changed := lb.events.Since(since)
+	if len(events) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-changed:
+			events, last, _ = lb.events.Since(since)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"events": events,
+		"last":   last,
+	})
+}
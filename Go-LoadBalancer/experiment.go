@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultVariantCookie = "lb_variant"
+
+// Variant is one arm of an experiment with its own backend pool and metrics
+type Variant struct {
+	name     string
+	percent  float64
+	pool     *ServerPool
+	requests int64
+	errors   int64
+	latency  *LatencyWindow
+}
+
+// Experiment assigns clients to variants and keeps the assignment in a cookie
+type Experiment struct {
+	name       string
+	cookieName string
+	variants   []*Variant
+	mux        sync.RWMutex // guards variant percentages
+}
+
+// SetupExperiment creates the configured experiment and its variant pools
+func (lb *LoadBalancer) SetupExperiment(config ExperimentConfig) error {
+	if len(config.Variants) == 0 {
+		return nil
+	}
+
+	experiment := &Experiment{
+		name:       config.Name,
+		cookieName: config.CookieName,
+	}
+	if experiment.cookieName == "" {
+		experiment.cookieName = defaultVariantCookie
+	}
+
+	splits := make(map[string]float64)
+	for _, vc := range config.Variants {
+		if vc.Name == "" || len(vc.Backends) == 0 {
+			return fmt.Errorf("variant %q needs a name and at least one backend", vc.Name)
+		}
+		if _, exists := splits[vc.Name]; exists {
+			return fmt.Errorf("duplicate variant %q", vc.Name)
+		}
+		splits[vc.Name] = vc.Percent
+
+		variant := &Variant{
+			name:    vc.Name,
+			pool:    NewServerPool(CreateAlgorithm(lb.AlgorithmName())),
+			latency: NewLatencyWindow(defaultLatencySamples),
+		}
+		variant.pool.logs = lb.logs
+		variant.pool.name = "variant:" + vc.Name
+		variant.pool.events = lb.events
+		if lb.healthChecker != nil {
+			variant.pool.SetHealthChecker(lb.healthChecker)
+		}
+		for _, bc := range vc.Backends {
+			backend, err := lb.newBackend(bc.URL, bc.Weight)
+			if err != nil {
+				return err
+			}
+			variant.pool.AddBackend(backend)
+		}
+		experiment.variants = append(experiment.variants, variant)
+	}
+
+	if err := experiment.SetSplits(splits); err != nil {
+		return err
+	}
+
+	lb.experiment = experiment
+	log.Printf("🧪 [EXPERIMENT] %q running with %d variants (cookie %s)",
+		experiment.name, len(experiment.variants), experiment.cookieName)
+	return nil
+}
+
+// SetSplits updates variant percentages; variants not listed keep their current share
+func (e *Experiment) SetSplits(splits map[string]float64) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	total := 0.0
+	for _, variant := range e.variants {
+		percent := variant.percent
+		if p, ok := splits[variant.name]; ok {
+			percent = p
+		}
+		if percent < 0 {
+			return fmt.Errorf("variant %q has a negative percentage", variant.name)
+		}
+		total += percent
+	}
+	for name := range splits {
+		if e.variant(name) == nil {
+			return fmt.Errorf("unknown variant %q", name)
+		}
+	}
+	if total <= 0 {
+		return errors.New("variant percentages must add up to more than 0")
+	}
+
+	for _, variant := range e.variants {
+		if p, ok := splits[variant.name]; ok {
+			variant.percent = p
+		}
+		log.Printf("🧪 [EXPERIMENT] Variant %s now receives %.1f%% of new clients",
+			variant.name, variant.percent/total*100)
+	}
+	return nil
+}
+
+// variant returns the variant with the given name, or nil
+func (e *Experiment) variant(name string) *Variant {
+	for _, variant := range e.variants {
+		if variant.name == name {
+			return variant
+		}
+	}
+	return nil
+}
+
+// assign picks a variant at random according to the current splits
+func (e *Experiment) assign() *Variant {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	total := 0.0
+	for _, variant := range e.variants {
+		total += variant.percent
+	}
+
+	pick := rand.Float64() * total
+	for _, variant := range e.variants {
+		if pick < variant.percent {
+			return variant
+		}
+		pick -= variant.percent
+	}
+	return e.variants[len(e.variants)-1]
+}
+
+// GetStats returns per-variant splits, request counts and latencies
+func (e *Experiment) GetStats() map[string]interface{} {
+	if e == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	variants := make([]map[string]interface{}, 0, len(e.variants))
+	for _, variant := range e.variants {
+		variants = append(variants, map[string]interface{}{
+			"name":     variant.name,
+			"percent":  variant.percent,
+			"backends": len(variant.pool.GetBackends()),
+			"requests": atomic.LoadInt64(&variant.requests),
+			"errors":   atomic.LoadInt64(&variant.errors),
+			"latency":  variant.latency.Summary(),
+		})
+	}
+
+	return map[string]interface{}{
+		"enabled":  true,
+		"name":     e.name,
+		"cookie":   e.cookieName,
+		"variants": variants,
+	}
+}
+
+// experimentMiddleware routes each client to its assigned variant's pool
+func (lb *LoadBalancer) experimentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests already assigned a pool (e.g. quarantined clients) stay out of the experiment
+		if lb.experiment == nil || r.Context().Value(poolKey) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var variant *Variant
+		if cookie, err := r.Cookie(lb.experiment.cookieName); err == nil {
+			variant = lb.experiment.variant(cookie.Value)
+		}
+		if variant == nil {
+			variant = lb.experiment.assign()
+			http.SetCookie(w, &http.Cookie{
+				Name:     lb.experiment.cookieName,
+				Value:    variant.name,
+				Path:     "/",
+				HttpOnly: true,
+			})
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), poolKey, variant.pool)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		atomic.AddInt64(&variant.requests, 1)
+		if recorder.statusCode >= 500 {
+			atomic.AddInt64(&variant.errors, 1)
+		}
+		variant.latency.Record(time.Since(start))
+	})
+}
+
+// statusRecorder captures the status code, body size and time to first byte of the
+// response written by downstream handlers
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	written    int64
+	firstByte  time.Time // when the response started
+}
+
+// Write counts the body bytes written
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.firstByte.IsZero() {
+		sr.firstByte = time.Now()
+	}
+	n, err := sr.ResponseWriter.Write(p)
+	sr.written += int64(n)
+	return n, err
+}
+
+// WriteHeader captures the status code
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.statusCode == 0 {
+		sr.statusCode = statusCode
+		sr.firstByte = time.Now()
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap returns the wrapped writer, so flushes and hijacks reach the connection
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// StatsExporter periodically writes the /stats payload to disk, either appended as one
+// line to an NDJSON file or as one timestamped JSON file per snapshot, so a benchmark
+// run keeps its whole metric history
+type StatsExporter struct {
+	config StatsExportConfig
+	lb     *LoadBalancer
+
+	// Counters at the previous snapshot, for the per-interval window
+	last         time.Time
+	lastRequests int64
+	lastRetries  int64
+	lastDrops    int64
+
+	// Metrics
+	written int64
+	failed  int64
+}
+
+// Validate checks the export configuration
+func (c StatsExportConfig) Validate() error {
+	if c.Path == "" {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("stats export interval must be positive")
+	}
+	if c.Format != "ndjson" && c.Format != "files" {
+		return fmt.Errorf("unknown stats export format %q (want ndjson or files)", c.Format)
+	}
+	return nil
+}
+
+// StartStatsExport starts writing snapshots in the background; an empty path disables it
+func (lb *LoadBalancer) StartStatsExport(config StatsExportConfig) error {
+	if config.Path == "" {
+		return nil
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Format == "files" {
+		if err := os.MkdirAll(config.Path, 0o755); err != nil {
+			return err
+		}
+	}
+
+	exporter := &StatsExporter{
+		config:       config,
+		lb:           lb,
+		last:         time.Now(),
+		lastRequests: atomic.LoadInt64(&lb.requests),
+		lastRetries:  atomic.LoadInt64(&lb.retries),
+		lastDrops:    atomic.LoadInt64(&lb.clientDisconnects),
+	}
+	lb.exporter = exporter
+	go exporter.run()
+
+	log.Printf("📤 [CONFIG] Exporting stats every %v to %s (%s)", config.Interval, config.Path, config.Format)
+	return nil
+}
+
+// run writes a snapshot every interval
+func (se *StatsExporter) run() {
+	ticker := time.NewTicker(se.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := se.write(); err != nil {
+			atomic.AddInt64(&se.failed, 1)
+			log.Printf("❌ [EXPORT] Failed to write stats snapshot: %v", err)
+			continue
+		}
+		atomic.AddInt64(&se.written, 1)
+	}
+}
+
+// snapshot returns the /stats payload together with what changed since the last one
+func (se *StatsExporter) snapshot() map[string]interface{} {
+	now := time.Now()
+	elapsed := now.Sub(se.last).Seconds()
+	requests := atomic.LoadInt64(&se.lb.requests)
+	retries := atomic.LoadInt64(&se.lb.retries)
+	drops := atomic.LoadInt64(&se.lb.clientDisconnects)
+
+	window := map[string]interface{}{
+		"seconds":            elapsed,
+		"requests":           requests - se.lastRequests,
+		"retries":            retries - se.lastRetries,
+		"client_disconnects": drops - se.lastDrops,
+		"requests_per_sec":   0.0,
+	}
+	if elapsed > 0 {
+		window["requests_per_sec"] = float64(requests-se.lastRequests) / elapsed
+	}
+	se.last, se.lastRequests, se.lastRetries, se.lastDrops = now, requests, retries, drops
+
+	return map[string]interface{}{
+		"time":   now.Format(time.RFC3339Nano),
+		"window": window,
+		"stats":  se.lb.Stats(),
+	}
+}
+
+// write takes a snapshot and stores it in the configured format
+func (se *StatsExporter) write() error {
+	snapshot := se.snapshot()
+
+	if se.config.Format == "files" {
+		data, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("stats-%s-%s.json", se.lb.config.Port, time.Now().UTC().Format("20060102T150405.000Z"))
+		return os.WriteFile(filepath.Join(se.config.Path, name), data, 0o644)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(se.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GetStats returns the export configuration and counters
+func (se *StatsExporter) GetStats() map[string]interface{} {
+	if se == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":          true,
+		"path":             se.config.Path,
+		"format":           se.config.Format,
+		"interval_seconds": se.config.Interval.Seconds(),
+		"written":          atomic.LoadInt64(&se.written),
+		"failed":           atomic.LoadInt64(&se.failed),
+	}
+}
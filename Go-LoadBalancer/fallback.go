@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// fallbackFor returns the fallback response of the request's route, or the global one
+func (lb *LoadBalancer) fallbackFor(r *http.Request) FallbackConfig {
+	if route := lb.matchRoute(r.URL.Path); route != nil && route.Fallback != nil {
+		return *route.Fallback
+	}
+	return lb.config.Fallback
+}
+
+// writeUnavailable sends the configured fallback response when no backend can serve r
+func (lb *LoadBalancer) writeUnavailable(w http.ResponseWriter, r *http.Request) {
+	fallback := lb.fallbackFor(r)
+
+	if fallback.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(fallback.RetryAfter))
+	}
+
+	if fallback.RedirectURL != "" {
+		log.Printf("↪️ [FALLBACK] Redirecting %s %s to status page %s", r.Method, r.URL.Path, fallback.RedirectURL)
+		http.Redirect(w, r, fallback.RedirectURL, http.StatusFound)
+		return
+	}
+
+	status := fallback.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	if fallback.Body == "" {
+		http.Error(w, "Service not available", status)
+		return
+	}
+
+	contentType := fallback.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(fallback.Body)))
+	w.WriteHeader(status)
+	fmt.Fprint(w, fallback.Body)
+}
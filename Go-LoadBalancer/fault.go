@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// faultMiddleware injects the route's configured aborts and delays before proxying
+func (lb *LoadBalancer) faultMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := lb.matchRoute(r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fault := route.Fault
+
+		if fault.AbortPercent > 0 && rand.Float64()*100 < fault.AbortPercent {
+			status := fault.AbortStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			atomic.AddInt64(&lb.faultsAborted, 1)
+			log.Printf("💥 [FAULT] Aborting %s %s from %s with %d", r.Method, r.URL.Path, r.RemoteAddr, status)
+			w.Header().Set("X-Fault-Injected", "abort")
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		if fault.DelayPercent > 0 && fault.Delay > 0 && rand.Float64()*100 < fault.DelayPercent {
+			atomic.AddInt64(&lb.faultsDelayed, 1)
+			log.Printf("🐌 [FAULT] Delaying %s %s from %s by %v", r.Method, r.URL.Path, r.RemoteAddr, fault.Delay)
+
+			timer := time.NewTimer(fault.Delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Empty reports whether the rules change nothing
+func (hr HeaderRules) Empty() bool {
+	return len(hr.Add) == 0 && len(hr.Set) == 0 && len(hr.Remove) == 0
+}
+
+// Apply removes, sets, then adds headers, expanding placeholders for the serving backend
+func (hr HeaderRules) Apply(header http.Header, backend Backend, r *http.Request) {
+	if hr.Empty() {
+		return
+	}
+
+	for _, name := range hr.Remove {
+		header.Del(name)
+	}
+
+	var replacer *strings.Replacer
+	expand := func(value string) string {
+		if !strings.Contains(value, "{") {
+			return value
+		}
+		if replacer == nil {
+			replacer = placeholderReplacer(backend, r)
+		}
+		return replacer.Replace(value)
+	}
+
+	for name, value := range hr.Set {
+		header.Set(name, expand(value))
+	}
+	for name, value := range hr.Add {
+		header.Add(name, expand(value))
+	}
+}
+
+// placeholderReplacer expands {backend}, {backend_host} and {client_ip}
+func placeholderReplacer(backend Backend, r *http.Request) *strings.Replacer {
+	host := backend.Address()
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return strings.NewReplacer(
+		"{backend}", backend.Address(),
+		"{backend_host}", host,
+		"{client_ip}", getClientIP(r),
+	)
+}
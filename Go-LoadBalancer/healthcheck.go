@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultHealthTimeout bounds a single health check
+const defaultHealthTimeout = 2 * time.Second
+
+// HealthResult is the outcome of one health check
+type HealthResult struct {
+	Healthy bool
+	Latency time.Duration
+	Detail  string // what the check saw, e.g. the status code or the error
+}
+
+// HealthChecker decides whether a backend can take traffic. ServerPool.HealthCheck
+// runs it against every backend, so custom probes or test fakes can be plugged in.
+type HealthChecker interface {
+	Check(backend Backend) HealthResult
+}
+
+// HTTPHealthChecker expects a 2xx response from a GET of the backend's health path
+type HTTPHealthChecker struct {
+	Path           string // defaults to /health
+	FallbackToRoot bool   // try / when the health path can't be fetched at all
+	Timeout        time.Duration
+	Transport      http.RoundTripper // nil for http.DefaultTransport
+	UserAgent      string            // empty for Go's default
+	Headers        HealthHeaders
+}
+
+// Check probes the health path
+func (hc HTTPHealthChecker) Check(backend Backend) HealthResult {
+	start := time.Now()
+	client := http.Client{Transport: hc.Transport, Timeout: hc.Timeout}
+	if client.Timeout <= 0 {
+		client.Timeout = defaultHealthTimeout
+	}
+	path := hc.Path
+	if path == "" {
+		path = "/health"
+	}
+
+	resp, err := hc.get(&client, backend, strings.TrimSuffix(backend.Address(), "/")+path)
+	if err != nil && hc.FallbackToRoot {
+		resp, err = hc.get(&client, backend, backend.Address())
+	}
+	if err != nil {
+		return HealthResult{Latency: time.Since(start), Detail: err.Error()}
+	}
+	resp.Body.Close()
+
+	return HealthResult{
+		Healthy: resp.StatusCode >= 200 && resp.StatusCode < 300,
+		Latency: time.Since(start),
+		Detail:  resp.Status,
+	}
+}
+
+// get fetches target with the probe headers configured for backend
+func (hc HTTPHealthChecker) get(client *http.Client, backend Backend, target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if hc.UserAgent != "" {
+		req.Header.Set("User-Agent", hc.UserAgent)
+	}
+	// Per backend headers are set last, so they override the shared ones
+	perBackend := hc.Headers.Backends[strings.TrimSuffix(backend.Address(), "/")]
+	for _, headers := range []map[string]string{hc.Headers.All, perBackend} {
+		for name, value := range headers {
+			if strings.EqualFold(name, "Host") {
+				req.Host = value
+				continue
+			}
+			req.Header.Set(name, value)
+		}
+	}
+	return client.Do(req)
+}
+
+// TCPHealthChecker only expects the backend's port to accept a connection
+type TCPHealthChecker struct {
+	Timeout time.Duration
+}
+
+// Check dials the backend
+func (tc TCPHealthChecker) Check(backend Backend) HealthResult {
+	start := time.Now()
+	timeout := tc.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	host, err := backendHostPort(backend)
+	if err != nil {
+		return HealthResult{Detail: err.Error()}
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return HealthResult{Latency: time.Since(start), Detail: err.Error()}
+	}
+	conn.Close()
+	return HealthResult{Healthy: true, Latency: time.Since(start), Detail: "connected"}
+}
+
+// ScriptHealthChecker runs a command per backend and expects it to exit 0. The
+// command gets BACKEND_URL and BACKEND_HOST in its environment.
+type ScriptHealthChecker struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Check runs the command
+func (sc ScriptHealthChecker) Check(backend Backend) HealthResult {
+	start := time.Now()
+	timeout := sc.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	host, _ := backendHostPort(backend)
+	cmd := exec.CommandContext(ctx, sc.Command, sc.Args...)
+	cmd.Env = append(cmd.Environ(), "BACKEND_URL="+backend.Address(), "BACKEND_HOST="+host)
+	output, err := cmd.CombinedOutput()
+	detail := strings.TrimSpace(string(output))
+	if err != nil {
+		if detail == "" {
+			detail = err.Error()
+		}
+		return HealthResult{Latency: time.Since(start), Detail: detail}
+	}
+	return HealthResult{Healthy: true, Latency: time.Since(start), Detail: detail}
+}
+
+// backendHostPort returns host:port of a backend URL, defaulting the port from the scheme
+func backendHostPort(backend Backend) (string, error) {
+	u, err := url.Parse(backend.Address())
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("backend %s has no host", backend.Address())
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	}
+	return net.JoinHostPort(u.Hostname(), "80"), nil
+}
+
+// NewHealthChecker builds the checker a HealthCheckConfig describes
+func NewHealthChecker(config HealthCheckConfig) (HealthChecker, error) {
+	switch config.Type {
+	case "", "http":
+		checker := HTTPHealthChecker{
+			Path:           config.Path,
+			FallbackToRoot: config.Path == "",
+			Timeout:        config.Timeout,
+			UserAgent:      config.UserAgent,
+			Headers:        config.Headers,
+		}
+		if config.TLS != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = config.TLS
+			checker.Transport = transport
+		}
+		return checker, nil
+	case "tcp":
+		return TCPHealthChecker{Timeout: config.Timeout}, nil
+	case "script":
+		fields := strings.Fields(config.Command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("script health check needs a command")
+		}
+		return ScriptHealthChecker{Command: fields[0], Args: fields[1:], Timeout: config.Timeout}, nil
+	}
+	return nil, fmt.Errorf("unknown health check type %q (want http, tcp or script)", config.Type)
+}
+
+// SetHealthChecker switches every pool to checker, including experiment variants
+func (lb *LoadBalancer) SetHealthChecker(checker HealthChecker) {
+	lb.healthChecker = checker
+	lb.serverPool.SetHealthChecker(checker)
+	lb.quarantinePool.SetHealthChecker(checker)
+	if lb.experiment != nil {
+		for _, variant := range lb.experiment.variants {
+			variant.pool.SetHealthChecker(checker)
+		}
+	}
+}
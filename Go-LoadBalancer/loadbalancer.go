@@ -1,85 +1,268 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // LoadBalancer represents the main load balancer
 type LoadBalancer struct {
-	config     *Config
-	serverPool *ServerPool
+	config             *Config
+	serverPool         *ServerPool
+	quarantinePool     *ServerPool
+	acl                *AccessList
+	adminAuth          *AdminAuth
+	events             *EventLog
+	webhooks           *WebhookNotifier
+	cluster            *Cluster
+	exporter           *StatsExporter
+	weightStore        *WeightStore
+	stateStore         *stateStoreStatus
+	drainer            *Drainer
+	logs               *LogControl
+	server             atomic.Pointer[http.Server] // set once Start has built it
+	algorithm          atomic.Pointer[string]      // name of the main pool's algorithm
+	experiment         *Experiment
+	clientLimiter      *ClientLimiter
+	cache              *ResponseCache
+	routes             atomic.Pointer[[]RouteConfig]
+	director           atomic.Pointer[DirectorFunc] // custom upstream request hook, see SetDirector
+	healthChecker      HealthChecker                // nil for the pools' default
+	stateMux           sync.Mutex                   // serializes desired-state applies
+	bufferPool         *ProxyBufferPool
+	rateLimiter        *RateLimiter
+	concurrencyLimiter *ConcurrencyLimiter
+	overload           *OverloadProtector
+	budget             *ResourceBudget
+	transport          http.RoundTripper // shared upstream transport
+	queue              *RequestQueue
+	routeMetrics       *RouteMetrics
+	traffic            Traffic // body bytes exchanged with clients
+	warmPool           *WarmPool
+	upstream           *UpstreamMetrics
+
+	latency *LatencyWindow // durations of proxied requests, retries included
+	started time.Time      // for the uptime in /stats
+
+	requests           int64
+	clientDisconnects  int64
+	retries            int64
+	firstByteReroutes  int64
+	faultsAborted      int64
+	faultsDelayed      int64
+	deadlinesApplied   int64
+	deadlinesCapped    int64
+	deadlinesExceeded  int64
+	deadlinesInvalid   int64
+	requestTimeouts    int64
+	saturationReroutes int64
+	drainingReroutes   int64
+	backendsRetiring   int64
+	backendsReleased   int64
+	retireTimeouts     int64
+	tracesPropagated   int64
+	tracesGenerated    int64
+	tracesInvalid      int64
+	proxyErrors        [numProxyErrorKinds]int64
 }
 
 // NewLoadBalancer creates a new load balancer instance
 func NewLoadBalancer(config *Config) *LoadBalancer {
 	algorithm := CreateAlgorithm(config.Algorithm)
 
-	return &LoadBalancer{
-		config:     config,
-		serverPool: NewServerPool(algorithm),
+	if config.Retry.Methods == nil {
+		config.Retry.Methods = defaultRetryMethods
 	}
+	if config.Retry.StatusCodes == nil {
+		config.Retry.StatusCodes = defaultRetryStatusCodes
+	}
+
+	lb := &LoadBalancer{
+		config:             config,
+		serverPool:         NewServerPool(algorithm),
+		quarantinePool:     NewServerPool(&RoundRobinAlgorithm{}),
+		acl:                NewAccessList(),
+		rateLimiter:        NewRateLimiter(config.RateLimit),
+		concurrencyLimiter: NewConcurrencyLimiter(config.ConcurrencyLimit),
+		overload:           NewOverloadProtector(config.Overload),
+		budget:             NewResourceBudget(config.Budget),
+		queue:              NewRequestQueue(config.Queue),
+		routeMetrics:       NewRouteMetrics(config.RouteMetricsCap),
+		warmPool:           NewWarmPool(config.WarmPool),
+		upstream:           NewUpstreamMetrics(config.UpstreamTLS),
+		clientLimiter:      NewClientLimiter(config.ClientLimits),
+		cache:              NewResponseCache(config.Cache),
+		bufferPool:         NewProxyBufferPool(config.ProxyBufferSize),
+		events:             NewEventLog(1000),
+		drainer:            &Drainer{},
+		latency:            NewLatencyWindow(0),
+		logs:               NewLogControl(config.Logging, config.LogRouting),
+		started:            time.Now(),
+	}
+	algorithmName := config.Algorithm
+	lb.algorithm.Store(&algorithmName)
+	lb.routes.Store(&config.Routes)
+	transport := lb.budget.Transport()
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	lb.warmPool.Configure(transport)
+	lb.transport = lb.upstream.Wrap(transport)
+	lb.serverPool.logs = lb.logs
+	lb.quarantinePool.logs = lb.logs
+	lb.serverPool.name, lb.serverPool.events = "main", lb.events
+	lb.quarantinePool.name, lb.quarantinePool.events = "quarantine", lb.events
+
+	return lb
 }
 
 // AddBackend adds a backend server to the load balancer
 func (lb *LoadBalancer) AddBackend(serverURL string, weight int) error {
-	backend, err := NewBackend(serverURL, weight)
+	backend, err := lb.newBackend(serverURL, weight)
+	if err != nil {
+		return err
+	}
+
+	lb.serverPool.AddBackend(backend)
+	return nil
+}
+
+// AddQuarantineBackend adds a backend serving clients quarantined by the ACL
+func (lb *LoadBalancer) AddQuarantineBackend(serverURL string, weight int) error {
+	backend, err := lb.newBackend(serverURL, weight)
+	if err != nil {
+		return err
+	}
+
+	lb.quarantinePool.AddBackend(backend)
+	return nil
+}
+
+// newBackend creates a backend wired to the load balancer's error handling
+func (lb *LoadBalancer) newBackend(serverURL string, weight int) (*HTTPBackend, error) {
+	backend, err := NewHTTPBackend(serverURL, weight)
 	if err != nil {
-		return fmt.Errorf("failed to create backend %s: %v", serverURL, err)
+		return nil, fmt.Errorf("failed to create backend %s: %v", serverURL, err)
+	}
+
+	backend.maxConnections = int64(lb.config.MaxConnectionsPerBackend)
+	backend.onCircuitChange = func(open bool) {
+		if open {
+			lb.events.Record(EventCircuitOpen, lb.poolOf(backend), backend.Address(),
+				"opened (%d consecutive errors)", backend.GetConsecutiveErrors())
+		} else {
+			lb.events.Record(EventCircuitClosed, lb.poolOf(backend), backend.Address(), "closed")
+		}
 	}
 
 	// Customize the proxy error handler
+	lb.wrapDirector(backend)
 	backend.ReverseProxy.ErrorHandler = lb.createErrorHandler(backend)
+	backend.ReverseProxy.ModifyResponse = lb.createResponseModifier(backend)
+	backend.ReverseProxy.BufferPool = lb.bufferPool
+	backend.ReverseProxy.Transport = lb.transport
 
-	lb.serverPool.AddBackend(backend)
-	return nil
+	return backend, nil
 }
 
-func (lb *LoadBalancer) createErrorHandler(backend *Backend) func(http.ResponseWriter, *http.Request, error) {
+func (lb *LoadBalancer) createErrorHandler(backend *HTTPBackend) func(http.ResponseWriter, *http.Request, error) {
 	return func(writer http.ResponseWriter, request *http.Request, e error) {
+		if cutoff := firstByteCutoffFired(request); cutoff != nil {
+			lb.rerouteSlow(writer, request, backend, cutoff)
+			return
+		}
+
 		retries := getRetryFromContext(request)
+		kind := classifyProxyError(request, e)
+		lb.recordProxyError(kind)
+
+		switch kind {
+		case ErrKindClientCanceled:
+			// The client went away: the upstream call was aborted through the request
+			// context, so this is neither a backend failure nor worth retrying
+			lb.recordClientDisconnect(request, backend)
+			return
+
+		case ErrKindDeadlineExceeded:
+			// The client's deadline ran out: not the backend's fault, and no time to retry
+			lb.writeDeadlineExceeded(writer, request, "backend "+backend.Address())
+			return
+
+		case ErrKindRequestTimeout:
+			// The backend was too slow: it counts against the backend, but there is no
+			// time left to retry
+			backend.RecordError()
+			lb.writeDeadlineExceeded(writer, request, "backend "+backend.Address())
+			return
+
+		case ErrKindBodyTooLarge:
+			// The client sent more than the body size limit while the request was streaming
+			var maxBytesErr *http.MaxBytesError
+			errors.As(e, &maxBytesErr)
+			log.Printf("📦 [BODY_LIMIT] %s %s from %s exceeded %d byte body limit while proxying",
+				request.Method, request.URL.Path, request.RemoteAddr, maxBytesErr.Limit)
+			http.Error(writer, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+
+		case ErrKindBudgetExhausted:
+			// Shed rather than retry, since every backend shares the same budget and this
+			// says nothing about the backend's health
+			log.Printf("🧯 [BUDGET] %s %s from %s shed, upstream connection budget of %d reached",
+				request.Method, request.URL.Path, request.RemoteAddr, lb.config.Budget.MaxUpstreamConns)
+			writer.Header().Set("Retry-After", "1")
+			http.Error(writer, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
 
 		// Record the error for circuit breaker
-		backend.RecordError()
-
-		// Enhanced error logging with more context
-		errorType := "CONNECTION_ERROR"
-		if strings.Contains(e.Error(), "timeout") {
-			errorType = "TIMEOUT_ERROR"
-		} else if strings.Contains(e.Error(), "refused") {
-			errorType = "CONNECTION_REFUSED"
+		if kind.BackendFault() {
+			backend.RecordError()
 		}
 
 		log.Printf(
-			"[ERROR] 🚨 %s %s from %s → backend %s failed: %s (attempt %d/%d, consecutive errors: %d, error_type: %s)",
+			"[ERROR] 🚨 %s %s from %s → backend %s failed: %s (attempt %d/%d, consecutive errors: %d, error_type: %s)%s",
 			request.Method, request.URL.Path, request.RemoteAddr,
-			backend.URL.String(), e.Error(), retries+1, lb.config.MaxRetries,
-			backend.GetConsecutiveErrors(), errorType,
+			backend.Address(), e.Error(), retries+1, lb.config.MaxRetries,
+			backend.GetConsecutiveErrors(), kind, traceSuffix(request),
 		)
 
 		if backend.IsCircuitOpen() {
 			log.Printf("🔌 [CIRCUIT] Circuit breaker OPENED for backend %s (threshold reached: %d errors)",
-				backend.URL.String(), backend.GetConsecutiveErrors())
+				backend.Address(), backend.GetConsecutiveErrors())
 		}
 
-		if retries < lb.config.MaxRetries {
+		if retries < lb.config.MaxRetries && !kind.Retryable() {
+			log.Printf("🚫 [RETRY] Not retrying %s %s: %s errors aren't retried",
+				request.Method, request.URL.Path, kind)
+		} else if retries < lb.config.MaxRetries && !lb.canRetry(request) {
+			log.Printf("🚫 [RETRY] Not retrying %s %s: method not retryable or body not replayable",
+				request.Method, request.URL.Path)
+		} else if retries < lb.config.MaxRetries {
 			log.Printf(
 				"🔄 [RETRY] Attempting reroute for %s %s (attempt %d/%d) - looking for alternative backend",
 				request.Method, request.URL.Path, retries+1, lb.config.MaxRetries,
 			)
 
 			// Show available alternatives
-			alternatives := lb.serverPool.GetAvailableBackends()
+			alternatives := lb.poolFor(request).GetAvailableBackends()
+			attempted := getAttemptedFromContext(request)
 			if len(alternatives) > 0 {
 				var altUrls []string
 				for _, alt := range alternatives {
-					if alt != backend { // Don't include the failing backend
-						altUrls = append(altUrls, alt.URL.String())
+					if !slices.Contains(attempted, alt) { // Don't include backends already tried
+						altUrls = append(altUrls, alt.Address())
 					}
 				}
 				if len(altUrls) > 0 {
@@ -89,22 +272,39 @@ func (lb *LoadBalancer) createErrorHandler(backend *Backend) func(http.ResponseW
 				}
 			}
 
-			time.Sleep(10 * time.Millisecond)
-			ctx := context.WithValue(request.Context(), retryKey, retries+1)
-			lb.loadBalance(writer, request.WithContext(ctx))
+			lb.retryElsewhere(writer, request, backend)
 			return
 		}
 
-		log.Printf("❌ [FAIL] Max retries exceeded for %s %s, returning 503 (no healthy backends available)",
-			request.Method, request.URL.Path)
-		http.Error(writer, "Service not available", http.StatusServiceUnavailable)
+		log.Printf("❌ [FAIL] Giving up on %s %s after %d attempts, returning 503%s",
+			request.Method, request.URL.Path, retries+1, traceSuffix(request))
+		lb.writeUnavailable(writer, request)
 	}
 }
 
-// Retry key for context
+// retryElsewhere proxies the request again, to a backend it hasn't tried yet
+func (lb *LoadBalancer) retryElsewhere(w http.ResponseWriter, r *http.Request, backend Backend) {
+	// The retry runs inside this attempt, so let go of this backend first
+	lb.releaseConnection(r, backend)
+	// The retry's response isn't this backend's, so it mustn't pass through this
+	// attempt's recorder to be counted as its outcome or get its response headers
+	if rr, ok := w.(*ResponseRecorder); ok {
+		w = rr.ResponseWriter
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt64(&lb.retries, 1)
+	ctx := context.WithValue(r.Context(), retryKey, getRetryFromContext(r)+1)
+	lb.loadBalance(w, replayRequest(r.WithContext(ctx)))
+}
+
+// Context keys for per-request state
 type contextKey string
 
-const retryKey contextKey = "retry"
+const (
+	retryKey     contextKey = "retry"
+	poolKey      contextKey = "pool"
+	attemptedKey contextKey = "attempted"
+)
 
 // getRetryFromContext returns the retry count from context
 func getRetryFromContext(r *http.Request) int {
@@ -114,16 +314,116 @@ func getRetryFromContext(r *http.Request) int {
 	return 0
 }
 
+// getAttemptedFromContext returns the backends already tried for this request
+func getAttemptedFromContext(r *http.Request) []Backend {
+	if state, ok := r.Context().Value(attemptedKey).(*requestState); ok {
+		return state.attempted
+	}
+	return nil
+}
+
+// releaseConnection stops counting the request against backend and wakes a queued
+// request, unless it was already released
+func (lb *LoadBalancer) releaseConnection(r *http.Request, backend Backend) {
+	if state, ok := r.Context().Value(attemptedKey).(*requestState); ok {
+		lb.releaseConnectionState(state, backend)
+	}
+}
+
+// releaseConnectionState is releaseConnection for a request whose state is at hand
+func (lb *LoadBalancer) releaseConnectionState(state *requestState, backend Backend) {
+	if state.releaseConnection(backend) {
+		lb.queue.Signal()
+	}
+}
+
+// admit picks a backend from pool and takes a connection slot on it. A backend that
+// filled up between being picked and admitting the request is skipped (it is marked
+// saturated by then) and the algorithm picks again, so the request is rerouted rather
+// than queued behind a slow backend.
+//
+// The pick may come from a snapshot loaded before the backend was removed or drained, so
+// the backend is checked again once its slot is taken. Removal marks a backend draining
+// before waiting for its connections to finish, so a request either holds a slot the
+// removal waits for or sees the backend draining here and is rerouted; a removed backend
+// never starts a request after its removal has been seen to drain.
+func (lb *LoadBalancer) admit(pool *ServerPool, state *requestState, exclude []Backend) Backend {
+	for tries := len(pool.GetBackends()); tries > 0; tries-- {
+		peer := pool.NextAvailablePeer(exclude)
+		if peer == nil {
+			return nil
+		}
+		if state.acquireConnection(peer) {
+			if !peer.IsDraining() {
+				return peer
+			}
+			lb.releaseConnectionState(state, peer)
+			atomic.AddInt64(&lb.drainingReroutes, 1)
+			lb.logs.Debugf("🚰 [ROUTE] Backend %s started draining after it was picked, rerouting", peer.Address())
+			continue
+		}
+		atomic.AddInt64(&lb.saturationReroutes, 1)
+		if lb.logs.Routing() {
+			log.Printf("🚧 [ROUTE] Backend %s reached its %d connection limit, rerouting",
+				peer.Address(), lb.config.MaxConnectionsPerBackend)
+		}
+	}
+	return nil
+}
+
+// recordClientDisconnect counts a request abandoned by its client, separately from backend errors
+func (lb *LoadBalancer) recordClientDisconnect(r *http.Request, backend Backend) {
+	atomic.AddInt64(&lb.clientDisconnects, 1)
+
+	target := "before a backend was selected"
+	if backend != nil {
+		backend.RecordClientCancellation()
+		target = "while waiting on backend " + backend.Address()
+	}
+	log.Printf("🔕 [CANCELED] Client %s disconnected %s (%s %s)", r.RemoteAddr, target, r.Method, r.URL.Path)
+}
+
+// poolFor returns the pool a request was assigned to, defaulting to the main pool
+func (lb *LoadBalancer) poolFor(r *http.Request) *ServerPool {
+	if pool, ok := r.Context().Value(poolKey).(*ServerPool); ok {
+		return pool
+	}
+	return lb.serverPool
+}
+
+// getClientIP returns the client IP address without the port
+func getClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // ResponseRecorder wraps http.ResponseWriter to track response status for circuit breaker
 type ResponseRecorder struct {
 	http.ResponseWriter
-	backend    *Backend
+	backend    Backend
+	request    *http.Request
+	route      *RouteConfig
+	algorithm  string // when set, the response names the backend and this algorithm
 	statusCode int
+	written    int64     // response body bytes from the backend
+	firstByte  time.Time // when the backend's response headers arrived
 }
 
 // WriteHeader captures the status code and records success/failure
 func (rr *ResponseRecorder) WriteHeader(statusCode int) {
 	rr.statusCode = statusCode
+	rr.firstByte = time.Now()
+
+	if rr.algorithm != "" {
+		rr.Header().Set("X-Served-By", rr.backend.Address())
+		rr.Header().Set("X-LB-Algorithm", rr.algorithm)
+	}
+	if rr.route != nil {
+		rr.route.ResponseHeaders.Apply(rr.Header(), rr.backend, rr.request)
+	}
 
 	// Enhanced status code handling with better logging
 	if statusCode >= 500 && statusCode < 600 {
@@ -142,11 +442,11 @@ func (rr *ResponseRecorder) WriteHeader(statusCode int) {
 		}
 
 		log.Printf("🔴 [ERROR] Backend %s returned %d (%s) - consecutive errors: %d",
-			rr.backend.URL.String(), statusCode, errorCategory, rr.backend.GetConsecutiveErrors())
+			rr.backend.Address(), statusCode, errorCategory, rr.backend.GetConsecutiveErrors())
 
 		if rr.backend.IsCircuitOpen() {
 			log.Printf("🔌 [CIRCUIT] Circuit breaker OPENED for backend %s after %d consecutive errors",
-				rr.backend.URL.String(), rr.backend.GetConsecutiveErrors())
+				rr.backend.Address(), rr.backend.GetConsecutiveErrors())
 		}
 	} else if statusCode >= 200 && statusCode < 400 {
 		wasInError := rr.backend.GetConsecutiveErrors() > 0
@@ -154,102 +454,240 @@ func (rr *ResponseRecorder) WriteHeader(statusCode int) {
 
 		if wasInError {
 			log.Printf("✅ [RECOVERY] Backend %s recovered! Status: %d (errors reset to 0)",
-				rr.backend.URL.String(), statusCode)
+				rr.backend.Address(), statusCode)
 		}
+	} else if statusCode == http.StatusTooManyRequests {
+		log.Printf("🐢 [THROTTLED] Backend %s returned 429 (throttled, not backend failure)",
+			rr.backend.Address())
 	} else if statusCode >= 400 && statusCode < 500 {
 		// Client errors don't count as backend failures
 		log.Printf("⚠️ [CLIENT_ERROR] Backend %s returned %d (client error, not backend failure)",
-			rr.backend.URL.String(), statusCode)
+			rr.backend.Address(), statusCode)
 	}
 
 	rr.ResponseWriter.WriteHeader(statusCode)
 }
 
+// lbResponse returns the writer for a response the load balancer makes up itself
+// mid-proxy, so the recorder logs its status without counting it against the backend
+func lbResponse(w http.ResponseWriter, status int) http.ResponseWriter {
+	if rr, ok := w.(*ResponseRecorder); ok {
+		rr.statusCode = status
+		return rr.ResponseWriter
+	}
+	return w
+}
+
+// Write counts the response body bytes the backend sent
+func (rr *ResponseRecorder) Write(p []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(p)
+	rr.written += int64(n)
+	return n, err
+}
+
+// Flush sends buffered response data to the client, so streamed responses arrive as
+// the backend produces them
+func (rr *ResponseRecorder) Flush() {
+	if rr.statusCode == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rr.ResponseWriter).Flush()
+}
+
+// Hijack hands over the client connection for protocol upgrades such as WebSockets.
+// The reverse proxy writes the 101 response on the hijacked connection itself, so it
+// is recorded here.
+func (rr *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rr.ResponseWriter).Hijack()
+	if err == nil && rr.statusCode == 0 {
+		rr.statusCode = http.StatusSwitchingProtocols
+		rr.backend.RecordSuccess()
+	}
+	return conn, rw, err
+}
+
+// ReadFrom copies the body from src, letting the connection use sendfile or splice
+// when nothing in between needs to see the bytes
+func (rr *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rr.statusCode == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := rr.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{rr.ResponseWriter}, src)
+	}
+	rr.written += n
+	return n, err
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (rr *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
 func (lb *LoadBalancer) loadBalance(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	retryCount := getRetryFromContext(r)
 
 	// Use NextAvailablePeer to respect circuit breakers
-	peer := lb.serverPool.NextAvailablePeer()
+	pool := lb.poolFor(r)
+	r, state, release := withRequestState(r)
+	defer release()
+	attempted := state.attempted
+	// The connection slot taken here is held for as long as the backend works on the
+	// request: through the response body or an upgraded connection's lifetime, but not
+	// through a retry elsewhere
+	nextPeer := func() Backend { return lb.admit(pool, state, attempted) }
+	peer := nextPeer()
 	clientIP := r.RemoteAddr
 
+	// Optionally wait for a backend to free up instead of failing immediately
+	if peer == nil && lb.queue.Enabled() {
+		peer = lb.queue.Wait(r.Context(), nextPeer)
+	}
+
 	if peer != nil {
-		peer.AddConnection()
-		defer peer.RemoveConnection()
+		// Remember the backend so retries go elsewhere
+		state.attempted = append(state.attempted, peer)
+		defer lb.releaseConnection(r, peer)
 
 		// Create response recorder to track status codes
-		recorder := &ResponseRecorder{
-			ResponseWriter: w,
-			backend:        peer,
+		route := lb.matchRoute(r.URL.Path)
+		recorder := acquireRecorder(w, peer, r, route)
+		defer releaseRecorder(recorder)
+		if lb.config.IdentityHeaders {
+			recorder.algorithm = pool.Algorithm().Name()
 		}
 
-		// Enhanced request logging with health vs request status distinction
-		healthStatus := "✅ HEALTHY"
-		if !peer.IsAlive() {
-			healthStatus = "🔴 DOWN"
-		}
+		// Enhanced request logging with health vs request status distinction, for the
+		// requests the access log samples
+		accessLog := lb.logs.SampleAccess()
+		if accessLog {
+			healthStatus := "✅ HEALTHY"
+			if !peer.IsAlive() {
+				healthStatus = "🔴 DOWN"
+			}
+
+			circuitStatus := "🔓 CLOSED"
+			if peer.IsCircuitOpen() {
+				circuitStatus = "🔒 OPEN"
+			} else if peer.GetConsecutiveErrors() > 0 {
+				circuitStatus = fmt.Sprintf("⚠️ DEGRADED (%d errors)", peer.GetConsecutiveErrors())
+			}
 
-		circuitStatus := "🔓 CLOSED"
-		if peer.IsCircuitOpen() {
-			circuitStatus = "🔒 OPEN"
-		} else if peer.GetConsecutiveErrors() > 0 {
-			circuitStatus = fmt.Sprintf("⚠️ DEGRADED (%d errors)", peer.GetConsecutiveErrors())
+			retryInfo := ""
+			if retryCount > 0 {
+				retryInfo = fmt.Sprintf(" [RETRY %d/%d]", retryCount, lb.config.MaxRetries)
+			}
+
+			log.Printf(
+				"🎯 [ROUTE]%s %s %s from %s → backend %s (connections=%d, weight=%d, health=%s, circuit=%s)%s",
+				retryInfo, r.Method, r.URL.Path, clientIP,
+				peer.Address(),
+				peer.GetConnections(),
+				peer.GetWeight(),
+				healthStatus,
+				circuitStatus,
+				traceSuffix(r),
+			)
 		}
 
-		retryInfo := ""
-		if retryCount > 0 {
-			retryInfo = fmt.Sprintf(" [RETRY %d/%d]", retryCount, lb.config.MaxRetries)
+		outReq := r
+		if route != nil && !route.RequestHeaders.Empty() {
+			// Transform a copy so retries start from the original headers
+			outReq = r.Clone(r.Context())
+			route.RequestHeaders.Apply(outReq.Header, peer, r)
 		}
 
-		log.Printf(
-			"🎯 [ROUTE]%s %s %s from %s → backend %s (connections=%d, weight=%d, health=%s, circuit=%s)",
-			retryInfo, r.Method, r.URL.Path, clientIP,
-			peer.URL.String(),
-			peer.GetConnections(),
-			peer.Weight,
-			healthStatus,
-			circuitStatus,
-		)
+		outReq, cutoffDone := lb.armFirstByteCutoff(outReq, route)
+		requestBody := countBody(&outReq.Body)
+		served := time.Now()
+		peer.Serve(recorder, outReq)
+		cutoffDone()
+		duration := time.Since(start)
+		// The request body was sent to peer even if the attempt was retried elsewhere,
+		// but only a response it served itself counts as its response bytes
+		peer.Traffic().Request.Add(requestBody.bytesRead())
+		if state.holding == peer {
+			peer.Traffic().Response.Add(recorder.written)
+		}
 
-		peer.ReverseProxy.ServeHTTP(recorder, r)
+		// Feed latency-based algorithms the attempt's latency, unless it failed or was
+		// retried elsewhere (which releases the connection held on peer)
+		if observer, ok := pool.Algorithm().(LatencyObserver); ok &&
+			state.holding == peer && recorder.statusCode != 0 && recorder.statusCode < 500 {
+			observer.ObserveLatency(peer, time.Since(served), LatencyInBand)
+		}
+		// Time the backend's own response, not one made up by the load balancer or
+		// served by a retry elsewhere
+		if state.holding == peer && !recorder.firstByte.IsZero() {
+			peer.Timing().Observe(recorder.firstByte.Sub(served), time.Since(served))
+		}
+		if retryCount == 0 {
+			// Retries run inside the first attempt, so this times the whole request
+			atomic.AddInt64(&lb.requests, 1)
+			lb.latency.Record(duration)
+		}
 
-		// Enhanced response logging with success/failure indication
-		duration := time.Since(start)
-		statusInfo := ""
-		statusEmoji := "✅"
-
-		if recorder.statusCode != 0 {
-			statusInfo = fmt.Sprintf("[%d]", recorder.statusCode)
-			if recorder.statusCode >= 500 {
-				statusEmoji = "🔴"
-			} else if recorder.statusCode >= 400 {
-				statusEmoji = "⚠️"
+		if accessLog {
+			// Enhanced response logging with success/failure indication
+			statusInfo := ""
+			statusEmoji := "✅"
+
+			if recorder.statusCode != 0 {
+				statusInfo = fmt.Sprintf("[%d]", recorder.statusCode)
+				if recorder.statusCode >= 500 {
+					statusEmoji = "🔴"
+				} else if recorder.statusCode >= 400 {
+					statusEmoji = "⚠️"
+				}
 			}
+
+			log.Printf(
+				"%s [RESPONSE] %s %s served by %s in %v %s%s",
+				statusEmoji, r.Method, r.URL.Path, peer.Address(), duration, statusInfo, traceSuffix(r),
+			)
 		}
+		return
+	}
 
-		log.Printf(
-			"%s [RESPONSE] %s %s served by %s in %v %s",
-			statusEmoji, r.Method, r.URL.Path, peer.URL.String(), duration, statusInfo,
-		)
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		lb.recordClientDisconnect(r, nil)
+		return
+	}
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		lb.writeDeadlineExceeded(w, r, "an available backend")
 		return
 	}
 
 	// Enhanced failure logging with pool status
-	poolStats := lb.serverPool.GetPoolSummary()
-	log.Printf("❌ [FAIL] No available backend for %s %s from %s", r.Method, r.URL.Path, clientIP)
+	poolStats := pool.GetPoolSummary()
+	log.Printf("❌ [FAIL] No available backend for %s %s from %s%s", r.Method, r.URL.Path, clientIP, traceSuffix(r))
 	log.Printf("📊 [POOL_STATUS] Total: %d, Alive: %d, Available: %d (circuits closed: %d)",
 		poolStats["total"], poolStats["alive"], poolStats["available"], poolStats["circuits_closed"])
 
-	http.Error(w, "Service not available", http.StatusServiceUnavailable)
+	lb.writeUnavailable(w, r)
 }
 
 // healthCheck endpoint
 func (lb *LoadBalancer) healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	stats := lb.serverPool.GetStats()
+	response := HealthResponse{
+		SchemaVersion: StatusSchemaVersion,
+		PoolStats:     lb.serverPool.GetStats(),
+	}
+
+	// A draining load balancer reports itself unhealthy so whatever fronts it moves on
+	if lb.drainer.Draining() {
+		response.Drain = lb.drainer.GetStats()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -259,31 +697,83 @@ func (lb *LoadBalancer) healthCheck(w http.ResponseWriter, r *http.Request) {
 func (lb *LoadBalancer) stats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	stats := lb.serverPool.GetStats()
+	if err := json.NewEncoder(w).Encode(lb.Stats()); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
 
-	// Add additional runtime stats
-	extendedStats := map[string]interface{}{
-		"load_balancer": stats,
-		"config": map[string]interface{}{
-			"port":                  lb.config.Port,
-			"health_check_interval": lb.config.HealthCheckInterval,
-			"max_retries":           lb.config.MaxRetries,
-			"algorithm":             lb.config.Algorithm,
+// Stats returns the payload served at /stats
+func (lb *LoadBalancer) Stats() StatsResponse {
+	return StatsResponse{
+		SchemaVersion: StatusSchemaVersion,
+		LoadBalancer:  lb.serverPool.GetStats(),
+		Build:         BuildInfo(),
+		Config: StatsConfig{
+			Port:                lb.config.Port,
+			HealthCheckInterval: lb.config.HealthCheckInterval,
+			MaxRetries:          lb.config.MaxRetries,
+			Algorithm:           lb.AlgorithmName(),
+			IdentityHeaders:     lb.config.IdentityHeaders,
+			HealthCheck:         lb.config.HealthCheck.Type,
 		},
-		"circuit_breaker": map[string]interface{}{
-			"max_consecutive_errors":  10, // Default from backend
-			"circuit_timeout_seconds": 30, // Default from backend
+		RateLimit:        lb.rateLimiter.GetStats(),
+		ConcurrencyLimit: lb.concurrencyLimiter.GetStats(),
+		Overload:         lb.overload.GetStats(),
+		Budget:           lb.budget.GetStats(),
+		Queue:            lb.queue.GetStats(),
+		ACL:              lb.acl.GetStats(),
+		AdminAuth:        lb.adminAuth.GetStats(),
+		Drain:            lb.drainer.GetStats(),
+		Logging:          lb.logs.GetStats(),
+		Webhooks:         lb.webhooks.GetStats(),
+		Cluster:          lb.cluster.GetStats(),
+		StatsExport:      lb.exporter.GetStats(),
+		Weights:          lb.weightStore.GetStats(),
+		StateStore:       lb.stateStore.GetStats(),
+		Experiment:       lb.experiment.GetStats(),
+		ClientLimits:     lb.clientLimiter.GetStats(),
+		Cache:            lb.cache.GetStats(),
+		ProxyBuffers:     lb.bufferPool.GetStats(),
+		Tracing:          lb.tracingStats(),
+		RemovalDrain:     lb.retireStats(),
+		Routes:           lb.routeMetrics.GetStats(),
+		WarmPool:         lb.warmPool.GetStats(),
+		Upstream:         lb.upstream.GetStats(),
+		BackendAdmission: map[string]interface{}{
+			"max_connections_per_backend": lb.config.MaxConnectionsPerBackend,
+			"rerouted":                    atomic.LoadInt64(&lb.saturationReroutes),
+			"rerouted_draining":           atomic.LoadInt64(&lb.drainingReroutes), // picked from a snapshot older than a drain or removal
 		},
-		"runtime_info": map[string]interface{}{
-			"uptime_seconds": time.Since(time.Now()).Seconds(), // You might want to track actual start time
-			"total_requests": "N/A",                            // You could add request counters
+		Requests:          atomic.LoadInt64(&lb.requests),
+		Traffic:           lb.traffic.Report(),
+		Latency:           lb.latency.Summary(),
+		ClientDisconnects: atomic.LoadInt64(&lb.clientDisconnects),
+		Retries:           atomic.LoadInt64(&lb.retries),
+		FirstByteReroutes: atomic.LoadInt64(&lb.firstByteReroutes),
+		ProxyErrors:       lb.proxyErrorStats(),
+		FaultInjection: FaultInjectionStats{
+			Aborted: atomic.LoadInt64(&lb.faultsAborted),
+			Delayed: atomic.LoadInt64(&lb.faultsDelayed),
 		},
-		"timestamp": time.Now().Unix(),
-	}
-
-	if err := json.NewEncoder(w).Encode(extendedStats); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		Deadlines: DeadlineStats{
+			MaxSeconds:            lb.config.MaxRequestTimeout.Seconds(),
+			RequestTimeoutSeconds: lb.config.RequestTimeout.Seconds(),
+			RequestTimeouts:       atomic.LoadInt64(&lb.requestTimeouts),
+			Applied:               atomic.LoadInt64(&lb.deadlinesApplied),
+			Capped:                atomic.LoadInt64(&lb.deadlinesCapped),
+			Exceeded:              atomic.LoadInt64(&lb.deadlinesExceeded),
+			Invalid:               atomic.LoadInt64(&lb.deadlinesInvalid),
+		},
+		CircuitBreaker: CircuitBreakerDefaults{
+			MaxConsecutiveErrors:  10, // Default from backend
+			CircuitTimeoutSeconds: 30, // Default from backend
+		},
+		RuntimeInfo: RuntimeInfo{
+			UptimeSeconds: time.Since(lb.started).Seconds(),
+			TotalRequests: atomic.LoadInt64(&lb.requests),
+		},
+		Timestamp: time.Now().Unix(),
 	}
 }
 
@@ -292,45 +782,38 @@ func (lb *LoadBalancer) circuitBreakerStatus(w http.ResponseWriter, r *http.Requ
 	w.Header().Set("Content-Type", "application/json")
 
 	backends := lb.serverPool.GetBackends()
-	circuitStatus := make(map[string]interface{})
-
-	totalBackends := len(backends)
-	availableBackends := 0
-	circuitsOpen := 0
+	response := CircuitBreakersResponse{
+		SchemaVersion:   StatusSchemaVersion,
+		CircuitBreakers: make(map[string]CircuitBreakerStatus, len(backends)),
+		Summary:         CircuitBreakerSummary{TotalBackends: len(backends)},
+		Timestamp:       time.Now().Unix(),
+	}
 
 	for _, backend := range backends {
 		isAvailable := backend.IsAvailable()
 		isCircuitOpen := backend.IsCircuitOpen()
 
 		if isAvailable {
-			availableBackends++
+			response.Summary.AvailableBackends++
 		}
 		if isCircuitOpen {
-			circuitsOpen++
+			response.Summary.CircuitsOpen++
 		}
 
-		status := map[string]interface{}{
-			"url":                backend.URL.String(),
-			"consecutive_errors": backend.GetConsecutiveErrors(),
-			"circuit_open":       isCircuitOpen,
-			"available":          isAvailable,
-			"alive":              backend.IsAlive(),
-			"connections":        backend.GetConnections(),
-			"weight":             backend.Weight,
+		response.CircuitBreakers[backend.Address()] = CircuitBreakerStatus{
+			URL:               backend.Address(),
+			ConsecutiveErrors: backend.GetConsecutiveErrors(),
+			CircuitOpen:       isCircuitOpen,
+			Available:         isAvailable,
+			Alive:             backend.IsAlive(),
+			Connections:       backend.GetConnections(),
+			Weight:            backend.GetWeight(),
 		}
-		circuitStatus[backend.URL.String()] = status
 	}
 
-	response := map[string]interface{}{
-		"circuit_breakers": circuitStatus,
-		"summary": map[string]interface{}{
-			"total_backends":     totalBackends,
-			"available_backends": availableBackends,
-			"circuits_open":      circuitsOpen,
-			"circuits_closed":    totalBackends - circuitsOpen,
-			"health_percentage":  float64(availableBackends) / float64(totalBackends) * 100,
-		},
-		"timestamp": time.Now().Unix(),
+	response.Summary.CircuitsClosed = len(backends) - response.Summary.CircuitsOpen
+	if len(backends) > 0 {
+		response.Summary.HealthPercentage = float64(response.Summary.AvailableBackends) / float64(len(backends)) * 100
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -346,31 +829,103 @@ func (lb *LoadBalancer) Start() {
 	mux.HandleFunc("/health", lb.healthCheck)
 	mux.HandleFunc("/stats", lb.stats)
 	mux.HandleFunc("/circuit-breakers", lb.circuitBreakerStatus)
-	mux.HandleFunc("/", lb.loadBalance)
+	mux.HandleFunc("/version", lb.versionHandler)
+	mux.HandleFunc("/schema", lb.schemaHandler)
+	mux.HandleFunc("/metrics", lb.metricsHandler)
+	if lb.cluster != nil {
+		mux.HandleFunc("/cluster/state", lb.clusterState)
+	}
+	mux.Handle("/", lb.proxyHandler())
+	lb.registerAdminRoutes(mux)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", lb.config.Port),
 		Handler:      mux,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: lb.writeTimeout(),
 		IdleTimeout:  60 * time.Second,
 	}
+	lb.server.Store(server)
 
 	// Start health checking
 	go lb.healthChecking()
+	if lb.warmPool.Enabled() {
+		go lb.keepWarm()
+	}
+	lb.watchDumpSignal(lb.config.DumpDir)
 
-	log.Printf("🚀 [START] Load Balancer started at :%s with %s algorithm", lb.config.Port, lb.config.Algorithm)
+	log.Printf("🚀 [START] Load Balancer %s started at :%s with %s algorithm", version, lb.config.Port, lb.config.Algorithm)
 	log.Printf("🏥 [INFO] Health checks available at /health")
 	log.Printf("📊 [INFO] Statistics available at /stats")
 	log.Printf("🔌 [INFO] Circuit breaker status available at /circuit-breakers")
+	log.Printf("🏷️ [INFO] Build information available at /version")
+	log.Printf("📈 [INFO] Prometheus metrics available at /metrics")
+	log.Printf("📐 [INFO] Status schema v%d available at /schema", StatusSchemaVersion)
+	log.Printf("🛠️ [INFO] Admin API available at /admin/")
 	log.Printf("⚙️ [CONFIG] Max retries: %d, Health check interval: %ds",
 		lb.config.MaxRetries, lb.config.HealthCheckInterval)
+	if lb.warmPool.Enabled() {
+		log.Printf("🔥 [CONFIG] Warm pool: %d idle connections per backend, topped up every %v",
+			lb.config.WarmPool.Connections, lb.warmPool.config.Interval)
+	}
+	if lb.queue.Enabled() {
+		log.Printf("⏳ [CONFIG] Request queue: max %d waiting, timeout %v",
+			lb.config.Queue.MaxSize, lb.config.Queue.Timeout)
+	}
+
+	if lb.config.Acceptors > 1 {
+		lb.serveMultiAcceptor(server)
+		return
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if err := server.ListenAndServe(); err != nil {
+	if err := server.Serve(lb.clientLimiter.Wrap(listener)); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// serveMultiAcceptor opens one SO_REUSEPORT listener per configured acceptor and runs an
+// independent accept loop on each, avoiding contention on a single accept queue
+func (lb *LoadBalancer) serveMultiAcceptor(server *http.Server) {
+	errs := make(chan error, lb.config.Acceptors)
+	for i := 0; i < lb.config.Acceptors; i++ {
+		listener, err := listenReusePort(server.Addr)
+		if err != nil {
+			log.Fatalf("Failed to open acceptor %d: %v", i, err)
+		}
+		go func() {
+			errs <- server.Serve(lb.clientLimiter.Wrap(listener))
+		}()
+	}
+
+	log.Printf("🔀 [CONFIG] Accepting connections on %d SO_REUSEPORT listeners", lb.config.Acceptors)
+	log.Fatal(<-errs)
+}
+
+// proxyHandler wraps loadBalance with the request middleware chain
+func (lb *LoadBalancer) proxyHandler() http.Handler {
+	var handler http.Handler = http.HandlerFunc(lb.loadBalance)
+	handler = lb.retryBodyMiddleware(handler)
+	handler = lb.bodyLimitMiddleware(handler)
+	handler = lb.faultMiddleware(handler)
+	handler = lb.cacheMiddleware(handler)
+	handler = lb.concurrencyMiddleware(handler)
+	handler = lb.overloadMiddleware(handler)
+	handler = lb.budgetMiddleware(handler)
+	handler = lb.rateLimitMiddleware(handler)
+	handler = lb.deadlineMiddleware(handler)
+	handler = lb.experimentMiddleware(handler)
+	handler = lb.aclMiddleware(handler)
+	handler = lb.drainMiddleware(handler)
+	handler = lb.routeMetricsMiddleware(handler)
+	handler = lb.traceMiddleware(handler)
+	return handler
+}
+
 // healthChecking runs periodic health checks on backends
 func (lb *LoadBalancer) healthChecking() {
 	interval := time.Duration(lb.config.HealthCheckInterval) * time.Second
@@ -378,11 +933,25 @@ func (lb *LoadBalancer) healthChecking() {
 	defer ticker.Stop()
 
 	// Initial health check
-	log.Println("🏥 [HEALTH] Running initial health check...")
-	lb.serverPool.HealthCheck()
+	lb.logs.Debugf("🏥 [HEALTH] Running initial health check...")
+	lb.checkPools()
 
 	for range ticker.C {
-		log.Println("🏥 [HEALTH] Running periodic health check...")
-		lb.serverPool.HealthCheck()
+		lb.logs.Debugf("🏥 [HEALTH] Running periodic health check...")
+		lb.checkPools()
+	}
+}
+
+// checkPools health checks every pool with backends and wakes queued requests
+func (lb *LoadBalancer) checkPools() {
+	lb.serverPool.HealthCheck()
+	if len(lb.quarantinePool.GetBackends()) > 0 {
+		lb.quarantinePool.HealthCheck()
+	}
+	if lb.experiment != nil {
+		for _, variant := range lb.experiment.variants {
+			variant.pool.HealthCheck()
+		}
 	}
+	lb.queue.Signal()
 }
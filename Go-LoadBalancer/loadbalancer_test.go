@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The load balancer logs every request, retry and circuit change
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestLoadBalancer returns a load balancer over the given backend servers, and a
+// server proxying through it
+func newTestLoadBalancer(t testing.TB, config *Config, backends ...*httptest.Server) (*LoadBalancer, *httptest.Server) {
+	t.Helper()
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = "round-robin"
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.MaxRetryBodyBytes == 0 {
+		config.MaxRetryBodyBytes = 64 * 1024
+	}
+	config.Logging.DisableAccessLog = true
+
+	lb := NewLoadBalancer(config)
+	for _, backend := range backends {
+		if err := lb.AddBackend(backend.URL, 1); err != nil {
+			t.Fatalf("AddBackend(%s): %v", backend.URL, err)
+		}
+	}
+	proxy := httptest.NewServer(lb.proxyHandler())
+	t.Cleanup(proxy.Close)
+	return lb, proxy
+}
+
+// newStatusBackend returns a backend answering every request with status
+func newStatusBackend(t testing.TB, status int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// get fetches url and returns the response with its body read
+func get(t testing.TB, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp, string(body)
+}
+
+// waitForNoConnections waits for the requests counted against backend to finish, which
+// can be a moment after the client has its response
+func waitForNoConnections(t testing.TB, backend Backend) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for backend.GetConnections() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend %s still holds %d connections", backend.Address(), backend.GetConnections())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetriedStatusCountsAgainstFailedBackend(t *testing.T) {
+	failing := newStatusBackend(t, http.StatusBadGateway)
+	healthy := newStatusBackend(t, http.StatusOK)
+	lb, proxy := newTestLoadBalancer(t, nil, failing, healthy)
+	failed := lb.serverPool.FindBackend(failing.URL)
+
+	for i := 0; i < 30 && !failed.IsCircuitOpen(); i++ {
+		if resp, _ := get(t, proxy.URL); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, want the retry's %d", i, resp.StatusCode, http.StatusOK)
+		}
+	}
+	if !failed.IsCircuitOpen() {
+		t.Fatalf("circuit of a backend that always answers 502 is closed (consecutive errors %d)",
+			failed.GetConsecutiveErrors())
+	}
+}
+
+func TestRetriedResponseNamesServingBackend(t *testing.T) {
+	failing := newStatusBackend(t, http.StatusBadGateway)
+	healthy := newStatusBackend(t, http.StatusOK)
+	_, proxy := newTestLoadBalancer(t, &Config{IdentityHeaders: true}, failing, healthy)
+
+	// Round robin sends every other request to the failing backend first
+	for i := 0; i < 4; i++ {
+		resp, _ := get(t, proxy.URL)
+		if got := resp.Header.Values("X-Served-By"); len(got) != 1 || got[0] != healthy.URL {
+			t.Fatalf("request %d: X-Served-By = %q, want [%s]", i, got, healthy.URL)
+		}
+	}
+}
+
+func TestRetriedResponseGetsRouteHeadersOnce(t *testing.T) {
+	failing := newStatusBackend(t, http.StatusBadGateway)
+	healthy := newStatusBackend(t, http.StatusOK)
+	config := &Config{Routes: []RouteConfig{{
+		PathPrefix:      "/",
+		ResponseHeaders: HeaderRules{Add: map[string]string{"X-Via": "{backend}"}},
+	}}}
+	_, proxy := newTestLoadBalancer(t, config, failing, healthy)
+
+	for i := 0; i < 4; i++ {
+		resp, _ := get(t, proxy.URL)
+		if got := resp.Header.Values("X-Via"); len(got) != 1 || got[0] != healthy.URL {
+			t.Fatalf("request %d: X-Via = %q, want [%s]", i, got, healthy.URL)
+		}
+	}
+}
+
+func TestRetriedResponseBytesCountForServingBackend(t *testing.T) {
+	failing := newStatusBackend(t, http.StatusBadGateway)
+	healthy := newStatusBackend(t, http.StatusOK)
+	lb, proxy := newTestLoadBalancer(t, nil, failing, healthy)
+
+	var written int64
+	for i := 0; i < 4; i++ {
+		_, body := get(t, proxy.URL)
+		written += int64(len(body))
+	}
+	if got := lb.serverPool.FindBackend(failing.URL).Traffic().Response.Total(); got != 0 {
+		t.Errorf("failing backend credited with %d response bytes, want 0", got)
+	}
+	if got := lb.serverPool.FindBackend(healthy.URL).Traffic().Response.Total(); got != written {
+		t.Errorf("serving backend credited with %d response bytes, want %d", got, written)
+	}
+}
+
+func TestStreamedResponseFlushesThroughProxy(t *testing.T) {
+	// The backend holds the second event back until the client has the first, so the
+	// test only finishes if each flush reaches the client on its own
+	firstRead := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-firstRead:
+		case <-time.After(5 * time.Second):
+			return
+		}
+		io.WriteString(w, "data: second\n\n")
+	}))
+	t.Cleanup(backend.Close)
+	lb, proxy := newTestLoadBalancer(t, nil, backend)
+
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	for _, want := range []string{"data: first\n", "\n", "data: second\n", "\n"} {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading %q: %v", want, err)
+		}
+		if line != want {
+			t.Fatalf("read %q, want %q", line, want)
+		}
+		if want == "data: first\n" {
+			close(firstRead)
+		}
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	if got := lb.serverPool.FindBackend(backend.URL).Traffic().Response.Total(); got != int64(len("data: first\n\ndata: second\n\n")) {
+		t.Errorf("backend credited with %d response bytes", got)
+	}
+}
+
+func TestUpgradePassesThroughProxy(t *testing.T) {
+	// The backend accepts a WebSocket-style upgrade and echoes lines until the client
+	// hangs up
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString(line)
+			rw.Flush()
+		}
+	}))
+	t.Cleanup(backend.Close)
+	lb, proxy := newTestLoadBalancer(t, nil, backend)
+	upgraded := lb.serverPool.FindBackend(backend.URL)
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: lb\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+	client := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	for _, message := range []string{"ping\n", "pong\n"} {
+		io.WriteString(conn, message)
+		echo, err := client.ReadString('\n')
+		if err != nil || echo != message {
+			t.Fatalf("echo of %q: %q, %v", message, echo, err)
+		}
+	}
+	if got := upgraded.GetConnections(); got != 1 {
+		t.Errorf("backend holds %d connections during the upgrade, want 1", got)
+	}
+
+	conn.Close()
+	waitForNoConnections(t, upgraded)
+}
+
+func TestResponseRecorderReadFrom(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backend := newTestBackends(t, 1)[0]
+	rr := acquireRecorder(w, backend, r, nil)
+	defer releaseRecorder(rr)
+
+	n, err := rr.ReadFrom(strings.NewReader("streamed body"))
+	if err != nil || n != int64(len("streamed body")) {
+		t.Fatalf("ReadFrom = %d, %v", n, err)
+	}
+	if rr.statusCode != http.StatusOK || w.Code != http.StatusOK {
+		t.Errorf("status recorded %d, written %d, want %d", rr.statusCode, w.Code, http.StatusOK)
+	}
+	if rr.written != n || w.Body.String() != "streamed body" {
+		t.Errorf("recorded %d bytes, body %q", rr.written, w.Body.String())
+	}
+}
+
+func TestRetriesReleaseEveryConnection(t *testing.T) {
+	failing := newStatusBackend(t, http.StatusBadGateway)
+	aborting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler) // the proxy gets a transport error, not a status
+	}))
+	t.Cleanup(aborting.Close)
+	healthy := newStatusBackend(t, http.StatusOK)
+	lb, proxy := newTestLoadBalancer(t, nil, failing, aborting, healthy)
+
+	for i := 0; i < 6; i++ {
+		if resp, _ := get(t, proxy.URL); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, want the retry's %d", i, resp.StatusCode, http.StatusOK)
+		}
+	}
+	for _, backend := range lb.serverPool.GetBackends() {
+		waitForNoConnections(t, backend)
+	}
+}
+
+func TestAbortedResponseReleasesConnection(t *testing.T) {
+	// The backend dies mid-body, so the proxy aborts the client's response by panicking
+	// with http.ErrAbortHandler from inside loadBalance
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(backend.Close)
+	lb, proxy := newTestLoadBalancer(t, nil, backend)
+
+	resp, err := http.Get(proxy.URL)
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Fatal("the aborted response reached the client whole")
+	}
+	waitForNoConnections(t, lb.serverPool.FindBackend(backend.URL))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newLoadTestBackends starts n backends that name themselves in X-Backend and answer
+// every request with payloadBytes of body
+func newLoadTestBackends(tb testing.TB, n, payloadBytes int) []*httptest.Server {
+	tb.Helper()
+	payload := []byte(strings.Repeat("x", payloadBytes))
+	backends := make([]*httptest.Server, n)
+	for i := range backends {
+		name := fmt.Sprintf("backend-%d", i+1)
+		backends[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Backend", name)
+			w.Write(payload)
+		}))
+		tb.Cleanup(backends[i].Close)
+	}
+	return backends
+}
+
+// newLoadTestLoadBalancer proxies to backends with algorithm, weighting the i-th backend
+// i+1 and health checking them once so probe latency estimates are seeded
+func newLoadTestLoadBalancer(tb testing.TB, algorithm string, backends []*httptest.Server) *httptest.Server {
+	tb.Helper()
+	lb, proxy := newTestLoadBalancer(tb, &Config{Algorithm: algorithm}, backends...)
+	for i, backend := range backends {
+		lb.serverPool.FindBackend(backend.URL).SetWeight(i + 1)
+	}
+	lb.serverPool.HealthCheck()
+	return proxy
+}
+
+// BenchmarkAlgorithms drives parallel requests through the whole proxy, one
+// sub-benchmark per algorithm, reporting allocations and latency percentiles. The
+// backends, the client and the load balancer share the process, so the allocation
+// figures cover all three.
+func BenchmarkAlgorithms(b *testing.B) {
+	backends := newLoadTestBackends(b, 5, 1024)
+	for _, algorithm := range algorithmNames {
+		b.Run(algorithm, func(b *testing.B) {
+			proxy := newLoadTestLoadBalancer(b, algorithm, backends)
+			client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 256}}
+			defer client.CloseIdleConnections()
+			latencies := NewLatencyWindow(100000)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					start := time.Now()
+					resp, err := client.Get(proxy.URL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						b.Errorf("status %d", resp.StatusCode)
+						return
+					}
+					latencies.Record(time.Since(start))
+				}
+			})
+			b.StopTimer()
+
+			summary := latencies.Summary()
+			b.ReportMetric(summary.P50Ms, "p50-ms")
+			b.ReportMetric(summary.P99Ms, "p99-ms")
+		})
+	}
+}
+
+// TestLoadBalancerIntegration sends concurrent load through every algorithm to
+// in-process backends and checks every request is served, and that the round-robin
+// algorithms spread it as they promise
+func TestLoadBalancerIntegration(t *testing.T) {
+	const (
+		workers           = 20
+		requestsPerWorker = 30 // 600 requests, a multiple of the total weight 15
+	)
+	backends := newLoadTestBackends(t, 5, 1024)
+
+	for _, algorithm := range algorithmNames {
+		t.Run(algorithm, func(t *testing.T) {
+			proxy := newLoadTestLoadBalancer(t, algorithm, backends)
+			client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: workers}, Timeout: 10 * time.Second}
+			defer client.CloseIdleConnections()
+
+			var mux sync.Mutex
+			distribution := make(map[string]int)
+			var wg sync.WaitGroup
+			start := time.Now()
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < requestsPerWorker; i++ {
+						resp, err := client.Get(proxy.URL)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						body, err := io.ReadAll(resp.Body)
+						resp.Body.Close()
+						if err != nil || resp.StatusCode != http.StatusOK || len(body) != 1024 {
+							t.Errorf("status %d, %d body bytes, error %v", resp.StatusCode, len(body), err)
+							return
+						}
+						mux.Lock()
+						distribution[resp.Header.Get("X-Backend")]++
+						mux.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			t.Logf("%d requests in %v, distribution %v", workers*requestsPerWorker, time.Since(start), distribution)
+
+			total := 0
+			for _, served := range distribution {
+				total += served
+			}
+			if total != workers*requestsPerWorker {
+				t.Fatalf("%d requests served, want %d", total, workers*requestsPerWorker)
+			}
+
+			for i := range backends {
+				name := fmt.Sprintf("backend-%d", i+1)
+				var want int
+				switch algorithm {
+				case "round-robin":
+					want = total / len(backends)
+				case "weighted":
+					want = total * (i + 1) / 15
+				default:
+					continue
+				}
+				if distribution[name] != want {
+					t.Errorf("%s served %d requests, want %d", name, distribution[name], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// Log levels, from the most verbose
+const (
+	LogDebug int32 = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// parseLogLevel returns the level with the given name; "" means info
+func parseLogLevel(name string) (int32, error) {
+	if name == "" {
+		return LogInfo, nil
+	}
+	for level, levelName := range logLevelNames {
+		if name == levelName {
+			return int32(level), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+}
+
+// LogControl holds the logging settings that can change at runtime: the level of the
+// chattier messages, whether per-request access lines are written and for what fraction
+// of requests, and per-request routing decisions
+type LogControl struct {
+	level      atomic.Int32
+	accessLog  atomic.Bool
+	sampleRate atomic.Uint64 // float64 bits, 0-1
+	routing    atomic.Bool
+
+	// Metrics
+	accessLogged  int64
+	accessSkipped int64
+}
+
+// Validate checks the level name and sample rate
+func (config LoggingConfig) Validate() error {
+	if _, err := parseLogLevel(config.Level); err != nil {
+		return err
+	}
+	if config.AccessSampleRate < 0 || config.AccessSampleRate > 1 {
+		return fmt.Errorf("access log sample rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// NewLogControl creates a log control from a validated startup configuration
+func NewLogControl(config LoggingConfig, logRouting bool) *LogControl {
+	lc := &LogControl{}
+	level, err := parseLogLevel(config.Level)
+	if err != nil {
+		level = LogInfo
+	}
+	rate := config.AccessSampleRate
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	lc.level.Store(level)
+	lc.accessLog.Store(!config.DisableAccessLog)
+	lc.sampleRate.Store(math.Float64bits(rate))
+	lc.routing.Store(logRouting)
+	return lc
+}
+
+// Enabled reports whether messages at level are written; without a log control
+// everything from info up is
+func (lc *LogControl) Enabled(level int32) bool {
+	if lc == nil {
+		return level >= LogInfo
+	}
+	return level >= lc.level.Load()
+}
+
+// Debugf logs a message only at debug level
+func (lc *LogControl) Debugf(format string, args ...interface{}) {
+	if lc.Enabled(LogDebug) {
+		log.Printf(format, args...)
+	}
+}
+
+// Infof logs a message unless the level is warn or above
+func (lc *LogControl) Infof(format string, args ...interface{}) {
+	if lc.Enabled(LogInfo) {
+		log.Printf(format, args...)
+	}
+}
+
+// SampleAccess decides whether to write the access log lines of one request
+func (lc *LogControl) SampleAccess() bool {
+	if !lc.accessLog.Load() || !lc.Enabled(LogInfo) {
+		atomic.AddInt64(&lc.accessSkipped, 1)
+		return false
+	}
+	if rate := math.Float64frombits(lc.sampleRate.Load()); rate < 1 && rand.Float64() >= rate {
+		atomic.AddInt64(&lc.accessSkipped, 1)
+		return false
+	}
+	atomic.AddInt64(&lc.accessLogged, 1)
+	return true
+}
+
+// Routing reports whether every backend selection is logged
+func (lc *LogControl) Routing() bool {
+	return lc != nil && lc.routing.Load()
+}
+
+// GetStats returns the current settings and access log counters
+func (lc *LogControl) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"level":              logLevelNames[lc.level.Load()],
+		"access_log":         lc.accessLog.Load(),
+		"access_sample_rate": math.Float64frombits(lc.sampleRate.Load()),
+		"routing":            lc.routing.Load(),
+		"access_logged":      atomic.LoadInt64(&lc.accessLogged),
+		"access_skipped":     atomic.LoadInt64(&lc.accessSkipped),
+	}
+}
+
+// adminLogging returns (GET) or changes (PUT) the logging settings. PUT changes only the
+// fields given, e.g. {"level": "debug", "access_sample_rate": 0.1}.
+func (lb *LoadBalancer) adminLogging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Level            *string  `json:"level"`
+			AccessLog        *bool    `json:"access_log"`
+			AccessSampleRate *float64 `json:"access_sample_rate"`
+			Routing          *bool    `json:"routing"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		var level int32
+		if req.Level != nil {
+			var err error
+			if level, err = parseLogLevel(*req.Level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.AccessSampleRate != nil && (*req.AccessSampleRate < 0 || *req.AccessSampleRate > 1) {
+			http.Error(w, "access_sample_rate must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		if req.Level != nil {
+			lb.logs.level.Store(level)
+		}
+		if req.AccessLog != nil {
+			lb.logs.accessLog.Store(*req.AccessLog)
+		}
+		if req.AccessSampleRate != nil {
+			lb.logs.sampleRate.Store(math.Float64bits(*req.AccessSampleRate))
+		}
+		if req.Routing != nil {
+			lb.logs.routing.Store(*req.Routing)
+		}
+		stats := lb.logs.GetStats()
+		log.Printf("📝 [LOGGING] Changed by %s: level=%s, access_log=%v, access_sample_rate=%g, routing=%v",
+			adminIdentity(r), stats["level"], stats["access_log"], stats["access_sample_rate"], stats["routing"])
+		lb.events.Record(EventAdmin, "", "", "logging changed by %s", adminIdentity(r))
+	default:
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, lb.logs.GetStats())
+}
@@ -1,16 +1,213 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 )
 
 func main() {
+	simulation := flag.String("simulate", "", "run the simulation in this JSON file against synthetic in-process backends and exit")
+	simulationTrace := flag.String("simulate-trace", "", "directory virtual clock simulations write every algorithm's routing decisions to, as <algorithm>.csv")
+	simulationJSON := flag.Bool("simulate-json", false, "print simulation results as JSON")
+	showVersion := flag.Bool("version", false, "print build information and exit")
+	port := flag.String("port", "3030", "port to listen on")
+	algorithm := flag.String("algorithm", "round-robin", "load balancing algorithm: round-robin, weighted, least-connections, ewma (health check latency) or least-latency (request latency)")
+	backendList := flag.String("backends", "", "comma separated backends as URL or URL=weight (defaults to localhost:3001-3006)")
+	healthInterval := flag.Int("health-interval", 30, "seconds between health checks")
+	healthType := flag.String("health-check", "http", "health check type: http, tcp or script")
+	healthPath := flag.String("health-path", "", "path http health checks expect 2xx from (default /health, falling back to /)")
+	healthCommand := flag.String("health-command", "", "command run per backend by script health checks, with BACKEND_URL and BACKEND_HOST set")
+	healthTimeout := flag.Duration("health-timeout", 2*time.Second, "timeout of each health check")
+	healthUserAgent := flag.String("health-user-agent", "", "User-Agent sent with http health checks (default Go's)")
+	healthHeaders := flag.String("health-headers", "", "JSON file of headers sent with http health checks, to every backend and per backend URL (a Host entry overrides the request host)")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error (changeable at /admin/logging)")
+	accessLog := flag.Bool("access-log", true, "log a route and a response line per request")
+	accessLogSample := flag.Float64("access-log-sample", 1, "fraction of requests written to the access log (0-1)")
+	requestTimeoutFlag := flag.Duration("request-timeout", 0, "answer 504 when a proxied request takes longer than this, retries included (0 for no limit)")
+	maxRequestTimeout := flag.Duration("max-request-timeout", 0, "honor X-Request-Timeout and grpc-timeout deadlines up to this long (0 ignores them)")
+	identityHeaders := flag.Bool("identity-headers", false, "add X-Served-By and X-LB-Algorithm headers to proxied responses")
+	maxBackendConns := flag.Int("max-backend-connections", 0, "concurrent requests each backend is admitted; requests over it are rerouted (0 for no limit)")
+	removalDrainTimeout := flag.Duration("removal-drain-timeout", 30*time.Second, "how long a removed backend may finish its in-flight requests before it is released")
+	routeMetricsCap := flag.Int("route-metrics-cap", 100, "distinct routes (route prefixes, else paths) broken down in /stats and /metrics; later ones count as \"other\" (0 disables)")
+	warmConns := flag.Int("warm-connections", 0, "idle keep-alive connections kept open to each backend so cold requests skip connection setup (0 disables)")
+	warmInterval := flag.Duration("warm-interval", 30*time.Second, "how often the warm connections are topped up; keep it under the backends' idle timeout")
+	upstreamCA := flag.String("upstream-ca", "", "PEM file of CA certificates https backends are verified against (default: system roots)")
+	upstreamInsecure := flag.Bool("upstream-insecure", false, "accept any https backend certificate, e.g. self-signed test backends")
+	upstreamSessionCache := flag.Int("upstream-tls-session-cache", 64, "TLS sessions kept for resuming connections to https backends (0 makes every handshake a full one)")
+	traceHeaders := flag.Bool("trace-headers", false, "propagate traceparent and B3 trace headers to backends, generating them when absent")
+	dumpDir := flag.String("dump-dir", ".", "directory for the state dumps written on SIGUSR1")
+	clusterPeers := flag.String("cluster-peers", "", "comma separated base URLs of other load balancer instances to share backend health and circuit state with")
+	clusterNode := flag.String("cluster-node", "", "this instance's node ID in the cluster (default hostname:port)")
+	clusterInterval := flag.Duration("cluster-interval", time.Second, "how often the full backend state is gossiped to cluster peers")
+	clusterStaleness := flag.Duration("cluster-max-staleness", 0, "ignore a peer's connection counts in least-connections once it hasn't gossiped for this long (default 3 intervals)")
+	clusterKey := flag.String("cluster-key", "", "shared secret cluster peers authenticate gossip with")
+	webhooks := flag.String("webhooks", "", "comma separated URLs notified of backend up/down and circuit open/close")
+	webhookDebounce := flag.Duration("webhook-debounce", 10*time.Second, "how long a backend must keep a new state before webhooks hear of it")
+	statsExport := flag.String("stats-export", "", "write /stats snapshots to this NDJSON file (or directory with -stats-export-format files)")
+	statsExportFormat := flag.String("stats-export-format", "ndjson", "stats export format: ndjson or files")
+	statsExportInterval := flag.Duration("stats-export-interval", 10*time.Second, "time between stats snapshots")
+	weightsFile := flag.String("weights-file", "", "JSON file backend weights changed at runtime are saved to")
+	weightsInterval := flag.Duration("weights-save-interval", 30*time.Second, "how often changed backend weights are saved")
+	stateFile := flag.String("state-file", "", "JSON file the admin state (backends, weights, drain flags, routes) is saved to after every change")
+	restoreState := flag.Bool("restore-state", false, "apply the admin state saved in -state-file at startup")
+	restoreWeights := flag.Bool("restore-weights", false, "apply the weights saved in -weights-file at startup")
+	adminToken := flag.String("admin-token", "", "bearer token for the admin API, with identity and role \"admin\"")
+	adminAuthFile := flag.String("admin-auth", "", "JSON file of admin API credentials and per-endpoint roles")
+	flag.Parse()
+
+	if *showVersion {
+		info := BuildInfo()
+		fmt.Printf("Go-LoadBalancer %s (commit %s, built %s, %s)\n",
+			info.Version, info.Commit, info.BuildTime, info.GoVersion)
+		return
+	}
+
+	if *simulation != "" {
+		sim, err := LoadSimulation(*simulation)
+		if err != nil {
+			log.Fatalf("Failed to load simulation %s: %v", *simulation, err)
+		}
+		results, err := RunSimulation(sim, *simulationTrace)
+		if err != nil {
+			log.Fatalf("Simulation failed: %v", err)
+		}
+		if err := PrintSimulationResults(os.Stdout, results, *simulationJSON); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Configuration
 	config := &Config{
-		Port:                "3030",
-		HealthCheckInterval: 30, // seconds
+		Port:                *port,
+		HealthCheckInterval: *healthInterval, // seconds
+		HealthCheck: HealthCheckConfig{
+			Type:    *healthType,
+			Path:    *healthPath,
+			Command: *healthCommand,
+			Timeout: *healthTimeout,
+
+			UserAgent: *healthUserAgent,
+		},
 		MaxRetries:          3,
-		Algorithm:           "round-robin", // "round-robin", "weighted", "least-connections"
+		MaxRetryBodyBytes:   64 * 1024, // larger bodies are streamed and never retried
+		MaxRequestBodyBytes: 10 * 1024 * 1024,
+		MaxRequestTimeout:   *maxRequestTimeout,
+		RequestTimeout:      *requestTimeoutFlag,
+		RemovalDrainTimeout: *removalDrainTimeout,
+		Algorithm:           *algorithm, // "round-robin", "weighted", "least-connections"
+		DumpDir:             *dumpDir,
+		IdentityHeaders:     *identityHeaders,
+		TraceHeaders:        *traceHeaders,
+
+		MaxConnectionsPerBackend: *maxBackendConns,
+		RouteMetricsCap:          *routeMetricsCap,
+
+		Logging: LoggingConfig{
+			Level:            *logLevel,
+			DisableAccessLog: !*accessLog || *accessLogSample == 0,
+			AccessSampleRate: *accessLogSample,
+		},
+
+		Throttle: ThrottleConfig{
+			Failover:        true,
+			PenaltyDuration: 5 * time.Second,
+			PenaltyFactor:   0.5,
+			RetryAfter:      "propagate",
+		},
+
+		Webhooks: WebhookConfig{Debounce: *webhookDebounce},
+		Cluster: ClusterConfig{
+			NodeID:   *clusterNode,
+			Interval: *clusterInterval,
+			Key:      *clusterKey,
+
+			MaxStaleness: *clusterStaleness,
+		},
+
+		UpstreamTLS: UpstreamTLSConfig{
+			InsecureSkipVerify: *upstreamInsecure,
+			SessionCacheSize:   *upstreamSessionCache,
+		},
+
+		WarmPool: WarmPoolConfig{
+			Connections: *warmConns,
+			Interval:    *warmInterval,
+			Path:        *healthPath,
+		},
+
+		Weights: WeightPersistenceConfig{
+			Path:     *weightsFile,
+			Interval: *weightsInterval,
+			Restore:  *restoreWeights,
+		},
+		StateStore: StateStoreConfig{
+			Path:    *stateFile,
+			Restore: *restoreState,
+		},
+
+		StatsExport: StatsExportConfig{
+			Path:     *statsExport,
+			Format:   *statsExportFormat,
+			Interval: *statsExportInterval,
+		},
+
+		// Zero rates disable rate limiting
+		RateLimit: RateLimitConfig{},
+	}
+
+	if err := config.Logging.Validate(); err != nil {
+		log.Fatalf("Invalid logging flags: %v", err)
+	}
+	if err := config.StatsExport.Validate(); err != nil {
+		log.Fatalf("Invalid stats export flags: %v", err)
+	}
+
+	for _, u := range strings.Split(*webhooks, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			config.Webhooks.URLs = append(config.Webhooks.URLs, u)
+		}
+	}
+	for _, u := range strings.Split(*clusterPeers, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			config.Cluster.Peers = append(config.Cluster.Peers, u)
+		}
+	}
+	if config.Cluster.NodeID == "" {
+		hostname, _ := os.Hostname()
+		config.Cluster.NodeID = hostname + ":" + config.Port
+	}
+
+	if *upstreamCA != "" {
+		var err error
+		if config.UpstreamTLS.RootCAs, err = LoadCertPool(*upstreamCA); err != nil {
+			log.Fatalf("Invalid -upstream-ca: %v", err)
+		}
+	}
+	if *upstreamCA != "" || *upstreamInsecure {
+		// Health checks must trust https backends the same way the proxy does
+		config.HealthCheck.TLS = config.UpstreamTLS.ClientConfig()
+	}
+
+	if *healthHeaders != "" {
+		var err error
+		if config.HealthCheck.Headers, err = LoadHealthHeaders(*healthHeaders); err != nil {
+			log.Fatalf("Invalid -health-headers: %v", err)
+		}
+	}
+
+	if *adminAuthFile != "" {
+		var err error
+		if config.AdminAuth, err = LoadAdminAuthConfig(*adminAuthFile); err != nil {
+			log.Fatalf("Invalid -admin-auth: %v", err)
+		}
+	}
+	if *adminToken != "" {
+		config.AdminAuth.Credentials = append(config.AdminAuth.Credentials, AdminCredential{Name: "admin", Token: *adminToken, Roles: []string{"admin"}})
 	}
 
 	// Create load balancer
@@ -26,12 +223,61 @@ func main() {
 		{URL: "http://localhost:3006", Weight: 6},
 	}
 
+	if *backendList != "" {
+		var err error
+		if backends, err = ParseBackendList(*backendList); err != nil {
+			log.Fatalf("Invalid -backends: %v", err)
+		}
+	}
+
 	for _, backend := range backends {
 		if err := lb.AddBackend(backend.URL, backend.Weight); err != nil {
 			log.Fatalf("Failed to add backend %s: %v", backend.URL, err)
 		}
 	}
 
+	if err := lb.SetACL(config.ACL); err != nil {
+		log.Fatalf("Invalid ACL configuration: %v", err)
+	}
+	for _, backend := range config.ACL.QuarantineBackends {
+		if err := lb.AddQuarantineBackend(backend.URL, backend.Weight); err != nil {
+			log.Fatalf("Failed to add quarantine backend %s: %v", backend.URL, err)
+		}
+	}
+
+	if err := lb.SetAdminAuth(config.AdminAuth); err != nil {
+		log.Fatalf("Invalid admin authentication configuration: %v", err)
+	}
+
+	checker, err := NewHealthChecker(config.HealthCheck)
+	if err != nil {
+		log.Fatalf("Invalid health check configuration: %v", err)
+	}
+	lb.SetHealthChecker(checker)
+
+	if err := lb.SetupWebhooks(config.Webhooks); err != nil {
+		log.Fatalf("Invalid webhook configuration: %v", err)
+	}
+	if err := lb.SetupCluster(config.Cluster); err != nil {
+		log.Fatalf("Invalid cluster configuration: %v", err)
+	}
+
+	if err := lb.SetupExperiment(config.Experiment); err != nil {
+		log.Fatalf("Invalid experiment configuration: %v", err)
+	}
+
+	if err := lb.SetupStateStore(config.StateStore); err != nil {
+		log.Fatalf("Failed to restore admin state: %v", err)
+	}
+
+	if err := lb.StartWeightPersistence(config.Weights); err != nil {
+		log.Fatalf("Failed to restore backend weights: %v", err)
+	}
+
+	if err := lb.StartStatsExport(config.StatsExport); err != nil {
+		log.Fatalf("Failed to start stats export: %v", err)
+	}
+
 	// Start the load balancer
 	log.Printf("Starting load balancer on port %s with %s algorithm", config.Port, config.Algorithm)
 	lb.Start()
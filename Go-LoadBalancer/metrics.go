@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultLatencySamples is the number of recent samples kept by a LatencyWindow
+const defaultLatencySamples = 1024
+
+// LatencyWindow keeps the most recent duration samples for percentile reporting
+type LatencyWindow struct {
+	samples []time.Duration
+	next    int
+	full    bool
+	mux     sync.Mutex
+}
+
+// NewLatencyWindow creates a window holding up to size samples
+func NewLatencyWindow(size int) *LatencyWindow {
+	if size <= 0 {
+		size = defaultLatencySamples
+	}
+	return &LatencyWindow{samples: make([]time.Duration, size)}
+}
+
+// Record adds a sample, overwriting the oldest once the window is full
+func (lw *LatencyWindow) Record(d time.Duration) {
+	lw.mux.Lock()
+	lw.samples[lw.next] = d
+	lw.next++
+	if lw.next == len(lw.samples) {
+		lw.next = 0
+		lw.full = true
+	}
+	lw.mux.Unlock()
+}
+
+// Count returns the number of samples currently held
+func (lw *LatencyWindow) Count() int {
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+	if lw.full {
+		return len(lw.samples)
+	}
+	return lw.next
+}
+
+// Percentiles returns the requested percentiles (0-100) of the held samples
+func (lw *LatencyWindow) Percentiles(ps ...float64) []time.Duration {
+	lw.mux.Lock()
+	n := lw.next
+	if lw.full {
+		n = len(lw.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, lw.samples[:n])
+	lw.mux.Unlock()
+
+	result := make([]time.Duration, len(ps))
+	if n == 0 {
+		return result
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, p := range ps {
+		idx := int(p / 100 * float64(n-1))
+		if idx < 0 {
+			idx = 0
+		} else if idx >= n {
+			idx = n - 1
+		}
+		result[i] = sorted[idx]
+	}
+	return result
+}
+
+// LatencySummary is a latency window's percentiles in milliseconds
+type LatencySummary struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// Summary returns p50/p95/p99 in milliseconds for the stats endpoints
+func (lw *LatencyWindow) Summary() LatencySummary {
+	p := lw.Percentiles(50, 95, 99)
+	return LatencySummary{
+		Samples: lw.Count(),
+		P50Ms:   float64(p[0].Microseconds()) / 1000,
+		P95Ms:   float64(p[1].Microseconds()) / 1000,
+		P99Ms:   float64(p[2].Microseconds()) / 1000,
+	}
+}
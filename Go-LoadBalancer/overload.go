@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	overloadEvalInterval = 250 * time.Millisecond // how often p99 is recomputed
+	overloadMaxShed      = 0.9                    // always admit some traffic so latency can be re-measured
+	overloadShedStep     = 0.1                    // shed fraction change per interval
+)
+
+// OverloadProtector sheds a growing share of requests while recent p99 latency exceeds a target
+type OverloadProtector struct {
+	config  OverloadConfig
+	latency *LatencyWindow
+
+	shedFraction uint64 // float64 bits, read on every request
+	lastP99      int64  // nanoseconds
+	evalMux      sync.Mutex
+	lastEval     time.Time
+
+	// Metrics
+	admitted int64
+	shed     int64
+}
+
+// NewOverloadProtector creates an overload protector from the given configuration
+func NewOverloadProtector(config OverloadConfig) *OverloadProtector {
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = 1
+	}
+	return &OverloadProtector{
+		config:   config,
+		latency:  NewLatencyWindow(defaultLatencySamples),
+		lastEval: time.Now(),
+	}
+}
+
+// Enabled reports whether a latency target is configured
+func (op *OverloadProtector) Enabled() bool {
+	return op.config.TargetP99 > 0
+}
+
+// Admit decides whether to let a request through at the current shed fraction
+func (op *OverloadProtector) Admit() bool {
+	fraction := math.Float64frombits(atomic.LoadUint64(&op.shedFraction))
+	if fraction > 0 && rand.Float64() < fraction {
+		atomic.AddInt64(&op.shed, 1)
+		return false
+	}
+	atomic.AddInt64(&op.admitted, 1)
+	return true
+}
+
+// Observe records the latency of an admitted request and periodically re-evaluates shedding
+func (op *OverloadProtector) Observe(latency time.Duration) {
+	op.latency.Record(latency)
+
+	op.evalMux.Lock()
+	defer op.evalMux.Unlock()
+	if time.Since(op.lastEval) < overloadEvalInterval {
+		return
+	}
+	op.lastEval = time.Now()
+
+	p99 := op.latency.Percentiles(99)[0]
+	atomic.StoreInt64(&op.lastP99, int64(p99))
+
+	// Step the shed fraction up while over target and back down once latency recovers
+	old := math.Float64frombits(atomic.LoadUint64(&op.shedFraction))
+	fraction := old
+	if p99 > op.config.TargetP99 {
+		fraction = math.Min(overloadMaxShed, fraction+overloadShedStep)
+	} else {
+		fraction = math.Max(0, fraction-overloadShedStep)
+	}
+	if fraction == old {
+		return
+	}
+	atomic.StoreUint64(&op.shedFraction, math.Float64bits(fraction))
+	log.Printf("🌡️ [OVERLOAD] p99 %v vs target %v, shedding %.0f%% of requests",
+		p99, op.config.TargetP99, fraction*100)
+}
+
+// GetStats returns overload protection counters
+func (op *OverloadProtector) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":       op.Enabled(),
+		"target_p99_ms": op.config.TargetP99.Milliseconds(),
+		"p99_ms":        float64(time.Duration(atomic.LoadInt64(&op.lastP99)).Microseconds()) / 1000,
+		"shed_percent":  math.Float64frombits(atomic.LoadUint64(&op.shedFraction)) * 100,
+		"admitted":      atomic.LoadInt64(&op.admitted),
+		"shed":          atomic.LoadInt64(&op.shed),
+	}
+}
+
+// overloadMiddleware sheds load with 503 while proxied latency is above the p99 target
+func (lb *LoadBalancer) overloadMiddleware(next http.Handler) http.Handler {
+	if !lb.overload.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !lb.overload.Admit() {
+			log.Printf("🌡️ [OVERLOAD] %s %s from %s shed, p99 above %v",
+				r.Method, r.URL.Path, r.RemoteAddr, lb.overload.config.TargetP99)
+			w.Header().Set("Retry-After", strconv.Itoa(lb.overload.config.RetryAfter))
+			http.Error(w, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			lb.overload.Observe(time.Since(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,137 @@
+// Package circuit implements the consecutive-failure circuit breaker the load balancer
+// keeps for each backend.
+//
+// A breaker starts closed. Once Threshold failures are recorded in a row it opens for
+// Timeout, and every further failure while it is open extends that. When the timeout
+// passes it closes again with its failure count reset; a recorded success closes it at
+// once. There is no half-open state: once closed, a backend takes its full share of
+// requests again and the next Threshold failures reopen it.
+//
+// Every method is safe for concurrent use and lock-free.
+package circuit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// State is whether a breaker lets requests through
+type State int32
+
+const (
+	Closed State = iota // requests flow
+	Open                // requests are held back until the timeout passes
+)
+
+// String names the state in logs and stats
+func (s State) String() string {
+	if s == Open {
+		return "open"
+	}
+	return "closed"
+}
+
+// Breaker is a consecutive-failure circuit breaker
+type Breaker struct {
+	threshold int64
+	timeout   time.Duration
+	now       func() time.Time
+
+	failures  int64 // consecutive
+	openUntil int64 // unix nanoseconds, 0 while closed
+}
+
+// New creates a closed breaker that opens after threshold consecutive failures (at
+// least 1) and stays open for timeout
+func New(threshold int, timeout time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: int64(threshold), timeout: timeout, now: time.Now}
+}
+
+// SetClock makes the breaker tell time with now instead of time.Now, as simulations on
+// a virtual clock do. It must be called before the breaker is used.
+func (b *Breaker) SetClock(now func() time.Time) {
+	b.now = now
+}
+
+// Threshold returns the consecutive failures that open the breaker
+func (b *Breaker) Threshold() int {
+	return int(b.threshold)
+}
+
+// Timeout returns how long the breaker stays open after the latest failure
+func (b *Breaker) Timeout() time.Duration {
+	return b.timeout
+}
+
+// State returns whether the breaker is open, closing it first if its timeout has passed
+func (b *Breaker) State() State {
+	until := atomic.LoadInt64(&b.openUntil)
+	if until == 0 {
+		return Closed
+	}
+	if b.now().UnixNano() <= until {
+		return Open
+	}
+	// Only the caller that closes it resets the count, so a failure recorded since
+	// (which moved openUntil) isn't lost
+	if atomic.CompareAndSwapInt64(&b.openUntil, until, 0) {
+		atomic.StoreInt64(&b.failures, 0)
+	}
+	return b.State()
+}
+
+// Allow reports whether a request may be sent, which is whenever the breaker is closed
+func (b *Breaker) Allow() bool {
+	return b.State() == Closed
+}
+
+// RecordSuccess resets the failure count and closes the breaker
+func (b *Breaker) RecordSuccess() {
+	atomic.StoreInt64(&b.failures, 0)
+	atomic.StoreInt64(&b.openUntil, 0)
+}
+
+// RecordFailure counts a failure, opening the breaker (or keeping it open for another
+// timeout) once the threshold is reached, and returns the resulting state
+func (b *Breaker) RecordFailure() State {
+	if atomic.AddInt64(&b.failures, 1) >= b.threshold {
+		b.open()
+	}
+	return b.State()
+}
+
+// Trip opens the breaker for a timeout regardless of its failure count, as when another
+// load balancer instance saw the backend fail
+func (b *Breaker) Trip() {
+	b.open()
+}
+
+// Reset closes the breaker and clears its failure count
+func (b *Breaker) Reset() {
+	b.RecordSuccess()
+}
+
+// open marks the breaker open until a timeout from now
+func (b *Breaker) open() {
+	until := b.now().Add(b.timeout).UnixNano()
+	if until == 0 {
+		until = 1 // 0 means closed
+	}
+	atomic.StoreInt64(&b.openUntil, until)
+}
+
+// Failures returns the consecutive failures recorded
+func (b *Breaker) Failures() int64 {
+	return atomic.LoadInt64(&b.failures)
+}
+
+// OpenUntil returns when the breaker closes, or the zero time while it is closed
+func (b *Breaker) OpenUntil() time.Time {
+	if until := atomic.LoadInt64(&b.openUntil); until != 0 {
+		return time.Unix(0, until)
+	}
+	return time.Time{}
+}
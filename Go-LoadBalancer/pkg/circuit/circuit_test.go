@@ -0,0 +1,315 @@
+package circuit
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced time source
+type clock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+	c.mux.Unlock()
+}
+
+// newTestBreaker returns a breaker driven by a manual clock
+func newTestBreaker(threshold int, timeout time.Duration) (*Breaker, *clock) {
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	b := New(threshold, timeout)
+	b.now = c.Now
+	return b, c
+}
+
+// step is one action applied to a breaker, and the state expected afterwards
+type step struct {
+	action   string // "fail", "success", "trip", "reset" or "wait"
+	wait     time.Duration
+	want     State
+	failures int64
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	const timeout = 10 * time.Second
+
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "stays closed below the threshold",
+			threshold: 3,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Closed, failures: 2},
+			},
+		},
+		{
+			name:      "opens at the threshold",
+			threshold: 3,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Closed, failures: 2},
+				{action: "fail", want: Open, failures: 3},
+			},
+		},
+		{
+			name:      "a success resets the count",
+			threshold: 3,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Closed, failures: 2},
+				{action: "success", want: Closed, failures: 0},
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Closed, failures: 2},
+			},
+		},
+		{
+			name:      "closes once the timeout passes",
+			threshold: 2,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Open, failures: 2},
+				{action: "wait", wait: timeout, want: Open, failures: 2},
+				{action: "wait", wait: time.Nanosecond, want: Closed, failures: 0},
+			},
+		},
+		{
+			name:      "failures while open extend the timeout",
+			threshold: 1,
+			steps: []step{
+				{action: "fail", want: Open, failures: 1},
+				{action: "wait", wait: timeout / 2, want: Open, failures: 1},
+				{action: "fail", want: Open, failures: 2},
+				{action: "wait", wait: timeout / 2, want: Open, failures: 2},
+				{action: "wait", wait: timeout / 2, want: Open, failures: 2},
+				{action: "wait", wait: time.Nanosecond, want: Closed, failures: 0},
+			},
+		},
+		{
+			name:      "a success closes an open breaker",
+			threshold: 1,
+			steps: []step{
+				{action: "fail", want: Open, failures: 1},
+				{action: "success", want: Closed, failures: 0},
+			},
+		},
+		{
+			name:      "reopens after the threshold again",
+			threshold: 2,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Open, failures: 2},
+				{action: "wait", wait: timeout + time.Nanosecond, want: Closed, failures: 0},
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Open, failures: 2},
+			},
+		},
+		{
+			name:      "trip opens regardless of the count",
+			threshold: 5,
+			steps: []step{
+				{action: "trip", want: Open, failures: 0},
+				{action: "wait", wait: timeout + time.Nanosecond, want: Closed, failures: 0},
+			},
+		},
+		{
+			name:      "reset closes and clears the count",
+			threshold: 2,
+			steps: []step{
+				{action: "fail", want: Closed, failures: 1},
+				{action: "fail", want: Open, failures: 2},
+				{action: "reset", want: Closed, failures: 0},
+			},
+		},
+		{
+			name:      "a threshold below 1 opens on the first failure",
+			threshold: 0,
+			steps: []step{
+				{action: "fail", want: Open, failures: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, c := newTestBreaker(tt.threshold, timeout)
+			for i, s := range tt.steps {
+				switch s.action {
+				case "fail":
+					if got := b.RecordFailure(); got != s.want {
+						t.Fatalf("step %d: RecordFailure() = %v, want %v", i, got, s.want)
+					}
+				case "success":
+					b.RecordSuccess()
+				case "trip":
+					b.Trip()
+				case "reset":
+					b.Reset()
+				case "wait":
+					c.Advance(s.wait)
+				default:
+					t.Fatalf("step %d: unknown action %q", i, s.action)
+				}
+
+				if got := b.State(); got != s.want {
+					t.Fatalf("step %d (%s): State() = %v, want %v", i, s.action, got, s.want)
+				}
+				if got := b.Allow(); got != (s.want == Closed) {
+					t.Fatalf("step %d (%s): Allow() = %v, want %v", i, s.action, got, s.want == Closed)
+				}
+				if got := b.Failures(); got != s.failures {
+					t.Fatalf("step %d (%s): Failures() = %d, want %d", i, s.action, got, s.failures)
+				}
+				if got := b.OpenUntil().IsZero(); got != (s.want == Closed) {
+					t.Fatalf("step %d (%s): OpenUntil().IsZero() = %v, want %v", i, s.action, got, s.want == Closed)
+				}
+			}
+		})
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := []struct {
+		state State
+		want  string
+	}{
+		{Closed, "closed"},
+		{Open, "open"},
+	}
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("State(%d).String() = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
+
+// TestBreakerMatchesModel drives random actions through the breaker and a plain
+// sequential model of it, and checks they agree after every action
+func TestBreakerMatchesModel(t *testing.T) {
+	const timeout = time.Second
+	rng := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 200; run++ {
+		threshold := 1 + rng.Intn(5)
+		b, c := newTestBreaker(threshold, timeout)
+
+		var failures int64
+		var openUntil time.Time // zero while closed
+
+		for i := 0; i < 100; i++ {
+			switch rng.Intn(4) {
+			case 0, 1:
+				b.RecordFailure()
+				failures++
+				if failures >= int64(threshold) {
+					openUntil = c.Now().Add(timeout)
+				}
+			case 2:
+				b.RecordSuccess()
+				failures, openUntil = 0, time.Time{}
+			case 3:
+				c.Advance(time.Duration(rng.Int63n(int64(timeout))))
+			}
+			if !openUntil.IsZero() && c.Now().After(openUntil) {
+				failures, openUntil = 0, time.Time{}
+			}
+
+			want := Closed
+			if !openUntil.IsZero() {
+				want = Open
+			}
+			if got := b.State(); got != want {
+				t.Fatalf("run %d step %d: State() = %v, want %v", run, i, got, want)
+			}
+			if got := b.Failures(); got != failures {
+				t.Fatalf("run %d step %d: Failures() = %d, want %d", run, i, got, failures)
+			}
+			if got := b.OpenUntil(); !got.Equal(openUntil) {
+				t.Fatalf("run %d step %d: OpenUntil() = %v, want %v", run, i, got, openUntil)
+			}
+		}
+	}
+}
+
+func TestBreakerConcurrentFailures(t *testing.T) {
+	const (
+		goroutines = 16
+		perG       = 1000
+	)
+	b, _ := newTestBreaker(goroutines*perG, time.Minute)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				b.RecordFailure()
+				b.State()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// No failure is lost, and the last one reaches the threshold exactly
+	if got := b.Failures(); got != goroutines*perG {
+		t.Fatalf("Failures() = %d, want %d", got, goroutines*perG)
+	}
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v, want %v", got, Open)
+	}
+}
+
+func TestBreakerConcurrentMixed(t *testing.T) {
+	b, c := newTestBreaker(3, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				switch (g + i) % 5 {
+				case 0:
+					b.RecordSuccess()
+				case 1:
+					c.Advance(time.Millisecond)
+				case 2:
+					b.Trip()
+				default:
+					b.RecordFailure()
+				}
+				if state := b.State(); state != Open && state != Closed {
+					t.Errorf("State() = %d", state)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Whatever happened, a success leaves it closed and the timeout closes it
+	b.RecordSuccess()
+	if b.State() != Closed || b.Failures() != 0 {
+		t.Fatalf("after RecordSuccess: State() = %v, Failures() = %d", b.State(), b.Failures())
+	}
+	b.Trip()
+	c.Advance(2 * time.Millisecond)
+	if b.State() != Closed {
+		t.Fatalf("State() = %v after the timeout, want %v", b.State(), Closed)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queuePollInterval bounds how long a waiting request sleeps between retries when
+// no signal arrives (e.g. a circuit breaker timing out)
+const queuePollInterval = 100 * time.Millisecond
+
+// RequestQueue holds requests waiting for a backend to become available
+type RequestQueue struct {
+	config QueueConfig
+	length int64
+
+	// waitCh is closed and replaced to wake every waiting request
+	waitCh  chan struct{}
+	waitMux sync.Mutex
+
+	waitTimes *LatencyWindow
+
+	// Metrics
+	enqueued int64
+	dequeued int64
+	timedOut int64
+	rejected int64
+}
+
+// NewRequestQueue creates a request queue from the given configuration
+func NewRequestQueue(config QueueConfig) *RequestQueue {
+	return &RequestQueue{
+		config:    config,
+		waitCh:    make(chan struct{}),
+		waitTimes: NewLatencyWindow(defaultLatencySamples),
+	}
+}
+
+// Enabled reports whether queueing is configured
+func (q *RequestQueue) Enabled() bool {
+	return q.config.MaxSize > 0 && q.config.Timeout > 0
+}
+
+// Signal wakes waiting requests so they retry backend selection
+func (q *RequestQueue) Signal() {
+	if atomic.LoadInt64(&q.length) == 0 {
+		return
+	}
+	q.waitMux.Lock()
+	close(q.waitCh)
+	q.waitCh = make(chan struct{})
+	q.waitMux.Unlock()
+}
+
+// waitChan returns the channel closed by the next Signal
+func (q *RequestQueue) waitChan() <-chan struct{} {
+	q.waitMux.Lock()
+	defer q.waitMux.Unlock()
+	return q.waitCh
+}
+
+// Wait blocks until next returns a backend, the timeout expires, or the client goes away.
+// It returns nil immediately if the queue is full.
+func (q *RequestQueue) Wait(ctx context.Context, next func() Backend) Backend {
+	if atomic.AddInt64(&q.length, 1) > int64(q.config.MaxSize) {
+		atomic.AddInt64(&q.length, -1)
+		atomic.AddInt64(&q.rejected, 1)
+		log.Printf("🚫 [QUEUE] Queue full (%d waiting), rejecting request", q.config.MaxSize)
+		return nil
+	}
+	defer atomic.AddInt64(&q.length, -1)
+	atomic.AddInt64(&q.enqueued, 1)
+
+	start := time.Now()
+	timeout := time.NewTimer(q.config.Timeout)
+	defer timeout.Stop()
+	poll := time.NewTicker(queuePollInterval)
+	defer poll.Stop()
+
+	for {
+		// Grab the channel before trying so a Signal in between is not missed
+		wake := q.waitChan()
+		if peer := next(); peer != nil {
+			wait := time.Since(start)
+			q.waitTimes.Record(wait)
+			atomic.AddInt64(&q.dequeued, 1)
+			log.Printf("⏳ [QUEUE] Request dequeued to %s after waiting %v", peer.Address(), wait)
+			return peer
+		}
+
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-timeout.C:
+			q.waitTimes.Record(time.Since(start))
+			atomic.AddInt64(&q.timedOut, 1)
+			log.Printf("⌛ [QUEUE] Request timed out after waiting %v for a backend", q.config.Timeout)
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// GetStats returns queue counters and wait time percentiles
+func (q *RequestQueue) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":    q.Enabled(),
+		"max_size":   q.config.MaxSize,
+		"timeout_ms": q.config.Timeout.Milliseconds(),
+		"length":     atomic.LoadInt64(&q.length),
+		"enqueued":   atomic.LoadInt64(&q.enqueued),
+		"dequeued":   atomic.LoadInt64(&q.dequeued),
+		"timed_out":  atomic.LoadInt64(&q.timedOut),
+		"rejected":   atomic.LoadInt64(&q.rejected),
+		"wait_time":  q.waitTimes.Summary(),
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTrackedClients bounds the per-IP buckets; past it the least recently used is evicted
+const maxTrackedClients = 10000
+
+// TokenBucket is a thread-safe token bucket refilled continuously at a fixed rate
+type TokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	mux      sync.Mutex
+}
+
+// NewTokenBucket creates a full token bucket
+func NewTokenBucket(cfg TokenBucketConfig) *TokenBucket {
+	capacity := float64(cfg.Burst)
+	if capacity < 1 {
+		capacity = math.Max(1, cfg.Rate)
+	}
+	return &TokenBucket{
+		rate:     cfg.Rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// Allow takes a token if one is available, otherwise returns how long until one will be
+func (tb *TokenBucket) Allow() (bool, time.Duration) {
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+
+	if wait := tb.refill(time.Now()); wait > 0 {
+		return false, wait
+	}
+	tb.tokens--
+	return true, 0
+}
+
+// refill adds the tokens accrued since the last refill and returns how long until a
+// token is available, 0 if one is now. The caller holds tb.mux.
+func (tb *TokenBucket) refill(now time.Time) time.Duration {
+	tb.tokens = math.Min(tb.capacity, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// takeTokens takes a token from every bucket if each has one available, and from none
+// otherwise, so a request turned away by one limit doesn't use up another. It returns
+// the index of the first bucket without a token and how long until it has one, or -1.
+// The buckets are locked in the order given; callers must always pass them in the same
+// order of kinds so two requests can't each hold a bucket the other waits for.
+func takeTokens(buckets []*TokenBucket) (int, time.Duration) {
+	for _, bucket := range buckets {
+		bucket.mux.Lock()
+		defer bucket.mux.Unlock()
+	}
+
+	now := time.Now()
+	for i, bucket := range buckets {
+		if wait := bucket.refill(now); wait > 0 {
+			return i, wait
+		}
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return -1, 0
+}
+
+// RateLimiter applies global, per client IP and per route token buckets
+type RateLimiter struct {
+	config RateLimitConfig
+	global *TokenBucket
+
+	clients    map[string]*list.Element // of *clientBucket, in clientLRU
+	clientLRU  *list.List               // front is most recently used
+	maxClients int
+	routes     map[string]*TokenBucket
+	clientMux  sync.Mutex
+	routeMux   sync.Mutex
+
+	// Metrics
+	allowed        int64
+	limitedGlobal  int64
+	limitedPerIP   int64
+	limitedByRoute int64
+	evictedClients int64
+}
+
+// clientBucket is a client IP's bucket in the rate limiter's LRU list
+type clientBucket struct {
+	ip     string
+	bucket *TokenBucket
+}
+
+// NewRateLimiter creates a rate limiter from the given configuration
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{
+		config:     config,
+		clients:    make(map[string]*list.Element),
+		clientLRU:  list.New(),
+		maxClients: maxTrackedClients,
+		routes:     make(map[string]*TokenBucket),
+	}
+	if config.Global.Rate > 0 {
+		rl.global = NewTokenBucket(config.Global)
+	}
+	return rl
+}
+
+// Allow checks every applicable bucket, returning the limit that rejected the request.
+// A request is only charged once every bucket allows it, so one rejected by its client
+// or route limit leaves the global bucket for other clients.
+func (rl *RateLimiter) Allow(clientIP string, route *RouteConfig) (bool, string, time.Duration) {
+	var buckets [3]*TokenBucket
+	var limits [3]string
+	var limited [3]*int64
+	n := 0
+	if rl.global != nil {
+		buckets[n], limits[n], limited[n] = rl.global, "global", &rl.limitedGlobal
+		n++
+	}
+	if rl.config.PerIP.Rate > 0 {
+		buckets[n], limits[n], limited[n] = rl.clientBucket(clientIP), "client", &rl.limitedPerIP
+		n++
+	}
+	if route != nil && route.RateLimit.Rate > 0 {
+		buckets[n], limits[n], limited[n] = rl.routeBucket(route), "route", &rl.limitedByRoute
+		n++
+	}
+
+	if rejected, wait := takeTokens(buckets[:n]); rejected >= 0 {
+		atomic.AddInt64(limited[rejected], 1)
+		return false, limits[rejected], wait
+	}
+	atomic.AddInt64(&rl.allowed, 1)
+	return true, "", 0
+}
+
+// clientBucket returns the bucket for a client IP, creating it if needed. Buckets are
+// kept for at most maxClients IPs, so a flood of new addresses evicts the least recently
+// seen rather than growing the map; an evicted client starts again with a full bucket.
+func (rl *RateLimiter) clientBucket(clientIP string) *TokenBucket {
+	rl.clientMux.Lock()
+	defer rl.clientMux.Unlock()
+
+	if elem, exists := rl.clients[clientIP]; exists {
+		rl.clientLRU.MoveToFront(elem)
+		return elem.Value.(*clientBucket).bucket
+	}
+
+	if rl.clientLRU.Len() >= rl.maxClients {
+		evicted := rl.clientLRU.Remove(rl.clientLRU.Back()).(*clientBucket)
+		delete(rl.clients, evicted.ip)
+		atomic.AddInt64(&rl.evictedClients, 1)
+	}
+
+	bucket := NewTokenBucket(rl.config.PerIP)
+	rl.clients[clientIP] = rl.clientLRU.PushFront(&clientBucket{ip: clientIP, bucket: bucket})
+	return bucket
+}
+
+// routeBucket returns the bucket for a route, creating it if needed
+func (rl *RateLimiter) routeBucket(route *RouteConfig) *TokenBucket {
+	rl.routeMux.Lock()
+	defer rl.routeMux.Unlock()
+
+	bucket, exists := rl.routes[route.PathPrefix]
+	if !exists {
+		bucket = NewTokenBucket(route.RateLimit)
+		rl.routes[route.PathPrefix] = bucket
+	}
+	return bucket
+}
+
+// ResetRoutes drops per-route buckets so changed route limits take effect
+func (rl *RateLimiter) ResetRoutes() {
+	rl.routeMux.Lock()
+	rl.routes = make(map[string]*TokenBucket)
+	rl.routeMux.Unlock()
+}
+
+// GetStats returns rate limiting counters
+func (rl *RateLimiter) GetStats() map[string]interface{} {
+	rl.clientMux.Lock()
+	trackedClients := rl.clientLRU.Len()
+	rl.clientMux.Unlock()
+
+	return map[string]interface{}{
+		"allowed":          atomic.LoadInt64(&rl.allowed),
+		"limited_global":   atomic.LoadInt64(&rl.limitedGlobal),
+		"limited_per_ip":   atomic.LoadInt64(&rl.limitedPerIP),
+		"limited_by_route": atomic.LoadInt64(&rl.limitedByRoute),
+		"tracked_clients":  trackedClients,
+		"evicted_clients":  atomic.LoadInt64(&rl.evictedClients),
+		"global_rate":      rl.config.Global.Rate,
+		"per_ip_rate":      rl.config.PerIP.Rate,
+	}
+}
+
+// rateLimitMiddleware rejects requests exceeding any configured limit with 429
+func (lb *LoadBalancer) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, limit, wait := lb.rateLimiter.Allow(getClientIP(r), lb.matchRoute(r.URL.Path))
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		log.Printf("🚦 [RATE_LIMIT] %s %s from %s rejected by %s limit (retry after %ds)",
+			r.Method, r.URL.Path, r.RemoteAddr, limit, retryAfter)
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRateLimiterChargesOnlyAllowedRequests(t *testing.T) {
+	// Rates low enough that no bucket refills during the test
+	rl := NewRateLimiter(RateLimitConfig{
+		Global: TokenBucketConfig{Rate: 0.001, Burst: 3},
+		PerIP:  TokenBucketConfig{Rate: 0.001, Burst: 2},
+	})
+	route := &RouteConfig{PathPrefix: "/slow", RateLimit: TokenBucketConfig{Rate: 0.001, Burst: 1}}
+
+	steps := []struct {
+		client string
+		route  *RouteConfig
+		want   string // the limit that rejects the request, "" if it's allowed
+	}{
+		{"10.0.0.1", route, ""},
+		{"10.0.0.1", route, "route"}, // must not use up the client's or the global token
+		{"10.0.0.1", nil, ""},
+		{"10.0.0.1", nil, "client"}, // must not use up the global token
+		{"10.0.0.1", nil, "client"},
+		{"10.0.0.2", nil, ""},
+		{"10.0.0.3", nil, "global"},
+	}
+	for i, step := range steps {
+		allowed, limit, _ := rl.Allow(step.client, step.route)
+		if allowed != (step.want == "") || limit != step.want {
+			t.Fatalf("request %d from %s: allowed %v by limit %q, want limit %q", i, step.client, allowed, limit, step.want)
+		}
+	}
+
+	stats := rl.GetStats()
+	for counter, want := range map[string]int64{"allowed": 3, "limited_global": 1, "limited_per_ip": 2, "limited_by_route": 1} {
+		if stats[counter] != want {
+			t.Errorf("%s = %v, want %d", counter, stats[counter], want)
+		}
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentClient(t *testing.T) {
+	rl := NewRateLimiter(RateLimitConfig{PerIP: TokenBucketConfig{Rate: 0.001, Burst: 1}})
+	rl.maxClients = 3
+
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rl.Allow(client, nil)
+	}
+	rl.Allow("10.0.0.1", nil) // rejected, and now the most recently seen
+	for i := 4; i <= 5; i++ {
+		if allowed, _, _ := rl.Allow(fmt.Sprintf("10.0.0.%d", i), nil); !allowed {
+			t.Fatalf("new client 10.0.0.%d rejected", i)
+		}
+	}
+
+	stats := rl.GetStats()
+	if stats["tracked_clients"] != 3 || stats["evicted_clients"] != int64(2) {
+		t.Errorf("tracking %v clients after evicting %v, want 3 after 2", stats["tracked_clients"], stats["evicted_clients"])
+	}
+	if allowed, limit, _ := rl.Allow("10.0.0.1", nil); allowed || limit != "client" {
+		t.Error("the most recently seen client's bucket was evicted")
+	}
+	if allowed, _, _ := rl.Allow("10.0.0.2", nil); !allowed {
+		t.Error("the least recently seen client's bucket wasn't evicted")
+	}
+}
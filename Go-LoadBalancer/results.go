@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SimulationResult holds the measurements of one algorithm's simulation
+type SimulationResult struct {
+	Algorithm    string           `json:"algorithm"`
+	Clock        string           `json:"clock"` // "real" or "virtual"
+	Requests     int64            `json:"requests"`
+	Errors       int64            `json:"errors"`
+	Seconds      float64          `json:"seconds"`
+	Throughput   float64          `json:"requests_per_second"`
+	Latency      LatencySummary   `json:"latency"`
+	Distribution map[string]int64 `json:"distribution"`
+
+	// Real clock simulations only: the load balancer's allocations per request. Virtual
+	// clock runs allocate for the simulation itself, so they aren't measured.
+	AllocsPerRequest float64 `json:"allocs_per_request,omitempty"`
+	BytesPerRequest  float64 `json:"bytes_per_request,omitempty"`
+
+	// Virtual clock simulations only: the seed, and a hash of every routing decision
+	// that is the same whenever the run is replayed
+	Seed        uint64 `json:"seed,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// PrintSimulationResults writes the results as a table, or as JSON when asJSON is set.
+// Allocations that weren't measured are shown as "-".
+func PrintSimulationResults(w io.Writer, results []SimulationResult, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	fmt.Fprintf(w, "%-20s %10s %8s %12s %9s %9s %9s %12s %12s\n",
+		"ALGORITHM", "REQUESTS", "ERRORS", "REQ/S", "P50 MS", "P95 MS", "P99 MS", "ALLOCS/REQ", "BYTES/REQ")
+	for _, r := range results {
+		allocs, bytes := "-", "-"
+		if r.Clock == "real" {
+			allocs, bytes = fmt.Sprintf("%.1f", r.AllocsPerRequest), fmt.Sprintf("%.0f", r.BytesPerRequest)
+		}
+		fmt.Fprintf(w, "%-20s %10d %8d %12.0f %9.3f %9.3f %9.3f %12s %12s\n",
+			r.Algorithm, r.Requests, r.Errors, r.Throughput,
+			r.Latency.P50Ms, r.Latency.P95Ms, r.Latency.P99Ms,
+			allocs, bytes)
+	}
+	for _, r := range results {
+		if r.Fingerprint != "" {
+			fmt.Fprintf(w, "%-20s seed %d, routing fingerprint %s\n", r.Algorithm, r.Seed, r.Fingerprint)
+		}
+	}
+	return nil
+}
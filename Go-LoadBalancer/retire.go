@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// retirePollInterval is how often a removed backend's in-flight requests are checked
+const retirePollInterval = 100 * time.Millisecond
+
+// BackendForgetter is implemented by algorithms that keep per-backend state, so a
+// removed backend's state can be dropped once it has no requests left. Selections and
+// samples from before the removal may still reach the algorithm after Forget, so it must
+// not create state for a draining backend; removed backends are draining before Forget.
+type BackendForgetter interface {
+	Forget(backend Backend)
+}
+
+// RetiringBackendReport is a removed backend still finishing its requests
+type RetiringBackendReport struct {
+	URL            string  `json:"url"`
+	InFlight       int64   `json:"in_flight"`
+	RemovedSeconds float64 `json:"removed_seconds"` // how long ago it was removed
+}
+
+// retire keeps track of a backend just removed from the pool until release
+func (s *ServerPool) retire(backend Backend) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.retiring == nil {
+		s.retiring = make(map[Backend]time.Time)
+	}
+	s.retiring[backend] = time.Now()
+}
+
+// release forgets a retired backend, along with whatever the algorithm kept about it
+func (s *ServerPool) release(backend Backend) {
+	s.mux.Lock()
+	delete(s.retiring, backend)
+	s.mux.Unlock()
+	if forgetter, ok := s.Algorithm().(BackendForgetter); ok {
+		forgetter.Forget(backend)
+	}
+}
+
+// retiringReports lists the removed backends still finishing requests
+func (s *ServerPool) retiringReports() []RetiringBackendReport {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	reports := make([]RetiringBackendReport, 0, len(s.retiring))
+	for backend, removed := range s.retiring {
+		reports = append(reports, RetiringBackendReport{
+			URL:            backend.Address(),
+			InFlight:       backend.GetConnections(),
+			RemovedSeconds: time.Since(removed).Seconds(),
+		})
+	}
+	return reports
+}
+
+// removeBackend takes a backend out of pool so it gets no new requests, and releases it
+// once the requests it is still serving finish or RemovalDrainTimeout passes
+func (lb *LoadBalancer) removeBackend(pool *ServerPool, address string) Backend {
+	backend := pool.RemoveBackend(address)
+	if backend == nil {
+		return nil
+	}
+	backend.SetDraining(true)
+	pool.retire(backend)
+	atomic.AddInt64(&lb.backendsRetiring, 1)
+	go lb.awaitRetired(pool, backend)
+	return backend
+}
+
+// awaitRetired waits for a removed backend's in-flight requests, then releases it
+func (lb *LoadBalancer) awaitRetired(pool *ServerPool, backend Backend) {
+	start := time.Now()
+	deadline := start.Add(lb.config.RemovalDrainTimeout)
+	if inFlight := backend.GetConnections(); inFlight > 0 {
+		log.Printf("🚰 [POOL] Waiting up to %v for %d in-flight requests on removed backend %s",
+			lb.config.RemovalDrainTimeout, inFlight, backend.Address())
+	}
+
+	ticker := time.NewTicker(retirePollInterval)
+	defer ticker.Stop()
+	for backend.GetConnections() > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+
+	pool.release(backend)
+	atomic.AddInt64(&lb.backendsRetiring, -1)
+	atomic.AddInt64(&lb.backendsReleased, 1)
+	if inFlight := backend.GetConnections(); inFlight > 0 {
+		atomic.AddInt64(&lb.retireTimeouts, 1)
+		log.Printf("⏰ [POOL] Released removed backend %s after the %v drain timeout with %d requests still in flight",
+			backend.Address(), lb.config.RemovalDrainTimeout, inFlight)
+		lb.events.Record(EventAdmin, pool.name, backend.Address(), "released with %d requests still in flight", inFlight)
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= retirePollInterval {
+		log.Printf("✅ [POOL] Released removed backend %s after its last request finished (%v)",
+			backend.Address(), elapsed.Round(time.Millisecond))
+	}
+}
+
+// retireStats returns the removal drain settings and counters
+func (lb *LoadBalancer) retireStats() map[string]interface{} {
+	return map[string]interface{}{
+		"timeout_seconds": lb.config.RemovalDrainTimeout.Seconds(),
+		"retiring":        atomic.LoadInt64(&lb.backendsRetiring),
+		"released":        atomic.LoadInt64(&lb.backendsReleased),
+		"timed_out":       atomic.LoadInt64(&lb.retireTimeouts),
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// remembers reports whether algorithm still keeps state for backend
+func remembers(algorithm LoadBalancingAlgorithm, backend Backend) bool {
+	switch a := algorithm.(type) {
+	case *WeightedRoundRobinAlgorithm:
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		_, ok := a.currentWeights[backend]
+		return ok
+	case *LatencyAlgorithm:
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		_, ok := a.estimates[backend]
+		return ok
+	}
+	return false
+}
+
+// TestMembershipChurnWhileRouting adds and removes a backend over and over while
+// clients route through the proxy and health checks run. Run it under -race: routing
+// reads pool snapshots without locking while membership changes swap them.
+func TestMembershipChurnWhileRouting(t *testing.T) {
+	const (
+		clients = 8
+		churns  = 20
+	)
+	stable := newStatusBackend(t, http.StatusOK)
+	churned := newStatusBackend(t, http.StatusOK)
+
+	for _, algorithm := range algorithmNames {
+		t.Run(algorithm, func(t *testing.T) {
+			lb, proxy := newTestLoadBalancer(t, &Config{Algorithm: algorithm, RemovalDrainTimeout: 5 * time.Second}, stable)
+
+			done := make(chan struct{})
+			var served, failed atomic.Int64
+			var wg sync.WaitGroup
+			for c := 0; c < clients; c++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						resp, err := http.Get(proxy.URL)
+						if err != nil {
+							failed.Add(1)
+							continue
+						}
+						resp.Body.Close()
+						if resp.StatusCode != http.StatusOK {
+							failed.Add(1)
+							continue
+						}
+						served.Add(1)
+					}
+				}()
+			}
+
+			var removed []Backend
+			for i := 0; i < churns; i++ {
+				if err := lb.AddBackend(churned.URL, 2); err != nil {
+					t.Fatal(err)
+				}
+				lb.serverPool.HealthCheck()
+				time.Sleep(5 * time.Millisecond)
+				removed = append(removed, lb.removeBackend(lb.serverPool, churned.URL))
+			}
+			close(done)
+			wg.Wait()
+
+			if failed.Load() > 0 {
+				t.Errorf("%d of %d requests failed during churn", failed.Load(), failed.Load()+served.Load())
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt64(&lb.backendsRetiring) > 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d removed backends never released", atomic.LoadInt64(&lb.backendsRetiring))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			var churnedBytes int64
+			for i, backend := range removed {
+				churnedBytes += backend.Traffic().Response.Total()
+				if connections := backend.GetConnections(); connections != 0 {
+					t.Errorf("removed backend %d still holds %d connections", i, connections)
+				}
+				if remembers(lb.serverPool.Algorithm(), backend) {
+					t.Errorf("algorithm kept state for removed backend %d after releasing it", i)
+				}
+			}
+			if churnedBytes == 0 {
+				t.Error("the churned backend served nothing between being added and removed")
+			}
+			if got := len(lb.serverPool.GetBackends()); got != 1 {
+				t.Errorf("pool has %d backends after churn, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+)
+
+var (
+	defaultRetryMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete, http.MethodTrace,
+	}
+	defaultRetryStatusCodes = []int{
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+	}
+
+	// errRetryableStatus is returned from ModifyResponse to hand a retryable upstream
+	// status to the error handler
+	errRetryableStatus = errors.New("retryable upstream status")
+)
+
+// retryPolicyFor returns the retry policy of the request's route, or the global policy
+func (lb *LoadBalancer) retryPolicyFor(r *http.Request) RetryPolicy {
+	if route := lb.matchRoute(r.URL.Path); route != nil && route.Retry != nil {
+		return *route.Retry
+	}
+	return lb.config.Retry
+}
+
+// canRetry reports whether the request method is retryable and its body can be replayed
+func (lb *LoadBalancer) canRetry(r *http.Request) bool {
+	if !slices.Contains(lb.retryPolicyFor(r).Methods, r.Method) {
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// createResponseModifier turns retryable upstream statuses into proxy errors while
+// retries remain, so the error handler reroutes the request
+func (lb *LoadBalancer) createResponseModifier(backend *HTTPBackend) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		request := resp.Request
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return lb.handleThrottled(backend, resp)
+		}
+		if getRetryFromContext(request) >= lb.config.MaxRetries {
+			return nil
+		}
+		if !slices.Contains(lb.retryPolicyFor(request).StatusCodes, resp.StatusCode) || !lb.canRetry(request) {
+			return nil
+		}
+
+		log.Printf("🔁 [RETRY] Backend %s returned %d for %s %s, retrying on another backend",
+			backend.Address(), resp.StatusCode, request.Method, request.URL.Path)
+		return errRetryableStatus
+	}
+}
+
+// retryBodyMiddleware buffers small bodies of retryable requests so they can be replayed
+func (lb *LoadBalancer) retryBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lb.config.MaxRetries == 0 || r.Body == nil || r.Body == http.NoBody ||
+			!slices.Contains(lb.retryPolicyFor(r).Methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := lb.config.MaxRetryBodyBytes
+		if r.ContentLength > limit {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		if int64(len(buf)) > limit {
+			// Too large to buffer: stream it through without replay support
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body.Close()
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(buf)), nil
+		}
+		r.Body, _ = r.GetBody()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// replayRequest rewinds a buffered request body before the request is retried
+func replayRequest(r *http.Request) *http.Request {
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			r.Body = body
+		}
+	}
+	return r
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Per-request objects are recycled through sync.Pools to cut GC pressure at high request rates.
+// Nothing may hold on to them once the handler that acquired them has returned.
+
+var recorderPool = sync.Pool{
+	New: func() interface{} { return new(ResponseRecorder) },
+}
+
+// acquireRecorder returns a ResponseRecorder from the pool wrapping w
+func acquireRecorder(w http.ResponseWriter, backend Backend, r *http.Request, route *RouteConfig) *ResponseRecorder {
+	rr := recorderPool.Get().(*ResponseRecorder)
+	rr.ResponseWriter = w
+	rr.backend = backend
+	rr.request = r
+	rr.route = route
+	rr.statusCode = 0
+	return rr
+}
+
+// releaseRecorder returns a ResponseRecorder to the pool
+func releaseRecorder(rr *ResponseRecorder) {
+	*rr = ResponseRecorder{}
+	recorderPool.Put(rr)
+}
+
+// requestState is the mutable per-request state shared by every attempt of a request
+type requestState struct {
+	attempted []Backend // backends already tried, so retries go elsewhere
+	holding   Backend   // backend whose connection count includes this request, if any
+}
+
+// acquireConnection counts the request against peer's connections until released, or
+// returns false if peer is at its connection limit
+func (s *requestState) acquireConnection(peer Backend) bool {
+	if !peer.TryAddConnection() {
+		return false
+	}
+	s.holding = peer
+	return true
+}
+
+// releaseConnection stops counting the request against peer, if it still is. A failed
+// attempt releases before its retry runs (nested inside it) and again when it returns,
+// so each AddConnection is matched by exactly one RemoveConnection.
+func (s *requestState) releaseConnection(peer Backend) bool {
+	if peer == nil || s.holding != peer {
+		return false
+	}
+	s.holding = nil
+	peer.RemoveConnection()
+	return true
+}
+
+var requestStatePool = sync.Pool{
+	New: func() interface{} { return &requestState{attempted: make([]Backend, 0, 4)} },
+}
+
+// withRequestState attaches pooled request state to r unless an earlier attempt already did.
+// The returned release func must be called once the request has been fully handled.
+func withRequestState(r *http.Request) (*http.Request, *requestState, func()) {
+	if state, ok := r.Context().Value(attemptedKey).(*requestState); ok {
+		return r, state, func() {}
+	}
+
+	state := requestStatePool.Get().(*requestState)
+	r = r.WithContext(context.WithValue(r.Context(), attemptedKey, state))
+	return r, state, func() {
+		clear(state.attempted)
+		state.attempted = state.attempted[:0]
+		state.holding = nil
+		requestStatePool.Put(state)
+	}
+}
+
+// defaultProxyBufferSize matches the chunk size httputil.ReverseProxy allocates without a pool
+const defaultProxyBufferSize = 32 * 1024
+
+// ProxyBufferPool is an httputil.BufferPool shared by every backend's reverse proxy, so
+// copying large response bodies reuses buffers instead of allocating one per request
+type ProxyBufferPool struct {
+	size int
+	pool sync.Pool
+
+	// Metrics
+	gets      int64
+	allocated int64
+}
+
+// NewProxyBufferPool creates a buffer pool handing out buffers of the given size
+func NewProxyBufferPool(size int) *ProxyBufferPool {
+	if size <= 0 {
+		size = defaultProxyBufferSize
+	}
+	bp := &ProxyBufferPool{size: size}
+	bp.pool.New = func() interface{} {
+		atomic.AddInt64(&bp.allocated, 1)
+		buf := make([]byte, bp.size)
+		return &buf
+	}
+	return bp
+}
+
+// Get returns a buffer from the pool
+func (bp *ProxyBufferPool) Get() []byte {
+	atomic.AddInt64(&bp.gets, 1)
+	return *bp.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer to the pool
+func (bp *ProxyBufferPool) Put(buf []byte) {
+	if cap(buf) != bp.size {
+		return
+	}
+	buf = buf[:bp.size]
+	bp.pool.Put(&buf)
+}
+
+// GetStats returns how many buffers were requested and how many had to be allocated
+func (bp *ProxyBufferPool) GetStats() map[string]interface{} {
+	gets := atomic.LoadInt64(&bp.gets)
+	allocated := atomic.LoadInt64(&bp.allocated)
+	reuseRate := 0.0
+	if gets > 0 {
+		reuseRate = float64(gets-allocated) / float64(gets) * 100
+	}
+	return map[string]interface{}{
+		"buffer_size":    bp.size,
+		"gets":           gets,
+		"allocated":      allocated,
+		"reuse_rate_pct": reuseRate,
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Sinks the benchmarks store results in, so the compiler can't keep them on the stack
+var (
+	sinkWriter  http.ResponseWriter
+	sinkRequest *http.Request
+)
+
+// BenchmarkResponseRecorder compares taking recorders from recorderPool with allocating
+// one per request, as loadBalance did before they were pooled
+func BenchmarkResponseRecorder(b *testing.B) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backend := newTestBackends(b, 1)[0]
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rr := acquireRecorder(w, backend, r, nil)
+			sinkWriter = rr
+			releaseRecorder(rr)
+		}
+	})
+	b.Run("allocated", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			sinkWriter = &ResponseRecorder{ResponseWriter: w, backend: backend, request: r}
+		}
+	})
+}
+
+// BenchmarkRequestState compares attaching pooled retry state to a request with
+// allocating it per request. Both allocate the request's new context.
+func BenchmarkRequestState(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backend := newTestBackends(b, 1)[0]
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			req, state, release := withRequestState(r)
+			state.attempted = append(state.attempted, backend)
+			sinkRequest = req
+			release()
+		}
+	})
+	b.Run("allocated", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			state := &requestState{}
+			req := r.WithContext(context.WithValue(r.Context(), attemptedKey, state))
+			state.attempted = append(state.attempted, backend)
+			sinkRequest = req
+		}
+	})
+}
+
+// discardWriter is a ResponseWriter that drops the body, so benchmarks measure the copy
+// through the proxy rather than buffering the response
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkProxyBufferPool proxies the heavy backend's 1MB response with and without the
+// shared buffer pool, reporting throughput and garbage collections per request
+func BenchmarkProxyBufferPool(b *testing.B) {
+	payload := []byte(strings.Repeat("x", 1024*1024))
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	for _, pooled := range []bool{true, false} {
+		name := "unpooled"
+		if pooled {
+			name = "pooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			proxy := httputil.NewSingleHostReverseProxy(target)
+			if pooled {
+				proxy.BufferPool = NewProxyBufferPool(0)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/heavy", nil)
+
+			b.SetBytes(int64(len(payload)))
+			b.ReportAllocs()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			for b.Loop() {
+				proxy.ServeHTTP(&discardWriter{header: make(http.Header)}, r)
+			}
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gc/op")
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// soReusePort is SO_REUSEPORT on Linux, which the syscall package does not define
+const soReusePort = 0xf
+
+// listenReusePort opens a TCP listener with SO_REUSEPORT set, so several listeners can
+// bind the same address and the kernel spreads incoming connections across them
+func listenReusePort(address string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	return lc.Listen(context.Background(), "tcp", address)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// listenReusePort is unsupported on this platform
+func listenReusePort(address string) (net.Listener, error) {
+	return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+}
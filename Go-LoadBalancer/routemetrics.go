@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	routeLatencySamples = 256     // latency samples kept per route for percentiles
+	routeStatsTopN      = 20      // busiest routes listed in /stats
+	otherRoute          = "other" // where requests go once the route cap is reached
+)
+
+// routeLatencyBuckets are the /metrics histogram upper bounds in seconds, the same as
+// the test backend's so the two can be compared bucket by bucket
+var routeLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// routeStats are the counters of one route
+type routeStats struct {
+	requests     int64
+	clientErrors int64 // 4xx
+	errors       int64 // 5xx, including the load balancer's own 502/503/504
+	nanos        int64 // latency sum
+	buckets      []int64
+	latency      *LatencyWindow
+
+	// The same for the time to the response's first byte
+	firstByteNanos   int64
+	firstByteBuckets []int64
+	firstByte        *LatencyWindow
+
+	traffic Traffic
+}
+
+// RouteMetrics breaks requests down by route: the configured route prefix a request
+// matched, or its path when it matched none. At most max distinct routes are tracked;
+// requests for any route beyond that are counted under "other".
+type RouteMetrics struct {
+	max    int
+	mux    sync.RWMutex
+	routes map[string]*routeStats
+
+	overflowed int64 // requests counted under "other"
+}
+
+// NewRouteMetrics tracks up to max routes; 0 disables route metrics
+func NewRouteMetrics(max int) *RouteMetrics {
+	if max <= 0 {
+		return nil
+	}
+	return &RouteMetrics{max: max, routes: make(map[string]*routeStats)}
+}
+
+// stats returns the counters of route, creating them unless the cap is reached
+func (rm *RouteMetrics) stats(route string) *routeStats {
+	rm.mux.RLock()
+	stats, ok := rm.routes[route]
+	rm.mux.RUnlock()
+	if ok {
+		return stats
+	}
+
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+	if stats, ok := rm.routes[route]; ok {
+		return stats
+	}
+	if len(rm.routes) >= rm.max {
+		atomic.AddInt64(&rm.overflowed, 1)
+		route = otherRoute
+		if stats, ok := rm.routes[route]; ok {
+			return stats
+		}
+	}
+	stats = &routeStats{
+		buckets:          make([]int64, len(routeLatencyBuckets)),
+		latency:          NewLatencyWindow(routeLatencySamples),
+		firstByteBuckets: make([]int64, len(routeLatencyBuckets)),
+		firstByte:        NewLatencyWindow(routeLatencySamples),
+	}
+	rm.routes[route] = stats
+	return stats
+}
+
+// Observe records a finished request, how long it took to its response's first byte and
+// in full, and its request and response body bytes
+func (rm *RouteMetrics) Observe(route string, status int, firstByte, duration time.Duration, requestBytes, responseBytes int64) {
+	if rm == nil {
+		return
+	}
+	stats := rm.stats(route)
+	stats.traffic.Request.Add(requestBytes)
+	stats.traffic.Response.Add(responseBytes)
+	atomic.AddInt64(&stats.requests, 1)
+	switch {
+	case status >= 500:
+		atomic.AddInt64(&stats.errors, 1)
+	case status >= 400:
+		atomic.AddInt64(&stats.clientErrors, 1)
+	}
+	observeLatency(&stats.nanos, stats.buckets, stats.latency, duration)
+	observeLatency(&stats.firstByteNanos, stats.firstByteBuckets, stats.firstByte, firstByte)
+}
+
+// observeLatency adds a duration to a latency sum, histogram and window
+func observeLatency(nanos *int64, buckets []int64, window *LatencyWindow, duration time.Duration) {
+	atomic.AddInt64(nanos, int64(duration))
+	seconds := duration.Seconds()
+	for i, bound := range routeLatencyBuckets {
+		if seconds <= bound {
+			atomic.AddInt64(&buckets[i], 1)
+		}
+	}
+	window.Record(duration)
+}
+
+// snapshot returns the tracked routes sorted by request count, busiest first
+func (rm *RouteMetrics) snapshot() ([]string, map[string]*routeStats) {
+	rm.mux.RLock()
+	routes := make(map[string]*routeStats, len(rm.routes))
+	for route, stats := range rm.routes {
+		routes[route] = stats
+	}
+	rm.mux.RUnlock()
+
+	names := make([]string, 0, len(routes))
+	for route := range routes {
+		names = append(names, route)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := atomic.LoadInt64(&routes[names[i]].requests), atomic.LoadInt64(&routes[names[j]].requests)
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	return names, routes
+}
+
+// GetStats returns the busiest routes' request counts, error rates and latency
+func (rm *RouteMetrics) GetStats() map[string]interface{} {
+	if rm == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	names, routes := rm.snapshot()
+
+	top := make([]map[string]interface{}, 0, min(len(names), routeStatsTopN))
+	for _, route := range names[:min(len(names), routeStatsTopN)] {
+		stats := routes[route]
+		requests := atomic.LoadInt64(&stats.requests)
+		errors := atomic.LoadInt64(&stats.errors)
+		errorRate := 0.0
+		if requests > 0 {
+			errorRate = float64(errors) / float64(requests)
+		}
+		top = append(top, map[string]interface{}{
+			"route":         route,
+			"requests":      requests,
+			"errors":        errors,
+			"client_errors": atomic.LoadInt64(&stats.clientErrors),
+			"error_rate":    errorRate,
+			"latency":       stats.latency.Summary(),
+			"first_byte":    stats.firstByte.Summary(),
+			"traffic":       stats.traffic.Report(),
+		})
+	}
+
+	return map[string]interface{}{
+		"enabled":    true,
+		"max_routes": rm.max,
+		"tracked":    len(names),
+		"overflowed": atomic.LoadInt64(&rm.overflowed),
+		"top":        top,
+	}
+}
+
+// routeMetricsMiddleware counts the body bytes exchanged with clients and records every
+// request under its route, whether a backend answered it or the load balancer did
+func (lb *LoadBalancer) routeMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestBody := countBody(&r.Body)
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		requestBytes, responseBytes := requestBody.bytesRead(), recorder.written
+		lb.traffic.Request.Add(requestBytes)
+		lb.traffic.Response.Add(responseBytes)
+		if lb.routeMetrics == nil {
+			return
+		}
+
+		route := r.URL.Path
+		if matched := lb.matchRoute(r.URL.Path); matched != nil {
+			route = matched.PathPrefix
+		}
+		status := recorder.statusCode
+		if status == 0 {
+			status = http.StatusOK
+		}
+		duration, firstByte := time.Since(start), time.Since(start)
+		if !recorder.firstByte.IsZero() {
+			firstByte = recorder.firstByte.Sub(start)
+		}
+		lb.routeMetrics.Observe(route, status, firstByte, duration, requestBytes, responseBytes)
+	})
+}
+
+// metricsHandler serves load balancer metrics in Prometheus text exposition format
+func (lb *LoadBalancer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# HELP loadbalancer_requests_total Requests proxied to a backend.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_requests_total counter\n")
+	fmt.Fprintf(&sb, "loadbalancer_requests_total %d\n", atomic.LoadInt64(&lb.requests))
+	fmt.Fprintf(&sb, "# HELP loadbalancer_retries_total Requests retried on another backend.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_retries_total counter\n")
+	fmt.Fprintf(&sb, "loadbalancer_retries_total %d\n", atomic.LoadInt64(&lb.retries))
+	fmt.Fprintf(&sb, "# HELP loadbalancer_first_byte_reroutes_total Retries after a backend didn't start responding within the route's first byte timeout.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_first_byte_reroutes_total counter\n")
+	fmt.Fprintf(&sb, "loadbalancer_first_byte_reroutes_total %d\n", atomic.LoadInt64(&lb.firstByteReroutes))
+	fmt.Fprintf(&sb, "# HELP loadbalancer_request_bytes_total Request body bytes received from clients.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_request_bytes_total counter\n")
+	fmt.Fprintf(&sb, "loadbalancer_request_bytes_total %d\n", lb.traffic.Request.Total())
+	fmt.Fprintf(&sb, "# HELP loadbalancer_response_bytes_total Response body bytes sent to clients.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_response_bytes_total counter\n")
+	fmt.Fprintf(&sb, "loadbalancer_response_bytes_total %d\n", lb.traffic.Response.Total())
+
+	backends := append(lb.serverPool.GetBackends(), lb.quarantinePool.GetBackends()...)
+	fmt.Fprintf(&sb, "# HELP loadbalancer_backend_request_bytes_total Request body bytes sent to each backend.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_backend_request_bytes_total counter\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&sb, "loadbalancer_backend_request_bytes_total{backend=%q} %d\n", backend.Address(), backend.Traffic().Request.Total())
+	}
+	fmt.Fprintf(&sb, "# HELP loadbalancer_backend_response_bytes_total Response body bytes received from each backend.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_backend_response_bytes_total counter\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&sb, "loadbalancer_backend_response_bytes_total{backend=%q} %d\n", backend.Address(), backend.Traffic().Response.Total())
+	}
+
+	// Quantiles are over each backend's recent responses, the sum and count over all of them
+	fmt.Fprintf(&sb, "# HELP loadbalancer_backend_response_seconds Response latency of each backend, to the first byte and in full.\n")
+	fmt.Fprintf(&sb, "# TYPE loadbalancer_backend_response_seconds summary\n")
+	for _, backend := range backends {
+		report := backend.Timing().Report()
+		responses, firstByte, total := backend.Timing().Totals()
+		for _, phase := range []struct {
+			name    string
+			summary LatencySummary
+			sum     time.Duration
+		}{{"first_byte", report.FirstByte, firstByte}, {"total", report.Total, total}} {
+			for _, q := range []struct {
+				quantile string
+				ms       float64
+			}{{"0.5", phase.summary.P50Ms}, {"0.95", phase.summary.P95Ms}, {"0.99", phase.summary.P99Ms}} {
+				fmt.Fprintf(&sb, "loadbalancer_backend_response_seconds{backend=%q,phase=%q,quantile=%q} %g\n",
+					backend.Address(), phase.name, q.quantile, q.ms/1000)
+			}
+			fmt.Fprintf(&sb, "loadbalancer_backend_response_seconds_sum{backend=%q,phase=%q} %g\n",
+				backend.Address(), phase.name, phase.sum.Seconds())
+			fmt.Fprintf(&sb, "loadbalancer_backend_response_seconds_count{backend=%q,phase=%q} %d\n",
+				backend.Address(), phase.name, responses)
+		}
+	}
+
+	lb.upstream.writeMetrics(&sb)
+
+	if lb.routeMetrics != nil {
+		names, routes := lb.routeMetrics.snapshot()
+		sort.Strings(names)
+
+		fmt.Fprintf(&sb, "# HELP loadbalancer_route_requests_total Requests by route and status class.\n")
+		fmt.Fprintf(&sb, "# TYPE loadbalancer_route_requests_total counter\n")
+		for _, route := range names {
+			stats := routes[route]
+			requests := atomic.LoadInt64(&stats.requests)
+			clientErrors := atomic.LoadInt64(&stats.clientErrors)
+			errors := atomic.LoadInt64(&stats.errors)
+			fmt.Fprintf(&sb, "loadbalancer_route_requests_total{route=%q,class=\"ok\"} %d\n", route, requests-clientErrors-errors)
+			fmt.Fprintf(&sb, "loadbalancer_route_requests_total{route=%q,class=\"4xx\"} %d\n", route, clientErrors)
+			fmt.Fprintf(&sb, "loadbalancer_route_requests_total{route=%q,class=\"5xx\"} %d\n", route, errors)
+		}
+
+		fmt.Fprintf(&sb, "# HELP loadbalancer_route_request_bytes_total Request body bytes by route.\n")
+		fmt.Fprintf(&sb, "# TYPE loadbalancer_route_request_bytes_total counter\n")
+		for _, route := range names {
+			fmt.Fprintf(&sb, "loadbalancer_route_request_bytes_total{route=%q} %d\n", route, routes[route].traffic.Request.Total())
+		}
+		fmt.Fprintf(&sb, "# HELP loadbalancer_route_response_bytes_total Response body bytes by route.\n")
+		fmt.Fprintf(&sb, "# TYPE loadbalancer_route_response_bytes_total counter\n")
+		for _, route := range names {
+			fmt.Fprintf(&sb, "loadbalancer_route_response_bytes_total{route=%q} %d\n", route, routes[route].traffic.Response.Total())
+		}
+
+		fmt.Fprintf(&sb, "# HELP loadbalancer_route_request_duration_seconds Request latency through the load balancer, by route.\n")
+		fmt.Fprintf(&sb, "# TYPE loadbalancer_route_request_duration_seconds histogram\n")
+		for _, route := range names {
+			stats := routes[route]
+			for i, bound := range routeLatencyBuckets {
+				fmt.Fprintf(&sb, "loadbalancer_route_request_duration_seconds_bucket{route=%q,le=\"%g\"} %d\n",
+					route, bound, atomic.LoadInt64(&stats.buckets[i]))
+			}
+			requests := atomic.LoadInt64(&stats.requests)
+			fmt.Fprintf(&sb, "loadbalancer_route_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, requests)
+			fmt.Fprintf(&sb, "loadbalancer_route_request_duration_seconds_sum{route=%q} %g\n",
+				route, time.Duration(atomic.LoadInt64(&stats.nanos)).Seconds())
+			fmt.Fprintf(&sb, "loadbalancer_route_request_duration_seconds_count{route=%q} %d\n", route, requests)
+		}
+
+		fmt.Fprintf(&sb, "# HELP loadbalancer_route_first_byte_seconds Time until the response started (its headers were written), by route.\n")
+		fmt.Fprintf(&sb, "# TYPE loadbalancer_route_first_byte_seconds histogram\n")
+		for _, route := range names {
+			stats := routes[route]
+			for i, bound := range routeLatencyBuckets {
+				fmt.Fprintf(&sb, "loadbalancer_route_first_byte_seconds_bucket{route=%q,le=\"%g\"} %d\n",
+					route, bound, atomic.LoadInt64(&stats.firstByteBuckets[i]))
+			}
+			requests := atomic.LoadInt64(&stats.requests)
+			fmt.Fprintf(&sb, "loadbalancer_route_first_byte_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, requests)
+			fmt.Fprintf(&sb, "loadbalancer_route_first_byte_seconds_sum{route=%q} %g\n",
+				route, time.Duration(atomic.LoadInt64(&stats.firstByteNanos)).Seconds())
+			fmt.Fprintf(&sb, "loadbalancer_route_first_byte_seconds_count{route=%q} %d\n", route, requests)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, sb.String())
+}
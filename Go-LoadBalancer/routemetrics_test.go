@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMetricsMatchDeclaredTypes checks every sample in /metrics against the TYPE of its
+// family, as Prometheus parses it: only summaries carry quantiles, with _sum and _count
+func TestMetricsMatchDeclaredTypes(t *testing.T) {
+	backend := newStatusBackend(t, http.StatusOK)
+	lb, proxy := newTestLoadBalancer(t, nil, backend)
+	get(t, proxy.URL)
+
+	w := httptest.NewRecorder()
+	lb.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var family, kind string
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+			family, kind = fields[2], fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, _ := strings.Cut(strings.Fields(line)[0], "{")
+		quantile := strings.Contains(labels, "quantile=")
+
+		var ok bool
+		switch kind {
+		case "counter", "gauge":
+			ok = name == family && !quantile
+		case "summary":
+			ok = (name == family && quantile) || (!quantile && (name == family+"_sum" || name == family+"_count"))
+		case "histogram":
+			ok = (name == family+"_bucket" && strings.Contains(labels, "le=")) || name == family+"_sum" || name == family+"_count"
+		}
+		if !ok {
+			t.Errorf("sample %q doesn't fit %s family %s", line, kind, family)
+		}
+	}
+
+	for _, want := range []string{
+		"# TYPE loadbalancer_backend_response_seconds summary",
+		`loadbalancer_backend_response_seconds_count{backend="` + backend.URL + `",phase="total"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
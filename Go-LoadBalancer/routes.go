@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// matchRoute returns the configured route with the longest prefix matching path, or nil
+func (lb *LoadBalancer) matchRoute(path string) *RouteConfig {
+	routes := *lb.routes.Load()
+
+	var matched *RouteConfig
+	for i := range routes {
+		route := &routes[i]
+		if !strings.HasPrefix(path, route.PathPrefix) {
+			continue
+		}
+		if matched == nil || len(route.PathPrefix) > len(matched.PathPrefix) {
+			matched = route
+		}
+	}
+	return matched
+}
+
+// Routes returns the current route table
+func (lb *LoadBalancer) Routes() []RouteConfig {
+	return *lb.routes.Load()
+}
+
+// SetRoutes atomically replaces the route table. The slice must not be modified afterwards.
+func (lb *LoadBalancer) SetRoutes(routes []RouteConfig) {
+	lb.routes.Store(&routes)
+	lb.rateLimiter.ResetRoutes()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// StatusSchemaVersion versions the /stats, /health and /circuit-breakers payloads. It is
+// bumped when a field is renamed, removed or changes meaning; new fields don't bump it.
+const StatusSchemaVersion = 1
+
+// BackendReport is one backend as reported by /health and /stats
+type BackendReport struct {
+	URL                 string `json:"url"`
+	Status              string `json:"status"` // "up" or "down", plus any " (circuit open)" / " (draining)"
+	Connections         int64  `json:"connections"`
+	RemoteConnections   int64  `json:"remote_connections"` // through other clustered load balancers
+	Weight              int    `json:"weight"`
+	EffectiveWeight     int    `json:"effective_weight"`
+	Throttled           bool   `json:"throttled"`
+	ConsecutiveErrors   int64  `json:"consecutive_errors"`
+	ClientCancellations int64  `json:"client_cancellations"`
+	SaturationReroutes  int64  `json:"saturation_reroutes"` // requests turned away at its connection limit
+	CircuitOpen         bool   `json:"circuit_open"`
+	Draining            bool   `json:"draining"`
+	Available           bool   `json:"available"`
+	Alive               bool   `json:"alive"`
+	HealthStatus        string `json:"health_status"`  // "healthy" or "unhealthy"
+	CircuitStatus       string `json:"circuit_status"` // "open" or "closed"
+
+	Traffic TrafficReport `json:"traffic"` // body bytes proxied to and from it
+	Timing  TimingReport  `json:"timing"`  // its responses' time to first byte and in full
+}
+
+// PoolStats summarises a server pool and its backends
+type PoolStats struct {
+	Algorithm            string          `json:"algorithm"`
+	TotalBackends        int             `json:"total_backends"`
+	AliveBackends        int             `json:"alive_backends"`
+	AvailableBackends    int             `json:"available_backends"`
+	PoolHealthPercentage float64         `json:"pool_health_percentage"`
+	SaturatedSelections  int64           `json:"saturated_selections"` // selections that skipped a full backend
+	Backends             []BackendReport `json:"backends"`
+
+	Retiring []RetiringBackendReport `json:"retiring,omitempty"` // removed, still finishing requests
+}
+
+// HealthResponse is served at /health
+type HealthResponse struct {
+	SchemaVersion int `json:"schema_version"`
+	PoolStats
+	Drain map[string]interface{} `json:"drain,omitempty"` // only while draining
+}
+
+// StatsConfig is the configuration reported by /stats
+type StatsConfig struct {
+	Port                string `json:"port"`
+	HealthCheckInterval int    `json:"health_check_interval"` // seconds
+	MaxRetries          int    `json:"max_retries"`
+	Algorithm           string `json:"algorithm"`
+	IdentityHeaders     bool   `json:"identity_headers"`
+	HealthCheck         string `json:"health_check"`
+}
+
+// FaultInjectionStats counts the faults injected into requests
+type FaultInjectionStats struct {
+	Aborted int64 `json:"aborted"`
+	Delayed int64 `json:"delayed"`
+}
+
+// DeadlineStats reports request deadlines and timeouts
+type DeadlineStats struct {
+	MaxSeconds            float64 `json:"max_seconds"`
+	RequestTimeoutSeconds float64 `json:"request_timeout_seconds"`
+	RequestTimeouts       int64   `json:"request_timeouts"`
+	Applied               int64   `json:"applied"`
+	Capped                int64   `json:"capped"`
+	Exceeded              int64   `json:"exceeded"`
+	Invalid               int64   `json:"invalid"`
+}
+
+// CircuitBreakerDefaults are the circuit breaker settings backends start with
+type CircuitBreakerDefaults struct {
+	MaxConsecutiveErrors  int `json:"max_consecutive_errors"`
+	CircuitTimeoutSeconds int `json:"circuit_timeout_seconds"`
+}
+
+// RuntimeInfo describes the running process
+type RuntimeInfo struct {
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	TotalRequests int64   `json:"total_requests"`
+}
+
+// StatsResponse is served at /stats. Each subsystem section is that subsystem's
+// GetStats map, whose fields depend on whether the subsystem is enabled.
+type StatsResponse struct {
+	SchemaVersion     int                    `json:"schema_version"`
+	LoadBalancer      PoolStats              `json:"load_balancer"`
+	Build             BuildDetails           `json:"build"`
+	Config            StatsConfig            `json:"config"`
+	RateLimit         map[string]interface{} `json:"rate_limit"`
+	ConcurrencyLimit  map[string]interface{} `json:"concurrency_limit"`
+	Overload          map[string]interface{} `json:"overload"`
+	Budget            map[string]interface{} `json:"budget"`
+	Queue             map[string]interface{} `json:"queue"`
+	ACL               map[string]interface{} `json:"acl"`
+	AdminAuth         map[string]interface{} `json:"admin_auth"`
+	Drain             map[string]interface{} `json:"drain"`
+	Logging           map[string]interface{} `json:"logging"`
+	Webhooks          map[string]interface{} `json:"webhooks"`
+	Cluster           map[string]interface{} `json:"cluster"`
+	StatsExport       map[string]interface{} `json:"stats_export"`
+	Weights           map[string]interface{} `json:"weights"`
+	StateStore        map[string]interface{} `json:"state_store"`
+	Experiment        map[string]interface{} `json:"experiment"`
+	ClientLimits      map[string]interface{} `json:"client_limits"`
+	Cache             map[string]interface{} `json:"cache"`
+	ProxyBuffers      map[string]interface{} `json:"proxy_buffers"`
+	Tracing           map[string]interface{} `json:"tracing"`
+	RemovalDrain      map[string]interface{} `json:"removal_drain"`
+	BackendAdmission  map[string]interface{} `json:"backend_admission"`
+	Routes            map[string]interface{} `json:"routes"` // busiest routes first
+	WarmPool          map[string]interface{} `json:"warm_pool"`
+	Upstream          map[string]interface{} `json:"upstream"` // connection reuse and TLS handshakes by backend host
+	Requests          int64                  `json:"requests"`
+	Traffic           TrafficReport          `json:"traffic"` // body bytes exchanged with clients
+	Latency           LatencySummary         `json:"latency"`
+	ClientDisconnects int64                  `json:"client_disconnects"`
+	Retries           int64                  `json:"retries"`
+	FirstByteReroutes int64                  `json:"first_byte_reroutes"` // retries after a route's first byte timeout, not proxy errors
+	ProxyErrors       map[string]int64       `json:"proxy_errors"`        // by error kind
+	FaultInjection    FaultInjectionStats    `json:"fault_injection"`
+	Deadlines         DeadlineStats          `json:"deadlines"`
+	CircuitBreaker    CircuitBreakerDefaults `json:"circuit_breaker"`
+	RuntimeInfo       RuntimeInfo            `json:"runtime_info"`
+	Timestamp         int64                  `json:"timestamp"` // Unix seconds
+}
+
+// CircuitBreakerStatus is one backend's entry in /circuit-breakers
+type CircuitBreakerStatus struct {
+	URL               string `json:"url"`
+	ConsecutiveErrors int64  `json:"consecutive_errors"`
+	CircuitOpen       bool   `json:"circuit_open"`
+	Available         bool   `json:"available"`
+	Alive             bool   `json:"alive"`
+	Connections       int64  `json:"connections"`
+	Weight            int    `json:"weight"`
+}
+
+// CircuitBreakerSummary totals the circuit breakers of the main pool
+type CircuitBreakerSummary struct {
+	TotalBackends     int     `json:"total_backends"`
+	AvailableBackends int     `json:"available_backends"`
+	CircuitsOpen      int     `json:"circuits_open"`
+	CircuitsClosed    int     `json:"circuits_closed"`
+	HealthPercentage  float64 `json:"health_percentage"`
+}
+
+// CircuitBreakersResponse is served at /circuit-breakers
+type CircuitBreakersResponse struct {
+	SchemaVersion   int                             `json:"schema_version"`
+	CircuitBreakers map[string]CircuitBreakerStatus `json:"circuit_breakers"` // keyed by backend URL
+	Summary         CircuitBreakerSummary           `json:"summary"`
+	Timestamp       int64                           `json:"timestamp"` // Unix seconds
+}
+
+// statusEndpoints maps each status endpoint to the type it serves
+var statusEndpoints = map[string]reflect.Type{
+	"/health":           reflect.TypeFor[HealthResponse](),
+	"/stats":            reflect.TypeFor[StatsResponse](),
+	"/circuit-breakers": reflect.TypeFor[CircuitBreakersResponse](),
+}
+
+// schemaHandler publishes a JSON Schema for each status endpoint, so clients can check
+// the payloads they parse against the schema_version they were written for
+func (lb *LoadBalancer) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints := make(map[string]interface{}, len(statusEndpoints))
+	for path, t := range statusEndpoints {
+		schema := jsonSchema(t)
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		schema["title"] = t.Name()
+		endpoints[path] = schema
+	}
+	writeJSON(w, map[string]interface{}{
+		"schema_version": StatusSchemaVersion,
+		"endpoints":      endpoints,
+	})
+}
+
+// jsonSchema describes how encoding/json renders a value of type t
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		addStructFields(t, properties, &required)
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{} // interface{}: any value
+}
+
+// addStructFields adds the JSON fields of struct type t, including those of embedded
+// structs, to properties; fields without omitempty are required
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = jsonSchema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -3,129 +3,206 @@ package main
 import (
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// ServerPool holds information about reachable backends
+// ServerPool holds information about reachable backends.
+//
+// Membership changes run concurrently with routing, which never locks: each selection
+// works on the snapshot it loaded, so it may pick a backend removed a moment ago (see
+// LoadBalancer.admit for how such picks are turned away). Backends are only ever added
+// to or dropped from new snapshots, never changed in place, so a slice returned by
+// GetBackends stays valid and may be kept for as long as needed. A removed backend is
+// marked draining, retired until its last request finishes, and then released, which
+// lets the algorithm Forget it.
 type ServerPool struct {
-	backends  []*Backend
-	algorithm LoadBalancingAlgorithm
-	mux       sync.RWMutex
+	// backends is an immutable snapshot swapped on membership changes, so request
+	// routing reads it without locking or copying
+	backends  atomic.Pointer[[]Backend]
+	algorithm atomic.Pointer[LoadBalancingAlgorithm] // swapped by SetAlgorithm
+	mux       sync.Mutex                             // serializes membership changes
+	name      string                                 // pool name in events
+	checker   atomic.Pointer[HealthChecker]          // nil for defaultHealthChecker
+	events    *EventLog
+	retiring  map[Backend]time.Time // removed backends still finishing requests, guarded by mux
+
+	saturatedSelections int64 // selections that left out a backend at its connection limit
+
+	logs *LogControl // routing decisions are logged while its routing switch is on
 }
 
+// defaultHealthChecker expects 2xx from /health, or from / if /health can't be fetched
+var defaultHealthChecker HealthChecker = HTTPHealthChecker{FallbackToRoot: true}
+
 // NewServerPool creates a new server pool
 func NewServerPool(algorithm LoadBalancingAlgorithm) *ServerPool {
-	return &ServerPool{
-		backends:  make([]*Backend, 0),
-		algorithm: algorithm,
+	s := &ServerPool{}
+	s.algorithm.Store(&algorithm)
+	s.backends.Store(&[]Backend{})
+	return s
+}
+
+// HealthChecker returns the checker HealthCheck runs against the pool's backends
+func (s *ServerPool) HealthChecker() HealthChecker {
+	if checker := s.checker.Load(); checker != nil {
+		return *checker
 	}
+	return defaultHealthChecker
+}
+
+// SetHealthChecker replaces the pool's health checker
+func (s *ServerPool) SetHealthChecker(checker HealthChecker) {
+	s.checker.Store(&checker)
+}
+
+// Algorithm returns the pool's load balancing algorithm
+func (s *ServerPool) Algorithm() LoadBalancingAlgorithm {
+	return *s.algorithm.Load()
+}
+
+// SetAlgorithm switches the pool to another algorithm; requests already routed are unaffected
+func (s *ServerPool) SetAlgorithm(algorithm LoadBalancingAlgorithm) {
+	s.algorithm.Store(&algorithm)
+	log.Printf("🔀 [POOL] Switched to %s", algorithm.Name())
+}
+
+// FindBackend returns the backend with the given address, or nil
+func (s *ServerPool) FindBackend(address string) Backend {
+	for _, backend := range s.GetBackends() {
+		if backend.Address() == address {
+			return backend
+		}
+	}
+	return nil
 }
 
 // AddBackend adds a backend to the server pool
-func (s *ServerPool) AddBackend(backend *Backend) {
+func (s *ServerPool) AddBackend(backend Backend) {
 	s.mux.Lock()
-	s.backends = append(s.backends, backend)
+	current := *s.backends.Load()
+	backends := make([]Backend, len(current), len(current)+1)
+	copy(backends, current)
+	backends = append(backends, backend)
+	s.backends.Store(&backends)
 	s.mux.Unlock()
-	log.Printf("➕ [POOL] Added backend: %s (weight: %d)", backend.URL.String(), backend.Weight)
+	log.Printf("➕ [POOL] Added backend: %s (weight: %d)", backend.Address(), backend.GetWeight())
 }
 
-// NextPeer returns the next available backend (including circuit breaker check)
-func (s *ServerPool) NextPeer() *Backend {
-	s.mux.RLock()
-	backends := make([]*Backend, len(s.backends))
-	copy(backends, s.backends)
-	s.mux.RUnlock()
+// RemoveBackend removes the backend with the given address from the pool
+func (s *ServerPool) RemoveBackend(address string) Backend {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	current := *s.backends.Load()
+	for i, backend := range current {
+		if backend.Address() == address {
+			backends := make([]Backend, 0, len(current)-1)
+			backends = append(backends, current[:i]...)
+			backends = append(backends, current[i+1:]...)
+			s.backends.Store(&backends)
+			log.Printf("➖ [POOL] Removed backend: %s", address)
+			return backend
+		}
+	}
+	return nil
+}
 
-	backend := s.algorithm.NextBackend(backends)
-	if backend == nil {
-		log.Printf("❌ [POOL] No available backends")
+// isCandidate reports whether a backend can take a request right now
+func isCandidate(backend Backend, exclude []Backend) bool {
+	status := backend.Status()
+	return status.Available() && !status.Saturated() && !slices.Contains(exclude, backend)
+}
+
+// NextAvailablePeer returns the next available backend, respecting circuit breakers.
+// Backends in exclude are skipped unless no other backend is available.
+func (s *ServerPool) NextAvailablePeer(exclude []Backend) Backend {
+	backends := s.GetBackends()
+
+	// Fast path: when every backend is a candidate the snapshot is handed to the
+	// algorithm as is, without allocating a filtered copy
+	candidates := backends
+	for _, backend := range backends {
+		if !isCandidate(backend, exclude) {
+			candidates = s.filterCandidates(backends, exclude)
+			break
+		}
+	}
+	if candidates == nil {
 		return nil
 	}
 
-	if backend.IsAvailable() {
-		log.Printf("🎯 [ROUTE] Selected backend: %s (connections: %d, weight: %d, errors: %d)",
-			backend.URL.String(), backend.GetConnections(), backend.Weight, backend.GetConsecutiveErrors())
-	} else if backend.IsCircuitOpen() {
-		log.Printf("🔒 [ROUTE] Backend %s circuit breaker is OPEN, looking for alternative", backend.URL.String())
-		// Try to find another available backend
-		return s.findAlternativeBackend(backends, backend)
-	} else {
-		log.Printf("⚠️ [ROUTE] Warning: chosen backend %s is DOWN, request may fail", backend.URL.String())
+	// Use the load balancing algorithm on available backends
+	backend := s.Algorithm().NextBackend(candidates)
+	if backend != nil && s.logs.Routing() {
+		healthStatus := "✅"
+		if backend.GetConsecutiveErrors() > 0 {
+			healthStatus = "⚠️"
+		}
+		log.Printf("%s [ROUTE] Selected backend: %s (connections: %d, weight: %d, errors: %d, %d/%d candidates)",
+			healthStatus, backend.Address(), backend.GetConnections(),
+			backend.GetWeight(), backend.GetConsecutiveErrors(), len(candidates), len(backends))
 	}
 
 	return backend
 }
 
-// NextAvailablePeer returns the next available backend, respecting circuit breakers
-func (s *ServerPool) NextAvailablePeer() *Backend {
-	s.mux.RLock()
-	backends := make([]*Backend, len(s.backends))
-	copy(backends, s.backends)
-	s.mux.RUnlock()
-
-	// Filter only available backends (alive and circuit not open)
-	availableBackends := make([]*Backend, 0)
-	unavailableReasons := make([]string, 0)
+// filterCandidates is the slow path of NextAvailablePeer, taken when some backend is
+// unavailable, saturated or excluded. It returns nil if no backend is available at all.
+func (s *ServerPool) filterCandidates(backends []Backend, exclude []Backend) []Backend {
+	availableBackends := make([]Backend, 0, len(backends))
+	untried := make([]Backend, 0, len(backends))
+	var unavailableReasons []string
+	saturated := false
 
 	for _, backend := range backends {
-		if backend.IsAvailable() {
+		status := backend.Status()
+		if status.Available() && !status.Saturated() {
 			availableBackends = append(availableBackends, backend)
-		} else {
-			reason := "DOWN"
-			if backend.IsAlive() && backend.IsCircuitOpen() {
-				reason = "CIRCUIT_OPEN"
-			} else if !backend.IsAlive() && backend.IsCircuitOpen() {
-				reason = "DOWN+CIRCUIT_OPEN"
+			if !slices.Contains(exclude, backend) {
+				untried = append(untried, backend)
 			}
-			unavailableReasons = append(unavailableReasons,
-				backend.URL.String()+":"+reason)
+			continue
+		}
+
+		reason := "DOWN"
+		if status.Draining() {
+			reason = "DRAINING"
+		} else if status.Alive() && status.CircuitOpen() {
+			reason = "CIRCUIT_OPEN"
+		} else if !status.Alive() && status.CircuitOpen() {
+			reason = "DOWN+CIRCUIT_OPEN"
+		} else if status.Available() {
+			reason = "SATURATED"
+			saturated = true
 		}
+		unavailableReasons = append(unavailableReasons, backend.Address()+":"+reason)
+	}
+	if saturated {
+		atomic.AddInt64(&s.saturatedSelections, 1)
 	}
 
 	if len(availableBackends) == 0 {
 		log.Printf("❌ [POOL] No available backends - unavailable: [%s]",
-			joinStrings(unavailableReasons, ", "))
+			strings.Join(unavailableReasons, ", "))
 		return nil
 	}
 
-	// Log the available pool
-	var availableUrls []string
-	for _, b := range availableBackends {
-		status := "HEALTHY"
-		if b.GetConsecutiveErrors() > 0 {
-			status = "DEGRADED"
-		}
-		availableUrls = append(availableUrls, b.URL.String()+":"+status)
+	// Skip backends this request already tried, if any others remain
+	if len(untried) > 0 {
+		return untried
 	}
-
-	log.Printf("📋 [POOL] Available backends: [%s] (%d/%d available)",
-		joinStrings(availableUrls, ", "), len(availableBackends), len(backends))
-
-	// Use the load balancing algorithm on available backends
-	backend := s.algorithm.NextBackend(availableBackends)
-	if backend != nil {
-		healthStatus := "✅"
-		if backend.GetConsecutiveErrors() > 0 {
-			healthStatus = "⚠️"
-		}
-		log.Printf("%s [ROUTE] Selected backend: %s (connections: %d, weight: %d, errors: %d)",
-			healthStatus, backend.URL.String(), backend.GetConnections(),
-			backend.Weight, backend.GetConsecutiveErrors())
-	}
-
-	return backend
+	log.Printf("⚠️ [POOL] All available backends already tried, reusing one")
+	return availableBackends
 }
 
 // GetAvailableBackends returns all currently available backends
-func (s *ServerPool) GetAvailableBackends() []*Backend {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-
-	availableBackends := make([]*Backend, 0)
-	for _, backend := range s.backends {
+func (s *ServerPool) GetAvailableBackends() []Backend {
+	availableBackends := make([]Backend, 0)
+	for _, backend := range s.GetBackends() {
 		if backend.IsAvailable() {
 			availableBackends = append(availableBackends, backend)
 		}
@@ -135,15 +212,13 @@ func (s *ServerPool) GetAvailableBackends() []*Backend {
 
 // GetPoolSummary returns a quick summary of pool status
 func (s *ServerPool) GetPoolSummary() map[string]int {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-
-	total := len(s.backends)
+	backends := s.GetBackends()
+	total := len(backends)
 	alive := 0
 	available := 0
 	circuitsClosed := 0
 
-	for _, backend := range s.backends {
+	for _, backend := range backends {
 		if backend.IsAlive() {
 			alive++
 		}
@@ -163,42 +238,28 @@ func (s *ServerPool) GetPoolSummary() map[string]int {
 	}
 }
 
-// findAlternativeBackend tries to find an alternative backend when the primary choice is unavailable
-func (s *ServerPool) findAlternativeBackend(backends []*Backend, excludeBackend *Backend) *Backend {
-	for _, backend := range backends {
-		if backend != excludeBackend && backend.IsAvailable() {
-			log.Printf("🔄 [ROUTE] Found alternative backend: %s (errors: %d)",
-				backend.URL.String(), backend.GetConsecutiveErrors())
-			return backend
-		}
-	}
-	log.Printf("❌ [ROUTE] No alternative backends available")
-	return nil
-}
-
-// GetBackends returns a copy of the backends slice
-func (s *ServerPool) GetBackends() []*Backend {
-	s.mux.RLock()
-	backends := make([]*Backend, len(s.backends))
-	copy(backends, s.backends)
-	s.mux.RUnlock()
-	return backends
+// GetBackends returns the current backends snapshot, which must not be modified
+func (s *ServerPool) GetBackends() []Backend {
+	return *s.backends.Load()
 }
 
 // HealthCheck pings the backends and updates the status
 func (s *ServerPool) HealthCheck() {
 	backends := s.GetBackends()
+	checker := s.HealthChecker()
 	var wg sync.WaitGroup
 
-	log.Printf("🏥 [HEALTH] Checking %d backends...", len(backends))
+	s.logs.Debugf("🏥 [HEALTH] Checking %d backends...", len(backends))
 
 	for _, b := range backends {
 		wg.Add(1)
-		go func(backend *Backend) {
+		go func(backend Backend) {
 			defer wg.Done()
-			start := time.Now()
-			alive := isBackendAlive(backend.URL)
-			latency := time.Since(start)
+			result := checker.Check(backend)
+			alive, latency := result.Healthy, result.Latency
+			if observer, ok := s.Algorithm().(LatencyObserver); ok && alive {
+				observer.ObserveLatency(backend, latency, LatencyProbe)
+			}
 
 			wasAlive := backend.IsAlive()
 			wasCircuitOpen := backend.IsCircuitOpen()
@@ -225,21 +286,26 @@ func (s *ServerPool) HealthCheck() {
 
 			// Log status changes prominently
 			if alive != wasAlive {
-				log.Printf("🔄 [HEALTH] Backend %s status CHANGED: %s%s → %s%s (latency: %v)",
-					backend.URL.String(),
+				log.Printf("🔄 [HEALTH] Backend %s status CHANGED: %s%s → %s%s (latency: %v, %s)",
+					backend.Address(),
 					map[bool]string{true: "✅UP", false: "🔴DOWN"}[wasAlive],
 					map[bool]string{true: "🔒CIRCUIT_OPEN", false: "🔓CIRCUIT_CLOSED"}[wasCircuitOpen],
-					healthEmoji+healthStatus, circuitEmoji+circuitStatus, latency)
+					healthEmoji+healthStatus, circuitEmoji+circuitStatus, latency, result.Detail)
 			} else {
 				// Regular health check log (less prominent)
-				log.Printf("🏥 [HEALTH] %s: %s%s, circuit=%s%s (latency: %v)",
-					backend.URL.String(), healthEmoji, healthStatus, circuitEmoji, circuitStatus, latency)
+				s.logs.Debugf("🏥 [HEALTH] %s: %s%s, circuit=%s%s (latency: %v)",
+					backend.Address(), healthEmoji, healthStatus, circuitEmoji, circuitStatus, latency)
 			}
 
 			// Circuit breaker recovery logic
 			if alive && backend.IsCircuitOpen() {
-				log.Printf("🔄 [CIRCUIT] Backend %s is healthy again, circuit may reset on next successful request",
-					backend.URL.String())
+				s.logs.Infof("🔄 [CIRCUIT] Backend %s is healthy again, circuit may reset on next successful request",
+					backend.Address())
+			}
+
+			if alive != wasAlive {
+				s.events.Record(map[bool]string{true: EventBackendUp, false: EventBackendDown}[alive], s.name, backend.Address(),
+					"health check %s: %s", map[bool]string{true: "passed", false: "failed"}[alive], result.Detail)
 			}
 
 			// Log if backend becomes available/unavailable
@@ -249,7 +315,7 @@ func (s *ServerPool) HealthCheck() {
 				if !isAvailableNow {
 					availabilityStatus = "🔴 UNAVAILABLE"
 				}
-				log.Printf("📊 [AVAILABILITY] Backend %s is now: %s", backend.URL.String(), availabilityStatus)
+				log.Printf("📊 [AVAILABILITY] Backend %s is now: %s", backend.Address(), availabilityStatus)
 			}
 		}(b)
 	}
@@ -257,35 +323,30 @@ func (s *ServerPool) HealthCheck() {
 
 	// Summary after all health checks
 	summary := s.GetPoolSummary()
-	log.Printf("📊 [HEALTH] Health check complete: %d/%d alive, %d/%d available, %d/%d circuits closed",
+	s.logs.Infof("📊 [HEALTH] Health check complete: %d/%d alive, %d/%d available, %d/%d circuits closed",
 		summary["alive"], summary["total"],
 		summary["available"], summary["total"],
 		summary["circuits_closed"], summary["total"])
 }
 
 // GetStats returns statistics about the server pool including circuit breaker info
-func (s *ServerPool) GetStats() map[string]interface{} {
+func (s *ServerPool) GetStats() PoolStats {
 	backends := s.GetBackends()
-	stats := map[string]interface{}{
-		"algorithm":          s.algorithm.Name(),
-		"total_backends":     len(backends),
-		"alive_backends":     0,
-		"available_backends": 0,
-		"backends":           make([]map[string]interface{}, 0),
+	stats := PoolStats{
+		Algorithm:     s.Algorithm().Name(),
+		TotalBackends: len(backends),
+		Backends:      make([]BackendReport, 0, len(backends)),
 	}
 
-	aliveCount := 0
-	availableCount := 0
-
 	for _, backend := range backends {
 		alive := backend.IsAlive()
 		available := backend.IsAvailable()
 
 		if alive {
-			aliveCount++
+			stats.AliveBackends++
 		}
 		if available {
-			availableCount++
+			stats.AvailableBackends++
 		}
 
 		status := "down"
@@ -295,61 +356,38 @@ func (s *ServerPool) GetStats() map[string]interface{} {
 		if backend.IsCircuitOpen() {
 			status += " (circuit open)"
 		}
-
-		// Enhanced backend info
-		backendInfo := map[string]interface{}{
-			"url":                backend.URL.String(),
-			"status":             status,
-			"connections":        backend.GetConnections(),
-			"weight":             backend.Weight,
-			"consecutive_errors": backend.GetConsecutiveErrors(),
-			"circuit_open":       backend.IsCircuitOpen(),
-			"available":          available,
-			"alive":              alive,
-			"health_status":      map[bool]string{true: "healthy", false: "unhealthy"}[alive],
-			"circuit_status":     map[bool]string{true: "open", false: "closed"}[backend.IsCircuitOpen()],
+		if backend.IsDraining() {
+			status += " (draining)"
 		}
-		stats["backends"] = append(stats["backends"].([]map[string]interface{}), backendInfo)
-	}
-
-	stats["alive_backends"] = aliveCount
-	stats["available_backends"] = availableCount
-	stats["pool_health_percentage"] = float64(availableCount) / float64(len(backends)) * 100
-
-	return stats
-}
 
-// isBackendAlive checks whether a backend is alive by checking health endpoint
-func isBackendAlive(u *url.URL) bool {
-	client := http.Client{
-		Timeout: 2 * time.Second,
-	}
-
-	// Check the health endpoint specifically
-	healthURL := u.String() + "/health"
-	resp, err := client.Get(healthURL)
-	if err != nil {
-		// If health endpoint fails, try the root endpoint
-		resp, err = client.Get(u.String())
-		if err != nil {
-			return false
-		}
+		// Enhanced backend info
+		stats.Backends = append(stats.Backends, BackendReport{
+			URL:                 backend.Address(),
+			Status:              status,
+			Connections:         backend.GetConnections(),
+			RemoteConnections:   backend.RemoteConnections(),
+			Weight:              backend.GetWeight(),
+			EffectiveWeight:     backend.EffectiveWeight(),
+			Throttled:           backend.IsThrottled(),
+			ConsecutiveErrors:   backend.GetConsecutiveErrors(),
+			ClientCancellations: backend.GetClientCancellations(),
+			SaturationReroutes:  backend.GetSaturationReroutes(),
+			CircuitOpen:         backend.IsCircuitOpen(),
+			Draining:            backend.IsDraining(),
+			Available:           available,
+			Alive:               alive,
+			HealthStatus:        map[bool]string{true: "healthy", false: "unhealthy"}[alive],
+			CircuitStatus:       map[bool]string{true: "open", false: "closed"}[backend.IsCircuitOpen()],
+			Traffic:             backend.Traffic().Report(),
+			Timing:              backend.Timing().Report(),
+		})
 	}
-	defer resp.Body.Close()
-
-	// Consider only 2xx status codes as alive
-	return resp.StatusCode >= 200 && resp.StatusCode < 300
-}
 
-// Helper function to join strings (since Go doesn't have a built-in for string slices)
-func joinStrings(strs []string, separator string) string {
-	if len(strs) == 0 {
-		return ""
+	stats.SaturatedSelections = atomic.LoadInt64(&s.saturatedSelections)
+	stats.Retiring = s.retiringReports()
+	if len(backends) > 0 {
+		stats.PoolHealthPercentage = float64(stats.AvailableBackends) / float64(len(backends)) * 100
 	}
 
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += separator + strs[i]
-	}
-	return result
+	return stats
 }
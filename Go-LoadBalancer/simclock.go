@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	simulationLatencySamples = 100000
+	// simulationBackoff is how long a closed loop client waits after finding no backend,
+	// so clients can't spin at one instant while every circuit is open
+	simulationBackoff = time.Millisecond
+)
+
+// simulationEpoch is where virtual clocks start, so traces don't depend on when they ran
+var simulationEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// VirtualClock is a simulation's time, moved forward only by its event loop
+type VirtualClock struct {
+	now time.Time
+}
+
+// Now returns the time of the event being processed
+func (c *VirtualClock) Now() time.Time {
+	return c.now
+}
+
+// clockSetter is implemented by algorithms whose state ages with time
+type clockSetter interface {
+	SetClock(now func() time.Time)
+}
+
+// randomSetter is implemented by algorithms that make random choices
+type randomSetter interface {
+	SetRandom(random func(n int) int)
+}
+
+// simRequest is a request in a virtual clock simulation
+type simRequest struct {
+	id      int64
+	arrived time.Time
+	state   *requestState
+	attempt int
+	client  int // closed loop client, -1 for open loop arrivals
+}
+
+// simEvent is a request arriving (or being retried) or an attempt completing
+type simEvent struct {
+	at      time.Time
+	seq     uint64 // scheduling order, breaking ties so runs are deterministic
+	request *simRequest
+
+	// Set for completions
+	backend *SyntheticBackend
+	latency time.Duration
+	status  int
+}
+
+// simSchedule is the event queue, earliest first
+type simSchedule struct {
+	events []*simEvent
+	seq    uint64
+}
+
+func (s *simSchedule) Len() int { return len(s.events) }
+func (s *simSchedule) Less(i, j int) bool {
+	a, b := s.events[i], s.events[j]
+	if !a.at.Equal(b.at) {
+		return a.at.Before(b.at)
+	}
+	return a.seq < b.seq
+}
+func (s *simSchedule) Swap(i, j int)      { s.events[i], s.events[j] = s.events[j], s.events[i] }
+func (s *simSchedule) Push(x interface{}) { s.events = append(s.events, x.(*simEvent)) }
+func (s *simSchedule) Pop() interface{} {
+	event := s.events[len(s.events)-1]
+	s.events = s.events[:len(s.events)-1]
+	return event
+}
+
+// schedule queues an event
+func (s *simSchedule) schedule(event *simEvent) {
+	s.seq++
+	event.seq = s.seq
+	heap.Push(s, event)
+}
+
+// runVirtualSimulation runs the simulation against one algorithm as a discrete event
+// simulation: a single loop takes arrivals and completions in time order, routes each
+// request through the load balancer's pool and algorithm, and moves a virtual clock
+// that the algorithm and the circuit breakers tell time by. Nothing sleeps, so a minute
+// of traffic takes as long as its routing decisions do, and all randomness comes from
+// streams seeded by sim.Seed: the same file and seed replay the same run exactly, and
+// with an open loop "rate" every algorithm sees the very same arrivals and backend
+// latencies, so two of them can be compared decision by decision.
+func runVirtualSimulation(algorithm string, sim Simulation, traceDir string) (SimulationResult, error) {
+	duration := defaultSimulationDuration
+	if sim.Duration != "" {
+		duration, _ = time.ParseDuration(sim.Duration)
+	}
+	concurrency := sim.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultSimulationConcurrency
+	}
+	seed := sim.Seed
+	if seed == 0 {
+		seed = 1
+	}
+
+	lb, backends, err := newSimulationLoadBalancer(algorithm, sim)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	clock := &VirtualClock{now: simulationEpoch}
+	if setter, ok := lb.serverPool.Algorithm().(clockSetter); ok {
+		setter.SetClock(clock.Now)
+	}
+	if setter, ok := lb.serverPool.Algorithm().(randomSetter); ok {
+		// Stream 0, apart from the arrivals' and the backends' below
+		setter.SetRandom(rand.New(rand.NewPCG(seed, 0)).IntN)
+	}
+	index := make(map[*SyntheticBackend]int, len(backends))
+	for i, backend := range backends {
+		// Each backend draws from its own stream, so the latencies it samples don't
+		// depend on how many requests the algorithm sent to the others
+		backend.random = rand.New(rand.NewPCG(seed, uint64(i)+2)).Float64
+		backend.breaker.SetClock(clock.Now)
+		index[backend] = i
+	}
+	arrivals := rand.New(rand.NewPCG(seed, 1))
+	observer, _ := lb.serverPool.Algorithm().(LatencyObserver)
+
+	var trace *bufio.Writer
+	if traceDir != "" {
+		f, err := os.Create(filepath.Join(traceDir, algorithm+".csv"))
+		if err != nil {
+			return SimulationResult{}, err
+		}
+		defer f.Close()
+		trace = bufio.NewWriter(f)
+		defer trace.Flush()
+		fmt.Fprintln(trace, "time_us,request,attempt,backend,latency_us,status")
+	}
+
+	var schedule simSchedule
+	end := simulationEpoch.Add(duration)
+	var nextID int64
+	arrive := func(at time.Time, client int) {
+		nextID++
+		schedule.schedule(&simEvent{at: at, request: &simRequest{id: nextID, arrived: at, state: &requestState{}, client: client}})
+	}
+	interarrival := func() time.Duration {
+		return time.Duration(arrivals.ExpFloat64() / sim.Rate * float64(time.Second))
+	}
+	if sim.Rate > 0 {
+		arrive(simulationEpoch.Add(interarrival()), -1)
+	} else {
+		for client := 0; client < concurrency; client++ {
+			arrive(simulationEpoch, client)
+		}
+	}
+
+	latencies := NewLatencyWindow(simulationLatencySamples)
+	fingerprint := fnv.New64a()
+	var requests, errors int64
+	finish := func(request *simRequest, status int) {
+		requests++
+		if status != http.StatusOK {
+			errors++
+		}
+		latencies.Record(clock.now.Sub(request.arrived))
+		if request.client < 0 {
+			return
+		}
+		next := clock.now
+		if len(request.state.attempted) == 0 {
+			next = next.Add(simulationBackoff)
+		}
+		if next.Before(end) {
+			arrive(next, request.client)
+		}
+	}
+
+	var buf []byte
+	for schedule.Len() > 0 {
+		event := heap.Pop(&schedule).(*simEvent)
+		clock.now = event.at
+		request := event.request
+
+		if event.backend == nil {
+			if request.client < 0 && request.attempt == 0 {
+				// Open loop arrivals don't depend on how earlier requests were served
+				if next := clock.now.Add(interarrival()); next.Before(end) {
+					arrive(next, -1)
+				}
+			}
+			peer := lb.admit(lb.serverPool, request.state, request.state.attempted)
+			if peer == nil {
+				finish(request, http.StatusServiceUnavailable)
+				continue
+			}
+			backend := peer.(*SyntheticBackend)
+			request.state.attempted = append(request.state.attempted, peer)
+			atomic.AddInt64(&backend.served, 1)
+			latency := backend.latency.Sample(backend.GetConnections()-1, backend.random)
+			status := http.StatusOK
+			if backend.errorRate > 0 && backend.random() < backend.errorRate {
+				status = backend.errorStatus
+			}
+			schedule.schedule(&simEvent{at: clock.now.Add(latency), request: request, backend: backend, latency: latency, status: status})
+			continue
+		}
+
+		backend := event.backend
+		lb.releaseConnectionState(request.state, backend)
+		buf = binary.LittleEndian.AppendUint64(buf[:0], uint64(request.id))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(request.attempt))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(index[backend]))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(event.status))
+		fingerprint.Write(buf)
+		if trace != nil {
+			fmt.Fprintf(trace, "%d,%d,%d,%s,%d,%d\n", clock.now.Sub(simulationEpoch).Microseconds(), request.id,
+				request.attempt, backend.Address(), event.latency.Microseconds(), event.status)
+		}
+
+		// The same outcomes the response recorder reports for a proxied request
+		switch {
+		case event.status >= 500:
+			backend.RecordError()
+		case event.status >= 200 && event.status < 400:
+			backend.RecordSuccess()
+			if observer != nil {
+				observer.ObserveLatency(backend, event.latency, LatencyInBand)
+			}
+		}
+		if slices.Contains(defaultRetryStatusCodes, event.status) && request.attempt < lb.config.MaxRetries {
+			request.attempt++
+			schedule.schedule(&simEvent{at: clock.now, request: request})
+			continue
+		}
+		finish(request, event.status)
+	}
+
+	elapsed := clock.now.Sub(simulationEpoch)
+	result := SimulationResult{
+		Algorithm:    algorithm,
+		Clock:        "virtual",
+		Requests:     requests,
+		Errors:       errors,
+		Seconds:      elapsed.Seconds(),
+		Latency:      latencies.Summary(),
+		Distribution: make(map[string]int64, len(backends)),
+		Seed:         seed,
+		Fingerprint:  hex.EncodeToString(fingerprint.Sum(nil)),
+	}
+	if elapsed > 0 {
+		result.Throughput = float64(requests) / elapsed.Seconds()
+	}
+	for _, backend := range backends {
+		result.Distribution[strings.TrimPrefix(backend.Address(), "sim://")] = backend.Served()
+	}
+	return result, nil
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSimulationDuration    = 5 * time.Second
+	defaultSimulationConcurrency = 100
+	simulationWorkerSamples      = 4096 // latency samples kept per simulated client
+)
+
+// Simulation is an in-process routing experiment read from a JSON file. Requests go
+// through the load balancer's handler to synthetic backends that answer from a latency
+// and error model, so nothing touches a socket and algorithms can be compared at
+// whatever rate the CPU allows:
+//
+//	{
+//	  "name": "one slow backend",
+//	  "duration": "10s",
+//	  "concurrency": 200,
+//	  "algorithms": ["round-robin", "least-connections", "least-latency"],
+//	  "backends": [
+//	    {"name": "fast", "count": 3, "latency": "2ms", "jitter": "1ms"},
+//	    {"name": "slow", "latency": "20ms", "per_request": "1ms", "error_rate": 0.01}
+//	  ]
+//	}
+//
+// With "clock": "virtual" the simulation runs on a virtual clock instead, see
+// runVirtualSimulation, and is deterministic for a given "seed".
+type Simulation struct {
+	Name        string              `json:"name"`
+	Duration    string              `json:"duration"`    // per algorithm, defaults to 5s
+	Concurrency int                 `json:"concurrency"` // simulated clients, defaults to 100
+	Clock       string              `json:"clock"`       // "real" (default) or "virtual"
+	Seed        uint64              `json:"seed"`        // of the virtual clock's randomness, defaults to 1
+	Rate        float64             `json:"rate"`        // virtual clock arrivals per second, instead of concurrency
+	Algorithms  []string            `json:"algorithms"`  // defaults to round-robin, weighted and least-connections
+	Backends    []SimulationBackend `json:"backends"`
+	Requests    []SimulationRequest `json:"requests"` // requested in turn, defaults to GET /
+}
+
+// SimulationRequest is a path simulated clients request
+type SimulationRequest struct {
+	Method string `json:"method"` // defaults to GET
+	Path   string `json:"path"`
+}
+
+// SimulationBackend describes Count identical synthetic backends
+type SimulationBackend struct {
+	Name         string  `json:"name"`   // numbered when Count > 1, defaults to "backend"
+	Weight       int     `json:"weight"` // defaults to 1
+	Count        int     `json:"count"`  // defaults to 1
+	Latency      string  `json:"latency"`
+	Jitter       string  `json:"jitter"`      // up to this much more, uniformly distributed
+	PerRequest   string  `json:"per_request"` // more for every other request in flight
+	TailRate     float64 `json:"tail_rate"`   // share of responses taking tail_latency instead
+	TailLatency  string  `json:"tail_latency"`
+	ErrorRate    float64 `json:"error_rate"`
+	ErrorStatus  int     `json:"error_status"` // defaults to 500
+	PayloadBytes int     `json:"payload_bytes"`
+}
+
+// LatencyModel is how long a synthetic backend takes to respond
+type LatencyModel struct {
+	Base       time.Duration
+	Jitter     time.Duration // up to this much more, uniformly distributed
+	PerRequest time.Duration // more for every other request in flight, so the backend slows under load
+	TailRate   float64       // share of responses taking Tail instead of Base
+	Tail       time.Duration
+}
+
+// Sample draws a response time for a request arriving with inFlight other requests in
+// flight on the backend, using random for uniform numbers in [0, 1)
+func (m LatencyModel) Sample(inFlight int64, random func() float64) time.Duration {
+	latency := m.Base
+	if m.TailRate > 0 && random() < m.TailRate {
+		latency = m.Tail
+	}
+	if m.Jitter > 0 {
+		latency += time.Duration(random() * float64(m.Jitter))
+	}
+	if inFlight > 0 {
+		latency += time.Duration(inFlight) * m.PerRequest
+	}
+	return latency
+}
+
+// LoadSimulation reads and validates a simulation file
+func LoadSimulation(path string) (Simulation, error) {
+	var sim Simulation
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sim, err
+	}
+	if err := json.Unmarshal(data, &sim); err != nil {
+		return sim, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if len(sim.Backends) == 0 {
+		return sim, fmt.Errorf("simulation has no backends")
+	}
+	if sim.Duration != "" {
+		if d, err := time.ParseDuration(sim.Duration); err != nil || d <= 0 {
+			return sim, fmt.Errorf("invalid duration %q", sim.Duration)
+		}
+	}
+	if sim.Concurrency < 0 {
+		return sim, fmt.Errorf("concurrency must not be negative")
+	}
+	switch sim.Clock {
+	case "", "real", "virtual":
+	default:
+		return sim, fmt.Errorf("unknown clock %q (use real or virtual)", sim.Clock)
+	}
+	if sim.Rate < 0 {
+		return sim, fmt.Errorf("rate must not be negative")
+	}
+	if sim.Rate > 0 && sim.Clock != "virtual" {
+		return sim, fmt.Errorf("rate needs the virtual clock")
+	}
+	for _, algorithm := range sim.Algorithms {
+		if !slices.Contains(algorithmNames, algorithm) {
+			return sim, fmt.Errorf("unknown algorithm %q", algorithm)
+		}
+	}
+	for i, request := range sim.Requests {
+		if !strings.HasPrefix(request.Path, "/") {
+			return sim, fmt.Errorf("request %d: path %q must start with /", i+1, request.Path)
+		}
+	}
+	for i, backend := range sim.Backends {
+		if backend.Weight < 0 || backend.Count < 0 || backend.PayloadBytes < 0 {
+			return sim, fmt.Errorf("backend %d: weight, count and payload_bytes must not be negative", i+1)
+		}
+		if backend.ErrorRate < 0 || backend.ErrorRate > 1 || backend.TailRate < 0 || backend.TailRate > 1 {
+			return sim, fmt.Errorf("backend %d: error_rate and tail_rate must be between 0 and 1", i+1)
+		}
+		if backend.ErrorStatus != 0 && (backend.ErrorStatus < 100 || backend.ErrorStatus > 599) {
+			return sim, fmt.Errorf("backend %d: invalid error_status %d", i+1, backend.ErrorStatus)
+		}
+		latency, err := backend.latencyModel()
+		if err != nil {
+			return sim, fmt.Errorf("backend %d: %v", i+1, err)
+		}
+		if sim.Clock == "virtual" && sim.Rate == 0 && latency.Base == 0 && latency.Jitter == 0 {
+			// Closed loop clients would send request after request without time passing
+			return sim, fmt.Errorf("backend %d: needs a latency for closed loop clients on the virtual clock", i+1)
+		}
+	}
+	return sim, nil
+}
+
+// latencyModel parses the backend's latency settings
+func (b SimulationBackend) latencyModel() (LatencyModel, error) {
+	model := LatencyModel{TailRate: b.TailRate}
+	for _, field := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"latency", b.Latency, &model.Base},
+		{"jitter", b.Jitter, &model.Jitter},
+		{"per_request", b.PerRequest, &model.PerRequest},
+		{"tail_latency", b.TailLatency, &model.Tail},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil || d < 0 {
+			return model, fmt.Errorf("invalid %s %q", field.name, field.value)
+		}
+		*field.into = d
+	}
+	return model, nil
+}
+
+// SyntheticBackend answers requests in-process from a latency and error model instead of
+// proxying them. It embeds an HTTPBackend for its health, circuit breaker, connection
+// and weight state, so the load balancer treats it like any other backend.
+type SyntheticBackend struct {
+	*HTTPBackend
+	latency     LatencyModel
+	errorRate   float64
+	errorStatus int
+	payload     []byte
+	random      func() float64 // uniform in [0, 1)
+
+	served int64
+}
+
+// newSyntheticBackend creates a synthetic backend wired to the load balancer's error
+// handling, addressed as sim://name
+func (lb *LoadBalancer) newSyntheticBackend(name string, weight int, latency LatencyModel, errorRate float64, errorStatus, payloadBytes int) (*SyntheticBackend, error) {
+	backend, err := lb.newBackend("sim://"+name, weight)
+	if err != nil {
+		return nil, err
+	}
+	if errorStatus == 0 {
+		errorStatus = http.StatusInternalServerError
+	}
+	return &SyntheticBackend{
+		HTTPBackend: backend,
+		latency:     latency,
+		errorRate:   errorRate,
+		errorStatus: errorStatus,
+		payload:     []byte(strings.Repeat("x", payloadBytes)),
+		random:      rand.Float64,
+	}, nil
+}
+
+// Serve waits out the modelled latency and answers with the payload or an error status.
+// The response goes through the proxy's ModifyResponse and ErrorHandler like a real one,
+// so retries and 429 handling apply.
+func (sb *SyntheticBackend) Serve(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&sb.served, 1)
+	if delay := sb.latency.Sample(sb.GetConnections()-1, sb.random); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			sb.ReverseProxy.ErrorHandler(w, r, r.Context().Err())
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if sb.errorRate > 0 && sb.random() < sb.errorRate {
+		status = sb.errorStatus
+	}
+	if modify := sb.ReverseProxy.ModifyResponse; modify != nil {
+		resp := &http.Response{StatusCode: status, Header: make(http.Header), Request: r}
+		if err := modify(resp); err != nil {
+			sb.ReverseProxy.ErrorHandler(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		w.Write(sb.payload)
+	}
+}
+
+// Served returns the requests the backend has answered
+func (sb *SyntheticBackend) Served() int64 {
+	return atomic.LoadInt64(&sb.served)
+}
+
+// simulationWriter discards a response, keeping its status
+type simulationWriter struct {
+	header http.Header
+	status int
+}
+
+func (sw *simulationWriter) Header() http.Header { return sw.header }
+
+func (sw *simulationWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+}
+
+func (sw *simulationWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+// RunSimulation routes simulated clients' requests to synthetic backends through a load
+// balancer per algorithm, with no network in between, and reports throughput, latency,
+// allocations and distribution per algorithm. With the virtual clock, every routing decision is also written to
+// traceDir as <algorithm>.csv when it is set.
+func RunSimulation(sim Simulation, traceDir string) ([]SimulationResult, error) {
+	// Per-request logging would dominate the measurements
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	algorithms := sim.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"round-robin", "weighted", "least-connections"}
+	}
+	results := make([]SimulationResult, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		var result SimulationResult
+		var err error
+		if sim.Clock == "virtual" {
+			result, err = runVirtualSimulation(algorithm, sim, traceDir)
+		} else {
+			result, err = simulate(algorithm, sim)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// newSimulationLoadBalancer creates a load balancer running algorithm with the
+// simulation's synthetic backends in its main pool
+func newSimulationLoadBalancer(algorithm string, sim Simulation) (*LoadBalancer, []*SyntheticBackend, error) {
+	lb := NewLoadBalancer(&Config{Algorithm: algorithm, MaxRetries: 3})
+	var backends []*SyntheticBackend
+	for _, spec := range sim.Backends {
+		latency, _ := spec.latencyModel()
+		name, weight, count := spec.Name, max(spec.Weight, 1), max(spec.Count, 1)
+		if name == "" {
+			name = "backend"
+		}
+		for i := 0; i < count; i++ {
+			backendName := name
+			if count > 1 {
+				backendName = fmt.Sprintf("%s-%d", name, i+1)
+			}
+			backend, err := lb.newSyntheticBackend(backendName, weight, latency, spec.ErrorRate, spec.ErrorStatus, spec.PayloadBytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			lb.serverPool.AddBackend(backend)
+			backends = append(backends, backend)
+		}
+	}
+	return lb, backends, nil
+}
+
+// simulate runs the simulation against one algorithm in real time
+func simulate(algorithm string, sim Simulation) (SimulationResult, error) {
+	duration := defaultSimulationDuration
+	if sim.Duration != "" {
+		duration, _ = time.ParseDuration(sim.Duration)
+	}
+	concurrency := sim.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultSimulationConcurrency
+	}
+	requests := sim.Requests
+	if len(requests) == 0 {
+		requests = []SimulationRequest{{Path: "/"}}
+	}
+
+	lb, backends, err := newSimulationLoadBalancer(algorithm, sim)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	handler := lb.proxyHandler()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// Every client keeps its own counters and latency samples so they don't contend
+	type client struct {
+		requests, errors int64
+		latency          *LatencyWindow
+	}
+	clients := make([]client, concurrency)
+	start := time.Now()
+	deadline := start.Add(duration)
+	var wg sync.WaitGroup
+	for i := range clients {
+		c := &clients[i]
+		c.latency = NewLatencyWindow(simulationWorkerSamples)
+		wg.Add(1)
+		go func(next int) {
+			defer wg.Done()
+			w := &simulationWriter{header: make(http.Header)}
+			for time.Now().Before(deadline) {
+				request := requests[next%len(requests)]
+				next++
+				method := request.Method
+				if method == "" {
+					method = http.MethodGet
+				}
+				r := httptest.NewRequest(method, request.Path, nil)
+
+				clear(w.header)
+				w.status = 0
+				reqStart := time.Now()
+				handler.ServeHTTP(w, r)
+				c.latency.Record(time.Since(reqStart))
+				c.requests++
+				if w.status != http.StatusOK {
+					c.errors++
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	result := SimulationResult{
+		Algorithm:    algorithm,
+		Clock:        "real",
+		Seconds:      elapsed.Seconds(),
+		Distribution: make(map[string]int64, len(backends)),
+	}
+	samples := 0
+	for _, c := range clients {
+		result.Requests += c.requests
+		result.Errors += c.errors
+		samples += c.latency.Count()
+	}
+	latency := NewLatencyWindow(samples)
+	for _, c := range clients {
+		for _, sample := range c.latency.samples[:c.latency.Count()] {
+			latency.Record(sample)
+		}
+	}
+	result.Latency = latency.Summary()
+	result.Throughput = float64(result.Requests) / elapsed.Seconds()
+	for _, backend := range backends {
+		result.Distribution[strings.TrimPrefix(backend.Address(), "sim://")] = backend.Served()
+	}
+	if result.Requests > 0 {
+		result.AllocsPerRequest = float64(after.Mallocs-before.Mallocs) / float64(result.Requests)
+		result.BytesPerRequest = float64(after.TotalAlloc-before.TotalAlloc) / float64(result.Requests)
+	}
+	return result, nil
+}
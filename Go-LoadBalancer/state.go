@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// BackendSpec is the desired state of a single backend
+type BackendSpec struct {
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	Draining bool   `json:"draining,omitempty"`
+}
+
+// StateSpec is the declarative desired state of the load balancer. Pools left out of the
+// spec and a nil route table are left unchanged.
+type StateSpec struct {
+	Pools  map[string][]BackendSpec `json:"pools"` // "main", "quarantine" or "variant:<name>"
+	Routes *[]RouteConfig           `json:"routes,omitempty"`
+}
+
+// StateDiff lists the changes made (or that would be made) by applying a spec
+type StateDiff struct {
+	Added         []string `json:"added"`
+	Removed       []string `json:"removed"`
+	Updated       []string `json:"updated"`
+	RoutesChanged bool     `json:"routes_changed"`
+}
+
+// namedPools returns every backend pool keyed by its name in the state spec
+func (lb *LoadBalancer) namedPools() map[string]*ServerPool {
+	pools := map[string]*ServerPool{
+		"main":       lb.serverPool,
+		"quarantine": lb.quarantinePool,
+	}
+	if lb.experiment != nil {
+		for _, variant := range lb.experiment.variants {
+			pools["variant:"+variant.name] = variant.pool
+		}
+	}
+	return pools
+}
+
+// poolOf returns the name of the pool holding backend, or "" once it was removed
+func (lb *LoadBalancer) poolOf(backend Backend) string {
+	for name, pool := range lb.namedPools() {
+		if pool.FindBackend(backend.Address()) == backend {
+			return name
+		}
+	}
+	return ""
+}
+
+// CurrentState returns the running state in the same shape accepted by ApplyState
+func (lb *LoadBalancer) CurrentState() StateSpec {
+	routes := append([]RouteConfig{}, lb.Routes()...)
+	spec := StateSpec{
+		Pools:  make(map[string][]BackendSpec),
+		Routes: &routes,
+	}
+	for name, pool := range lb.namedPools() {
+		backends := []BackendSpec{}
+		for _, backend := range pool.GetBackends() {
+			backends = append(backends, BackendSpec{
+				URL:      backend.Address(),
+				Weight:   backend.GetWeight(),
+				Draining: backend.IsDraining(),
+			})
+		}
+		spec.Pools[name] = backends
+	}
+	return spec
+}
+
+// ApplyState reconciles the running pools and routes with the spec and returns the diff.
+// The spec is validated in full before anything is changed; with dryRun nothing is changed.
+func (lb *LoadBalancer) ApplyState(spec StateSpec, dryRun bool) (StateDiff, error) {
+	lb.stateMux.Lock()
+	defer lb.stateMux.Unlock()
+
+	diff := StateDiff{Added: []string{}, Removed: []string{}, Updated: []string{}}
+	pools := lb.namedPools()
+
+	for name, backends := range spec.Pools {
+		if _, ok := pools[name]; !ok {
+			return diff, fmt.Errorf("unknown pool %q", name)
+		}
+		seen := make(map[string]bool)
+		for _, backend := range backends {
+			if _, err := url.ParseRequestURI(backend.URL); err != nil {
+				return diff, fmt.Errorf("pool %s: invalid backend URL %q", name, backend.URL)
+			}
+			if backend.Weight < 1 {
+				return diff, fmt.Errorf("pool %s: backend %s must have a positive weight", name, backend.URL)
+			}
+			if seen[backend.URL] {
+				return diff, fmt.Errorf("pool %s: duplicate backend %s", name, backend.URL)
+			}
+			seen[backend.URL] = true
+		}
+	}
+	if spec.Routes != nil {
+		seen := make(map[string]bool)
+		for _, route := range *spec.Routes {
+			if !strings.HasPrefix(route.PathPrefix, "/") {
+				return diff, fmt.Errorf("route prefix %q must start with /", route.PathPrefix)
+			}
+			if seen[route.PathPrefix] {
+				return diff, fmt.Errorf("duplicate route %s", route.PathPrefix)
+			}
+			seen[route.PathPrefix] = true
+		}
+	}
+
+	names := make([]string, 0, len(spec.Pools))
+	for name := range spec.Pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pool := pools[name]
+		desired := make(map[string]BackendSpec)
+		for _, backend := range spec.Pools[name] {
+			desired[backend.URL] = backend
+		}
+
+		current := make(map[string]Backend)
+		for _, backend := range pool.GetBackends() {
+			current[backend.Address()] = backend
+			want, keep := desired[backend.Address()]
+			if !keep {
+				diff.Removed = append(diff.Removed, name+" "+backend.Address())
+				if !dryRun {
+					lb.removeBackend(pool, backend.Address())
+				}
+				continue
+			}
+			if want.Weight != backend.GetWeight() {
+				diff.Updated = append(diff.Updated,
+					fmt.Sprintf("%s %s weight %d -> %d", name, backend.Address(), backend.GetWeight(), want.Weight))
+				if !dryRun {
+					backend.SetWeight(want.Weight)
+				}
+			}
+			if want.Draining != backend.IsDraining() {
+				diff.Updated = append(diff.Updated, fmt.Sprintf("%s %s %s", name, backend.Address(),
+					map[bool]string{true: "drained", false: "undrained"}[want.Draining]))
+				if !dryRun {
+					backend.SetDraining(want.Draining)
+				}
+			}
+		}
+
+		for _, want := range spec.Pools[name] {
+			if _, exists := current[want.URL]; exists {
+				continue
+			}
+			diff.Added = append(diff.Added, name+" "+want.URL)
+			if dryRun {
+				continue
+			}
+			backend, err := lb.newBackend(want.URL, want.Weight)
+			if err != nil {
+				return diff, err
+			}
+			backend.SetDraining(want.Draining)
+			pool.AddBackend(backend)
+		}
+	}
+
+	if spec.Routes != nil && !routesEqual(lb.Routes(), *spec.Routes) {
+		diff.RoutesChanged = true
+		if !dryRun {
+			lb.SetRoutes(*spec.Routes)
+		}
+	}
+
+	if !dryRun {
+		log.Printf("📐 [STATE] Applied desired state: %d added, %d removed, %d updated, routes changed: %v",
+			len(diff.Added), len(diff.Removed), len(diff.Updated), diff.RoutesChanged)
+	}
+	return diff, nil
+}
+
+// routesEqual compares route tables by their JSON encoding
+func routesEqual(a, b []RouteConfig) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+// adminState returns (GET) the running state or reconciles it (PUT) with a full desired-state spec.
+// PUT with ?dry_run=true only reports the diff.
+func (lb *LoadBalancer) adminState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, lb.CurrentState())
+	case http.MethodPut:
+		var spec StateSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		diff, err := lb.ApplyState(spec, dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !dryRun {
+			lb.persistState()
+		}
+		writeJSON(w, map[string]interface{}{
+			"dry_run": dryRun,
+			"diff":    diff,
+		})
+	default:
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateStore keeps the admin state last applied to the load balancer (backends added
+// through the API, weights, drain flags and routes) so a restart can restore it
+type StateStore interface {
+	// Save replaces the stored state
+	Save(spec StateSpec) error
+	// Load returns the stored state, or nil if nothing has been saved yet
+	Load() (*StateSpec, error)
+}
+
+// FileStateStore keeps the state in a JSON file, replaced atomically on every save
+type FileStateStore struct {
+	Path string
+}
+
+// Save writes the state to a temporary file and renames it over the old one
+func (fs FileStateStore) Save(spec StateSpec) error {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fs.Path), ".state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.Path)
+}
+
+// Load reads the state file; a missing file means nothing was saved
+func (fs FileStateStore) Load() (*StateSpec, error) {
+	data, err := os.ReadFile(fs.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var spec StateSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// MemoryStateStore keeps the state in memory, for embedding the load balancer in tests
+// or restarting it within one process
+type MemoryStateStore struct {
+	mux  sync.Mutex
+	data []byte // JSON, so callers never share the stored spec
+}
+
+// Save stores a copy of the state
+func (ms *MemoryStateStore) Save(spec StateSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.data = data
+	return nil
+}
+
+// Load returns a copy of the stored state
+func (ms *MemoryStateStore) Load() (*StateSpec, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if ms.data == nil {
+		return nil, nil
+	}
+	var spec StateSpec
+	if err := json.Unmarshal(ms.data, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// stateStoreStatus counts what the load balancer did with its state store
+type stateStoreStatus struct {
+	store     StateStore
+	saveMux   sync.Mutex // so the last save holds the latest state
+	restored  bool
+	saves     int64
+	failures  int64
+	lastSaved atomic.Pointer[time.Time]
+}
+
+// SetStateStore starts saving the admin state to store after every change, first
+// restoring what it holds if restore is set
+func (lb *LoadBalancer) SetStateStore(store StateStore, restore bool) error {
+	status := &stateStoreStatus{store: store}
+	if restore {
+		spec, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			log.Printf("💾 [STATE] No saved admin state to restore")
+		} else {
+			diff, err := lb.ApplyState(*spec, false)
+			if err != nil {
+				return err
+			}
+			status.restored = true
+			log.Printf("💾 [STATE] Restored saved admin state: %d added, %d removed, %d updated",
+				len(diff.Added), len(diff.Removed), len(diff.Updated))
+		}
+	}
+	lb.stateStore = status
+	lb.persistState()
+	return nil
+}
+
+// SetupStateStore persists the admin state to the configured file
+func (lb *LoadBalancer) SetupStateStore(config StateStoreConfig) error {
+	if config.Path == "" {
+		return nil
+	}
+	if err := lb.SetStateStore(FileStateStore{Path: config.Path}, config.Restore); err != nil {
+		return err
+	}
+	log.Printf("💾 [CONFIG] Saving admin state to %s after every change", config.Path)
+	return nil
+}
+
+// persistState saves the current admin state, if a store is set
+func (lb *LoadBalancer) persistState() {
+	status := lb.stateStore
+	if status == nil {
+		return
+	}
+	status.saveMux.Lock()
+	defer status.saveMux.Unlock()
+	if err := status.store.Save(lb.CurrentState()); err != nil {
+		atomic.AddInt64(&status.failures, 1)
+		log.Printf("❌ [STATE] Failed to save admin state: %v", err)
+		return
+	}
+	now := time.Now()
+	atomic.AddInt64(&status.saves, 1)
+	status.lastSaved.Store(&now)
+}
+
+// GetStats returns the state store counters
+func (s *stateStoreStatus) GetStats() map[string]interface{} {
+	if s == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	stats := map[string]interface{}{
+		"enabled":  true,
+		"restored": s.restored,
+		"saves":    atomic.LoadInt64(&s.saves),
+		"failures": atomic.LoadInt64(&s.failures),
+	}
+	switch store := s.store.(type) {
+	case FileStateStore:
+		stats["type"], stats["path"] = "file", store.Path
+	case *MemoryStateStore:
+		stats["type"] = "memory"
+	}
+	if saved := s.lastSaved.Load(); saved != nil {
+		stats["last_saved"] = saved.Format(time.RFC3339)
+	}
+	return stats
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry-After handling modes for throttled responses passed to clients
+const (
+	retryAfterPropagate = "propagate"
+	retryAfterRewrite   = "rewrite"
+	retryAfterStrip     = "strip"
+)
+
+// errBackendThrottled is returned from ModifyResponse to fail a 429 over to another backend
+var errBackendThrottled = errors.New("backend throttled request")
+
+// handleThrottled penalizes a backend that returned 429 and either fails the request over
+// or adjusts the Retry-After header passed back to the client
+func (lb *LoadBalancer) handleThrottled(backend *HTTPBackend, resp *http.Response) error {
+	cfg := lb.config.Throttle
+	request := resp.Request
+
+	penalty := cfg.PenaltyDuration
+	if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > penalty {
+		penalty = retryAfter
+	}
+	if penalty > 0 && cfg.PenaltyFactor > 0 && cfg.PenaltyFactor < 1 {
+		backend.Throttle(penalty, cfg.PenaltyFactor)
+		log.Printf("🐢 [THROTTLE] Backend %s returned 429, weight %d → %d for %v",
+			backend.Address(), backend.GetWeight(), backend.EffectiveWeight(), penalty)
+	}
+
+	if cfg.Failover && getRetryFromContext(request) < lb.config.MaxRetries && lb.canRetry(request) {
+		log.Printf("🔁 [THROTTLE] Failing over %s %s away from throttled backend %s",
+			request.Method, request.URL.Path, backend.Address())
+		return errBackendThrottled
+	}
+
+	switch cfg.RetryAfter {
+	case retryAfterStrip:
+		resp.Header.Del("Retry-After")
+	case retryAfterRewrite:
+		resp.Header.Set("Retry-After", cfg.RetryAfterValue)
+	}
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// backendTimingSamples is the number of responses per backend kept for percentiles
+const backendTimingSamples = 256
+
+// ResponseTiming times responses twice: to their first byte (the response headers) and
+// in full, body included. For streaming or heavy endpoints the full time says more
+// about the payload than about the backend, so comparisons should use the first.
+type ResponseTiming struct {
+	FirstByte *LatencyWindow
+	Total     *LatencyWindow
+
+	// Every response ever observed, not just the recent ones the windows keep
+	responses      int64
+	firstByteNanos int64
+	totalNanos     int64
+}
+
+// NewResponseTiming keeps up to samples responses, defaulting like NewLatencyWindow
+func NewResponseTiming(samples int) *ResponseTiming {
+	return &ResponseTiming{FirstByte: NewLatencyWindow(samples), Total: NewLatencyWindow(samples)}
+}
+
+// Observe records one response
+func (t *ResponseTiming) Observe(firstByte, total time.Duration) {
+	t.FirstByte.Record(firstByte)
+	t.Total.Record(total)
+	atomic.AddInt64(&t.firstByteNanos, int64(firstByte))
+	atomic.AddInt64(&t.totalNanos, int64(total))
+	atomic.AddInt64(&t.responses, 1)
+}
+
+// Totals returns how many responses were observed in all and the sums of their times
+func (t *ResponseTiming) Totals() (responses int64, firstByte, total time.Duration) {
+	return atomic.LoadInt64(&t.responses),
+		time.Duration(atomic.LoadInt64(&t.firstByteNanos)),
+		time.Duration(atomic.LoadInt64(&t.totalNanos))
+}
+
+// TimingReport is the latency percentiles to the first byte and to the end of responses
+type TimingReport struct {
+	FirstByte LatencySummary `json:"first_byte"`
+	Total     LatencySummary `json:"total"`
+}
+
+// Report summarises the recorded responses
+func (t *ResponseTiming) Report() TimingReport {
+	return TimingReport{FirstByte: t.FirstByte.Summary(), Total: t.Total.Summary()}
+}
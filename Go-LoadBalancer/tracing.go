@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// traceContext is the trace a request belongs to, in W3C form: a 32 hex digit trace ID
+// and the 16 hex digit ID of the span that sent the request
+type traceContext struct {
+	traceID string
+	spanID  string
+	sampled bool
+}
+
+// traceKey holds a request's *traceContext when trace headers are enabled
+type traceKey struct{}
+
+// isHex reports whether s is n lowercase hex digits and not all zeros
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceparent reads a W3C traceparent header: version-traceid-spanid-flags
+func parseTraceparent(value string) (traceContext, bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceContext{}, false
+	}
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || len(parts[3]) != 2 {
+		return traceContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceContext{}, false
+	}
+	return traceContext{traceID: parts[1], spanID: parts[2], sampled: flags[0]&1 == 1}, true
+}
+
+// parseB3 reads B3 propagation, either the single b3 header (traceid-spanid[-sampled[-parent]])
+// or X-B3-TraceId and X-B3-SpanId. 64-bit trace IDs are left-padded to 128 bits.
+func parseB3(h http.Header) (traceContext, bool) {
+	traceID, spanID, sampled := h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId"), h.Get("X-B3-Sampled")
+	if single := h.Get("B3"); single != "" {
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return traceContext{}, false
+		}
+		traceID, spanID, sampled = parts[0], parts[1], ""
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	}
+	traceID, spanID = strings.ToLower(traceID), strings.ToLower(spanID)
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !isHex(traceID, 32) || !isHex(spanID, 16) {
+		return traceContext{}, false
+	}
+	return traceContext{traceID: traceID, spanID: spanID, sampled: sampled != "0"}, true
+}
+
+// newTraceContext starts a trace for a request that arrived without one
+func newTraceContext() traceContext {
+	var id [24]byte
+	rand.Read(id[:])
+	return traceContext{traceID: hex.EncodeToString(id[:16]), spanID: hex.EncodeToString(id[16:]), sampled: true}
+}
+
+// traceMiddleware makes sure every proxied request carries both traceparent and B3
+// headers. Headers the client sent pass through untouched, the other format is filled in
+// with the same IDs, and a request with neither gets a new trace. The load balancer
+// records no spans of its own, so it never replaces the parent span ID.
+func (lb *LoadBalancer) traceMiddleware(next http.Handler) http.Handler {
+	if !lb.config.TraceHeaders {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent := r.Header.Get("Traceparent")
+		trace, hasW3C := parseTraceparent(traceparent)
+		b3, hasB3 := parseB3(r.Header)
+
+		switch {
+		case hasW3C:
+			atomic.AddInt64(&lb.tracesPropagated, 1)
+		case hasB3:
+			trace = b3
+			atomic.AddInt64(&lb.tracesPropagated, 1)
+		default:
+			if traceparent != "" || r.Header.Get("B3") != "" || r.Header.Get("X-B3-TraceId") != "" {
+				atomic.AddInt64(&lb.tracesInvalid, 1)
+			}
+			trace = newTraceContext()
+			atomic.AddInt64(&lb.tracesGenerated, 1)
+		}
+
+		flags := "00"
+		sampled := "0"
+		if trace.sampled {
+			flags, sampled = "01", "1"
+		}
+		if !hasW3C {
+			r.Header.Set("Traceparent", "00-"+trace.traceID+"-"+trace.spanID+"-"+flags)
+			r.Header.Del("Tracestate") // only meaningful alongside the traceparent it came with
+		}
+		if !hasB3 {
+			r.Header.Del("B3")
+			r.Header.Set("X-B3-TraceId", trace.traceID)
+			r.Header.Set("X-B3-SpanId", trace.spanID)
+			r.Header.Set("X-B3-Sampled", sampled)
+		}
+
+		// Let the client look the request up in the load balancer and backend logs
+		w.Header().Set("X-Trace-Id", trace.traceID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), traceKey{}, &trace)))
+	})
+}
+
+// traceSuffix returns " trace=<id>" for log lines about r, or "" when it isn't traced
+func traceSuffix(r *http.Request) string {
+	if trace, ok := r.Context().Value(traceKey{}).(*traceContext); ok {
+		return " trace=" + trace.traceID
+	}
+	return ""
+}
+
+// tracingStats returns the trace header counters
+func (lb *LoadBalancer) tracingStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":    lb.config.TraceHeaders,
+		"propagated": atomic.LoadInt64(&lb.tracesPropagated),
+		"generated":  atomic.LoadInt64(&lb.tracesGenerated),
+		"invalid":    atomic.LoadInt64(&lb.tracesInvalid),
+	}
+}
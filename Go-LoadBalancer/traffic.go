@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trafficRateWindow is the shortest span byte rates are measured over
+const trafficRateWindow = 10 * time.Second
+
+// ByteMeter totals bytes and measures their rate. Counting is a single atomic add; the
+// rate is refreshed when read, over the time since the last refresh, once that is at
+// least trafficRateWindow ago.
+type ByteMeter struct {
+	total int64
+
+	mux        sync.Mutex
+	since      time.Time // start of the current measurement
+	sinceTotal int64
+	rate       float64 // bytes per second over the previous measurement
+}
+
+// Add counts n bytes
+func (m *ByteMeter) Add(n int64) {
+	if n > 0 {
+		atomic.AddInt64(&m.total, n)
+	}
+}
+
+// Total returns the bytes counted so far
+func (m *ByteMeter) Total() int64 {
+	return atomic.LoadInt64(&m.total)
+}
+
+// Rate returns the bytes per second of the latest measurement
+func (m *ByteMeter) Rate() float64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	now, total := time.Now(), m.Total()
+	if m.since.IsZero() {
+		// The first read measures from zero at the first read, not from process start
+		m.since, m.sinceTotal = now, total
+		return 0
+	}
+	if elapsed := now.Sub(m.since); elapsed >= trafficRateWindow {
+		m.rate = float64(total-m.sinceTotal) / elapsed.Seconds()
+		m.since, m.sinceTotal = now, total
+	}
+	return m.rate
+}
+
+// Traffic counts request and response body bytes
+type Traffic struct {
+	Request  ByteMeter
+	Response ByteMeter
+}
+
+// TrafficReport is the body bytes of requests and responses, totalled and per second.
+// The rates cover the time between two reads at least trafficRateWindow apart, so they
+// are 0 until a report has been read twice.
+type TrafficReport struct {
+	RequestBytes        int64   `json:"request_bytes"`
+	ResponseBytes       int64   `json:"response_bytes"`
+	RequestBytesPerSec  float64 `json:"request_bytes_per_sec"`
+	ResponseBytesPerSec float64 `json:"response_bytes_per_sec"`
+}
+
+// Report returns the totals and current rates
+func (t *Traffic) Report() TrafficReport {
+	return TrafficReport{
+		RequestBytes:        t.Request.Total(),
+		ResponseBytes:       t.Response.Total(),
+		RequestBytesPerSec:  t.Request.Rate(),
+		ResponseBytesPerSec: t.Response.Rate(),
+	}
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (cb *countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	cb.n += int64(n)
+	return n, err
+}
+
+// countBody wraps *body, unless the request has none, so the bytes read from it can be counted
+func countBody(body *io.ReadCloser) *countingBody {
+	if *body == nil || *body == http.NoBody {
+		return nil
+	}
+	counted := &countingBody{ReadCloser: *body}
+	*body = counted
+	return counted
+}
+
+// bytesRead returns the bytes read through cb, which may be nil
+func (cb *countingBody) bytesRead() int64 {
+	if cb == nil {
+		return 0
+	}
+	return cb.n
+}
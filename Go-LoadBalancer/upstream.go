@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadCertPool reads the PEM certificates in path into a pool, to verify backends by
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// ClientConfig returns the TLS configuration for connections to https backends
+func (c UpstreamTLSConfig) ClientConfig() *tls.Config {
+	config := &tls.Config{RootCAs: c.RootCAs, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.SessionCacheSize > 0 {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(c.SessionCacheSize)
+	}
+	return config
+}
+
+// upstreamStats counts the connections to one backend host and the requests sent over them
+type upstreamStats struct {
+	requests          int64
+	connections       int64 // dialed
+	handshakes        int64 // completed TLS handshakes
+	resumed           int64 // of which resumed a session
+	handshakeFailures int64
+	handshakeNanos    int64
+}
+
+// UpstreamMetrics measures what connections to backends cost: how often requests reuse
+// an idle connection, and for https backends how many TLS handshakes are made and how
+// many of them resume a session instead of running a full handshake
+type UpstreamMetrics struct {
+	config UpstreamTLSConfig
+	hosts  sync.Map // host:port -> *upstreamStats
+}
+
+// NewUpstreamMetrics creates upstream metrics for the given TLS configuration
+func NewUpstreamMetrics(config UpstreamTLSConfig) *UpstreamMetrics {
+	return &UpstreamMetrics{config: config}
+}
+
+// host returns the counters of a host:port, creating them on first use
+func (um *UpstreamMetrics) host(address string) *upstreamStats {
+	if stats, ok := um.hosts.Load(address); ok {
+		return stats.(*upstreamStats)
+	}
+	stats, _ := um.hosts.LoadOrStore(address, &upstreamStats{})
+	return stats.(*upstreamStats)
+}
+
+// Wrap applies the TLS configuration to transport and returns it instrumented: its dials
+// are counted and it runs TLS handshakes itself so resumption can be seen, and the
+// returned RoundTripper counts the requests sent through it
+func (um *UpstreamMetrics) Wrap(transport *http.Transport) http.RoundTripper {
+	transport.TLSClientConfig = um.config.ClientConfig()
+
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err == nil {
+			atomic.AddInt64(&um.host(address).connections, 1)
+		}
+		return conn, err
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := transport.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		// The transport adds its ALPN protocols to TLSClientConfig, so clone it per dial
+		config := transport.TLSClientConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		if transport.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, transport.TLSHandshakeTimeout)
+			defer cancel()
+		}
+
+		stats := um.host(address)
+		start := time.Now()
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			atomic.AddInt64(&stats.handshakeFailures, 1)
+			return nil, err
+		}
+		atomic.AddInt64(&stats.handshakeNanos, int64(time.Since(start)))
+		atomic.AddInt64(&stats.handshakes, 1)
+		if tlsConn.ConnectionState().DidResume {
+			atomic.AddInt64(&stats.resumed, 1)
+		}
+		return tlsConn, nil
+	}
+	return &countingTransport{RoundTripper: transport, metrics: um}
+}
+
+// countingTransport counts the requests sent to each backend host
+type countingTransport struct {
+	http.RoundTripper
+	metrics *UpstreamMetrics
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	address := req.URL.Host
+	if req.URL.Port() == "" {
+		port := "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(req.URL.Hostname(), port)
+	}
+	atomic.AddInt64(&ct.metrics.host(address).requests, 1)
+	return ct.RoundTripper.RoundTrip(req)
+}
+
+// ratio returns part/whole, or 0 when whole is 0
+func ratio(part, whole int64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// hostNames returns the backend hosts seen so far, sorted
+func (um *UpstreamMetrics) hostNames() []string {
+	var names []string
+	um.hosts.Range(func(key, _ interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// writeMetrics writes the per-host counters in Prometheus text exposition format
+func (um *UpstreamMetrics) writeMetrics(sb *strings.Builder) {
+	names := um.hostNames()
+	counters := []struct {
+		name, help string
+		value      func(*upstreamStats) *int64
+	}{
+		{"upstream_requests_total", "Requests sent to each backend host.", func(s *upstreamStats) *int64 { return &s.requests }},
+		{"upstream_connections_total", "Connections dialed to each backend host.", func(s *upstreamStats) *int64 { return &s.connections }},
+		{"upstream_tls_handshakes_total", "TLS handshakes completed with each backend host.", func(s *upstreamStats) *int64 { return &s.handshakes }},
+		{"upstream_tls_resumed_total", "TLS handshakes that resumed a session.", func(s *upstreamStats) *int64 { return &s.resumed }},
+		{"upstream_tls_handshake_failures_total", "TLS handshakes that failed.", func(s *upstreamStats) *int64 { return &s.handshakeFailures }},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(sb, "# HELP loadbalancer_%s %s\n", counter.name, counter.help)
+		fmt.Fprintf(sb, "# TYPE loadbalancer_%s counter\n", counter.name)
+		for _, name := range names {
+			fmt.Fprintf(sb, "loadbalancer_%s{upstream=%q} %d\n", counter.name, name, atomic.LoadInt64(counter.value(um.host(name))))
+		}
+	}
+	fmt.Fprintf(sb, "# HELP loadbalancer_upstream_tls_handshake_seconds_total Time spent in TLS handshakes with each backend host.\n")
+	fmt.Fprintf(sb, "# TYPE loadbalancer_upstream_tls_handshake_seconds_total counter\n")
+	for _, name := range names {
+		fmt.Fprintf(sb, "loadbalancer_upstream_tls_handshake_seconds_total{upstream=%q} %g\n",
+			name, time.Duration(atomic.LoadInt64(&um.host(name).handshakeNanos)).Seconds())
+	}
+}
+
+// GetStats returns the TLS settings and each backend host's connection counters
+func (um *UpstreamMetrics) GetStats() map[string]interface{} {
+	hosts := make(map[string]interface{})
+	for _, name := range um.hostNames() {
+		stats := um.host(name)
+		requests := atomic.LoadInt64(&stats.requests)
+		connections := atomic.LoadInt64(&stats.connections)
+		handshakes := atomic.LoadInt64(&stats.handshakes)
+		resumed := atomic.LoadInt64(&stats.resumed)
+
+		// Requests beyond the connections dialed went over a connection already open
+		reused := max(requests-connections, 0)
+		host := map[string]interface{}{
+			"requests":    requests,
+			"connections": connections,
+			"reuse_rate":  ratio(reused, requests),
+		}
+		if handshakes > 0 || atomic.LoadInt64(&stats.handshakeFailures) > 0 {
+			host["tls_handshakes"] = handshakes
+			host["tls_resumed"] = resumed
+			host["tls_resumption_rate"] = ratio(resumed, handshakes)
+			host["tls_handshake_failures"] = atomic.LoadInt64(&stats.handshakeFailures)
+			host["tls_handshake_avg_ms"] = ratio(atomic.LoadInt64(&stats.handshakeNanos), handshakes) / float64(time.Millisecond)
+		}
+		hosts[name] = host
+	}
+
+	return map[string]interface{}{
+		"tls_session_cache": um.config.SessionCacheSize,
+		"tls_insecure":      um.config.InsecureSkipVerify,
+		"tls_custom_roots":  um.config.RootCAs != nil,
+		"hosts":             hosts,
+	}
+}
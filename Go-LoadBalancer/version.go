@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Left unset, the commit and time come from the VCS stamp the go command embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+// BuildDetails describes the running binary
+type BuildDetails struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Dirty     bool   `json:"dirty,omitempty"` // built from a modified checkout
+}
+
+// BuildInfo describes the running binary
+func BuildInfo() BuildDetails {
+	info := BuildDetails{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if buildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Dirty = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// versionHandler serves the build metadata
+func (lb *LoadBalancer) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, BuildInfo())
+}
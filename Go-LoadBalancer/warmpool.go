@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWarmInterval = 30 * time.Second
+	warmRequestTimeout  = 5 * time.Second
+)
+
+// WarmPool keeps Connections idle keep-alive connections open to each backend in the
+// proxy transport's connection pool. Every round it sends that many concurrent requests
+// to each backend: the transport reuses the idle connections it has, dials the missing
+// ones, and keeps them all idle afterwards, which also resets their idle timeout.
+type WarmPool struct {
+	config WarmPoolConfig
+
+	// Metrics
+	rounds   int64
+	requests int64
+	failures int64
+	dials    int64 // connections the proxy transport opened, for warming or for traffic
+}
+
+// NewWarmPool creates a warm pool from the given configuration
+func NewWarmPool(config WarmPoolConfig) *WarmPool {
+	if config.Interval <= 0 {
+		config.Interval = defaultWarmInterval
+	}
+	if config.Path == "" {
+		config.Path = "/health"
+	}
+	return &WarmPool{config: config}
+}
+
+// Enabled reports whether the warm pool keeps connections open
+func (wp *WarmPool) Enabled() bool {
+	return wp.config.Connections > 0
+}
+
+// Configure lets the proxy transport keep Connections idle connections per backend, and
+// counts its dials
+func (wp *WarmPool) Configure(t *http.Transport) {
+	if !wp.Enabled() {
+		return
+	}
+	if t.MaxIdleConnsPerHost < wp.config.Connections {
+		t.MaxIdleConnsPerHost = wp.config.Connections
+	}
+	t.MaxIdleConns = 0 // the per-backend limit is what matters
+
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err == nil {
+			atomic.AddInt64(&wp.dials, 1)
+		}
+		return conn, err
+	}
+}
+
+// Warm tops up the idle connections to each backend, sending its requests through the
+// proxy transport so they land in its connection pool
+func (wp *WarmPool) Warm(transport http.RoundTripper, backends []Backend) {
+	client := &http.Client{Transport: transport, Timeout: warmRequestTimeout}
+	var wg sync.WaitGroup
+	for _, backend := range backends {
+		target := strings.TrimSuffix(backend.Address(), "/") + wp.config.Path
+		for i := 0; i < wp.config.Connections; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				atomic.AddInt64(&wp.requests, 1)
+				resp, err := client.Get(target)
+				if err != nil {
+					atomic.AddInt64(&wp.failures, 1)
+					return
+				}
+				// Read the body to the end so the connection goes back to the idle pool
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+	atomic.AddInt64(&wp.rounds, 1)
+}
+
+// keepWarm warms the live backends of both pools at startup and every Interval
+func (lb *LoadBalancer) keepWarm() {
+	ticker := time.NewTicker(lb.warmPool.config.Interval)
+	defer ticker.Stop()
+	for {
+		var backends []Backend
+		for _, pool := range []*ServerPool{lb.serverPool, lb.quarantinePool} {
+			for _, backend := range pool.GetBackends() {
+				if backend.IsAlive() && !backend.IsDraining() {
+					backends = append(backends, backend)
+				}
+			}
+		}
+
+		start := time.Now()
+		failures := atomic.LoadInt64(&lb.warmPool.failures)
+		dials := atomic.LoadInt64(&lb.warmPool.dials)
+		lb.warmPool.Warm(lb.transport, backends)
+		lb.logs.Debugf("🔥 [WARM] Warmed %d backends in %v: %d connections dialed, %d requests failed",
+			len(backends), time.Since(start).Round(time.Millisecond),
+			atomic.LoadInt64(&lb.warmPool.dials)-dials, atomic.LoadInt64(&lb.warmPool.failures)-failures)
+
+		<-ticker.C
+	}
+}
+
+// GetStats returns the warm pool settings and counters
+func (wp *WarmPool) GetStats() map[string]interface{} {
+	if !wp.Enabled() {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":                 true,
+		"connections_per_backend": wp.config.Connections,
+		"interval_seconds":        wp.config.Interval.Seconds(),
+		"path":                    wp.config.Path,
+		"rounds":                  atomic.LoadInt64(&wp.rounds),
+		"requests":                atomic.LoadInt64(&wp.requests),
+		"failures":                atomic.LoadInt64(&wp.failures),
+		"dials":                   atomic.LoadInt64(&wp.dials),
+	}
+}
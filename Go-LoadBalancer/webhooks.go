@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webhookEvents are the transitions webhooks are notified of
+var webhookEvents = []string{EventBackendUp, EventBackendDown, EventCircuitOpen, EventCircuitClosed}
+
+// webhookAttempts is how many times a notification is tried before it is dropped
+const webhookAttempts = 3
+
+// WebhookNotification is the JSON body POSTed to webhooks. Text repeats the event as
+// one line, so Slack-style incoming webhooks can take it as is.
+type WebhookNotification struct {
+	Event
+	LoadBalancer string `json:"load_balancer"` // the listen port, telling load balancers apart
+	Text         string `json:"text"`
+}
+
+// WebhookNotifier POSTs backend up/down and circuit open/close transitions to webhook
+// URLs. A transition is only sent once the backend has kept its new state for the
+// debounce interval, so flapping doesn't flood the receivers.
+type WebhookNotifier struct {
+	debounce time.Duration
+	port     string
+	client   *http.Client
+
+	mux      sync.Mutex
+	urls     []string
+	pending  map[string]*pendingTransition // "health|backend" or "circuit|backend"
+	notified map[string]string             // last event type sent per key
+
+	// Metrics
+	sent       int64
+	failed     int64
+	suppressed int64
+}
+
+// pendingTransition is a transition waiting out the debounce interval
+type pendingTransition struct {
+	event Event
+	timer *time.Timer
+}
+
+// NewWebhookNotifier validates the webhook URLs and creates a notifier
+func NewWebhookNotifier(config WebhookConfig, port string) (*WebhookNotifier, error) {
+	for _, u := range config.URLs {
+		if err := validateWebhookURL(u); err != nil {
+			return nil, err
+		}
+	}
+	if config.Debounce < 0 {
+		return nil, fmt.Errorf("webhook debounce must not be negative")
+	}
+	return &WebhookNotifier{
+		debounce: config.Debounce,
+		port:     port,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		urls:     slices.Clone(config.URLs),
+		pending:  make(map[string]*pendingTransition),
+		notified: make(map[string]string),
+	}, nil
+}
+
+// validateWebhookURL accepts absolute http and https URLs
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", raw)
+	}
+	return nil
+}
+
+// URLs returns the registered webhook URLs
+func (wn *WebhookNotifier) URLs() []string {
+	wn.mux.Lock()
+	defer wn.mux.Unlock()
+	return slices.Clone(wn.urls)
+}
+
+// Add registers a webhook URL; it returns false if it already was
+func (wn *WebhookNotifier) Add(u string) (bool, error) {
+	if err := validateWebhookURL(u); err != nil {
+		return false, err
+	}
+	wn.mux.Lock()
+	defer wn.mux.Unlock()
+	if slices.Contains(wn.urls, u) {
+		return false, nil
+	}
+	wn.urls = append(wn.urls, u)
+	return true, nil
+}
+
+// Remove unregisters a webhook URL; it returns false if it wasn't registered
+func (wn *WebhookNotifier) Remove(u string) bool {
+	wn.mux.Lock()
+	defer wn.mux.Unlock()
+	i := slices.Index(wn.urls, u)
+	if i < 0 {
+		return false
+	}
+	wn.urls = slices.Delete(wn.urls, i, i+1)
+	return true
+}
+
+// handle takes an event from the event log, starting or restarting its debounce timer
+func (wn *WebhookNotifier) handle(event Event) {
+	if !slices.Contains(webhookEvents, event.Type) {
+		return
+	}
+	kind := "health"
+	if event.Type == EventCircuitOpen || event.Type == EventCircuitClosed {
+		kind = "circuit"
+	}
+	key := kind + "|" + event.Pool + "|" + event.Backend
+
+	wn.mux.Lock()
+	defer wn.mux.Unlock()
+	if p, ok := wn.pending[key]; ok {
+		// Still settling: the newest state replaces the pending one
+		p.timer.Stop()
+		atomic.AddInt64(&wn.suppressed, 1)
+	}
+	p := &pendingTransition{event: event}
+	p.timer = time.AfterFunc(wn.debounce, func() { wn.fire(key, p) })
+	wn.pending[key] = p
+}
+
+// fire sends a transition that outlasted the debounce interval, unless the backend is
+// back in the state last sent
+func (wn *WebhookNotifier) fire(key string, p *pendingTransition) {
+	wn.mux.Lock()
+	if wn.pending[key] != p {
+		wn.mux.Unlock()
+		return
+	}
+	delete(wn.pending, key)
+	last, seen := wn.notified[key]
+	if last == p.event.Type || (!seen && (p.event.Type == EventBackendUp || p.event.Type == EventCircuitClosed)) {
+		// A flap that settled where it started, or a recovery nobody was told was needed
+		wn.mux.Unlock()
+		atomic.AddInt64(&wn.suppressed, 1)
+		return
+	}
+	wn.notified[key] = p.event.Type
+	urls := slices.Clone(wn.urls)
+	wn.mux.Unlock()
+
+	notification := WebhookNotification{
+		Event:        p.event,
+		LoadBalancer: wn.port,
+		Text:         fmt.Sprintf("[lb :%s] %s %s %s: %s", wn.port, p.event.Type, p.event.Pool, p.event.Backend, p.event.Message),
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+	for _, u := range urls {
+		go wn.send(u, body, p.event)
+	}
+}
+
+// send POSTs one notification, retrying with backoff
+func (wn *WebhookNotifier) send(u string, body []byte, event Event) {
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		var resp *http.Response
+		resp, err = wn.client.Post(u, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				atomic.AddInt64(&wn.sent, 1)
+				return
+			}
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	atomic.AddInt64(&wn.failed, 1)
+	log.Printf("🪝 [WEBHOOK] Failed to deliver %s for %s to %s: %v", event.Type, event.Backend, u, err)
+}
+
+// GetStats returns the webhook configuration and delivery counters
+func (wn *WebhookNotifier) GetStats() map[string]interface{} {
+	if wn == nil {
+		return map[string]interface{}{"urls": 0}
+	}
+	return map[string]interface{}{
+		"urls":             len(wn.URLs()),
+		"debounce_seconds": wn.debounce.Seconds(),
+		"sent":             atomic.LoadInt64(&wn.sent),
+		"failed":           atomic.LoadInt64(&wn.failed),
+		"suppressed":       atomic.LoadInt64(&wn.suppressed),
+	}
+}
+
+// SetupWebhooks creates the webhook notifier and subscribes it to the event log
+func (lb *LoadBalancer) SetupWebhooks(config WebhookConfig) error {
+	notifier, err := NewWebhookNotifier(config, lb.config.Port)
+	if err != nil {
+		return err
+	}
+	lb.webhooks = notifier
+	lb.events.Subscribe(notifier.handle)
+	if len(config.URLs) > 0 {
+		log.Printf("🪝 [CONFIG] Notifying %d webhooks of backend transitions (debounce %v)", len(config.URLs), config.Debounce)
+	}
+	return nil
+}
+
+// adminWebhooks lists (GET), registers (POST {"url": ...}) or removes (DELETE ?url=)
+// webhook URLs
+func (lb *LoadBalancer) adminWebhooks(w http.ResponseWriter, r *http.Request) {
+	if lb.webhooks == nil {
+		http.Error(w, "Webhooks not set up", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		added, err := lb.webhooks.Add(req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if added {
+			log.Printf("🪝 [WEBHOOK] %s registered by %s", req.URL, adminIdentity(r))
+		}
+	case http.MethodDelete:
+		u := r.URL.Query().Get("url")
+		if !lb.webhooks.Remove(u) {
+			http.Error(w, fmt.Sprintf("No webhook %s", u), http.StatusNotFound)
+			return
+		}
+		log.Printf("🪝 [WEBHOOK] %s removed by %s", u, adminIdentity(r))
+	default:
+		http.Error(w, "Only GET, POST and DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"urls":  lb.webhooks.URLs(),
+		"stats": lb.webhooks.GetStats(),
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// weightsFile is the on-disk form of the backends' runtime weights
+type weightsFile struct {
+	Saved time.Time                 `json:"saved"`
+	Pools map[string]map[string]int `json:"pools"` // pool name → backend URL → weight
+}
+
+// WeightStore saves the backends' weights while the load balancer runs, so weights
+// changed at runtime survive a restart
+type WeightStore struct {
+	config WeightPersistenceConfig
+	lb     *LoadBalancer
+	last   map[string]map[string]int // what was last written
+
+	// Metrics
+	saves     int64
+	failures  int64
+	lastSaved atomic.Pointer[time.Time]
+}
+
+// currentWeights returns every pool's backend weights
+func (lb *LoadBalancer) currentWeights() map[string]map[string]int {
+	weights := make(map[string]map[string]int)
+	for name, pool := range lb.namedPools() {
+		backends := pool.GetBackends()
+		if len(backends) == 0 {
+			continue
+		}
+		weights[name] = make(map[string]int, len(backends))
+		for _, backend := range backends {
+			weights[name][backend.Address()] = backend.GetWeight()
+		}
+	}
+	return weights
+}
+
+// RestoreWeights applies the weights saved in path to the backends still configured.
+// A missing file is not an error: nothing has been saved yet.
+func (lb *LoadBalancer) RestoreWeights(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("⚖️ [WEIGHTS] No saved weights at %s, keeping the configured ones", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved weightsFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	restored := 0
+	pools := lb.namedPools()
+	for name, weights := range saved.Pools {
+		pool, ok := pools[name]
+		if !ok {
+			continue
+		}
+		for address, weight := range weights {
+			if backend := pool.FindBackend(address); backend != nil && weight > 0 && backend.GetWeight() != weight {
+				backend.SetWeight(weight)
+				restored++
+			}
+		}
+	}
+	log.Printf("⚖️ [WEIGHTS] Restored %d backend weights saved at %s from %s",
+		restored, saved.Saved.Format(time.RFC3339), path)
+	return nil
+}
+
+// StartWeightPersistence restores saved weights if asked to, then saves them every
+// interval; an empty path disables it
+func (lb *LoadBalancer) StartWeightPersistence(config WeightPersistenceConfig) error {
+	if config.Path == "" {
+		return nil
+	}
+	if config.Restore {
+		if err := lb.RestoreWeights(config.Path); err != nil {
+			return err
+		}
+	}
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+
+	store := &WeightStore{config: config, lb: lb}
+	lb.weightStore = store
+	go store.run()
+
+	log.Printf("⚖️ [CONFIG] Saving backend weights to %s every %v", config.Path, config.Interval)
+	return nil
+}
+
+// run saves the weights every interval when they changed
+func (ws *WeightStore) run() {
+	ticker := time.NewTicker(ws.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ws.Save(); err != nil {
+			atomic.AddInt64(&ws.failures, 1)
+			log.Printf("❌ [WEIGHTS] Failed to save weights to %s: %v", ws.config.Path, err)
+		}
+	}
+}
+
+// Save writes the current weights unless they match what was last written. The file
+// is replaced atomically, so a crash mid-write leaves the previous weights in place.
+func (ws *WeightStore) Save() error {
+	weights := ws.lb.currentWeights()
+	if ws.last != nil && maps.EqualFunc(weights, ws.last, maps.Equal) {
+		return nil
+	}
+
+	now := time.Now()
+	data, err := json.MarshalIndent(weightsFile{Saved: now, Pools: weights}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ws.config.Path), ".weights-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ws.config.Path); err != nil {
+		return err
+	}
+
+	ws.last = weights
+	atomic.AddInt64(&ws.saves, 1)
+	ws.lastSaved.Store(&now)
+	return nil
+}
+
+// GetStats returns the weight persistence settings and counters
+func (ws *WeightStore) GetStats() map[string]interface{} {
+	if ws == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	stats := map[string]interface{}{
+		"enabled":          true,
+		"path":             ws.config.Path,
+		"interval_seconds": ws.config.Interval.Seconds(),
+		"saves":            atomic.LoadInt64(&ws.saves),
+		"failures":         atomic.LoadInt64(&ws.failures),
+	}
+	if saved := ws.lastSaved.Load(); saved != nil {
+		stats["last_saved"] = saved.Format(time.RFC3339)
+	}
+	return stats
+}
@@ -2,8 +2,12 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -22,6 +26,20 @@ type Backend struct {
 	// New fields for controlled testing
 	FailureMode *FailureMode
 	IsHealthy   bool // Manual health toggle
+	Draining    bool // Set on shutdown so health checks fail while traffic drains
+	JSONLogs    bool // Access logs are JSON lines instead of plain text
+
+	Metrics   *Metrics
+	Warmup    WarmupConfig // set before serving, read-only afterwards
+	RateLimit *RateLimiter // nil means unlimited
+
+	Degradation DegradationConfig // set before serving, read-only afterwards
+
+	heldMemoryMB int64    // memory currently held by /memory requests
+	sessions     sync.Map // session ID -> *int64 requests served here, for /session
+
+	// mux guards the fields changed at runtime through /control
+	mux sync.RWMutex
 }
 
 func NewBackend(port int, backendType string, baseDelay, maxDelay time.Duration,
@@ -37,26 +55,57 @@ func NewBackend(port int, backendType string, baseDelay, maxDelay time.Duration,
 		Hostname:    hostname,
 		IsHealthy:   true, // Start healthy by default
 		FailureMode: nil,  // Start without failure mode
+		Metrics:     NewMetrics(),
 	}
 }
 
-func (b *Backend) LogRequest(method, path, remoteAddr string, duration time.Duration, status int) {
+func (b *Backend) LogRequest(r *http.Request, duration time.Duration, status int) {
 	count := atomic.AddInt64(&b.RequestCount, 1)
-	log.Printf("[%s:%d] #%d %s %s from %s -> %d (%v)",
-		b.Type, b.Port, count, method, path, remoteAddr, status, duration)
+	method := r.Method
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		method = "GRPC"
+	}
+
+	if b.JSONLogs {
+		b.logAccessJSON(AccessLogEntry{
+			Time:       time.Now().Format(time.RFC3339Nano),
+			Backend:    fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+			Type:       b.Type,
+			Count:      count,
+			RequestID:  r.Header.Get("X-Request-ID"),
+			TraceID:    traceID(r),
+			Method:     method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			Status:     status,
+			DurationMs: float64(duration.Microseconds()) / 1000,
+		})
+		return
+	}
+	trace := ""
+	if id := traceID(r); id != "" {
+		trace = " trace=" + id
+	}
+	log.Printf("[%s:%d] #%d %s %s from %s -> %d (%v)%s",
+		b.Type, b.Port, count, method, r.URL.Path, r.RemoteAddr, status, duration, trace)
 }
 
 func (b *Backend) ShouldFail() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
 	return rand.Float64() < b.ErrorRate
 }
 
 func (b *Backend) GetDelay() time.Duration {
-	if b.MaxDelay == 0 {
-		return b.BaseDelay
-	}
-	// Random delay between BaseDelay and MaxDelay
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	// Random delay between BaseDelay and MaxDelay, plus whatever warm-up still adds
 	diff := b.MaxDelay - b.BaseDelay
-	return b.BaseDelay + time.Duration(rand.Int63n(int64(diff)))
+	if diff <= 0 {
+		return b.BaseDelay + b.warmupDelay()
+	}
+	return b.BaseDelay + time.Duration(rand.Int63n(int64(diff))) + b.warmupDelay()
 }
 
 func (b *Backend) GetRequestCount() int64 {
@@ -68,16 +117,65 @@ func (b *Backend) GetUptime() time.Duration {
 }
 
 func (b *Backend) shouldFailRequest() bool {
-	if b.FailureMode == nil {
+	if b.warmupFails() {
+		return true
+	}
+
+	b.mux.RLock()
+	mode := b.FailureMode
+	b.mux.RUnlock()
+
+	if mode == nil {
 		return b.ShouldFail() // Original behavior
 	}
 
-	if b.FailureMode.RequestsFail {
-		if b.FailureMode.PartialFailure > 0 {
-			return rand.Float64() < b.FailureMode.PartialFailure
+	if mode.RequestsFail {
+		if mode.PartialFailure > 0 {
+			return rand.Float64() < mode.PartialFailure
 		}
 		return true
 	}
 
 	return b.ShouldFail() // Fallback to original behavior
 }
+
+// SetDraining makes health checks fail from now on
+func (b *Backend) SetDraining() {
+	b.mux.Lock()
+	b.Draining = true
+	b.mux.Unlock()
+}
+
+// getFailureMode returns a copy of the current failure mode (zero if none is set)
+func (b *Backend) getFailureMode() FailureMode {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	if b.FailureMode == nil {
+		return FailureMode{}
+	}
+	return *b.FailureMode
+}
+
+// ControlState returns the full runtime-adjustable configuration
+func (b *Backend) ControlState() map[string]interface{} {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	mode := FailureMode{}
+	if b.FailureMode != nil {
+		mode = *b.FailureMode
+	}
+	return map[string]interface{}{
+		"base_delay_ms":      b.BaseDelay.Milliseconds(),
+		"max_delay_ms":       b.MaxDelay.Milliseconds(),
+		"payload_size":       b.PayloadSize,
+		"error_rate":         b.ErrorRate,
+		"is_healthy":         b.IsHealthy,
+		"draining":           b.Draining,
+		"health_check_fails": mode.HealthCheckFails,
+		"requests_fail":      mode.RequestsFail,
+		"partial_failure":    mode.PartialFailure,
+		"slow_responses":     mode.SlowResponses,
+		"health_delay_ms":    mode.HealthCheckDelay.Milliseconds(),
+	}
+}
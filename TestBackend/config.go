@@ -0,0 +1,118 @@
+// config.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// FileConfig is a TestBackend configuration file. Any flag can be set by its name, with a
+// string, number or boolean value; flags given on the command line take precedence.
+// "timeline" holds failure schedule entries (see ParseScenario) and "endpoints", when
+// present, restricts which endpoints are served besides /health, /control and /metrics.
+//
+//	{
+//	  "type": "slow",
+//	  "port": 3002,
+//	  "delay": "200ms",
+//	  "error-rate": 0.05,
+//	  "timeline": ["at 30s: error-rate 0.5 for 60s", "at 120s: down for 20s"],
+//	  "endpoints": ["/", "/stream", "/status"]
+//	}
+type FileConfig struct {
+	Timeline  []string
+	Endpoints []string
+}
+
+// LoadConfigFile reads a configuration file and applies its flag values to fs, skipping
+// flags that were set explicitly on the command line
+func LoadConfigFile(path string, fs *flag.FlagSet) (FileConfig, error) {
+	var config FileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return config, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for name, raw := range entries {
+		switch name {
+		case "timeline":
+			if err := json.Unmarshal(raw, &config.Timeline); err != nil {
+				return config, fmt.Errorf("timeline must be a list of strings")
+			}
+			continue
+		case "endpoints":
+			if err := json.Unmarshal(raw, &config.Endpoints); err != nil {
+				return config, fmt.Errorf("endpoints must be a list of paths")
+			}
+			continue
+		case "config":
+			return config, fmt.Errorf("config files cannot include other config files")
+		}
+
+		if fs.Lookup(name) == nil {
+			return config, fmt.Errorf("unknown setting %q", name)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		// Strings are unquoted; numbers and booleans are passed through as written
+		value := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			value = s
+		}
+		if err := fs.Set(name, value); err != nil {
+			return config, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return config, nil
+}
+
+// EndpointEnabled reports whether the route pattern should be served. Patterns with path
+// wildcards match their static prefix, so "/status" enables "/status/{code}".
+func (c FileConfig) EndpointEnabled(pattern string) bool {
+	if c.Endpoints == nil {
+		return true
+	}
+	for _, endpoint := range c.Endpoints {
+		if endpoint == endpointPath(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckEndpoints returns an error if an enabled endpoint matches none of the route patterns
+func (c FileConfig) CheckEndpoints(patterns map[string]http.HandlerFunc) error {
+	for _, endpoint := range c.Endpoints {
+		known := false
+		for pattern := range patterns {
+			known = known || endpoint == endpointPath(pattern)
+		}
+		if !known {
+			return fmt.Errorf("unknown endpoint %q", endpoint)
+		}
+	}
+	return nil
+}
+
+// endpointPath strips path wildcards from a route pattern
+func endpointPath(pattern string) string {
+	if i := strings.Index(pattern, "/{"); i > 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
@@ -0,0 +1,107 @@
+// cpu.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cpuSlice is the duty-cycle period used to apply intensity
+const cpuSlice = 10 * time.Millisecond
+
+// HandleCPU burns CPU for a fixed wall-clock duration so CPU-bound saturation can be simulated.
+// GET /cpu?duration_ms=100&parallelism=1&intensity=1.0
+// intensity (0-1] is the share of each 10ms slice spent computing; parallelism is the
+// number of goroutines burning concurrently.
+func (b *Backend) HandleCPU(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	duration := time.Duration(queryInt(query.Get("duration_ms"), 100)) * time.Millisecond
+	parallelism := queryInt(query.Get("parallelism"), 1)
+	intensity := 1.0
+	if value := query.Get("intensity"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "intensity must be a number", http.StatusBadRequest)
+			return
+		}
+		intensity = parsed
+	}
+	if duration < 0 || parallelism < 1 || parallelism > 256 || intensity <= 0 || intensity > 1 {
+		http.Error(w, "duration_ms must not be negative, parallelism must be 1-256, intensity must be in (0, 1]",
+			http.StatusBadRequest)
+		return
+	}
+
+	cpuBefore := processCPUTime()
+	var wg sync.WaitGroup
+	iterations := make([]uint64, parallelism)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			iterations[i] = burnCPU(duration, intensity)
+		}(i)
+	}
+	wg.Wait()
+	cpuUsed := processCPUTime() - cpuBefore
+
+	var total uint64
+	for _, n := range iterations {
+		total += n
+	}
+
+	elapsed := time.Since(start)
+	b.LogRequest(r, elapsed, http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":     fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+		"duration_ms": duration.Milliseconds(),
+		"parallelism": parallelism,
+		"intensity":   intensity,
+		"wall_ms":     float64(elapsed.Microseconds()) / 1000,
+		// Process-wide, so concurrent requests inflate it; -1 where unsupported
+		"cpu_ms":     cpuMillis(cpuUsed),
+		"iterations": total,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	})
+}
+
+// burnCPU spins for intensity of every slice until duration has passed, returning the work done
+func burnCPU(duration time.Duration, intensity float64) uint64 {
+	var iterations uint64
+	x := 1.0
+	deadline := time.Now().Add(duration)
+	for now := time.Now(); now.Before(deadline); now = time.Now() {
+		busyUntil := now.Add(time.Duration(float64(cpuSlice) * intensity))
+		if busyUntil.After(deadline) {
+			busyUntil = deadline
+		}
+		for time.Now().Before(busyUntil) {
+			for i := 0; i < 1000; i++ {
+				x = math.Sqrt(x + float64(i))
+			}
+			iterations++
+		}
+		if idle := time.Until(now.Add(cpuSlice)); intensity < 1 && idle > 0 {
+			time.Sleep(idle)
+		}
+	}
+	if x < 0 {
+		iterations++ // keeps the computation from being optimized away
+	}
+	return iterations
+}
+
+func cpuMillis(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+// cputime_other.go
+package main
+
+import "time"
+
+// processCPUTime is unsupported on this platform
+func processCPUTime() time.Duration {
+	return -1
+}
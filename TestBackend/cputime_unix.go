@@ -0,0 +1,18 @@
+//go:build unix
+
+// cputime_unix.go
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user plus system CPU time consumed by the process
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return -1
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -0,0 +1,60 @@
+// crash.go
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HandleCrash exits the process with the given code after delay. By default the request
+// never gets a response, so the load balancer sees a backend die mid-request; with
+// respond=true it is answered with 202 first and the process exits in the background.
+// GET /crash?code=1&delay=2s&respond=false
+func (b *Backend) HandleCrash(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code := queryInt(query.Get("code"), 1)
+	delay, err := time.ParseDuration(queryString(query.Get("delay"), "0s"))
+	if err != nil || delay < 0 || code < 0 || code > 255 {
+		http.Error(w, "code must be 0-255 and delay a non-negative duration", http.StatusBadRequest)
+		return
+	}
+
+	b.Metrics.RecordInjectedFailure("crash")
+	log.Printf("[%s:%d] Crash requested from %s: exiting with code %d in %v", b.Type, b.Port, r.RemoteAddr, code, delay)
+
+	crash := func() {
+		time.Sleep(delay)
+		log.Printf("[%s:%d] Crashing now (exit %d)", b.Type, b.Port, code)
+		os.Exit(code)
+	}
+
+	if query.Get("respond") == "true" {
+		w.WriteHeader(http.StatusAccepted)
+		go crash()
+		return
+	}
+	crash()
+}
+
+// HandleHang accepts the request and never responds, holding the connection until the
+// client gives up or the server shuts down. With after_headers=true the status line and
+// headers are sent first and only the body hangs, to separate header and body timeouts.
+// GET /hang?after_headers=false
+func (b *Backend) HandleHang(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	b.Metrics.RecordInjectedFailure("hang")
+
+	if r.URL.Query().Get("after_headers") == "true" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	<-r.Context().Done()
+	log.Printf("[%s:%d] Hung request from %s released after %v: %v",
+		b.Type, b.Port, r.RemoteAddr, time.Since(start), r.Context().Err())
+}
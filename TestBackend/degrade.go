@@ -0,0 +1,38 @@
+// degrade.go
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DegradationConfig makes the root endpoint behave like a saturating server: every other
+// request in flight adds delay, and the payload shrinks as concurrency approaches Capacity
+type DegradationConfig struct {
+	Capacity        int64         // concurrent requests at which the payload is smallest (0 disables)
+	DelayPerRequest time.Duration // extra delay per other in-flight request
+	MinPayload      float64       // payload fraction served at or beyond Capacity
+}
+
+// concurrentRequests returns how many other requests are in flight
+func (b *Backend) concurrentRequests() int64 {
+	return max(0, atomic.LoadInt64(&b.Metrics.inFlight)-1)
+}
+
+// degradeDelay returns the extra delay caused by the current concurrency
+func (b *Backend) degradeDelay() time.Duration {
+	if b.Degradation.Capacity <= 0 {
+		return 0
+	}
+	return time.Duration(b.concurrentRequests()) * b.Degradation.DelayPerRequest
+}
+
+// degradePayload scales size down linearly with concurrency, to MinPayload at Capacity
+func (b *Backend) degradePayload(size int) int {
+	if b.Degradation.Capacity <= 0 {
+		return size
+	}
+	load := min(1, float64(b.concurrentRequests())/float64(b.Degradation.Capacity))
+	fraction := 1 - load*(1-b.Degradation.MinPayload)
+	return int(float64(size) * fraction)
+}
@@ -0,0 +1,107 @@
+// download.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDownloadBytes caps the size a single /download may request
+const maxDownloadBytes = 16 << 30 // 16GB
+
+// downloadPattern is the repeating payload served by /download: byte i of the body is
+// downloadPattern[i % len(downloadPattern)], so clients can verify what they received
+var downloadPattern = func() []byte {
+	pattern := make([]byte, 251*256) // a whole number of periods, about 64KB
+	for i := range pattern {
+		pattern[i] = byte(i % 251)
+	}
+	return pattern
+}()
+
+// HandleDownload streams a deterministic payload of the requested size at rate bytes per
+// second (unlimited when rate is absent), flushing every tick, so buffering, flush
+// behavior and bandwidth accounting in the load balancer can be measured.
+// GET /download?size=100MB&rate=10MBps
+func (b *Backend) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	size, err := parseByteSize(queryString(query.Get("size"), "10MB"))
+	if err != nil || size < 0 || size > maxDownloadBytes {
+		http.Error(w, fmt.Sprintf("size must be between 0 and %d bytes (e.g., 100MB)", int64(maxDownloadBytes)), http.StatusBadRequest)
+		return
+	}
+	rate, err := parseByteSize(strings.TrimSuffix(strings.TrimSuffix(query.Get("rate"), "ps"), "/s"))
+	if err != nil || rate < 0 {
+		http.Error(w, "rate must be a byte rate (e.g., 10MBps)", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Payload-Pattern", "i%251")
+	w.WriteHeader(http.StatusOK)
+
+	// Send a tick's worth of bytes at a time when rate limited, otherwise a pattern at a time
+	flusher, _ := w.(http.Flusher)
+	perTick := int64(len(downloadPattern))
+	if rate > 0 {
+		perTick = max(1, rate*int64(slowTick)/int64(time.Second))
+	}
+
+	var sent int64
+	next := time.Now()
+	for sent < size {
+		tickEnd := min(sent+perTick, size)
+		for sent < tickEnd {
+			offset := sent % int64(len(downloadPattern))
+			n := min(int64(len(downloadPattern))-offset, tickEnd-sent)
+			if _, err := w.Write(downloadPattern[offset : offset+n]); err != nil {
+				b.LogRequest(r, time.Since(start), http.StatusOK)
+				return // peer went away
+			}
+			sent += n
+		}
+		if rate > 0 {
+			if flusher != nil {
+				flusher.Flush()
+			}
+			// Pace against the schedule rather than sleeping a fixed tick, so write time
+			// doesn't lower the effective rate
+			next = next.Add(slowTick)
+			time.Sleep(time.Until(next))
+		}
+	}
+
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+}
+
+// parseByteSize parses sizes such as "512", "64KB", "100MB" or "1GB" (binary multiples).
+// An empty string is 0.
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSuffix(value, unit.suffix)
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n * float64(multiplier)), nil
+}
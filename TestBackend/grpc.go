@@ -0,0 +1,288 @@
+// grpc.go
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The gRPC server is implemented on the standard library's cleartext HTTP/2 support with a
+// minimal protobuf codec, covering just the messages in echo.proto and grpc.health.v1.
+
+// gRPC status codes used by the server
+const (
+	grpcOK            = 0
+	grpcInvalidArg    = 3
+	grpcNotFound      = 5
+	grpcUnimplemented = 12
+	grpcUnavailable   = 14
+)
+
+// Health check serving status values from grpc.health.v1
+const (
+	healthServing    = 1
+	healthNotServing = 2
+)
+
+// maxGRPCMessage bounds the size of a single request message
+const maxGRPCMessage = 4 * 1024 * 1024
+
+type echoRequest struct {
+	Message   string
+	DelayMs   int
+	ErrorCode int
+	Count     int
+}
+
+// StartGRPCServer serves the Echo and Health services over cleartext HTTP/2 on port
+func (b *Backend) StartGRPCServer(port int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/testbackend.Echo/Unary", b.grpcUnary)
+	mux.HandleFunc("/testbackend.Echo/ServerStream", b.grpcServerStream)
+	mux.HandleFunc("/grpc.health.v1.Health/Check", b.grpcHealthCheck)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeGRPCStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+	})
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Addr:      ":" + strconv.Itoa(port),
+		Handler:   mux,
+		Protocols: protocols,
+	}
+
+	log.Printf("Starting gRPC server (cleartext HTTP/2) on port %d", port)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+func (b *Backend) grpcUnary(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req, ok := readEchoRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.DelayMs > 0 {
+		time.Sleep(time.Duration(req.DelayMs) * time.Millisecond)
+	}
+	if req.ErrorCode != grpcOK {
+		b.Metrics.RecordInjectedFailure("grpc")
+		writeGRPCStatus(w, req.ErrorCode, "injected error")
+		b.LogRequest(r, time.Since(start), req.ErrorCode)
+		return
+	}
+
+	startGRPCResponse(w)
+	writeGRPCMessage(w, b.encodeEchoResponse(req.Message, 1))
+	setGRPCTrailers(w, grpcOK, "")
+	b.LogRequest(r, time.Since(start), grpcOK)
+}
+
+func (b *Backend) grpcServerStream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req, ok := readEchoRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Count <= 0 {
+		req.Count = 5
+	}
+
+	startGRPCResponse(w)
+	flusher, _ := w.(http.Flusher)
+	for seq := 1; seq <= req.Count; seq++ {
+		if req.DelayMs > 0 {
+			select {
+			case <-time.After(time.Duration(req.DelayMs) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if err := writeGRPCMessage(w, b.encodeEchoResponse(req.Message, seq)); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	code, message := grpcOK, ""
+	if req.ErrorCode != grpcOK {
+		b.Metrics.RecordInjectedFailure("grpc")
+		code, message = req.ErrorCode, "injected error"
+	}
+	setGRPCTrailers(w, code, message)
+	b.LogRequest(r, time.Since(start), code)
+}
+
+// grpcHealthCheck implements grpc.health.v1.Health/Check from the backend's health state
+func (b *Backend) grpcHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if _, err := readGRPCMessage(r.Body); err != nil {
+		writeGRPCStatus(w, grpcInvalidArg, err.Error())
+		return
+	}
+
+	mode := b.getFailureMode()
+	b.mux.RLock()
+	healthy := b.IsHealthy && !b.Draining && !mode.HealthCheckFails
+	b.mux.RUnlock()
+
+	status := healthServing
+	if !healthy {
+		status = healthNotServing
+	}
+
+	startGRPCResponse(w)
+	writeGRPCMessage(w, appendVarintField(nil, 1, uint64(status)))
+	setGRPCTrailers(w, grpcOK, "")
+}
+
+// readEchoRequest reads and decodes the request message, writing a gRPC error on failure
+func readEchoRequest(w http.ResponseWriter, r *http.Request) (echoRequest, bool) {
+	var req echoRequest
+	msg, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalidArg, err.Error())
+		return req, false
+	}
+
+	err = decodeProto(msg, func(field int, varint uint64, bytes []byte) {
+		switch field {
+		case 1:
+			req.Message = string(bytes)
+		case 2:
+			req.DelayMs = int(int32(varint))
+		case 3:
+			req.ErrorCode = int(int32(varint))
+		case 4:
+			req.Count = int(int32(varint))
+		}
+	})
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalidArg, err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func (b *Backend) encodeEchoResponse(message string, seq int) []byte {
+	msg := appendBytesField(nil, 1, []byte(message))
+	msg = appendBytesField(msg, 2, []byte(fmt.Sprintf("%s:%d", b.Hostname, b.Port)))
+	return appendVarintField(msg, 3, uint64(seq))
+}
+
+// startGRPCResponse sends the response headers and announces the status trailers
+func startGRPCResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+}
+
+func setGRPCTrailers(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", message)
+	}
+}
+
+// writeGRPCStatus sends a trailers-only response carrying just a status
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// readGRPCMessage reads one length-prefixed message
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading message prefix: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxGRPCMessage {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit", length)
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage writes one uncompressed length-prefixed message
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// decodeProto walks the fields of a protobuf message, calling fn for varint and
+// length-delimited fields and skipping fixed-width ones
+func decodeProto(msg []byte, fn func(field int, varint uint64, bytes []byte)) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("malformed field key")
+		}
+		msg = msg[n:]
+		field, wireType := int(key>>3), key&7
+
+		switch wireType {
+		case 0:
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errors.New("malformed varint")
+			}
+			msg = msg[n:]
+			fn(field, value, nil)
+		case 1:
+			if len(msg) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			msg = msg[8:]
+		case 2:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return errors.New("truncated length-delimited field")
+			}
+			fn(field, 0, msg[n:n+int(length)])
+			msg = msg[n+int(length):]
+		case 5:
+			if len(msg) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+func appendVarintField(buf []byte, field int, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3)
+	return binary.AppendUvarint(buf, value)
+}
+
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -24,19 +24,21 @@ func (b *Backend) HandleRoot(w http.ResponseWriter, r *http.Request) {
 
 	// Check for failure mode
 	if b.shouldFailRequest() {
+		b.Metrics.RecordInjectedFailure("error")
 		duration := time.Since(start)
-		b.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, duration, 500)
+		b.LogRequest(r, duration, 500)
 		http.Error(w, "Backend temporarily unavailable", http.StatusInternalServerError)
 		return
 	}
 
-	// Apply delay
-	if delay := b.GetDelay(); delay > 0 {
+	// Apply delay, growing with concurrency when degradation is enabled
+	if delay := b.GetDelay() + b.degradeDelay(); delay > 0 {
 		time.Sleep(delay)
 	}
 
 	// Apply slow response mode
-	if b.FailureMode != nil && b.FailureMode.SlowResponses {
+	if b.getFailureMode().SlowResponses {
+		b.Metrics.RecordInjectedFailure("slow")
 		time.Sleep(2 * time.Second)
 	}
 
@@ -49,12 +51,16 @@ func (b *Backend) HandleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add payload if specified
-	if b.PayloadSize > 0 {
-		response["payload"] = strings.Repeat("x", b.PayloadSize)
+	b.mux.RLock()
+	payloadSize := b.PayloadSize
+	b.mux.RUnlock()
+	payloadSize = b.degradePayload(payloadSize)
+	if payloadSize > 0 {
+		response["payload"] = strings.Repeat("x", payloadSize)
 	}
 
 	duration := time.Since(start)
-	b.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, duration, 200)
+	b.LogRequest(r, duration, 200)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -63,15 +69,21 @@ func (b *Backend) HandleRoot(w http.ResponseWriter, r *http.Request) {
 func (b *Backend) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	mode := b.getFailureMode()
+	b.mux.RLock()
+	healthy := b.IsHealthy && !b.Draining
+	b.mux.RUnlock()
+
 	// Apply health check delay if specified
-	if b.FailureMode != nil && b.FailureMode.HealthCheckDelay > 0 {
-		time.Sleep(b.FailureMode.HealthCheckDelay)
+	if mode.HealthCheckDelay > 0 {
+		time.Sleep(mode.HealthCheckDelay)
 	}
 
 	// Check if health check should fail
-	if (b.FailureMode != nil && b.FailureMode.HealthCheckFails) || !b.IsHealthy {
+	if mode.HealthCheckFails || !healthy {
+		b.Metrics.RecordInjectedFailure("health")
 		duration := time.Since(start)
-		b.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, duration, 503)
+		b.LogRequest(r, duration, 503)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":    "unhealthy",
@@ -83,7 +95,7 @@ func (b *Backend) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	duration := time.Since(start)
-	b.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, duration, 200)
+	b.LogRequest(r, duration, 200)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -91,6 +103,8 @@ func (b *Backend) HandleHealth(w http.ResponseWriter, r *http.Request) {
 		"backend":   fmt.Sprintf("%s:%d", b.Hostname, b.Port),
 		"uptime":    b.GetUptime().String(),
 		"requests":  b.GetRequestCount(),
+		"warmup":    b.warmupStatus(),
+		"load":      b.LoadReport(),
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
@@ -99,10 +113,11 @@ func (b *Backend) HandleInfo(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	// Info endpoint rarely fails, but can be slow
-	if b.FailureMode != nil && b.FailureMode.SlowResponses {
+	if b.getFailureMode().SlowResponses {
 		time.Sleep(time.Second)
 	}
 
+	b.mux.RLock()
 	info := map[string]interface{}{
 		"backend":      fmt.Sprintf("%s:%d", b.Hostname, b.Port),
 		"type":         b.Type,
@@ -114,27 +129,44 @@ func (b *Backend) HandleInfo(w http.ResponseWriter, r *http.Request) {
 		"error_rate":   b.ErrorRate,
 		"is_healthy":   b.IsHealthy,
 		"failure_mode": b.FailureMode,
+		"warmup":       b.warmupStatus(),
 		"timestamp":    time.Now().Format(time.RFC3339),
 	}
+	b.mux.RUnlock()
 
 	duration := time.Since(start)
-	b.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, duration, 200)
+	b.LogRequest(r, duration, 200)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
 }
 
-// Control endpoint to change backend behavior during testing
+// Control endpoint to change backend behavior during testing.
+// GET returns the current configuration; POST applies an action and returns the new one.
 func (b *Backend) HandleControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"backend": fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+			"config":  b.ControlState(),
+		})
+		return
+	}
 	if r.Method != "POST" {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		http.Error(w, "Only GET and POST allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Action      string  `json:"action"`       // "fail_health", "fail_requests", "slow", "recover"
-		ErrorRate   float64 `json:"error_rate"`   // For partial failures
-		HealthDelay int     `json:"health_delay"` // Health check delay in ms
+		Action      string   `json:"action"`       // "fail_health", "fail_requests", "slow", "recover", "set"
+		ErrorRate   *float64 `json:"error_rate"`   // For partial failures, or the base error rate with "set"
+		HealthDelay int      `json:"health_delay"` // Health check delay in ms
+
+		// Fields applied by "set"; omitted fields are left unchanged
+		BaseDelayMs *int  `json:"base_delay_ms"`
+		MaxDelayMs  *int  `json:"max_delay_ms"`
+		PayloadSize *int  `json:"payload_size"`
+		Healthy     *bool `json:"healthy"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -142,46 +174,97 @@ func (b *Backend) HandleControl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if b.FailureMode == nil {
-		b.FailureMode = &FailureMode{}
+	b.mux.Lock()
+	// Failure modes are replaced rather than modified so readers can use them without locking
+	mode := FailureMode{}
+	if b.FailureMode != nil {
+		mode = *b.FailureMode
 	}
 
 	switch req.Action {
 	case "fail_health":
-		b.FailureMode.HealthCheckFails = true
+		mode.HealthCheckFails = true
 		b.IsHealthy = false
 		log.Printf("[%s:%d] Health checks will now fail", b.Type, b.Port)
 
 	case "fail_requests":
-		b.FailureMode.RequestsFail = true
-		if req.ErrorRate > 0 {
-			b.FailureMode.PartialFailure = req.ErrorRate
+		mode.RequestsFail = true
+		if req.ErrorRate != nil && *req.ErrorRate > 0 {
+			mode.PartialFailure = *req.ErrorRate
 		} else {
-			b.FailureMode.PartialFailure = 1.0 // 100% failure
+			mode.PartialFailure = 1.0 // 100% failure
 		}
-		log.Printf("[%s:%d] Requests will now fail (%.1f%% rate)", b.Type, b.Port, b.FailureMode.PartialFailure*100)
+		log.Printf("[%s:%d] Requests will now fail (%.1f%% rate)", b.Type, b.Port, mode.PartialFailure*100)
 
 	case "slow":
-		b.FailureMode.SlowResponses = true
+		mode.SlowResponses = true
 		if req.HealthDelay > 0 {
-			b.FailureMode.HealthCheckDelay = time.Duration(req.HealthDelay) * time.Millisecond
+			mode.HealthCheckDelay = time.Duration(req.HealthDelay) * time.Millisecond
 		}
 		log.Printf("[%s:%d] Responses will now be slow", b.Type, b.Port)
 
 	case "recover":
-		b.FailureMode = &FailureMode{}
+		mode = FailureMode{}
 		b.IsHealthy = true
 		log.Printf("[%s:%d] Backend recovered", b.Type, b.Port)
 
+	case "set":
+		if err := b.applySettings(req.ErrorRate, req.BaseDelayMs, req.MaxDelayMs, req.PayloadSize, req.Healthy); err != nil {
+			b.mux.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.HealthDelay > 0 {
+			mode.HealthCheckDelay = time.Duration(req.HealthDelay) * time.Millisecond
+		}
+		log.Printf("[%s:%d] Settings updated: delay=%v, max-delay=%v, payload=%d bytes, error-rate=%.1f%%, healthy=%v",
+			b.Type, b.Port, b.BaseDelay, b.MaxDelay, b.PayloadSize, b.ErrorRate*100, b.IsHealthy)
+
 	default:
+		b.mux.Unlock()
 		http.Error(w, "Unknown action", http.StatusBadRequest)
 		return
 	}
+	b.FailureMode = &mode
+	b.mux.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "success",
 		"backend": fmt.Sprintf("%s:%d", b.Hostname, b.Port),
 		"action":  req.Action,
+		"config":  b.ControlState(),
 	})
 }
+
+// applySettings validates and applies the "set" control action. Callers hold b.mux.
+func (b *Backend) applySettings(errorRate *float64, baseDelayMs, maxDelayMs, payloadSize *int, healthy *bool) error {
+	baseDelay, maxDelay := b.BaseDelay, b.MaxDelay
+	if baseDelayMs != nil {
+		baseDelay = time.Duration(*baseDelayMs) * time.Millisecond
+	}
+	if maxDelayMs != nil {
+		maxDelay = time.Duration(*maxDelayMs) * time.Millisecond
+	}
+	if baseDelay < 0 || maxDelay < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+	if errorRate != nil && (*errorRate < 0 || *errorRate > 1) {
+		return fmt.Errorf("error_rate must be between 0.0 and 1.0")
+	}
+	if payloadSize != nil && *payloadSize < 0 {
+		return fmt.Errorf("payload_size must not be negative")
+	}
+
+	b.BaseDelay, b.MaxDelay = baseDelay, maxDelay
+	if errorRate != nil {
+		b.ErrorRate = *errorRate
+	}
+	if payloadSize != nil {
+		b.PayloadSize = *payloadSize
+	}
+	if healthy != nil {
+		b.IsHealthy = *healthy
+	}
+	return nil
+}
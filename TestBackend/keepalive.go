@@ -0,0 +1,42 @@
+// keepalive.go
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// KeepAlivePolicy controls how long the backend lets clients reuse HTTP/1.1 connections.
+// Connections are closed by answering with "Connection: close".
+type KeepAlivePolicy struct {
+	MaxRequestsPerConn int64   // close after this many requests on one connection (0 = unlimited)
+	CloseProbability   float64 // chance of closing after any request (0.0 to 1.0)
+}
+
+// connRequestsKey holds the per-connection request counter in the request context
+type connRequestsKey struct{}
+
+// ConnContext gives every connection its own request counter
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(int64))
+}
+
+// KeepAliveControlled applies the keep-alive policy to every response from next
+func (b *Backend) KeepAliveControlled(policy KeepAlivePolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		closeConn := policy.CloseProbability > 0 && rand.Float64() < policy.CloseProbability
+		if counter, ok := r.Context().Value(connRequestsKey{}).(*int64); ok && policy.MaxRequestsPerConn > 0 {
+			if atomic.AddInt64(counter, 1) >= policy.MaxRequestsPerConn {
+				closeConn = true
+			}
+		}
+		if closeConn {
+			b.Metrics.RecordInjectedFailure("connection_close")
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,114 @@
+// load.go
+package main
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadWindowSize is how many recent request latencies the load report's p95 covers
+const loadWindowSize = 1024
+
+// cpuSampleInterval is the minimum time between CPU usage samples
+const cpuSampleInterval = time.Second
+
+// LoadReport is the backend-reported load included in /health responses under "load":
+//
+//	in_flight       requests being served right now, not counting the health check itself
+//	p95_latency_ms  95th percentile latency of the last 1024 non-health requests (0 if none)
+//	window_requests how many requests the p95 was computed over
+//	cpu_percent     process CPU usage over the last second, where 100 is one full core
+//	                (-1 if the platform can't report it)
+//	cpu_cores       logical CPUs available, so cpu_percent can be normalized
+type LoadReport struct {
+	InFlight       int64   `json:"in_flight"`
+	P95LatencyMs   float64 `json:"p95_latency_ms"`
+	WindowRequests int     `json:"window_requests"`
+	CPUPercent     float64 `json:"cpu_percent"`
+	CPUCores       int     `json:"cpu_cores"`
+}
+
+// loadTracker keeps the recent latency window and CPU samples behind the load report
+type loadTracker struct {
+	mux       sync.Mutex
+	latencies [loadWindowSize]time.Duration
+	next      int
+	filled    int
+
+	cpuMux     sync.Mutex
+	lastCPU    time.Duration
+	lastSample time.Time
+	cpuPercent float64
+}
+
+// record adds a request latency to the window
+func (t *loadTracker) record(duration time.Duration) {
+	t.mux.Lock()
+	t.latencies[t.next] = duration
+	t.next = (t.next + 1) % loadWindowSize
+	if t.filled < loadWindowSize {
+		t.filled++
+	}
+	t.mux.Unlock()
+}
+
+// p95 returns the 95th percentile of the window and the number of samples in it
+func (t *loadTracker) p95() (time.Duration, int) {
+	t.mux.Lock()
+	window := make([]time.Duration, t.filled)
+	copy(window, t.latencies[:t.filled])
+	t.mux.Unlock()
+
+	if len(window) == 0 {
+		return 0, 0
+	}
+	sort.Slice(window, func(i, j int) bool { return window[i] < window[j] })
+	return window[(len(window)-1)*95/100], len(window)
+}
+
+// cpuUsage returns process CPU usage in percent of one core, resampling at most once
+// per cpuSampleInterval so frequent health checks don't measure tiny intervals
+func (t *loadTracker) cpuUsage() float64 {
+	t.cpuMux.Lock()
+	defer t.cpuMux.Unlock()
+
+	now := time.Now()
+	cpu := processCPUTime()
+	if cpu < 0 {
+		return -1
+	}
+	if t.lastSample.IsZero() {
+		// First sample, nothing to compare against yet
+		t.lastCPU, t.lastSample = cpu, now
+		t.cpuPercent = 0
+		return t.cpuPercent
+	}
+	if elapsed := now.Sub(t.lastSample); elapsed >= cpuSampleInterval {
+		t.cpuPercent = math.Round(float64(cpu-t.lastCPU)/float64(elapsed)*1000) / 10
+		t.lastCPU, t.lastSample = cpu, now
+	}
+	return t.cpuPercent
+}
+
+// LoadReport summarizes the backend's current load for /health
+func (b *Backend) LoadReport() LoadReport {
+	p95, samples := b.Metrics.load.p95()
+
+	// The health check asking for the report is itself in flight
+	inFlight := atomic.LoadInt64(&b.Metrics.inFlight) - 1
+	if inFlight < 0 {
+		inFlight = 0
+	}
+
+	return LoadReport{
+		InFlight:       inFlight,
+		P95LatencyMs:   float64(p95.Microseconds()) / 1000,
+		WindowRequests: samples,
+		CPUPercent:     b.Metrics.load.cpuUsage(),
+		CPUCores:       runtime.NumCPU(),
+	}
+}
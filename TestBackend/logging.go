@@ -0,0 +1,80 @@
+// logging.go
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// accessLog writes JSON access log entries; it is only used with JSON logging enabled
+var accessLog = log.New(os.Stderr, "", 0)
+
+// AccessLogEntry is one request in the JSON access log. request_id is echoed from the
+// X-Request-ID header and trace_id from the trace headers, so entries can be joined with
+// the load balancer's logs.
+type AccessLogEntry struct {
+	Time       string  `json:"time"`
+	Backend    string  `json:"backend"`
+	Type       string  `json:"type"`
+	Count      int64   `json:"count"`
+	RequestID  string  `json:"request_id,omitempty"`
+	TraceID    string  `json:"trace_id,omitempty"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	RemoteAddr string  `json:"remote_addr"`
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// jsonLogWriter wraps each plain log line in a JSON object, so every line of output is
+// JSON when structured logging is enabled
+type jsonLogWriter struct {
+	out io.Writer
+}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	line, err := json.Marshal(struct {
+		Time string `json:"time"`
+		Msg  string `json:"msg"`
+	}{time.Now().Format(time.RFC3339Nano), strings.TrimSuffix(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// EnableJSONLogs switches both access logs and other log output to JSON lines
+func (b *Backend) EnableJSONLogs() {
+	b.JSONLogs = true
+	log.SetFlags(0)
+	log.SetOutput(jsonLogWriter{out: os.Stderr})
+}
+
+// logAccessJSON writes a request to the JSON access log
+func (b *Backend) logAccessJSON(entry AccessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	accessLog.Print(string(line))
+}
+
+// traceID returns the trace ID from a request's traceparent, b3 or X-B3-TraceId header
+func traceID(r *http.Request) string {
+	if parts := strings.Split(r.Header.Get("Traceparent"), "-"); len(parts) >= 4 {
+		return parts[1]
+	}
+	if single := r.Header.Get("B3"); single != "" {
+		id, _, _ := strings.Cut(single, "-")
+		return id
+	}
+	return r.Header.Get("X-B3-TraceId")
+}
@@ -2,11 +2,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -19,9 +23,40 @@ func main() {
 		payloadSize  = flag.Int("size", 0, "Payload size in bytes for heavy endpoints")
 		errorRate    = flag.Float64("error-rate", 0.0, "Error rate (0.0 to 1.0)")
 		startHealthy = flag.Bool("healthy", true, "Start in healthy state")
+		drainTimeout = flag.Duration("drain-timeout", 10*time.Second, "Time allowed for in-flight requests to finish on SIGTERM")
+		drainHealth  = flag.Duration("drain-fail-health", 0, "Fail health checks for this long on SIGTERM before draining (e.g., 5s)")
+		warmup       = flag.Duration("warmup", 0, "Warm-up period after startup during which the backend is slower and/or failing, improving linearly")
+		warmupDelay  = flag.Duration("warmup-delay", 500*time.Millisecond, "Extra delay per request at startup, fading out over -warmup")
+		warmupErrors = flag.Float64("warmup-error-rate", 0.0, "Extra error rate at startup, fading out over -warmup (0.0 to 1.0)")
+		rateLimit    = flag.Float64("rate-limit", 0, "Requests per second the backend accepts before answering 429 with Retry-After (0 disables)")
+		rateBurst    = flag.Int("rate-burst", 0, "Burst allowed above -rate-limit (defaults to one second's worth)")
+		keepAlive    = flag.Bool("keep-alive", true, "Allow HTTP/1.1 keep-alive connections")
+		maxConnReqs  = flag.Int64("max-requests-per-conn", 0, "Close a connection after this many requests (0 = unlimited)")
+		closeProb    = flag.Float64("close-probability", 0.0, "Chance of closing the connection after any request (0.0 to 1.0)")
+		degradeCap   = flag.Int64("degrade-capacity", 0, "Concurrent requests at which / serves its smallest payload; enables degradation under load (0 disables)")
+		degradeDelay = flag.Duration("degrade-delay", 10*time.Millisecond, "Extra delay on / per other request in flight, with -degrade-capacity")
+		degradeMin   = flag.Float64("degrade-min-payload", 0.1, "Fraction of the payload served at -degrade-capacity (0.0 to 1.0)")
+		useTLS       = flag.Bool("tls", false, "Serve HTTPS (self-signed unless -cert and -key are given)")
+		certFile     = flag.String("cert", "", "TLS certificate file (PEM)")
+		keyFile      = flag.String("key", "", "TLS private key file (PEM)")
+		useHTTP2     = flag.Bool("http2", true, "Enable HTTP/2 (h2 over TLS, h2c prior knowledge in cleartext)")
+		grpcPort     = flag.Int("grpc-port", 0, "Port for the gRPC echo and health services (0 disables)")
+		logFormat    = flag.String("log-format", "text", "Log format: text or json (JSON access logs echo X-Request-ID)")
+		configFile   = flag.String("config", "", "JSON configuration file; flags given on the command line override it")
+		scenarioFile = flag.String("scenario", "", "Failure timeline file (e.g., \"at 30s: error-rate 0.5 for 60s; at 120s: down for 20s\")")
 	)
 	flag.Parse()
 
+	var fileConfig FileConfig
+	if *configFile != "" {
+		var err error
+		fileConfig, err = LoadConfigFile(*configFile, flag.CommandLine)
+		if err != nil {
+			log.Fatalf("Invalid config %s: %v", *configFile, err)
+		}
+		log.Printf("Loaded config %s", *configFile)
+	}
+
 	hostname, _ := os.Hostname()
 	if hostname == "" {
 		hostname = "localhost"
@@ -88,19 +123,140 @@ func main() {
 
 	backend := NewBackend(*port, *backendType, *baseDelay, *maxDelay, *payloadSize, *errorRate, hostname)
 	backend.IsHealthy = *startHealthy
+	switch *logFormat {
+	case "json":
+		backend.EnableJSONLogs()
+	case "text":
+	default:
+		log.Fatalf("Unknown log format %q (use text or json)", *logFormat)
+	}
+	if *rateLimit > 0 {
+		backend.RateLimit = NewRateLimiter(*rateLimit, *rateBurst)
+		log.Printf("Rate limiting to %.1f requests/second", *rateLimit)
+	}
+	if *degradeCap > 0 {
+		if *degradeMin < 0 || *degradeMin > 1 {
+			log.Fatalf("-degrade-min-payload must be between 0.0 and 1.0")
+		}
+		backend.Degradation = DegradationConfig{Capacity: *degradeCap, DelayPerRequest: *degradeDelay, MinPayload: *degradeMin}
+		log.Printf("Degrading under load: +%v per concurrent request, payload down to %.0f%% at %d in flight",
+			*degradeDelay, *degradeMin*100, *degradeCap)
+	}
+	if *warmup > 0 {
+		backend.Warmup = WarmupConfig{Duration: *warmup, Delay: *warmupDelay, ErrorRate: *warmupErrors}
+		log.Printf("Warming up for %v (extra delay %v, extra error rate %.1f%%)", *warmup, *warmupDelay, *warmupErrors*100)
+	}
 
-	// Setup routes
-	http.HandleFunc("/", backend.HandleRoot)
-	http.HandleFunc("/health", backend.HandleHealth)
-	http.HandleFunc("/info", backend.HandleInfo)
-	http.HandleFunc("/control", backend.HandleControl) // New control endpoint
+	if *scenarioFile != "" {
+		steps, err := LoadScenario(*scenarioFile)
+		if err != nil {
+			log.Fatalf("Invalid scenario %s: %v", *scenarioFile, err)
+		}
+		backend.RunScenario(steps)
+		log.Printf("Running scenario %s with %d steps", *scenarioFile, len(steps))
+	} else if len(fileConfig.Timeline) > 0 {
+		steps, err := ParseScenario(strings.Join(fileConfig.Timeline, "\n"))
+		if err != nil {
+			log.Fatalf("Invalid timeline in %s: %v", *configFile, err)
+		}
+		backend.RunScenario(steps)
+		log.Printf("Running timeline from %s with %d steps", *configFile, len(steps))
+	}
+
+	// Setup routes. /health, /control and /metrics are always served; a config file
+	// may restrict the others.
+	http.HandleFunc("/health", backend.Metrics.Instrument("/health", backend.HandleHealth))
+	http.HandleFunc("/control", backend.HandleControl) // Runtime behavior control
+	http.HandleFunc("/metrics", backend.HandleMetrics) // Prometheus text format
+
+	endpoints := map[string]http.HandlerFunc{
+		"/":              backend.HandleRoot,
+		"/info":          backend.HandleInfo,
+		"/slow":          backend.HandleSlow,
+		"/upload":        backend.HandleUpload,
+		"/download":      backend.HandleDownload,
+		"/session":       backend.HandleSession,
+		"/status/{code}": backend.HandleStatus,
+		"/cpu":           backend.HandleCPU,
+		"/memory":        backend.HandleMemory,
+		"/stream":        backend.HandleStream,
+		"/chunked":       backend.HandleChunked,
+		"/hang":          backend.HandleHang,
+		"/crash":         backend.HandleCrash, // Exits the process
+	}
+	if err := fileConfig.CheckEndpoints(endpoints); err != nil {
+		log.Fatalf("Invalid config %s: %v", *configFile, err)
+	}
+	for pattern, handler := range endpoints {
+		if !fileConfig.EndpointEnabled(pattern) {
+			// Registered anyway so disabled paths 404 instead of falling through to /
+			handler = http.NotFound
+		}
+		http.HandleFunc(pattern, backend.Metrics.Instrument(endpointPath(pattern), backend.RateLimited(handler)))
+	}
 
 	addr := ":" + strconv.Itoa(*port)
 	log.Printf("Starting %s backend server on port %d", *backendType, *port)
 	log.Printf("Config: delay=%v, max-delay=%v, payload=%d bytes, error-rate=%.1f%%, healthy=%v",
 		*baseDelay, *maxDelay, *payloadSize, *errorRate*100, *startHealthy)
 	log.Printf("Visit http://localhost:%d for endpoint overview", *port)
-	log.Printf("Use POST /control to change behavior during testing")
+	log.Printf("Use POST /control to change behavior during testing (GET /control shows the current settings)")
+
+	if *grpcPort > 0 {
+		go backend.StartGRPCServer(*grpcPort)
+	}
 
-	log.Fatal(http.ListenAndServe(addr, nil))
+	server := &http.Server{
+		Addr:        addr,
+		ConnState:   backend.Metrics.TrackConn,
+		ConnContext: ConnContext,
+	}
+	server.SetKeepAlivesEnabled(*keepAlive)
+	if *maxConnReqs > 0 || *closeProb > 0 {
+		server.Handler = backend.KeepAliveControlled(KeepAlivePolicy{
+			MaxRequestsPerConn: *maxConnReqs,
+			CloseProbability:   *closeProb,
+		}, http.DefaultServeMux)
+		log.Printf("Closing connections after %d requests, or with probability %.2f", *maxConnReqs, *closeProb)
+	}
+	if !*keepAlive {
+		log.Printf("Keep-alive disabled, every connection serves one request")
+	}
+	if err := configureProtocols(server, *useTLS, *useHTTP2, *certFile, *keyFile, hostname); err != nil {
+		log.Fatalf("TLS setup failed: %v", err)
+	}
+	go func() {
+		var err error
+		if *useTLS {
+			log.Printf("Serving HTTPS (http2=%v)", *useHTTP2)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Graceful shutdown: optionally fail health checks so load balancers stop sending
+	// traffic, then stop accepting connections and let in-flight requests finish
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigCh
+	log.Printf("[%s:%d] Received %v, shutting down", *backendType, *port, sig)
+
+	if *drainHealth > 0 {
+		backend.SetDraining()
+		log.Printf("[%s:%d] Failing health checks for %v before draining", *backendType, *port, *drainHealth)
+		time.Sleep(*drainHealth)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	log.Printf("[%s:%d] Draining in-flight requests (timeout %v)", *backendType, *port, *drainTimeout)
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("[%s:%d] Drain timed out, closing remaining connections: %v", *backendType, *port, err)
+		server.Close()
+	}
+	log.Printf("[%s:%d] Shutdown complete after %d requests", *backendType, *port, backend.GetRequestCount())
 }
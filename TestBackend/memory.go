@@ -0,0 +1,103 @@
+// memory.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// maxHeldMemoryMB caps the total memory /memory may hold at once
+const maxHeldMemoryMB = 4096
+
+// HandleMemory allocates and holds memory in the background, optionally forcing garbage
+// collections while it is held so GC pauses show up in request latency.
+// GET /memory?mb=100&hold=10s&gc_every=100ms
+func (b *Backend) HandleMemory(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	mb := queryInt(query.Get("mb"), 100)
+	hold, err := time.ParseDuration(queryString(query.Get("hold"), "10s"))
+	if err != nil {
+		http.Error(w, "hold must be a duration", http.StatusBadRequest)
+		return
+	}
+	gcEvery, err := time.ParseDuration(queryString(query.Get("gc_every"), "0s"))
+	if err != nil {
+		http.Error(w, "gc_every must be a duration", http.StatusBadRequest)
+		return
+	}
+	if mb < 1 || hold <= 0 || gcEvery < 0 {
+		http.Error(w, "mb and hold must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if atomic.AddInt64(&b.heldMemoryMB, int64(mb)) > maxHeldMemoryMB {
+		atomic.AddInt64(&b.heldMemoryMB, -int64(mb))
+		http.Error(w, fmt.Sprintf("would hold more than %d MB", maxHeldMemoryMB), http.StatusInsufficientStorage)
+		return
+	}
+
+	// Allocate in 1MB blocks and touch every page so the memory is really resident
+	blocks := make([][]byte, mb)
+	for i := range blocks {
+		blocks[i] = make([]byte, 1024*1024)
+		for j := 0; j < len(blocks[i]); j += 4096 {
+			blocks[i][j] = 1
+		}
+	}
+
+	go b.holdMemory(blocks, hold, gcEvery)
+	log.Printf("[%s:%d] Holding %d MB for %v (gc every %v)", b.Type, b.Port, mb, hold, gcEvery)
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":       fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+		"allocated_mb":  mb,
+		"hold":          hold.String(),
+		"gc_every":      gcEvery.String(),
+		"held_total_mb": atomic.LoadInt64(&b.heldMemoryMB),
+		"heap_alloc_mb": stats.HeapAlloc / (1024 * 1024),
+		"num_gc":        stats.NumGC,
+		"allocation_ms": float64(time.Since(start).Microseconds()) / 1000,
+		"timestamp":     time.Now().Format(time.RFC3339),
+	})
+}
+
+// holdMemory keeps blocks reachable for hold, forcing a GC every gcEvery when set
+func (b *Backend) holdMemory(blocks [][]byte, hold, gcEvery time.Duration) {
+	deadline := time.After(hold)
+	var ticker <-chan time.Time
+	if gcEvery > 0 {
+		t := time.NewTicker(gcEvery)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	for {
+		select {
+		case <-ticker:
+			runtime.GC()
+		case <-deadline:
+			atomic.AddInt64(&b.heldMemoryMB, -int64(len(blocks)))
+			runtime.KeepAlive(blocks)
+			return
+		}
+	}
+}
+
+// queryString returns value, or def when it is empty
+func queryString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,179 @@
+// metrics.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects backend-side request metrics exposed in Prometheus text format
+type Metrics struct {
+	inFlight    int64
+	connections int64 // open client connections
+	connsTotal  int64 // client connections accepted
+
+	mux      sync.Mutex
+	requests map[requestKey]int64 // by path and status
+	buckets  map[string][]int64   // cumulative counts per latency bucket, by path
+	sums     map[string]float64   // latency sum in seconds, by path
+	counts   map[string]int64     // observations, by path
+	injected map[string]int64     // injected failures by kind
+
+	load loadTracker // recent latencies and CPU usage for the /health load report
+}
+
+type requestKey struct {
+	path   string
+	status int
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[requestKey]int64),
+		buckets:  make(map[string][]int64),
+		sums:     make(map[string]float64),
+		counts:   make(map[string]int64),
+		injected: make(map[string]int64),
+	}
+}
+
+// Observe records a finished request
+func (m *Metrics) Observe(path string, status int, duration time.Duration) {
+	seconds := duration.Seconds()
+	if path != "/health" {
+		m.load.record(duration)
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.requests[requestKey{path, status}]++
+	buckets, ok := m.buckets[path]
+	if !ok {
+		buckets = make([]int64, len(latencyBuckets))
+		m.buckets[path] = buckets
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			buckets[i]++
+		}
+	}
+	m.sums[path] += seconds
+	m.counts[path]++
+}
+
+// TrackConn is an http.Server ConnState hook counting client connections, so connection
+// reuse by the load balancer shows up in the metrics
+func (m *Metrics) TrackConn(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&m.connsTotal, 1)
+		atomic.AddInt64(&m.connections, 1)
+	case http.StateClosed, http.StateHijacked:
+		atomic.AddInt64(&m.connections, -1)
+	}
+}
+
+// RecordInjectedFailure counts a failure injected on purpose ("error", "slow", "health", ...)
+func (m *Metrics) RecordInjectedFailure(kind string) {
+	m.mux.Lock()
+	m.injected[kind]++
+	m.mux.Unlock()
+}
+
+// Instrument wraps a handler to track in-flight requests, status codes and latency.
+// Requests are labelled with the registered pattern to keep label cardinality bounded.
+func (m *Metrics) Instrument(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&m.inFlight, 1)
+		defer atomic.AddInt64(&m.inFlight, -1)
+
+		if id := r.Header.Get("X-Request-ID"); id != "" {
+			w.Header().Set("X-Request-ID", id)
+		}
+
+		start := time.Now()
+		lrw := newLoggingResponseWriter(w)
+		next(lrw, r)
+
+		status := lrw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.Observe(pattern, status, time.Since(start))
+	}
+}
+
+// HandleMetrics serves the metrics in Prometheus text exposition format
+func (b *Backend) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := b.Metrics
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# HELP testbackend_in_flight_requests Requests currently being served.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_in_flight_requests gauge\n")
+	fmt.Fprintf(&sb, "testbackend_in_flight_requests %d\n", atomic.LoadInt64(&m.inFlight))
+	fmt.Fprintf(&sb, "# HELP testbackend_open_connections Client connections currently open.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_open_connections gauge\n")
+	fmt.Fprintf(&sb, "testbackend_open_connections %d\n", atomic.LoadInt64(&m.connections))
+	fmt.Fprintf(&sb, "# HELP testbackend_connections_total Client connections accepted.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_connections_total counter\n")
+	fmt.Fprintf(&sb, "testbackend_connections_total %d\n", atomic.LoadInt64(&m.connsTotal))
+
+	m.mux.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].status < keys[j].status
+	})
+	fmt.Fprintf(&sb, "# HELP testbackend_requests_total Requests served, by path and status code.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "testbackend_requests_total{path=%q,code=\"%d\"} %d\n", key.path, key.status, m.requests[key])
+	}
+
+	paths := make([]string, 0, len(m.counts))
+	for path := range m.counts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintf(&sb, "# HELP testbackend_request_duration_seconds Request latency measured inside the backend.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_request_duration_seconds histogram\n")
+	for _, path := range paths {
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&sb, "testbackend_request_duration_seconds_bucket{path=%q,le=\"%g\"} %d\n", path, bound, m.buckets[path][i])
+		}
+		fmt.Fprintf(&sb, "testbackend_request_duration_seconds_bucket{path=%q,le=\"+Inf\"} %d\n", path, m.counts[path])
+		fmt.Fprintf(&sb, "testbackend_request_duration_seconds_sum{path=%q} %g\n", path, m.sums[path])
+		fmt.Fprintf(&sb, "testbackend_request_duration_seconds_count{path=%q} %d\n", path, m.counts[path])
+	}
+
+	kinds := make([]string, 0, len(m.injected))
+	for kind := range m.injected {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(&sb, "# HELP testbackend_injected_failures_total Failures injected on purpose, by kind.\n")
+	fmt.Fprintf(&sb, "# TYPE testbackend_injected_failures_total counter\n")
+	for _, kind := range kinds {
+		fmt.Fprintf(&sb, "testbackend_injected_failures_total{kind=%q} %d\n", kind, m.injected[kind])
+	}
+	m.mux.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, sb.String())
+}
@@ -0,0 +1,68 @@
+// ratelimit.go
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket enforcing the backend's own requests-per-second limit
+type RateLimiter struct {
+	rate   float64 // tokens added per second
+	burst  float64
+	mux    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rps requests per second with bursts up to burst
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rps)))
+	}
+	return &RateLimiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token if one is available; otherwise it returns how long until one is
+func (l *RateLimiter) Allow() (bool, time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// RateLimited rejects requests over the backend's rate limit with 429 and a Retry-After
+// header, the way a throttling upstream would. Without a limit it returns next unchanged.
+func (b *Backend) RateLimited(next http.HandlerFunc) http.HandlerFunc {
+	if b.RateLimit == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := b.RateLimit.Allow()
+		if allowed {
+			next(w, r)
+			return
+		}
+
+		b.Metrics.RecordInjectedFailure("rate_limit")
+		b.LogRequest(r, 0, http.StatusTooManyRequests)
+		// Retry-After is in whole seconds, so round up and never advertise 0
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	}
+}
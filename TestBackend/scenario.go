@@ -0,0 +1,210 @@
+// scenario.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScenarioStep is one timed entry of a failure timeline, e.g. "at 30s: error-rate 0.5 for 60s"
+type ScenarioStep struct {
+	At     time.Duration // offset from startup
+	For    time.Duration // how long the change lasts, 0 means until changed again
+	Action string        // "error-rate", "delay", "payload", "down", "unhealthy", "slow", "recover"
+	Args   []string
+	Raw    string
+}
+
+// LoadScenario reads and parses a timeline file
+func LoadScenario(path string) ([]ScenarioStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(string(data))
+}
+
+// ParseScenario parses timeline entries separated by ';' or newlines. Lines starting
+// with '#' are comments. Each entry has the form "at <offset>: <action> [args] [for <duration>]".
+func ParseScenario(text string) ([]ScenarioStep, error) {
+	var steps []ScenarioStep
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ";") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			step, err := parseScenarioStep(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", entry, err)
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+func parseScenarioStep(entry string) (ScenarioStep, error) {
+	step := ScenarioStep{Raw: entry}
+
+	when, what, ok := strings.Cut(entry, ":")
+	if !ok {
+		return step, fmt.Errorf("expected \"at <offset>: <action>\"")
+	}
+	when = strings.TrimSpace(when)
+	if !strings.HasPrefix(when, "at ") {
+		return step, fmt.Errorf("expected \"at <offset>\"")
+	}
+	at, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(when, "at ")))
+	if err != nil {
+		return step, err
+	}
+	step.At = at
+
+	fields := strings.Fields(what)
+	if n := len(fields); n >= 2 && fields[n-2] == "for" {
+		if step.For, err = time.ParseDuration(fields[n-1]); err != nil {
+			return step, err
+		}
+		fields = fields[:n-2]
+	}
+	if len(fields) == 0 {
+		return step, fmt.Errorf("missing action")
+	}
+	step.Action, step.Args = fields[0], fields[1:]
+
+	// Validate the arguments up front so a typo fails at startup, not mid-run
+	switch step.Action {
+	case "error-rate":
+		if len(step.Args) != 1 {
+			return step, fmt.Errorf("error-rate takes a rate between 0.0 and 1.0")
+		}
+		rate, err := strconv.ParseFloat(step.Args[0], 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return step, fmt.Errorf("error-rate takes a rate between 0.0 and 1.0")
+		}
+	case "delay":
+		if len(step.Args) < 1 || len(step.Args) > 2 {
+			return step, fmt.Errorf("delay takes a base and optional max duration")
+		}
+		for _, arg := range step.Args {
+			if _, err := time.ParseDuration(arg); err != nil {
+				return step, err
+			}
+		}
+	case "payload":
+		if len(step.Args) != 1 {
+			return step, fmt.Errorf("payload takes a size in bytes")
+		}
+		if size, err := strconv.Atoi(step.Args[0]); err != nil || size < 0 {
+			return step, fmt.Errorf("payload takes a size in bytes")
+		}
+	case "down", "unhealthy", "slow", "recover":
+		if len(step.Args) != 0 {
+			return step, fmt.Errorf("%s takes no arguments", step.Action)
+		}
+	default:
+		return step, fmt.Errorf("unknown action %q", step.Action)
+	}
+	return step, nil
+}
+
+// RunScenario schedules every step relative to now
+func (b *Backend) RunScenario(steps []ScenarioStep) {
+	for _, step := range steps {
+		step := step
+		time.AfterFunc(step.At, func() {
+			log.Printf("[%s:%d] Scenario: %s", b.Type, b.Port, step.Raw)
+			revert := b.applyScenarioStep(step)
+			if step.For > 0 {
+				time.AfterFunc(step.For, func() {
+					log.Printf("[%s:%d] Scenario: reverting %q", b.Type, b.Port, step.Raw)
+					revert()
+				})
+			}
+		})
+	}
+}
+
+// applyScenarioStep applies a parsed step and returns a func restoring what it changed
+func (b *Backend) applyScenarioStep(step ScenarioStep) func() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	mode := FailureMode{}
+	if b.FailureMode != nil {
+		mode = *b.FailureMode
+	}
+
+	switch step.Action {
+	case "error-rate":
+		previous := b.ErrorRate
+		b.ErrorRate, _ = strconv.ParseFloat(step.Args[0], 64)
+		return func() { b.withLock(func() { b.ErrorRate = previous }) }
+
+	case "delay":
+		prevBase, prevMax := b.BaseDelay, b.MaxDelay
+		b.BaseDelay, _ = time.ParseDuration(step.Args[0])
+		b.MaxDelay = b.BaseDelay
+		if len(step.Args) == 2 {
+			b.MaxDelay, _ = time.ParseDuration(step.Args[1])
+		}
+		return func() { b.withLock(func() { b.BaseDelay, b.MaxDelay = prevBase, prevMax }) }
+
+	case "payload":
+		previous := b.PayloadSize
+		b.PayloadSize, _ = strconv.Atoi(step.Args[0])
+		return func() { b.withLock(func() { b.PayloadSize = previous }) }
+
+	case "down":
+		// Health checks and requests both fail
+		prevHealthy, prevMode := b.IsHealthy, mode
+		mode.HealthCheckFails, mode.RequestsFail, mode.PartialFailure = true, true, 1.0
+		b.IsHealthy = false
+		b.FailureMode = &mode
+		return func() {
+			b.withLock(func() {
+				b.IsHealthy = prevHealthy
+				b.FailureMode = &prevMode
+			})
+		}
+
+	case "unhealthy":
+		prevHealthy, prevMode := b.IsHealthy, mode
+		mode.HealthCheckFails = true
+		b.IsHealthy = false
+		b.FailureMode = &mode
+		return func() {
+			b.withLock(func() {
+				b.IsHealthy = prevHealthy
+				b.FailureMode = &prevMode
+			})
+		}
+
+	case "slow":
+		prevMode := mode
+		mode.SlowResponses = true
+		b.FailureMode = &mode
+		return func() { b.withLock(func() { b.FailureMode = &prevMode }) }
+
+	case "recover":
+		b.FailureMode = &FailureMode{}
+		b.IsHealthy = true
+	}
+	return func() {}
+}
+
+// withLock runs fn holding the configuration lock
+func (b *Backend) withLock(fn func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	fn()
+}
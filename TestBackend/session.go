@@ -0,0 +1,57 @@
+// session.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// sessionCookie carries the session ID handed out by /session
+const sessionCookie = "tb_session"
+
+// HandleSession reads the session ID from the X-Session-ID header or the tb_session cookie,
+// issuing a new one if there is none, and reports which instance served the request.
+// A known session arriving at an instance that never saw it means affinity was broken
+// (or the session was created elsewhere), which is flagged as moved_here.
+// GET /session
+func (b *Backend) HandleSession(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	instance := fmt.Sprintf("%s:%d", b.Hostname, b.Port)
+
+	sessionID := r.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sessionID = cookie.Value
+		}
+	}
+
+	issued := false
+	if sessionID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		sessionID = hex.EncodeToString(id)
+		issued = true
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sessionID, Path: "/", HttpOnly: true})
+	}
+
+	counter, _ := b.sessions.LoadOrStore(sessionID, new(int64))
+	requests := atomic.AddInt64(counter.(*int64), 1)
+
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Backend-Instance", instance)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_id": sessionID,
+		"issued":     issued,
+		"backend":    instance,
+		"requests":   requests, // requests for this session served by this instance
+		"moved_here": !issued && requests == 1,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,78 @@
+// slow.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slowTick is how often the slow handlers read or write a chunk
+const slowTick = 100 * time.Millisecond
+
+// HandleSlow simulates a slow peer: it reads the request body at read_bps bytes per second,
+// then trickles a size-byte response at write_bps bytes per second.
+// GET /slow?read_bps=100&write_bps=100&size=1024
+func (b *Backend) HandleSlow(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	readBPS := queryInt(query.Get("read_bps"), 100)
+	writeBPS := queryInt(query.Get("write_bps"), 100)
+	size := queryInt(query.Get("size"), 1024)
+	if readBPS <= 0 || writeBPS <= 0 || size < 0 {
+		http.Error(w, "read_bps and write_bps must be positive, size must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	// Read the body slowly, a small chunk per tick
+	received := 0
+	if r.Body != nil {
+		chunk := make([]byte, max(1, readBPS*int(slowTick)/int(time.Second)))
+		for {
+			n, err := io.ReadFull(r.Body, chunk)
+			received += n
+			if err != nil {
+				break
+			}
+			time.Sleep(slowTick)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	w.Header().Set("X-Received-Bytes", strconv.Itoa(received))
+	w.WriteHeader(http.StatusOK)
+
+	// Trickle the response, flushing every chunk so it really leaves the backend slowly
+	flusher, _ := w.(http.Flusher)
+	chunkSize := max(1, writeBPS*int(slowTick)/int(time.Second))
+	for sent := 0; sent < size; {
+		n := min(chunkSize, size-sent)
+		if _, err := io.WriteString(w, strings.Repeat("x", n)); err != nil {
+			break // peer went away
+		}
+		sent += n
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if sent < size {
+			time.Sleep(slowTick)
+		}
+	}
+
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+}
+
+// queryInt parses an integer query parameter, falling back to def when it is absent or invalid
+func queryInt(value string, def int) int {
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
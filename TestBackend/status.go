@@ -0,0 +1,59 @@
+// status.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HandleStatus responds with whatever status code the path asks for, after an optional
+// delay, so the load balancer's handling of specific codes (4xx vs 5xx vs 429) can be
+// tested precisely. body replaces the default JSON body; retry_after sets Retry-After.
+// GET /status/{code}?delay=100ms&body=...&retry_after=5
+func (b *Backend) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	code, err := strconv.Atoi(r.PathValue("code"))
+	if err != nil || code < 100 || code > 599 {
+		http.Error(w, "status code must be between 100 and 599", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	delay, err := time.ParseDuration(queryString(query.Get("delay"), "0s"))
+	if err != nil || delay < 0 {
+		http.Error(w, "delay must be a non-negative duration", http.StatusBadRequest)
+		return
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if retryAfter := query.Get("retry_after"); retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	b.LogRequest(r, time.Since(start), code)
+
+	if body, ok := query["body"]; ok {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(code)
+		fmt.Fprint(w, body[0])
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":   fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+		"status":    code,
+		"text":      http.StatusText(code),
+		"delay":     delay.String(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
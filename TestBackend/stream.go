@@ -0,0 +1,92 @@
+// stream.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HandleStream emits Server-Sent Events.
+// GET /stream?events=10&interval_ms=500
+func (b *Backend) HandleStream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	events := queryInt(query.Get("events"), 10)
+	interval := time.Duration(queryInt(query.Get("interval_ms"), 500)) * time.Millisecond
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for i := 1; i <= events; i++ {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: tick\ndata: {\"backend\":\"%s:%d\",\"seq\":%d,\"timestamp\":\"%s\"}\n\n",
+			i, b.Hostname, b.Port, i, time.Now().Format(time.RFC3339Nano))
+		if err != nil {
+			break // client went away
+		}
+		flusher.Flush()
+
+		if i < events {
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				b.LogRequest(r, time.Since(start), http.StatusOK)
+				return
+			}
+		}
+	}
+
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+}
+
+// HandleChunked writes a chunked response without Content-Length, flushing each chunk.
+// GET /chunked?chunks=10&chunk_size=1024&interval_ms=100
+func (b *Backend) HandleChunked(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	chunks := queryInt(query.Get("chunks"), 10)
+	chunkSize := queryInt(query.Get("chunk_size"), 1024)
+	interval := time.Duration(queryInt(query.Get("interval_ms"), 100)) * time.Millisecond
+	if chunkSize < 0 {
+		http.Error(w, "chunk_size must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Chunk-Count", fmt.Sprintf("%d", chunks))
+	w.WriteHeader(http.StatusOK)
+
+	chunk := strings.Repeat("x", chunkSize)
+	for i := 1; i <= chunks; i++ {
+		if _, err := fmt.Fprint(w, chunk); err != nil {
+			break // client went away
+		}
+		flusher.Flush()
+
+		if i < chunks {
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				b.LogRequest(r, time.Since(start), http.StatusOK)
+				return
+			}
+		}
+	}
+
+	b.LogRequest(r, time.Since(start), http.StatusOK)
+}
@@ -0,0 +1,83 @@
+// upload.go
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HandleUpload consumes the request body at rate bytes per second (0 reads as fast as
+// possible) and returns its size and SHA-256, so the load balancer's body streaming,
+// retries with bodies and size limits can be checked end-to-end. Bodies larger than
+// max_bytes are rejected with 413, up front when Content-Length says so.
+// POST /upload?rate=1048576&max_bytes=10485760
+func (b *Backend) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Only POST and PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	rate := queryInt(query.Get("rate"), 0)
+	maxBytes := queryInt(query.Get("max_bytes"), 0)
+	if rate < 0 || maxBytes < 0 {
+		http.Error(w, "rate and max_bytes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if maxBytes > 0 && r.ContentLength > int64(maxBytes) {
+		b.LogRequest(r, time.Since(start), http.StatusRequestEntityTooLarge)
+		http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Read a tick's worth of bytes at a time when rate limited, otherwise in 32KB chunks
+	chunk := make([]byte, 32*1024)
+	if rate > 0 {
+		chunk = make([]byte, max(1, rate*int(slowTick)/int(time.Second)))
+	}
+
+	hash := sha256.New()
+	received := 0
+	for {
+		n, err := io.ReadFull(r.Body, chunk)
+		hash.Write(chunk[:n])
+		received += n
+		if maxBytes > 0 && received > maxBytes {
+			b.LogRequest(r, time.Since(start), http.StatusRequestEntityTooLarge)
+			http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// Client went away or the body was cut off mid-stream
+			b.LogRequest(r, time.Since(start), http.StatusBadRequest)
+			http.Error(w, "error reading body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rate > 0 {
+			time.Sleep(slowTick)
+		}
+	}
+
+	elapsed := time.Since(start)
+	b.LogRequest(r, elapsed, http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":        fmt.Sprintf("%s:%d", b.Hostname, b.Port),
+		"received_bytes": received,
+		"sha256":         hex.EncodeToString(hash.Sum(nil)),
+		"duration_ms":    float64(elapsed.Microseconds()) / 1000,
+		"rate_bps":       rate,
+		"timestamp":      time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,49 @@
+// warmup.go
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// WarmupConfig makes a freshly started backend slow and/or failing, improving linearly
+// until Duration has passed, like a service warming its caches or JIT after a deploy
+type WarmupConfig struct {
+	Duration  time.Duration // how long warm-up lasts (0 disables it)
+	Delay     time.Duration // extra delay per request right after startup
+	ErrorRate float64       // extra failure probability right after startup
+}
+
+// warmupRemaining returns how far the backend is from warm: 1 at startup, 0 once warm
+func (b *Backend) warmupRemaining() float64 {
+	if b.Warmup.Duration <= 0 {
+		return 0
+	}
+	remaining := 1 - float64(b.GetUptime())/float64(b.Warmup.Duration)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// warmupDelay returns the extra delay still imposed by warm-up
+func (b *Backend) warmupDelay() time.Duration {
+	return time.Duration(float64(b.Warmup.Delay) * b.warmupRemaining())
+}
+
+// warmupFails reports whether warm-up should fail this request
+func (b *Backend) warmupFails() bool {
+	rate := b.Warmup.ErrorRate * b.warmupRemaining()
+	return rate > 0 && rand.Float64() < rate
+}
+
+// warmupStatus describes warm-up progress for the health and info endpoints
+func (b *Backend) warmupStatus() map[string]interface{} {
+	remaining := b.warmupRemaining()
+	return map[string]interface{}{
+		"warming_up":       remaining > 0,
+		"progress":         1 - remaining,
+		"extra_delay_ms":   b.warmupDelay().Milliseconds(),
+		"extra_error_rate": b.Warmup.ErrorRate * remaining,
+	}
+}